@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// Type mirror for an operations staff account, scopes narrow down what the admin may do
+type Admin struct {
+	Id             string
+	Username       string
+	Email          string
+	HashedPassword string
+	Scopes         []string
+	Created        time.Time
+}
+
+// Creates a new admin, returns a db.Admin
+func (r *Repository) CreateAdmin(username string, email string, hashedPassword string, scopes []string) (Admin, error) {
+	var a Admin
+
+	// GENERATING UUID
+	a.Id = "a:" + uuid.New()
+	a.Username = username
+	a.Email = email
+	a.HashedPassword = hashedPassword
+	a.Scopes = scopes
+	a.Created = time.Now()
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return a, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO admins (id, username, email, hashed_password, scopes, created) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.Exec(context.Background(), sql, a.Id, a.Username, a.Email, a.HashedPassword, a.Scopes, a.Created)
+
+	if err != nil {
+		return a, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Gets the admin by admin UUID
+func (r *Repository) GetAdminById(id string) (Admin, error) {
+	sql := `SELECT id, username, email, hashed_password, scopes, created FROM admins WHERE id = $1`
+
+	var a Admin
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, id).Scan(&a.Id, &a.Username, &a.Email, &a.HashedPassword, &a.Scopes, &a.Created); err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Gets the admin by admin username
+func (r *Repository) GetAdminByUsername(username string) (Admin, error) {
+	sql := `SELECT id, username, email, hashed_password, scopes, created FROM admins WHERE username = $1`
+
+	var a Admin
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, username).Scan(&a.Id, &a.Username, &a.Email, &a.HashedPassword, &a.Scopes, &a.Created); err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Suspends or unsuspends a user (student or tutor), suspended users cannot log in and tutors are no longer matched
+// Suspending also revokes every session of the user, so they are logged out everywhere
+func (r *Repository) SetSuspended(uid string, suspended bool, audit *Audit) error {
+	table, err := userTable(uid)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE ` + table + ` SET suspended = $2 WHERE id = $1`
+	_, err = tx.Exec(context.Background(), sql, uid, suspended)
+
+	if err != nil {
+		return err
+	}
+
+	if suspended {
+		sql = `UPDATE sessions SET revoked = TRUE WHERE user_id = $1`
+		if _, err = tx.Exec(context.Background(), sql, uid); err != nil {
+			return err
+		}
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
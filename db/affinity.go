@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"time"
+
+	"github.com/jackc/pgtype"
 )
 
 type Affinity struct {
@@ -12,6 +14,29 @@ type Affinity struct {
 	Score   int
 }
 
+// Type mirror for everything a lesson says about how well its student and tutor get along, affinity scores are computed from these
+// Cancelled is only set for lessons cancelled by their student or tutor, and Rating for lessons with a visible review
+type LessonOutcome struct {
+	Lesson    string
+	Tutor     string
+	Student   string
+	Subject   string
+	Status    string
+	StartTime time.Time
+	EndTime   time.Time
+	Cancelled *time.Time
+	Late      bool
+	Rating    *int
+	Reviewed  *time.Time
+}
+
+const lessonOutcomesSQL = `
+	SELECT lessons.id, lessons.tutor, lessons.student, lessons.subject, lessons.status, lessons.period,
+		lesson_cancellations.created, COALESCE(lesson_cancellations.late, FALSE), reviews.rating, reviews.created
+	FROM lessons
+	LEFT JOIN lesson_cancellations ON lesson_cancellations.lesson = lessons.id
+	LEFT JOIN reviews ON reviews.lesson = lessons.id AND reviews.hidden = FALSE`
+
 // Creates a new affinity, takes in the tutor UUID, student UUID and subject UUID
 func (r *Repository) CreateAffinity(tid string, sid string, subid string) (Affinity, error) {
 	var a Affinity
@@ -98,7 +123,7 @@ func (r *Repository) GetAffinity(tid string, sid string, subid string) (Affinity
 	a.Student = sid
 	a.Subject = subid
 
-	sql := `SELECT score FROM affinity WHERE tutor = $1, student = $2, subject = $3`
+	sql := `SELECT score FROM affinity WHERE tutor = $1 AND student = $2 AND subject = $3`
 	if err := r.dbPool.QueryRow(context.Background(), sql, a.Tutor, a.Student, a.Subject).Scan(&a.Score); err != nil {
 		return a, err
 	}
@@ -106,6 +131,99 @@ func (r *Repository) GetAffinity(tid string, sid string, subid string) (Affinity
 	return a, nil
 }
 
+// Gets the outcomes of every lesson between a tutor and student in a subject, earliest first
+func (r *Repository) GetLessonOutcomes(tid string, sid string, subid string) ([]LessonOutcome, error) {
+	sql := lessonOutcomesSQL + `
+	WHERE lessons.tutor = $1 AND lessons.student = $2 AND lessons.subject = $3
+	ORDER BY lower(lessons.period), lessons.id`
+
+	var outcomes []LessonOutcome
+
+	err := r.scanLessonOutcomes(func(o LessonOutcome) error {
+		outcomes = append(outcomes, o)
+		return nil
+	}, sql, tid, sid, subid)
+	if err != nil {
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+// Walks through the outcomes of every lesson, grouped by tutor, student and subject and earliest first within each group
+// Outcomes are streamed to fn rather than loaded at once, returning an error from fn stops the walk
+func (r *Repository) WalkLessonOutcomes(fn func(LessonOutcome) error) error {
+	sql := lessonOutcomesSQL + `
+	ORDER BY lessons.tutor, lessons.student, lessons.subject, lower(lessons.period), lessons.id`
+
+	return r.scanLessonOutcomes(fn, sql)
+}
+
+func (r *Repository) scanLessonOutcomes(fn func(LessonOutcome) error, sql string, args ...interface{}) error {
+	rows, err := r.dbPool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var o LessonOutcome
+		var period pgtype.Tstzrange
+
+		if err := rows.Scan(&o.Lesson, &o.Tutor, &o.Student, &o.Subject, &o.Status, &period, &o.Cancelled, &o.Late, &o.Rating, &o.Reviewed); err != nil {
+			return err
+		}
+
+		period.Lower.AssignTo(&o.StartTime)
+		period.Upper.AssignTo(&o.EndTime)
+
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Sets the scores of many affinities at once, creating those which do not exist yet
+// With reset, every other affinity is zeroed in the same transaction, so the given scores become the only ones
+func (r *Repository) SetAffinityScores(affinities []Affinity, reset bool) error {
+	tids := make([]string, len(affinities))
+	sids := make([]string, len(affinities))
+	subids := make([]string, len(affinities))
+	scores := make([]int, len(affinities))
+
+	for i, a := range affinities {
+		tids[i], sids[i], subids[i], scores[i] = a.Tutor, a.Student, a.Subject, a.Score
+	}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	if reset {
+		sql := `
+		UPDATE affinity SET score = 0
+		WHERE score <> 0 AND (tutor, student, subject) NOT IN (SELECT * FROM UNNEST($1::VARCHAR[], $2::VARCHAR[], $3::VARCHAR[]))`
+		if _, err = tx.Exec(context.Background(), sql, tids, sids, subids); err != nil {
+			return err
+		}
+	}
+
+	sql := `
+	INSERT INTO affinity (tutor, student, subject, score)
+	SELECT * FROM UNNEST($1::VARCHAR[], $2::VARCHAR[], $3::VARCHAR[], $4::INT[])
+	ON CONFLICT (tutor, student, subject) DO UPDATE SET score = EXCLUDED.score`
+	if _, err = tx.Exec(context.Background(), sql, tids, sids, subids, scores); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
 // Get random on-demand matches given a subject based on online status. Limited by count
 func (r *Repository) GetOnlineRandomMatches(subid string, count int) ([]string, error) {
 	sql := `
@@ -114,7 +232,10 @@ func (r *Repository) GetOnlineRandomMatches(subid string, count int) ([]string,
 	INNER JOIN tutors ON tutors.id = teaching.tutor
 	WHERE
 		tutors.last_seen > $1 AND
-		tutors.status = AVAILABLE AND
+		tutors.status = 'AVAILABLE' AND
+		tutors.email_verified = TRUE AND
+		tutors.suspended = FALSE AND
+		tutors.application_status = 'APPROVED' AND
 		teaching.subject = $2
 	ORDER BY RANDOM() LIMIT $3`
 
@@ -122,12 +243,9 @@ func (r *Repository) GetOnlineRandomMatches(subid string, count int) ([]string,
 
 	var tids []string
 
-	exp, err := time.Now().Add(time.Minute * 1).MarshalText()
-	if err != nil {
-		return nil, err
-	}
+	exp := time.Now().Add(time.Minute * -1)
 
-	rows, err := r.dbPool.Query(context.Background(), sql, exp, subid, count*100, count)
+	rows, err := r.dbPool.Query(context.Background(), sql, exp, subid, count)
 	if err != nil {
 		return nil, err
 	}
@@ -159,7 +277,10 @@ func (r *Repository) GetOnlineAffinityMatches(sid string, subid string, count in
 		affinity.student = $1 AND
 		affinity.subject = $2 AND
 		tutors.last_seen > $3 AND
-		tutors.status = AVAILABLE
+		tutors.status = 'AVAILABLE' AND
+		tutors.email_verified = TRUE AND
+		tutors.suspended = FALSE AND
+		tutors.application_status = 'APPROVED'
 	ORDER BY affinity.score DESC
 	LIMIT $4`
 
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for an audit log entry, recording an admin action on a target along with the target's state before and after
+type AuditEntry struct {
+	Id      string
+	Actor   string
+	Action  string
+	Target  string
+	Before  []byte
+	After   []byte
+	Created time.Time
+}
+
+// Convert a db.AuditEntry to a model.AuditEntry
+func (r *Repository) ToAuditEntryModel(a AuditEntry) model.AuditEntry {
+	entry := model.AuditEntry{ID: a.Id, Actor: a.Actor, Action: a.Action, Target: a.Target, Created: a.Created}
+
+	if a.Before != nil {
+		before := string(a.Before)
+		entry.Before = &before
+	}
+
+	if a.After != nil {
+		after := string(a.After)
+		entry.After = &after
+	}
+
+	return entry
+}
+
+// An admin action, recorded in the audit log in the same transaction as the change it describes
+// Before and after are encoded as JSON, nil is stored as NULL
+type Audit struct {
+	Actor  string
+	Action string
+	Target string
+	Before interface{}
+	After  interface{}
+}
+
+// Records an admin action which does not change anything in the database, such as resending a notification
+func (r *Repository) CreateAuditEntry(audit Audit) (AuditEntry, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	a, err := insertAuditEntry(tx, audit)
+	if err != nil {
+		return a, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Records an admin action within the transaction making the change, so neither is kept without the other
+// Changes not made by an admin have no audit, and nothing is written for them
+func writeAudit(tx pgx.Tx, audit *Audit) error {
+	if audit == nil {
+		return nil
+	}
+
+	_, err := insertAuditEntry(tx, *audit)
+	return err
+}
+
+func insertAuditEntry(tx pgx.Tx, audit Audit) (AuditEntry, error) {
+	var a AuditEntry
+
+	a.Id = uuid.New()
+	a.Actor = audit.Actor
+	a.Action = audit.Action
+	a.Target = audit.Target
+	a.Created = time.Now()
+
+	var err error
+	if audit.Before != nil {
+		if a.Before, err = json.Marshal(audit.Before); err != nil {
+			return a, err
+		}
+	}
+
+	if audit.After != nil {
+		if a.After, err = json.Marshal(audit.After); err != nil {
+			return a, err
+		}
+	}
+
+	sql := `INSERT INTO audit_log (id, actor, action, target, before, after, created) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err = tx.Exec(context.Background(), sql, a.Id, a.Actor, a.Action, a.Target, a.Before, a.After, a.Created); err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Gets the audit log, newest first. An empty target returns the entries for every target
+func (r *Repository) GetAuditLog(target string, limit int, offset int) ([]AuditEntry, error) {
+	sql := `SELECT id, actor, action, target, before, after, created FROM audit_log WHERE $1 = '' OR target = $1 ORDER BY created DESC LIMIT $2 OFFSET $3`
+
+	var entries []AuditEntry
+
+	rows, err := r.dbPool.Query(context.Background(), sql, target, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var a AuditEntry
+
+		if err := rows.Scan(&a.Id, &a.Actor, &a.Action, &a.Target, &a.Before, &a.After, &a.Created); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Purposes an auth token can be issued for, a token is only ever accepted for its own purpose
+const (
+	PasswordResetPurpose     = "PASSWORD_RESET"
+	EmailVerificationPurpose = "EMAIL_VERIFICATION"
+)
+
+// Type mirror for a single-use token emailed to a user, only the hash of the token is ever stored
+type AuthToken struct {
+	Hash    string
+	User    string
+	Purpose string
+	Used    bool
+	Expires time.Time
+	Created time.Time
+}
+
+// Stores the hash of a newly issued auth token for a user (student or tutor) UUID
+func (r *Repository) CreateAuthToken(uid string, purpose string, hash string, expires time.Time) (AuthToken, error) {
+	var at AuthToken
+
+	at.Hash = hash
+	at.User = uid
+	at.Purpose = purpose
+	at.Used = false
+	at.Expires = expires
+	at.Created = time.Now()
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return at, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO auth_tokens (hash, user_id, purpose, used, expires, created) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.Exec(context.Background(), sql, at.Hash, at.User, at.Purpose, at.Used, at.Expires, at.Created)
+
+	if err != nil {
+		return at, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return at, err
+	}
+
+	return at, nil
+}
+
+// Marks an auth token as used and returns the user UUID it was issued to
+// Only succeeds once, and only while the token is unexpired and presented for its purpose, otherwise returns pgx.ErrNoRows
+func (r *Repository) UseAuthToken(hash string, purpose string) (string, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	var uid string
+
+	sql := `UPDATE auth_tokens SET used = TRUE WHERE hash = $1 AND purpose = $2 AND used = FALSE AND expires > NOW() RETURNING user_id`
+	if err = tx.QueryRow(context.Background(), sql, hash, purpose).Scan(&uid); err != nil {
+		return "", err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	return uid, nil
+}
+
+// Invalidates every outstanding token of a user for a purpose, so only the latest emailed token works
+func (r *Repository) ExpireAuthTokens(uid string, purpose string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE auth_tokens SET used = TRUE WHERE user_id = $1 AND purpose = $2 AND used = FALSE`
+	_, err = tx.Exec(context.Background(), sql, uid, purpose)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Replaces the password hash of a user (student or tutor)
+func (r *Repository) UpdatePassword(uid string, hashedPassword string) error {
+	table, err := userTable(uid)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE ` + table + ` SET hashed_password = $2 WHERE id = $1`
+	_, err = tx.Exec(context.Background(), sql, uid, hashedPassword)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Marks the email of a user (student or tutor) as verified
+func (r *Repository) SetEmailVerified(uid string) error {
+	table, err := userTable(uid)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE ` + table + ` SET email_verified = TRUE WHERE id = $1`
+	_, err = tx.Exec(context.Background(), sql, uid)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -16,16 +16,18 @@ type Availability struct {
 	EndTime   time.Time
 }
 
-// Creates an availability time block for a tutor.
-// Takes a tutor id and recurring time period relative to epoch 0, ie. 0 epoch time corresponds to a recurring time at 12mid every Thursday
+// Creates a one-off availability window for a tutor, on top of their weekly rules
+// Windows overlapping or touching the new one are merged into it, so the returned window may be larger than requested
 func (r *Repository) CreateAvailability(tid string, startTime time.Time, endTime time.Time) (Availability, error) {
-	var a Availability
+	return r.saveAvailability(Availability{Id: uuid.New(), Tutor: tid, StartTime: startTime, EndTime: endTime})
+}
 
-	a.Id = uuid.New()
-	a.Tutor = tid
-	a.StartTime = startTime
-	a.EndTime = endTime
+// Moves a one-off availability window of a tutor, merging it with the windows it then overlaps or touches
+func (r *Repository) UpdateAvailability(a Availability) (Availability, error) {
+	return r.saveAvailability(a)
+}
 
+func (r *Repository) saveAvailability(a Availability) (Availability, error) {
 	tx, err := r.dbPool.Begin(context.Background())
 	if err != nil {
 		return a, err
@@ -33,25 +35,80 @@ func (r *Repository) CreateAvailability(tid string, startTime time.Time, endTime
 
 	defer tx.Rollback(context.Background())
 
-	period := getTstzrange(startTime, endTime)
+	// Serialise changes to the windows of a tutor, so that concurrent merges cannot miss each other
+	if _, err = tx.Exec(context.Background(), `SELECT id FROM tutors WHERE id = $1 FOR UPDATE`, a.Tutor); err != nil {
+		return a, err
+	}
 
-	sql := `INSERT INTO availabilities (id, tutor, period) VALUES ($1, $2, $3)`
-	_, err = tx.Exec(context.Background(), sql, a.Id, period)
+	sql := `
+	WITH absorbed AS (
+		DELETE FROM availabilities
+		WHERE tutor = $2 AND id <> $1 AND (period && $3 OR period -|- $3)
+		RETURNING period
+	)
+	INSERT INTO availabilities (id, tutor, period)
+	SELECT $1, $2, tstzrange(MIN(lower(windows.period)), MAX(upper(windows.period)), '(]')
+	FROM (SELECT period FROM absorbed UNION ALL SELECT $3::TSTZRANGE) AS windows
+	ON CONFLICT (id) DO UPDATE SET period = EXCLUDED.period
+	RETURNING lower(period), upper(period)`
+
+	period := getTstzrange(a.StartTime, a.EndTime)
+	if err = tx.QueryRow(context.Background(), sql, a.Id, a.Tutor, period).Scan(&a.StartTime, &a.EndTime); err != nil {
+		return a, err
+	}
 
-	if err != nil {
+	if err = tx.Commit(context.Background()); err != nil {
 		return a, err
 	}
-	err = tx.Commit(context.Background())
-	if err != nil {
+
+	return a, nil
+}
+
+// Get a one-off availability window based on its UUID
+func (r *Repository) GetAvailabilityById(aid string) (Availability, error) {
+	sql := `SELECT id, tutor, lower(period), upper(period) FROM availabilities WHERE id = $1`
+
+	var a Availability
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, aid).Scan(&a.Id, &a.Tutor, &a.StartTime, &a.EndTime); err != nil {
 		return a, err
 	}
 
 	return a, nil
 }
 
-// Deletes the availability for a tutor
-// Takes a tutor id and recurring time period relative to epoch 0, ie. 0 epoch time corresponds to a recurring time at 12mid every Thursday
-func (r *Repository) DeleteAvailability(tid string, startTime time.Time, endTime time.Time) error {
+// Gets the one-off availability windows of a tutor overlapping a range, ordered by start time
+func (r *Repository) GetAvailabilities(tid string, startTime time.Time, endTime time.Time) ([]Availability, error) {
+	sql := `SELECT id, tutor, lower(period), upper(period) FROM availabilities WHERE tutor = $1 AND period && $2 ORDER BY lower(period)`
+
+	var availabilities []Availability
+
+	period := getTstzrange(startTime, endTime)
+	rows, err := r.dbPool.Query(context.Background(), sql, tid, period)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var a Availability
+
+		if err := rows.Scan(&a.Id, &a.Tutor, &a.StartTime, &a.EndTime); err != nil {
+			return nil, err
+		}
+
+		availabilities = append(availabilities, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return availabilities, nil
+}
+
+// Deletes a one-off availability window
+func (r *Repository) DeleteAvailability(aid string) error {
 	tx, err := r.dbPool.Begin(context.Background())
 	if err != nil {
 		return err
@@ -59,8 +116,8 @@ func (r *Repository) DeleteAvailability(tid string, startTime time.Time, endTime
 
 	defer tx.Rollback(context.Background())
 
-	sql := `DELETE FROM availabilities WHERE tutor = $1 AND start_time = $2 AND end_time = $3`
-	_, err = tx.Exec(context.Background(), sql, tid, startTime, endTime)
+	sql := `DELETE FROM availabilities WHERE id = $1`
+	_, err = tx.Exec(context.Background(), sql, aid)
 
 	if err != nil {
 		return err
@@ -73,17 +130,20 @@ func (r *Repository) DeleteAvailability(tid string, startTime time.Time, endTime
 	return nil
 }
 
-// Gets all tutor ids set to be potentially available within a timeslot sorted by affinity. Check the returned tutors with CheckTutorAvailability to verify with already booked lessons
-// Takes a student id, subject id and a recurring time period relative to epoch 0 ie. 0 epoch time corresponds to a recurring time at 12mid every Thursday
+// Gets all tutor ids available for a timeslot, expanding their weekly rules and skipping their exceptions, sorted by affinity
+// Check the returned tutors with CheckTutorAvailability to verify with already booked lessons
 func (r *Repository) GetAvailableTutors(sid string, subid string, startTime time.Time, endTime time.Time) ([]string, error) {
 	sql := `
-	SELECT availabilities.tutor
-	FROM availabilities
-	INNER JOIN affinity ON availabilities.tutor = affinity.tutor
+	SELECT affinity.tutor
+	FROM affinity
+	INNER JOIN tutors ON tutors.id = affinity.tutor
 	WHERE
+		tutors.email_verified = TRUE AND
+		tutors.suspended = FALSE AND
+		tutors.application_status = 'APPROVED' AND
 		affinity.student = $1 AND
 		affinity.subject = $2 AND
-		availabilities.period @> $3
+		tutor_available(tutors.id, $3)
 	ORDER BY affinity.score DESC`
 
 	var tids []string
@@ -112,17 +172,19 @@ func (r *Repository) GetAvailableTutors(sid string, subid string, startTime time
 
 }
 
-// Gets all tutor ids set to be potentially available within a timeslot shuffled randomly. Check the returned tutors with CheckTutorAvailability to verify with already booked lessons
-// Takes a subject id,a recurring time period relative to epoch 0 ie. 0 epoch time corresponds to a recurring time at 12mid every Thursday, and a max count
+// Gets all tutor ids available for a timeslot, expanding their weekly rules and skipping their exceptions, shuffled randomly
+// Check the returned tutors with CheckTutorAvailability to verify with already booked lessons
 func (r *Repository) GetRandomAvailableTutors(subid string, startTime time.Time, endTime time.Time, count int) ([]string, error) {
 	sql := `
-	SELECT availabilities.tutor
-	FROM availabilities
-	INNER JOIN teaching ON teaching.tutor = availabilities.tutor
-	INNER JOIN subjects ON subjects.id = teaching.subject
+	SELECT tutors.id
+	FROM teaching
+	INNER JOIN tutors ON tutors.id = teaching.tutor
 	WHERE
-		subjects.id = $1 AND
-		availabilities.period @> $2
+		tutors.email_verified = TRUE AND
+		tutors.suspended = FALSE AND
+		tutors.application_status = 'APPROVED' AND
+		teaching.subject = $1 AND
+		tutor_available(tutors.id, $2)
 	ORDER BY RANDOM() LIMIT $3`
 
 	// TODO: THIS QUERY DOES NOT SCALE WELL WITH LARGE DATABASES, REFACTOR
@@ -153,8 +215,9 @@ func (r *Repository) GetRandomAvailableTutors(subid string, startTime time.Time,
 }
 
 // Checks the lessons the tutor already has, to see if there are any availability clashes
+// This only filters out clashes early, the exclusion constraints on lessons are what stop concurrent bookings, see CreateLesson
 func (r *Repository) CheckTutorAvailability(tid string, startTime time.Time, endTime time.Time) (bool, error) {
-	sql := `SELECT id FROM lessons WHERE tutor = $1 AND scheduled = true AND period && $2`
+	sql := `SELECT id FROM lessons WHERE tutor = $1 AND scheduled = true AND status <> 'CANCELLED' AND period && $2`
 
 	var id string
 
@@ -169,3 +232,33 @@ func (r *Repository) CheckTutorAvailability(tid string, startTime time.Time, end
 
 	return false, nil
 }
+
+// Gets the periods of the scheduled lessons a tutor has overlapping a range, ordered by start time
+func (r *Repository) GetTutorBookedPeriods(tid string, startTime time.Time, endTime time.Time) ([]AvailabilityWindow, error) {
+	sql := `SELECT lower(period), upper(period) FROM lessons WHERE tutor = $1 AND scheduled = true AND status <> 'CANCELLED' AND period && $2 ORDER BY lower(period)`
+
+	var booked []AvailabilityWindow
+
+	period := getTstzrange(startTime, endTime)
+	rows, err := r.dbPool.Query(context.Background(), sql, tid, period)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var w AvailabilityWindow
+
+		if err := rows.Scan(&w.StartTime, &w.EndTime); err != nil {
+			return nil, err
+		}
+
+		booked = append(booked, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return booked, nil
+}
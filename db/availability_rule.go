@@ -0,0 +1,233 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// Type mirror for a weekly availability rule, times are minutes since midnight of the weekday (0 is Sunday) in the tutor's timezone
+type AvailabilityRule struct {
+	Id          string
+	Tutor       string
+	Weekday     int
+	StartMinute int
+	EndMinute   int
+}
+
+// Type mirror for a one-off period, such as a holiday, in which a tutor is unavailable
+type AvailabilityException struct {
+	Id        string
+	Tutor     string
+	StartTime time.Time
+	EndTime   time.Time
+	Reason    string
+}
+
+// A concrete period of time a tutor is available in
+type AvailabilityWindow struct {
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Replaces the weekly availability rules of a tutor, along with the IANA timezone they are expressed in
+func (r *Repository) SetWeeklyAvailability(tid string, timezone string, rules []AvailabilityRule) ([]AvailabilityRule, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	if _, err = tx.Exec(context.Background(), `UPDATE tutors SET timezone = $2 WHERE id = $1`, tid, timezone); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(context.Background(), `DELETE FROM availability_rules WHERE tutor = $1`, tid); err != nil {
+		return nil, err
+	}
+
+	sql := `INSERT INTO availability_rules (id, tutor, weekday, start_minute, end_minute) VALUES ($1, $2, $3, $4, $5)`
+
+	var created []AvailabilityRule
+	for _, rule := range rules {
+		rule.Id = uuid.New()
+		rule.Tutor = tid
+
+		if _, err = tx.Exec(context.Background(), sql, rule.Id, rule.Tutor, rule.Weekday, rule.StartMinute, rule.EndMinute); err != nil {
+			return nil, err
+		}
+
+		created = append(created, rule)
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Gets the timezone of a tutor's weekly availability
+func (r *Repository) GetTutorTimezone(tid string) (string, error) {
+	sql := `SELECT timezone FROM tutors WHERE id = $1`
+
+	var timezone string
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, tid).Scan(&timezone); err != nil {
+		return "", err
+	}
+
+	return timezone, nil
+}
+
+// Gets the weekly availability rules of a tutor, ordered through the week
+func (r *Repository) GetAvailabilityRules(tid string) ([]AvailabilityRule, error) {
+	sql := `SELECT id, tutor, weekday, start_minute, end_minute FROM availability_rules WHERE tutor = $1 ORDER BY weekday, start_minute`
+
+	var rules []AvailabilityRule
+
+	rows, err := r.dbPool.Query(context.Background(), sql, tid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var rule AvailabilityRule
+
+		if err := rows.Scan(&rule.Id, &rule.Tutor, &rule.Weekday, &rule.StartMinute, &rule.EndMinute); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Expands the weekly rules and one-off windows of a tutor into the concrete windows overlapping a range, ordered by start time
+// Exceptions are not taken into account, see GetAvailabilityExceptions
+func (r *Repository) GetTutorWindows(tid string, startTime time.Time, endTime time.Time) ([]AvailabilityWindow, error) {
+	sql := `SELECT lower(period), upper(period) FROM tutor_windows($1, $2, $3) ORDER BY lower(period)`
+
+	var windows []AvailabilityWindow
+
+	rows, err := r.dbPool.Query(context.Background(), sql, tid, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var w AvailabilityWindow
+
+		if err := rows.Scan(&w.StartTime, &w.EndTime); err != nil {
+			return nil, err
+		}
+
+		windows = append(windows, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// Creates a period in which a tutor is unavailable
+func (r *Repository) CreateAvailabilityException(tid string, startTime time.Time, endTime time.Time, reason string) (AvailabilityException, error) {
+	var e AvailabilityException
+
+	e.Id = uuid.New()
+	e.Tutor = tid
+	e.StartTime = startTime
+	e.EndTime = endTime
+	e.Reason = reason
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return e, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	period := getTstzrange(startTime, endTime)
+
+	sql := `INSERT INTO availability_exceptions (id, tutor, period, reason) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(context.Background(), sql, e.Id, e.Tutor, period, e.Reason); err != nil {
+		return e, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// Get an availability exception based on its UUID
+func (r *Repository) GetAvailabilityExceptionById(eid string) (AvailabilityException, error) {
+	sql := `SELECT id, tutor, lower(period), upper(period), reason FROM availability_exceptions WHERE id = $1`
+
+	var e AvailabilityException
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, eid).Scan(&e.Id, &e.Tutor, &e.StartTime, &e.EndTime, &e.Reason); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// Gets the exceptions of a tutor overlapping a range, ordered by start time
+func (r *Repository) GetAvailabilityExceptions(tid string, startTime time.Time, endTime time.Time) ([]AvailabilityException, error) {
+	sql := `SELECT id, tutor, lower(period), upper(period), reason FROM availability_exceptions WHERE tutor = $1 AND period && $2 ORDER BY lower(period)`
+
+	var exceptions []AvailabilityException
+
+	period := getTstzrange(startTime, endTime)
+	rows, err := r.dbPool.Query(context.Background(), sql, tid, period)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var e AvailabilityException
+
+		if err := rows.Scan(&e.Id, &e.Tutor, &e.StartTime, &e.EndTime, &e.Reason); err != nil {
+			return nil, err
+		}
+
+		exceptions = append(exceptions, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exceptions, nil
+}
+
+// Deletes an availability exception
+func (r *Repository) DeleteAvailabilityException(eid string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM availability_exceptions WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), sql, eid); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for a report of a user misbehaving in chat, conversation is empty if the two users never talked
+type UserReport struct {
+	Id           string
+	Reporter     string
+	Reported     string
+	Conversation string
+	Reason       string
+	Resolved     bool
+	ResolvedBy   string
+	Created      time.Time
+}
+
+// Convert a db.UserReport to a model.UserReport
+func (r *Repository) ToUserReportModel(ur UserReport) model.UserReport {
+	mur := model.UserReport{ID: ur.Id, Reporter: ur.Reporter, Reported: ur.Reported, Reason: ur.Reason, Resolved: ur.Resolved, Created: ur.Created}
+	if ur.Conversation != "" {
+		mur.Conversation = &ur.Conversation
+	}
+
+	return mur
+}
+
+const userReportColumns = `id, reporter, reported, conversation, reason, resolved, resolved_by, created`
+
+func scanUserReport(row pgx.Row) (UserReport, error) {
+	var ur UserReport
+
+	// To handle possible null values
+	var conversation pgtype.Varchar
+	var resolvedBy pgtype.Varchar
+
+	if err := row.Scan(&ur.Id, &ur.Reporter, &ur.Reported, &conversation, &ur.Reason, &ur.Resolved, &resolvedBy, &ur.Created); err != nil {
+		return ur, err
+	}
+
+	conversation.AssignTo(&ur.Conversation)
+	resolvedBy.AssignTo(&ur.ResolvedBy)
+	return ur, nil
+}
+
+// Checks whether a student and a tutor have a lesson together, whatever became of it, or a match still waiting for the tutor
+func (r *Repository) SharesLessonOrMatch(sid string, tid string) (bool, error) {
+	sql := `
+	SELECT EXISTS (SELECT 1 FROM lessons WHERE student = $1 AND tutor = $2)
+		OR EXISTS (SELECT 1 FROM matchings WHERE student = $1 AND tutor = $2 AND status = 'MATCHING')`
+
+	var shares bool
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, sid, tid).Scan(&shares); err != nil {
+		return shares, err
+	}
+
+	return shares, nil
+}
+
+// Blocks a user on behalf of another, blocking the same user twice does nothing
+func (r *Repository) BlockUser(blocker string, blocked string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO user_blocks (blocker, blocked) VALUES ($1, $2) ON CONFLICT (blocker, blocked) DO NOTHING`
+	if _, err = tx.Exec(context.Background(), sql, blocker, blocked); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Lifts a block a user placed on another
+func (r *Repository) UnblockUser(blocker string, blocked string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM user_blocks WHERE blocker = $1 AND blocked = $2`
+	if _, err = tx.Exec(context.Background(), sql, blocker, blocked); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Checks whether either of two users blocked the other
+func (r *Repository) IsBlocked(uid string, other string) (bool, error) {
+	sql := `SELECT EXISTS (SELECT 1 FROM user_blocks WHERE (blocker = $1 AND blocked = $2) OR (blocker = $2 AND blocked = $1))`
+
+	var blocked bool
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, uid, other).Scan(&blocked); err != nil {
+		return blocked, err
+	}
+
+	return blocked, nil
+}
+
+// Gets the ids of the users a user blocked, most recently blocked first
+func (r *Repository) GetBlockedUsers(uid string) ([]string, error) {
+	sql := `SELECT blocked FROM user_blocks WHERE blocker = $1 ORDER BY created DESC`
+
+	blocked := []string{}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		blocked = append(blocked, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blocked, nil
+}
+
+// Reports a user, attaching the conversation between the reporter and them if there is one
+func (r *Repository) CreateUserReport(reporter string, reported string, reason string) (UserReport, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return UserReport{}, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `
+	INSERT INTO user_reports (id, reporter, reported, conversation, reason, created)
+	VALUES ($1, $2, $3, (SELECT id FROM conversations WHERE user_a = LEAST($2::VARCHAR, $3::VARCHAR) AND user_b = GREATEST($2::VARCHAR, $3::VARCHAR)), $4, NOW())
+	RETURNING ` + userReportColumns
+
+	ur, err := scanUserReport(tx.QueryRow(context.Background(), sql, uuid.New(), reporter, reported, reason))
+	if err != nil {
+		return ur, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return ur, err
+	}
+
+	return ur, nil
+}
+
+// Get user report by report UUID
+func (r *Repository) GetUserReportById(rid string) (UserReport, error) {
+	sql := `SELECT ` + userReportColumns + ` FROM user_reports WHERE id = $1`
+
+	return scanUserReport(r.dbPool.QueryRow(context.Background(), sql, rid))
+}
+
+// Gets the reports which are resolved or not, oldest first
+func (r *Repository) GetUserReports(resolved bool, limit int, offset int) ([]UserReport, error) {
+	sql := `SELECT ` + userReportColumns + ` FROM user_reports WHERE resolved = $1 ORDER BY created, id LIMIT $2 OFFSET $3`
+
+	reports := []UserReport{}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, resolved, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		ur, err := scanUserReport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, ur)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// Marks a report as resolved by an admin
+func (r *Repository) ResolveUserReport(rid string, aid string, audit *Audit) (UserReport, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return UserReport{}, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE user_reports SET resolved = TRUE, resolved_by = $2 WHERE id = $1 RETURNING ` + userReportColumns
+
+	ur, err := scanUserReport(tx.QueryRow(context.Background(), sql, rid, aid))
+	if err != nil {
+		return ur, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return ur, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return ur, err
+	}
+
+	return ur, nil
+}
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for how far a participant has read a conversation, LastRead is nil until they read it once
+type ConversationParticipant struct {
+	Id       string
+	LastRead *time.Time
+	Unread   int
+}
+
+// Type mirror for a conversation between two users, the last message is empty until one is sent
+// Only the kind and text of the last message are kept, enough to preview it
+type Conversation struct {
+	Id              string
+	Participants    []ConversationParticipant
+	Messages        int
+	LastMessageId   string
+	LastMessageKind string
+	LastMessage     string
+	LastSender      string
+	LastMessageAt   *time.Time
+	LastDeleted     *time.Time
+	Created         time.Time
+}
+
+// Gets the participant of the conversation with the given id
+func (c Conversation) Participant(uid string) (ConversationParticipant, bool) {
+	for _, p := range c.Participants {
+		if p.Id == uid {
+			return p, true
+		}
+	}
+
+	return ConversationParticipant{}, false
+}
+
+// Gets the other participant of the conversation of the user with the given id
+func (c Conversation) Other(uid string) string {
+	for _, p := range c.Participants {
+		if p.Id != uid {
+			return p.Id
+		}
+	}
+
+	return ""
+}
+
+// Convert a db.Conversation to a model.Conversation, as seen by the participant with the given id
+func (r *Repository) ToConversationModel(c Conversation, uid string) model.Conversation {
+	mc := model.Conversation{ID: c.Id, Participants: []*model.ConversationParticipant{}, Created: c.Created}
+
+	for _, p := range c.Participants {
+		mc.Participants = append(mc.Participants, &model.ConversationParticipant{ID: p.Id, LastRead: p.LastRead})
+		if p.Id == uid {
+			mc.Unread = p.Unread
+		}
+	}
+
+	if c.LastMessageAt != nil {
+		mc.LastMessage = &model.Message{ID: c.LastMessageId, Conversation: c.Id, To: c.Other(c.LastSender), From: c.LastSender, Timestamp: *c.LastMessageAt, Kind: model.MessageKind(c.LastMessageKind), Message: c.LastMessage, Deleted: c.LastDeleted}
+	}
+
+	return mc
+}
+
+const conversationColumns = `id, messages, last_message_id, last_message_kind, last_message, last_sender, last_message_at, last_message_deleted, created`
+
+func scanConversation(row pgx.Row) (Conversation, error) {
+	var c Conversation
+
+	// To handle possible null values
+	var lastMessageId pgtype.Varchar
+	var lastMessageKind pgtype.Varchar
+	var lastMessage pgtype.Text
+	var lastSender pgtype.Varchar
+
+	if err := row.Scan(&c.Id, &c.Messages, &lastMessageId, &lastMessageKind, &lastMessage, &lastSender, &c.LastMessageAt, &c.LastDeleted, &c.Created); err != nil {
+		return c, err
+	}
+
+	lastMessageId.AssignTo(&c.LastMessageId)
+	lastMessageKind.AssignTo(&c.LastMessageKind)
+	lastMessage.AssignTo(&c.LastMessage)
+	lastSender.AssignTo(&c.LastSender)
+	return c, nil
+}
+
+// Gets the conversation between two users, starting it if they never talked before
+func (r *Repository) GetOrCreateConversation(uid string, other string) (Conversation, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	// Users are stored in order, so that the unique constraint holds whoever starts the conversation
+	sql := `
+	INSERT INTO conversations (id, user_a, user_b, created) VALUES ($1, LEAST($2::VARCHAR, $3::VARCHAR), GREATEST($2::VARCHAR, $3::VARCHAR), NOW())
+	ON CONFLICT (user_a, user_b) DO NOTHING`
+
+	cid := uuid.New()
+	tag, err := tx.Exec(context.Background(), sql, cid, uid, other)
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	if tag.RowsAffected() == 1 {
+		sql = `INSERT INTO conversation_participants (conversation, participant) VALUES ($1, $2), ($1, $3)`
+		if _, err = tx.Exec(context.Background(), sql, cid, uid, other); err != nil {
+			return Conversation{}, err
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return Conversation{}, err
+	}
+
+	sql = `SELECT ` + conversationColumns + ` FROM conversations WHERE user_a = LEAST($1::VARCHAR, $2::VARCHAR) AND user_b = GREATEST($1::VARCHAR, $2::VARCHAR)`
+
+	c, err := scanConversation(r.dbPool.QueryRow(context.Background(), sql, uid, other))
+	if err != nil {
+		return c, err
+	}
+
+	return r.withParticipants(c)
+}
+
+// Get conversation by conversation UUID
+func (r *Repository) GetConversationById(cid string) (Conversation, error) {
+	sql := `SELECT ` + conversationColumns + ` FROM conversations WHERE id = $1`
+
+	c, err := scanConversation(r.dbPool.QueryRow(context.Background(), sql, cid))
+	if err != nil {
+		return c, err
+	}
+
+	return r.withParticipants(c)
+}
+
+// Gets the conversations a user takes part in, those with the most recent messages first
+func (r *Repository) GetUserConversations(uid string) ([]Conversation, error) {
+	sql := `
+	SELECT ` + conversationColumns + ` FROM conversations
+	WHERE id IN (SELECT conversation FROM conversation_participants WHERE participant = $1)
+	ORDER BY COALESCE(last_message_at, created) DESC, id`
+
+	conversations := []Conversation{}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations = append(conversations, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(conversations) == 0 {
+		return conversations, nil
+	}
+
+	cids := []string{}
+	for _, c := range conversations {
+		cids = append(cids, c.Id)
+	}
+
+	participants, err := r.getConversationParticipants(cids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range conversations {
+		conversations[i].Participants = participants[conversations[i].Id]
+	}
+
+	return conversations, nil
+}
+
+// Records a message sent in a conversation, counting it as unread by everyone but its sender
+// Sending a message reads the conversation up to it. Messages are only counted once, so recording can be retried
+// Messages kept in Postgres are recorded along with them instead, see CreateRecordedMessage
+func (r *Repository) RecordMessage(m Message) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO recorded_messages (message, conversation, created) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	tag, err := tx.Exec(context.Background(), sql, m.Id, m.Conversation, m.Created)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return nil
+	}
+
+	if err = recordMessage(tx, m); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Counts a message in its conversation. The last message only changes to a later one, so messages recorded out of order leave the latest in place
+func recordMessage(tx pgx.Tx, m Message) error {
+	// Compared against the conversation as it is once locked by the update, so concurrent messages are ordered correctly
+	later := `last_message_at IS NULL OR last_message_at <= $5`
+
+	sql := `
+	UPDATE conversations SET
+		messages = messages + 1,
+		last_message_id = CASE WHEN ` + later + ` THEN $2 ELSE last_message_id END,
+		last_message_kind = CASE WHEN ` + later + ` THEN $6 ELSE last_message_kind END,
+		last_message = CASE WHEN ` + later + ` THEN $4 ELSE last_message END,
+		last_sender = CASE WHEN ` + later + ` THEN $3 ELSE last_sender END,
+		last_message_deleted = CASE WHEN ` + later + ` THEN NULL ELSE last_message_deleted END,
+		last_message_at = GREATEST(last_message_at, $5)
+	WHERE id = $1`
+	if _, err := tx.Exec(context.Background(), sql, m.Conversation, m.Id, m.From, m.Message, m.Created, m.Kind); err != nil {
+		return err
+	}
+
+	sql = `
+	UPDATE conversation_participants SET
+		unread = CASE WHEN participant = $2 THEN 0 ELSE unread + 1 END,
+		last_read = CASE WHEN participant = $2 THEN GREATEST(last_read, $3) ELSE last_read END
+	WHERE conversation = $1`
+	_, err := tx.Exec(context.Background(), sql, m.Conversation, m.From, m.Created)
+	return err
+}
+
+// Moves the read cursor of a participant up to the time at, clearing their unread messages
+// Read cursors never move backwards, the cursor after the update is returned
+func (r *Repository) MarkConversationRead(cid string, uid string, at time.Time) (time.Time, error) {
+	sql := `UPDATE conversation_participants SET last_read = GREATEST(last_read, $3), unread = 0 WHERE conversation = $1 AND participant = $2 RETURNING last_read`
+
+	var lastRead time.Time
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, cid, uid, at).Scan(&lastRead); err != nil {
+		return lastRead, err
+	}
+
+	return lastRead, nil
+}
+
+func (r *Repository) withParticipants(c Conversation) (Conversation, error) {
+	participants, err := r.getConversationParticipants([]string{c.Id})
+	if err != nil {
+		return c, err
+	}
+
+	c.Participants = participants[c.Id]
+	return c, nil
+}
+
+// Gets the participants of several conversations at once, by conversation
+func (r *Repository) getConversationParticipants(cids []string) (map[string][]ConversationParticipant, error) {
+	sql := `SELECT conversation, participant, last_read, unread FROM conversation_participants WHERE conversation = ANY($1) ORDER BY conversation, participant`
+
+	participants := map[string][]ConversationParticipant{}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, cids)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var cid string
+		var p ConversationParticipant
+
+		if err := rows.Scan(&cid, &p.Id, &p.LastRead, &p.Unread); err != nil {
+			return nil, err
+		}
+
+		participants[cid] = append(participants[cid], p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
@@ -0,0 +1,185 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// Recording the same message again leaves the conversation as it was, and an older message recorded late does not replace the last one
+func TestRecordMessage(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	tutor := dbtest.Tutor(t, repo)
+	student := dbtest.Student(t, repo)
+
+	conv, err := repo.GetOrCreateConversation(tutor.Id, student.Id)
+	if err != nil {
+		t.Fatalf("Cannot create conversation: %v", err)
+	}
+
+	sent := time.Now().Truncate(time.Microsecond)
+	message := func(text string, created time.Time) db.Message {
+		return db.Message{Id: uuid.New(), Conversation: conv.Id, From: tutor.Id, To: student.Id, Kind: "TEXT", Message: text, Created: created}
+	}
+
+	latest := message("latest", sent)
+	earlier := message("earlier", sent.Add(-time.Minute))
+
+	for _, m := range []db.Message{latest, latest, earlier, earlier} {
+		if err = repo.RecordMessage(m); err != nil {
+			t.Fatalf("Cannot record message %s: %v", m.Message, err)
+		}
+	}
+
+	got, err := repo.GetConversationById(conv.Id)
+	if err != nil {
+		t.Fatalf("Cannot get conversation: %v", err)
+	}
+
+	if got.Messages != 2 {
+		t.Errorf("Got %d messages, want 2", got.Messages)
+	}
+
+	if got.LastMessageId != latest.Id || got.LastMessageAt == nil || !got.LastMessageAt.Equal(sent) {
+		t.Errorf("Got last message %s at %v, want %s at %v", got.LastMessageId, got.LastMessageAt, latest.Id, sent)
+	}
+
+	for _, p := range got.Participants {
+		if want := map[string]int{tutor.Id: 0, student.Id: 2}[p.Id]; p.Unread != want {
+			t.Errorf("Participant %s has %d unread, want %d", p.Id, p.Unread, want)
+		}
+	}
+}
+
+func TestConversationParticipants(t *testing.T) {
+	read := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	sent := read.Add(time.Minute)
+
+	conv := db.Conversation{
+		Id: "c",
+		Participants: []db.ConversationParticipant{
+			{Id: "s:1", LastRead: &read, Unread: 2},
+			{Id: "t:1"},
+		},
+		LastMessageId:   "m",
+		LastMessageKind: "TEXT",
+		LastMessage:     "hello",
+		LastSender:      "t:1",
+		LastMessageAt:   &sent,
+	}
+
+	tests := []struct {
+		uid   string
+		other string
+		found bool
+	}{
+		{"s:1", "t:1", true},
+		{"t:1", "s:1", true},
+		{"s:2", "s:1", false},
+	}
+
+	for _, tt := range tests {
+		if got := conv.Other(tt.uid); got != tt.other {
+			t.Errorf("%s: got other %q, want %q", tt.uid, got, tt.other)
+		}
+
+		if p, found := conv.Participant(tt.uid); found != tt.found || (found && p.Id != tt.uid) {
+			t.Errorf("%s: got participant %v %t, want found %t", tt.uid, p, found, tt.found)
+		}
+	}
+
+	var repo *db.Repository
+	mc := repo.ToConversationModel(conv, "s:1")
+
+	if mc.Unread != 2 {
+		t.Errorf("Got %d unread, want 2", mc.Unread)
+	}
+
+	if mc.LastMessage == nil || mc.LastMessage.From != "t:1" || mc.LastMessage.To != "s:1" || mc.LastMessage.Message != "hello" {
+		t.Errorf("Got last message %+v, want hello from t:1 to s:1", mc.LastMessage)
+	}
+
+	conv.LastMessageAt = nil
+	if mc = repo.ToConversationModel(conv, "t:1"); mc.LastMessage != nil || mc.Unread != 0 {
+		t.Errorf("Conversation without messages got last message %+v and %d unread", mc.LastMessage, mc.Unread)
+	}
+}
+
+// Either user starting the conversation gets the same one, and it is listed for both of them
+func TestGetOrCreateConversation(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	tutor := dbtest.Tutor(t, repo)
+	student := dbtest.Student(t, repo)
+
+	conv, err := repo.GetOrCreateConversation(tutor.Id, student.Id)
+	if err != nil {
+		t.Fatalf("Cannot create conversation: %v", err)
+	}
+
+	again, err := repo.GetOrCreateConversation(student.Id, tutor.Id)
+	if err != nil {
+		t.Fatalf("Cannot get conversation: %v", err)
+	}
+
+	if again.Id != conv.Id {
+		t.Errorf("Got conversation %s the other way around, want %s", again.Id, conv.Id)
+	}
+
+	if len(again.Participants) != 2 || again.Other(student.Id) != tutor.Id {
+		t.Errorf("Got participants %v, want %s and %s", again.Participants, tutor.Id, student.Id)
+	}
+
+	for _, uid := range []string{tutor.Id, student.Id} {
+		conversations, err := repo.GetUserConversations(uid)
+		if err != nil {
+			t.Fatalf("Cannot list conversations: %v", err)
+		}
+
+		if len(conversations) != 1 || conversations[0].Id != conv.Id {
+			t.Errorf("%s: got conversations %v, want only %s", uid, conversations, conv.Id)
+		}
+	}
+}
+
+// Reading clears the unread messages, and the read cursor never moves backwards
+func TestMarkConversationRead(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	tutor := dbtest.Tutor(t, repo)
+	student := dbtest.Student(t, repo)
+
+	conv, err := repo.GetOrCreateConversation(tutor.Id, student.Id)
+	if err != nil {
+		t.Fatalf("Cannot create conversation: %v", err)
+	}
+
+	sent := time.Now().Truncate(time.Microsecond)
+	m := db.Message{Id: uuid.New(), Conversation: conv.Id, From: tutor.Id, To: student.Id, Kind: "TEXT", Message: "hello", Created: sent}
+	if err = repo.RecordMessage(m); err != nil {
+		t.Fatalf("Cannot record message: %v", err)
+	}
+
+	lastRead, err := repo.MarkConversationRead(conv.Id, student.Id, sent)
+	if err != nil || !lastRead.Equal(sent) {
+		t.Fatalf("Got read cursor %v with error %v, want %v", lastRead, err, sent)
+	}
+
+	if lastRead, err = repo.MarkConversationRead(conv.Id, student.Id, sent.Add(-time.Hour)); err != nil || !lastRead.Equal(sent) {
+		t.Errorf("Got read cursor %v with error %v after reading earlier, want %v", lastRead, err, sent)
+	}
+
+	got, err := repo.GetConversationById(conv.Id)
+	if err != nil {
+		t.Fatalf("Cannot get conversation: %v", err)
+	}
+
+	if p, _ := got.Participant(student.Id); p.Unread != 0 || p.LastRead == nil || !p.LastRead.Equal(sent) {
+		t.Errorf("Got %d unread read up to %v, want none read up to %v", p.Unread, p.LastRead, sent)
+	}
+}
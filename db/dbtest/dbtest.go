@@ -0,0 +1,102 @@
+// Package dbtest connects tests to a Postgres database, skipping them when none is configured
+package dbtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+// Env variable with the URL of the database tests run against. It is migrated to the latest state, and rows created by tests are left behind
+const EnvVar = "DB_URL"
+
+// Gets the URL of the test database, skipping the test when it is not set
+func URL(t *testing.T) string {
+	url := os.Getenv(EnvVar)
+	if url == "" {
+		t.Skip(EnvVar + " is not set, skipping database test")
+	}
+
+	return url
+}
+
+// Connects a repository to the migrated test database, skipping the test when it is not set
+func Repository(t *testing.T) *db.Repository {
+	url := URL(t)
+
+	// Migrations are found relative to this file, since tests run from their own package directory
+	_, file, _, _ := runtime.Caller(0)
+	m, err := migrate.New("file://"+filepath.Join(filepath.Dir(file), "..", "migrations"), url)
+	if err != nil {
+		t.Fatalf("Cannot setup migrations: %v", err)
+	}
+
+	if err = m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatalf("Cannot apply migrations: %v", err)
+	}
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	var repo db.Repository
+	repo.Init(logger, url)
+	t.Cleanup(repo.Close)
+
+	return &repo
+}
+
+// Creates a student with a unique username and email
+func Student(t *testing.T, repo *db.Repository) db.Student {
+	name := uuid.New()
+
+	s, err := repo.CreateStudent(name, "Test", "Student", name+"@example.com", "", "")
+	if err != nil {
+		t.Fatalf("Cannot create student: %v", err)
+	}
+
+	return s
+}
+
+// Creates a tutor with a unique username and email
+func Tutor(t *testing.T, repo *db.Repository) db.Tutor {
+	name := uuid.New()
+
+	tu, err := repo.CreateTutor(name, "Test", "Tutor", name+"@example.com", "", "", 0, 0, "", []string{}, []string{})
+	if err != nil {
+		t.Fatalf("Cannot create tutor: %v", err)
+	}
+
+	return tu
+}
+
+// Creates an admin with a unique username and email
+func Admin(t *testing.T, repo *db.Repository) db.Admin {
+	name := uuid.New()
+
+	a, err := repo.CreateAdmin(name, name+"@example.com", "", []string{})
+	if err != nil {
+		t.Fatalf("Cannot create admin: %v", err)
+	}
+
+	return a
+}
+
+// Gets a subject used by tests, creating it the first time
+func Subject(t *testing.T, repo *db.Repository) db.Subject {
+	sub, err := repo.GetSubject("Test", "Test")
+	if err != nil {
+		t.Fatalf("Cannot create subject: %v", err)
+	}
+
+	return sub
+}
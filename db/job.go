@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+)
+
+// Type mirror for a scheduled background job in the database
+type Job struct {
+	Id       string
+	Kind     string
+	Payload  []byte
+	Status   string
+	Due      time.Time
+	Attempts int
+}
+
+// Creates a new pending job that becomes claimable once the due time has passed
+// Takes the job kind, a JSON encoded payload and the absolute due time
+func (r *Repository) CreateJob(kind string, payload []byte, due time.Time) (Job, error) {
+	var j Job
+
+	j.Id = uuid.New()
+	j.Kind = kind
+	j.Payload = payload
+	j.Status = "PENDING"
+	j.Due = due
+	j.Attempts = 0
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return j, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO jobs (id, kind, payload, status, due) VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.Exec(context.Background(), sql, j.Id, j.Kind, string(j.Payload), j.Status, j.Due)
+
+	if err != nil {
+		return j, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return j, err
+	}
+
+	return j, nil
+}
+
+// Claims up to limit jobs that are due at the time now, leasing them to owner until leaseExpires
+// Rows locked by other workers are skipped, and jobs with an expired lease (ie. a crashed worker) are reclaimed
+func (r *Repository) ClaimDueJobs(owner string, now time.Time, leaseExpires time.Time, limit int) ([]Job, error) {
+	sql := `
+	UPDATE jobs
+	SET lease_owner = $1, lease_expires = $2, attempts = attempts + 1
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE
+			status = 'PENDING' AND
+			due <= $3 AND
+			(lease_expires IS NULL OR lease_expires < $3)
+		ORDER BY due
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, kind, payload::TEXT, status, due, attempts`
+
+	var jobs []Job
+
+	rows, err := r.dbPool.Query(context.Background(), sql, owner, leaseExpires, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var j Job
+		var payload string
+
+		if err := rows.Scan(&j.Id, &j.Kind, &payload, &j.Status, &j.Due, &j.Attempts); err != nil {
+			return nil, err
+		}
+
+		j.Payload = []byte(payload)
+		jobs = append(jobs, j)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Creates a job of a singleton kind unless one of the kind is already pending or being run, in which case false is returned
+func (r *Repository) CreateSingletonJob(kind string, payload []byte, due time.Time) (Job, bool, error) {
+	j := Job{Id: uuid.New(), Kind: kind, Payload: payload, Status: "PENDING", Due: due}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return j, false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	created, err := insertSingletonJob(tx, j)
+	if err != nil {
+		return j, false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return j, false, err
+	}
+
+	return j, created, nil
+}
+
+// Deletes a job once it has been successfully handled. Only the current lease owner can complete a job
+// A non-nil next schedules the next run of a singleton job in the same transaction, with the same kind and payload
+func (r *Repository) CompleteJob(id string, owner string, next *time.Time) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM jobs WHERE id = $1 AND lease_owner = $2 RETURNING kind, payload::TEXT`
+	if err = repeatJob(tx, next, sql, id, owner); err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Releases the lease on a failed job and pushes it back to a later due time, recording the error
+// A status of DEAD stops the job from ever being claimed again, a non-nil next then schedules the next run of a singleton job as in CompleteJob
+func (r *Repository) RetryJob(id string, owner string, status string, due time.Time, lastError string, next *time.Time) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE jobs SET status = $3, due = $4, last_error = $5, lease_owner = NULL, lease_expires = NULL WHERE id = $1 AND lease_owner = $2 RETURNING kind, payload::TEXT`
+	if status != "DEAD" {
+		next = nil
+	}
+
+	if err = repeatJob(tx, next, sql, id, owner, status, due, lastError); err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Runs the statement finishing a job, which returns its kind and payload, then schedules the next run at next unless it is nil
+// Nothing is scheduled if the job was not finished, ie. its lease was taken over
+func repeatJob(tx pgx.Tx, next *time.Time, sql string, args ...interface{}) error {
+	var j Job
+	var payload string
+
+	err := tx.QueryRow(context.Background(), sql, args...).Scan(&j.Kind, &payload)
+	if err == pgx.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if next == nil {
+		return nil
+	}
+
+	j.Id = uuid.New()
+	j.Payload = []byte(payload)
+	j.Status = "PENDING"
+	j.Due = *next
+
+	_, err = insertSingletonJob(tx, j)
+	return err
+}
+
+// Inserts a job of a singleton kind, returning false if one is already pending
+func insertSingletonJob(tx pgx.Tx, j Job) (bool, error) {
+	sql := `INSERT INTO jobs (id, kind, payload, status, due, singleton) VALUES ($1, $2, $3, $4, $5, TRUE) ON CONFLICT DO NOTHING`
+	tag, err := tx.Exec(context.Background(), sql, j.Id, j.Kind, string(j.Payload), j.Status, j.Due)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Deletes all pending jobs of a kind matching the payload, used to cancel jobs that are no longer needed
+func (r *Repository) CancelJobs(kind string, payload []byte) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM jobs WHERE kind = $1 AND payload = $2::JSONB AND status = 'PENDING'`
+	_, err = tx.Exec(context.Background(), sql, kind, string(payload))
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
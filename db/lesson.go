@@ -2,13 +2,25 @@ package db
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"github.com/pborman/uuid"
 	"github.com/solderneer/axiom-backend/graph/model"
 )
 
+// Returned when a lesson would overlap another lesson of the same tutor or student
+var ErrSlotTaken = errors.New("This time slot has already been booked")
+
+// The exclusion constraints keeping the lessons of a tutor or student from overlapping
+const (
+	lessonsTutorOverlap   = "lessons_tutor_no_overlap"
+	lessonsStudentOverlap = "lessons_student_no_overlap"
+)
+
 type Lesson struct {
 	Id        string
 	Subject   Subject
@@ -16,6 +28,7 @@ type Lesson struct {
 	Tutor     string
 	Student   string
 	Scheduled bool
+	Status    string
 	StartTime time.Time
 	EndTime   time.Time
 }
@@ -40,14 +53,37 @@ func (r *Repository) ToLessonModel(l Lesson) (model.Lesson, error) {
 	}
 	rsub := r.ToSubjectModel(l.Subject)
 
-	return model.Lesson{ID: l.Id, Subject: &rsub, Summary: l.Summary, Tutor: &rt, Student: &rs, Scheduled: l.Scheduled, StartTime: l.StartTime.UTC(), EndTime: l.EndTime.UTC()}, nil
+	return model.Lesson{ID: l.Id, Subject: &rsub, Summary: l.Summary, Tutor: &rt, Student: &rs, Scheduled: l.Scheduled, Status: model.LessonStatus(l.Status), StartTime: l.StartTime.UTC(), EndTime: l.EndTime.UTC()}, nil
 }
 
 // Creates a new lesson in the database
+// Overlapping lessons are rejected by the database itself with ErrSlotTaken, so concurrent bookings of the same slot cannot both succeed
 // Accepts a subject, tutor ID, student ID, scheduled status, and a startTime + endTime
-// For a scheduled lesson, startTime/endTime are releative to 0 epoch time and represent points in a week. ie. 0 epoch time is Thursday 12 midnight
+// Times are absolute, weekly availability is expanded into concrete windows before a lesson is booked, see GetAvailableTutors
 func (r *Repository) CreateLesson(subject Subject, tutor string, student string, scheduled bool, startTime time.Time, endTime time.Time) (Lesson, error) {
+	l := newLesson(subject, tutor, student, scheduled, startTime, endTime)
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return l, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	if err = insertLesson(tx, l); err != nil {
+		return l, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
 
+// Builds a new SCHEDULED lesson with a fresh ID, ready to be inserted
+func newLesson(subject Subject, tutor string, student string, scheduled bool, startTime time.Time, endTime time.Time) Lesson {
 	var l Lesson
 
 	// GENERATING UUID
@@ -56,57 +92,84 @@ func (r *Repository) CreateLesson(subject Subject, tutor string, student string,
 	l.Tutor = tutor
 	l.Student = student
 	l.Scheduled = scheduled
+	l.Status = "SCHEDULED"
 	l.StartTime = startTime
 	l.EndTime = endTime
 
+	return l
+}
+
+// Inserts a lesson as part of a larger transaction, returning ErrSlotTaken if it overlaps another lesson
+func insertLesson(tx pgx.Tx, l Lesson) error {
 	period := getTstzrange(l.StartTime, l.EndTime)
 
+	sql := `INSERT INTO lessons (id, subject, tutor, student, scheduled, status, period) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := tx.Exec(context.Background(), sql, l.Id, l.Subject.Id, l.Tutor, l.Student, l.Scheduled, l.Status, period)
+
+	return lessonError(err)
+}
+
+// Updates an existing lesson in the database, returning ErrSlotTaken if it would then overlap another lesson
+// Accepts a lesson object
+func (r *Repository) UpdateLesson(l Lesson) error {
+	period := getTstzrange(l.StartTime, l.EndTime)
 	tx, err := r.dbPool.Begin(context.Background())
 	if err != nil {
-		return l, err
+		return err
 	}
 
 	defer tx.Rollback(context.Background())
 
-	sql := `INSERT INTO lessons (id, subject, tutor, student, scheduled, period) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err = tx.Exec(context.Background(), sql, l.Id, l.Subject.Id, l.Tutor, l.Student, l.Scheduled, period)
+	sql := `UPDATE lessons SET subject = $2, summary = $3, tutor = $4, student = $5, scheduled = $6, status = $7, period = $8 WHERE id = $1`
+	_, err = tx.Exec(context.Background(), sql, l.Id, l.Subject.Id, l.Summary, l.Tutor, l.Student, l.Scheduled, l.Status, period)
 
 	if err != nil {
-		return l, err
+		return lessonError(err)
 	}
 
 	err = tx.Commit(context.Background())
 	if err != nil {
-		return l, err
+		return err
 	}
 
-	return l, nil
+	return nil
 }
 
-// Updates an existing lesson in the database
-// Accepts a lesson object
-func (r *Repository) UpdateLesson(l Lesson) error {
-	period := getTstzrange(l.StartTime, l.EndTime)
+// Hands a scheduled lesson over from one tutor to another, withdrawing its pending reschedule since the other party changed
+// Only the tutor is changed, and only if the lesson is still scheduled with the expected tutor, otherwise false is returned
+// Returns ErrSlotTaken if the new tutor has another lesson at the same time
+func (r *Repository) ReassignLesson(lid string, from string, to string, audit *Audit) (bool, error) {
 	tx, err := r.dbPool.Begin(context.Background())
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	defer tx.Rollback(context.Background())
 
-	sql := `UPDATE lessons SET subject = $2, summary = $3, tutor = $4, student = $5, scheduled = $6, period = $7 WHERE id = $1`
-	_, err = tx.Exec(context.Background(), sql, l.Id, l.Subject.Id, l.Summary, l.Tutor, l.Student, l.Scheduled, period)
-
+	sql := `UPDATE lessons SET tutor = $3 WHERE id = $1 AND tutor = $2 AND status = 'SCHEDULED'`
+	tag, err := tx.Exec(context.Background(), sql, lid, from, to)
 	if err != nil {
-		return err
+		return false, lessonError(err)
 	}
 
-	err = tx.Commit(context.Background())
-	if err != nil {
-		return err
+	if tag.RowsAffected() != 1 {
+		return false, nil
 	}
 
-	return nil
+	sql = `UPDATE lesson_reschedules SET status = 'CANCELLED', responded = NOW() WHERE lesson = $1 AND status = 'PENDING'`
+	if _, err = tx.Exec(context.Background(), sql, lid); err != nil {
+		return false, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 // Get lesson by the lesson UUID
@@ -114,8 +177,8 @@ func (r *Repository) GetLessonById(id string) (Lesson, error) {
 	var period pgtype.Tstzrange
 	var l Lesson
 
-	sql := `SELECT lessons.id, subjects.id, subjects.name, subjects.standard, lessons.summary, lessons.tutor, lessons.student, lessons.scheduled, lessons.period FROM lessons INNER JOIN subjects ON lessons.subject = subjects.id WHERE lessons.id = $1`
-	if err := r.dbPool.QueryRow(context.Background(), sql, id).Scan(&l.Id, &l.Subject.Id, &l.Subject.Name, &l.Subject.Standard, &l.Summary, &l.Tutor, &l.Student, &l.Scheduled, &period); err != nil {
+	sql := `SELECT lessons.id, subjects.id, subjects.name, subjects.standard, lessons.summary, lessons.tutor, lessons.student, lessons.scheduled, lessons.status, lessons.period FROM lessons INNER JOIN subjects ON lessons.subject = subjects.id WHERE lessons.id = $1`
+	if err := r.dbPool.QueryRow(context.Background(), sql, id).Scan(&l.Id, &l.Subject.Id, &l.Subject.Name, &l.Subject.Standard, &l.Summary, &l.Tutor, &l.Student, &l.Scheduled, &l.Status, &period); err != nil {
 		return l, err
 	}
 
@@ -123,3 +186,16 @@ func (r *Repository) GetLessonById(id string) (Lesson, error) {
 	period.Lower.AssignTo(&l.StartTime)
 	return l, nil
 }
+
+// Maps violations of the lesson exclusion constraints to ErrSlotTaken
+func lessonError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+		switch pgErr.ConstraintName {
+		case lessonsTutorOverlap, lessonsStudentOverlap:
+			return ErrSlotTaken
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,357 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for the report a tutor writes after a lesson, published is nil while it is still a draft
+type LessonReport struct {
+	Lesson    string
+	Tutor     string
+	Topics    []string
+	Summary   string
+	Homework  string
+	FollowUp  string
+	Published *time.Time
+	Updated   time.Time
+}
+
+// Type mirror for a private note kept by the student or tutor of a lesson
+type LessonNote struct {
+	Id      string
+	Lesson  string
+	Author  string
+	Body    string
+	Created time.Time
+}
+
+// Type mirror for a file shared on a lesson, its content lives in the blob store under the storage key
+type LessonAttachment struct {
+	Id          string
+	Lesson      string
+	UploadedBy  string
+	Name        string
+	ContentType string
+	Size        int64
+	StorageKey  string
+	Created     time.Time
+}
+
+// Convert a db.LessonReport to a model.LessonReport
+func (r *Repository) ToLessonReportModel(rep LessonReport) model.LessonReport {
+	return model.LessonReport{Topics: rep.Topics, Summary: rep.Summary, Homework: rep.Homework, FollowUp: rep.FollowUp, Published: rep.Published, Updated: rep.Updated}
+}
+
+// Convert a db.LessonNote to a model.LessonNote
+func (r *Repository) ToLessonNoteModel(n LessonNote) model.LessonNote {
+	return model.LessonNote{ID: n.Id, Lesson: n.Lesson, Body: n.Body, Created: n.Created}
+}
+
+// Convert a db.LessonAttachment to a model.LessonAttachment, url is where its content can be downloaded from
+func (r *Repository) ToLessonAttachmentModel(a LessonAttachment, url string) model.LessonAttachment {
+	return model.LessonAttachment{ID: a.Id, Lesson: a.Lesson, UploadedBy: a.UploadedBy, Name: a.Name, ContentType: a.ContentType, Size: int(a.Size), URL: url, Created: a.Created}
+}
+
+// Creates or updates the report of a lesson. Changes to a published report are published straight away, so the summary of the lesson is kept in sync
+func (r *Repository) SaveLessonReport(lid string, tid string, topics []string, summary string, homework string, followUp string) (LessonReport, error) {
+	var rep LessonReport
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return rep, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `
+	INSERT INTO lesson_reports (lesson, tutor, topics, summary, homework, follow_up, updated) VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	ON CONFLICT (lesson) DO UPDATE SET topics = EXCLUDED.topics, summary = EXCLUDED.summary, homework = EXCLUDED.homework, follow_up = EXCLUDED.follow_up, updated = EXCLUDED.updated
+	RETURNING lesson, tutor, topics, summary, homework, follow_up, published, updated`
+	if err = tx.QueryRow(context.Background(), sql, lid, tid, topics, summary, homework, followUp).Scan(&rep.Lesson, &rep.Tutor, &rep.Topics, &rep.Summary, &rep.Homework, &rep.FollowUp, &rep.Published, &rep.Updated); err != nil {
+		return rep, err
+	}
+
+	if rep.Published != nil {
+		sql = `UPDATE lessons SET summary = $2 WHERE id = $1`
+		if _, err = tx.Exec(context.Background(), sql, lid, summary); err != nil {
+			return rep, err
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return rep, err
+	}
+
+	return rep, nil
+}
+
+// Publishes the report of a lesson to its student, copying its summary onto the lesson
+// Returns false if the report was already published, pgx.ErrNoRows if the lesson has no report
+func (r *Repository) PublishLessonReport(lid string) (LessonReport, bool, error) {
+	var rep LessonReport
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return rep, false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE lesson_reports SET published = NOW() WHERE lesson = $1 AND published IS NULL`
+	tag, err := tx.Exec(context.Background(), sql, lid)
+	if err != nil {
+		return rep, false, err
+	}
+
+	first := tag.RowsAffected() == 1
+
+	sql = `SELECT lesson, tutor, topics, summary, homework, follow_up, published, updated FROM lesson_reports WHERE lesson = $1`
+	if err = tx.QueryRow(context.Background(), sql, lid).Scan(&rep.Lesson, &rep.Tutor, &rep.Topics, &rep.Summary, &rep.Homework, &rep.FollowUp, &rep.Published, &rep.Updated); err != nil {
+		return rep, false, err
+	}
+
+	sql = `UPDATE lessons SET summary = $2 WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), sql, lid, rep.Summary); err != nil {
+		return rep, false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return rep, false, err
+	}
+
+	return rep, first, nil
+}
+
+// Gets the report of a lesson, pgx.ErrNoRows if its tutor has not written one yet
+func (r *Repository) GetLessonReport(lid string) (LessonReport, error) {
+	sql := `SELECT lesson, tutor, topics, summary, homework, follow_up, published, updated FROM lesson_reports WHERE lesson = $1`
+
+	var rep LessonReport
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, lid).Scan(&rep.Lesson, &rep.Tutor, &rep.Topics, &rep.Summary, &rep.Homework, &rep.FollowUp, &rep.Published, &rep.Updated); err != nil {
+		return rep, err
+	}
+
+	return rep, nil
+}
+
+// Creates a private note on a lesson
+func (r *Repository) CreateLessonNote(lid string, uid string, body string) (LessonNote, error) {
+	n := LessonNote{Id: uuid.New(), Lesson: lid, Author: uid, Body: body, Created: time.Now()}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return n, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO lesson_notes (id, lesson, author, body, created) VALUES ($1, $2, $3, $4, $5)`
+	if _, err = tx.Exec(context.Background(), sql, n.Id, n.Lesson, n.Author, n.Body, n.Created); err != nil {
+		return n, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Get a lesson note based on its UUID
+func (r *Repository) GetLessonNoteById(nid string) (LessonNote, error) {
+	sql := `SELECT id, lesson, author, body, created FROM lesson_notes WHERE id = $1`
+
+	var n LessonNote
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, nid).Scan(&n.Id, &n.Lesson, &n.Author, &n.Body, &n.Created); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Gets the notes a user kept on a lesson, oldest first
+func (r *Repository) GetLessonNotes(lid string, uid string) ([]LessonNote, error) {
+	sql := `SELECT id, lesson, author, body, created FROM lesson_notes WHERE lesson = $1 AND author = $2 ORDER BY created`
+
+	var notes []LessonNote
+
+	rows, err := r.dbPool.Query(context.Background(), sql, lid, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var n LessonNote
+
+		if err := rows.Scan(&n.Id, &n.Lesson, &n.Author, &n.Body, &n.Created); err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// Deletes a lesson note
+func (r *Repository) DeleteLessonNote(nid string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM lesson_notes WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), sql, nid); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Records a file shared on a lesson, once its content has been written to the blob store
+func (r *Repository) CreateLessonAttachment(a LessonAttachment) (LessonAttachment, error) {
+	a.Created = time.Now()
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return a, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO lesson_attachments (id, lesson, uploaded_by, name, content_type, size, storage_key, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	if _, err = tx.Exec(context.Background(), sql, a.Id, a.Lesson, a.UploadedBy, a.Name, a.ContentType, a.Size, a.StorageKey, a.Created); err != nil {
+		return a, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Get a lesson attachment based on its UUID
+func (r *Repository) GetLessonAttachmentById(aid string) (LessonAttachment, error) {
+	sql := `SELECT id, lesson, uploaded_by, name, content_type, size, storage_key, created FROM lesson_attachments WHERE id = $1`
+
+	var a LessonAttachment
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, aid).Scan(&a.Id, &a.Lesson, &a.UploadedBy, &a.Name, &a.ContentType, &a.Size, &a.StorageKey, &a.Created); err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Gets the files shared on a lesson, oldest first
+func (r *Repository) GetLessonAttachments(lid string) ([]LessonAttachment, error) {
+	sql := `SELECT id, lesson, uploaded_by, name, content_type, size, storage_key, created FROM lesson_attachments WHERE lesson = $1 ORDER BY created`
+
+	var attachments []LessonAttachment
+
+	rows, err := r.dbPool.Query(context.Background(), sql, lid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var a LessonAttachment
+
+		if err := rows.Scan(&a.Id, &a.Lesson, &a.UploadedBy, &a.Name, &a.ContentType, &a.Size, &a.StorageKey, &a.Created); err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Deletes the record of a lesson attachment, its content has to be removed from the blob store separately
+func (r *Repository) DeleteLessonAttachment(aid string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM lesson_attachments WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), sql, aid); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Gets the completed lessons of a student or tutor, most recent first
+func (r *Repository) GetLessonHistory(uid string, limit int, offset int) ([]Lesson, error) {
+	sql := `
+	SELECT lessons.id, subjects.id, subjects.name, subjects.standard, lessons.summary, lessons.tutor, lessons.student, lessons.scheduled, lessons.status, lessons.period
+	FROM lessons
+	INNER JOIN subjects ON lessons.subject = subjects.id
+	WHERE (lessons.student = $1 OR lessons.tutor = $1) AND lessons.status = 'COMPLETED'
+	ORDER BY lower(lessons.period) DESC, lessons.id
+	LIMIT $2 OFFSET $3`
+
+	var lessons []Lesson
+
+	rows, err := r.dbPool.Query(context.Background(), sql, uid, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var l Lesson
+		var period pgtype.Tstzrange
+
+		if err := rows.Scan(&l.Id, &l.Subject.Id, &l.Subject.Name, &l.Subject.Standard, &l.Summary, &l.Tutor, &l.Student, &l.Scheduled, &l.Status, &period); err != nil {
+			return nil, err
+		}
+
+		period.Upper.AssignTo(&l.EndTime)
+		period.Lower.AssignTo(&l.StartTime)
+
+		lessons = append(lessons, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lessons, nil
+}
+
+// Counts the completed lessons of a student or tutor, see GetLessonHistory
+func (r *Repository) CountLessonHistory(uid string) (int, error) {
+	sql := `SELECT COUNT(*) FROM lessons WHERE (student = $1 OR tutor = $1) AND status = 'COMPLETED'`
+
+	var count int
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, uid).Scan(&count); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
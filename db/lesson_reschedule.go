@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Returned when a lesson already has a reschedule waiting for an answer
+var ErrReschedulePending = errors.New("This lesson already has a reschedule request waiting for an answer")
+
+// The index allowing only one pending reschedule per lesson
+const lessonReschedulesPending = "lesson_reschedules_pending_idx"
+
+// Type mirror for a request by the student or tutor of a lesson to move it to another time
+type LessonReschedule struct {
+	Id          string
+	Lesson      string
+	RequestedBy string
+	StartTime   time.Time
+	EndTime     time.Time
+	Status      string
+	Created     time.Time
+}
+
+// Type mirror for who cancelled a lesson and why, late cancellations were made within the cancellation window of the lesson
+type LessonCancellation struct {
+	Lesson      string
+	CancelledBy string
+	Reason      string
+	Late        bool
+	Created     time.Time
+}
+
+// Convert a db.LessonReschedule to a model.LessonReschedule
+func (r *Repository) ToLessonRescheduleModel(lr LessonReschedule) model.LessonReschedule {
+	return model.LessonReschedule{ID: lr.Id, Lesson: lr.Lesson, RequestedBy: lr.RequestedBy, StartTime: lr.StartTime.UTC(), EndTime: lr.EndTime.UTC(), Status: model.RescheduleStatus(lr.Status), Created: lr.Created}
+}
+
+// Convert a db.LessonCancellation to a model.LessonCancellation
+func (r *Repository) ToLessonCancellationModel(c LessonCancellation) model.LessonCancellation {
+	return model.LessonCancellation{CancelledBy: c.CancelledBy, Reason: c.Reason, Late: c.Late, Created: c.Created}
+}
+
+// Moves a lesson from one status to another. Returns false if the lesson was not in the expected status
+func (r *Repository) SetLessonStatus(lid string, from string, to string) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE lessons SET status = $3 WHERE id = $1 AND status = $2`
+	tag, err := tx.Exec(context.Background(), sql, lid, from, to)
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Creates a pending request to move a lesson, returning ErrReschedulePending if the lesson already has one
+func (r *Repository) CreateLessonReschedule(lid string, uid string, startTime time.Time, endTime time.Time) (LessonReschedule, error) {
+	var lr LessonReschedule
+
+	lr.Id = uuid.New()
+	lr.Lesson = lid
+	lr.RequestedBy = uid
+	lr.StartTime = startTime
+	lr.EndTime = endTime
+	lr.Status = "PENDING"
+	lr.Created = time.Now()
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return lr, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	period := getTstzrange(startTime, endTime)
+
+	sql := `INSERT INTO lesson_reschedules (id, lesson, requested_by, period, status, created) VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err = tx.Exec(context.Background(), sql, lr.Id, lr.Lesson, lr.RequestedBy, period, lr.Status, lr.Created); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == lessonReschedulesPending {
+			return lr, ErrReschedulePending
+		}
+		return lr, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return lr, err
+	}
+
+	return lr, nil
+}
+
+// Get a lesson reschedule based on its UUID
+func (r *Repository) GetLessonRescheduleById(rid string) (LessonReschedule, error) {
+	sql := `SELECT id, lesson, requested_by, period, status, created FROM lesson_reschedules WHERE id = $1`
+
+	var lr LessonReschedule
+	var period pgtype.Tstzrange
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, rid).Scan(&lr.Id, &lr.Lesson, &lr.RequestedBy, &period, &lr.Status, &lr.Created); err != nil {
+		return lr, err
+	}
+
+	period.Lower.AssignTo(&lr.StartTime)
+	period.Upper.AssignTo(&lr.EndTime)
+
+	return lr, nil
+}
+
+// Gets the reschedules requested for a lesson, oldest first
+func (r *Repository) GetLessonReschedules(lid string) ([]LessonReschedule, error) {
+	sql := `SELECT id, lesson, requested_by, period, status, created FROM lesson_reschedules WHERE lesson = $1 ORDER BY created`
+
+	var reschedules []LessonReschedule
+
+	rows, err := r.dbPool.Query(context.Background(), sql, lid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var lr LessonReschedule
+		var period pgtype.Tstzrange
+
+		if err := rows.Scan(&lr.Id, &lr.Lesson, &lr.RequestedBy, &period, &lr.Status, &lr.Created); err != nil {
+			return nil, err
+		}
+
+		period.Lower.AssignTo(&lr.StartTime)
+		period.Upper.AssignTo(&lr.EndTime)
+
+		reschedules = append(reschedules, lr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reschedules, nil
+}
+
+// Answers a pending reschedule, moving the lesson to the requested time if it was accepted
+// Returns false if the reschedule was already answered or the lesson is no longer scheduled, and ErrSlotTaken if the new time clashes with another lesson
+func (r *Repository) RespondToLessonReschedule(rid string, accept bool) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	status := "DECLINED"
+	if accept {
+		status = "ACCEPTED"
+	}
+
+	var lid string
+	var period pgtype.Tstzrange
+
+	sql := `UPDATE lesson_reschedules SET status = $2, responded = NOW() WHERE id = $1 AND status = 'PENDING' RETURNING lesson, period`
+	if err = tx.QueryRow(context.Background(), sql, rid, status).Scan(&lid, &period); err == pgx.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if accept {
+		sql = `UPDATE lessons SET period = $2 WHERE id = $1 AND status = 'SCHEDULED'`
+		tag, err := tx.Exec(context.Background(), sql, lid, period)
+		if err != nil {
+			return false, lessonError(err)
+		}
+
+		if tag.RowsAffected() != 1 {
+			return false, nil
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Cancels a scheduled lesson, recording who cancelled it and why, and withdrawing its pending reschedule
+// Returns false if the lesson was no longer scheduled
+func (r *Repository) CancelLesson(lid string, uid string, reason string, late bool, audit *Audit) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE lessons SET status = 'CANCELLED' WHERE id = $1 AND status = 'SCHEDULED'`
+	tag, err := tx.Exec(context.Background(), sql, lid)
+	if err != nil {
+		return false, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return false, nil
+	}
+
+	sql = `INSERT INTO lesson_cancellations (lesson, cancelled_by, reason, late) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(context.Background(), sql, lid, uid, reason, late); err != nil {
+		return false, err
+	}
+
+	sql = `UPDATE lesson_reschedules SET status = 'CANCELLED', responded = NOW() WHERE lesson = $1 AND status = 'PENDING'`
+	if _, err = tx.Exec(context.Background(), sql, lid); err != nil {
+		return false, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Gets the cancellation of a lesson, pgx.ErrNoRows if it was not cancelled by its student or tutor
+func (r *Repository) GetLessonCancellation(lid string) (LessonCancellation, error) {
+	sql := `SELECT lesson, cancelled_by, reason, late, created FROM lesson_cancellations WHERE lesson = $1`
+
+	var c LessonCancellation
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, lid).Scan(&c.Lesson, &c.CancelledBy, &c.Reason, &c.Late, &c.Created); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
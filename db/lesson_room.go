@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for the video room of a lesson. Started is when both the student and tutor had joined, nil until then, and ended is when the room was closed
+type LessonRoom struct {
+	Lesson  string
+	RoomSid string
+	Created time.Time
+	Started *time.Time
+	Ended   *time.Time
+}
+
+// Type mirror for a single connection of a participant to the video room of a lesson, left is nil while still connected
+type LessonAttendance struct {
+	ParticipantSid string
+	Lesson         string
+	Participant    string
+	Joined         time.Time
+	Left           *time.Time
+}
+
+// Convert a db.LessonAttendance to a model.ParticipantSession
+func (r *Repository) ToParticipantSessionModel(a LessonAttendance) model.ParticipantSession {
+	return model.ParticipantSession{Participant: a.Participant, Joined: a.Joined, Left: a.Left}
+}
+
+// Records the video room created for a lesson, rooms are named after their lesson
+func (r *Repository) RecordLessonRoom(lid string, roomSid string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `
+	INSERT INTO lesson_rooms (lesson, room_sid) VALUES ($1, NULLIF($2, ''))
+	ON CONFLICT (lesson) DO UPDATE SET room_sid = COALESCE(EXCLUDED.room_sid, lesson_rooms.room_sid)`
+	if _, err = tx.Exec(context.Background(), sql, lid, roomSid); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Records that a participant was issued an access token for the room of a lesson
+func (r *Repository) RecordLessonToken(lid string, uid string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `
+	INSERT INTO lesson_participants (lesson, participant, token_issued) VALUES ($1, $2, NOW())
+	ON CONFLICT (lesson, participant) DO UPDATE SET token_issued = EXCLUDED.token_issued`
+	if _, err = tx.Exec(context.Background(), sql, lid, uid); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Records a participant connecting to the room of a lesson. Once both the student and tutor have joined the lesson is started and moves to IN_PROGRESS
+// Returns true if this connection started the lesson. Repeated callbacks for the same connection are ignored
+func (r *Repository) RecordParticipantJoined(lid string, uid string, participantSid string, joined time.Time) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO lesson_rooms (lesson) VALUES ($1) ON CONFLICT (lesson) DO NOTHING`
+	if _, err = tx.Exec(context.Background(), sql, lid); err != nil {
+		return false, err
+	}
+
+	sql = `INSERT INTO lesson_attendance (participant_sid, lesson, participant, joined) VALUES ($1, $2, $3, $4) ON CONFLICT (participant_sid) DO NOTHING`
+	if _, err = tx.Exec(context.Background(), sql, participantSid, lid, uid, joined); err != nil {
+		return false, err
+	}
+
+	// The lesson starts when the second of the student and tutor first joined, whatever order the callbacks arrived in
+	sql = `
+	UPDATE lesson_rooms SET started = GREATEST(s.joined, t.joined)
+	FROM lessons,
+		LATERAL (SELECT MIN(joined) AS joined FROM lesson_attendance WHERE lesson_attendance.lesson = lessons.id AND lesson_attendance.participant = lessons.student) AS s,
+		LATERAL (SELECT MIN(joined) AS joined FROM lesson_attendance WHERE lesson_attendance.lesson = lessons.id AND lesson_attendance.participant = lessons.tutor) AS t
+	WHERE lesson_rooms.lesson = $1 AND lessons.id = lesson_rooms.lesson AND lesson_rooms.started IS NULL AND s.joined IS NOT NULL AND t.joined IS NOT NULL`
+	tag, err := tx.Exec(context.Background(), sql, lid)
+	if err != nil {
+		return false, err
+	}
+
+	started := tag.RowsAffected() == 1
+	if started {
+		sql = `UPDATE lessons SET status = 'IN_PROGRESS' WHERE id = $1 AND status = 'SCHEDULED'`
+		if _, err = tx.Exec(context.Background(), sql, lid); err != nil {
+			return false, err
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return started, nil
+}
+
+// Records a participant disconnecting from the room of a lesson
+func (r *Repository) RecordParticipantLeft(participantSid string, left time.Time) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE lesson_attendance SET left_at = $2 WHERE participant_sid = $1 AND left_at IS NULL`
+	if _, err = tx.Exec(context.Background(), sql, participantSid, left); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Gets the video room of a lesson, pgx.ErrNoRows if none was created yet
+func (r *Repository) GetLessonRoom(lid string) (LessonRoom, error) {
+	sql := `SELECT lesson, COALESCE(room_sid, ''), created, started, ended FROM lesson_rooms WHERE lesson = $1`
+
+	var room LessonRoom
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, lid).Scan(&room.Lesson, &room.RoomSid, &room.Created, &room.Started, &room.Ended); err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// Gets every connection made to the room of a lesson, in the order they joined
+func (r *Repository) GetLessonAttendance(lid string) ([]LessonAttendance, error) {
+	sql := `SELECT participant_sid, lesson, participant, joined, left_at FROM lesson_attendance WHERE lesson = $1 ORDER BY joined`
+
+	var attendance []LessonAttendance
+
+	rows, err := r.dbPool.Query(context.Background(), sql, lid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var a LessonAttendance
+
+		if err := rows.Scan(&a.ParticipantSid, &a.Lesson, &a.Participant, &a.Joined, &a.Left); err != nil {
+			return nil, err
+		}
+
+		attendance = append(attendance, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attendance, nil
+}
+
+// Ends a lesson, moving it from one status to COMPLETED or NO_SHOW and closing its room. Returns false if the lesson was not in the expected status
+// Completed lessons are charged for the time both parties were in the room, up to the length they were booked for
+func (r *Repository) FinishLesson(lid string, from string, to string, ended time.Time) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE lessons SET status = $3 WHERE id = $1 AND status = $2`
+	tag, err := tx.Exec(context.Background(), sql, lid, from, to)
+	if err != nil {
+		return false, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return false, nil
+	}
+
+	sql = `UPDATE lesson_rooms SET ended = COALESCE(ended, $2) WHERE lesson = $1`
+	if _, err = tx.Exec(context.Background(), sql, lid, ended); err != nil {
+		return false, err
+	}
+
+	if to == "COMPLETED" {
+		sql = `
+		INSERT INTO lesson_charges (lesson, student, tutor, minutes, hourly_rate, amount)
+		SELECT lessons.id, lessons.student, lessons.tutor, billed.minutes, tutors.hourly_rate, tutors.hourly_rate * billed.minutes / 60
+		FROM lessons
+		INNER JOIN tutors ON tutors.id = lessons.tutor
+		INNER JOIN lesson_rooms ON lesson_rooms.lesson = lessons.id,
+			LATERAL (SELECT GREATEST(LEAST(
+				FLOOR(EXTRACT(EPOCH FROM lesson_rooms.ended - lesson_rooms.started) / 60),
+				FLOOR(EXTRACT(EPOCH FROM upper(lessons.period) - lower(lessons.period)) / 60)), 0)::INT AS minutes) AS billed
+		WHERE lessons.id = $1 AND lesson_rooms.started IS NOT NULL
+		ON CONFLICT (lesson) DO NOTHING`
+		if _, err = tx.Exec(context.Background(), sql, lid); err != nil {
+			return false, err
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
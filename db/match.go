@@ -79,6 +79,10 @@ func (r *Repository) CreateMatch(token string, status string, scheduled bool, si
 		return m, err
 	}
 
+	if err = recordOffer(tx, m.Tutor); err != nil {
+		return m, err
+	}
+
 	err = tx.Commit(context.Background())
 	if err != nil {
 		return m, err
@@ -97,7 +101,7 @@ func (r *Repository) UpdateMatch(m Match) error {
 
 	defer tx.Rollback(context.Background())
 
-	sql := `UPDATE matchings SET status = $2, lesson $3 WHERE id = $1`
+	sql := `UPDATE matchings SET status = $2, lesson = NULLIF($3, '') WHERE id = $1`
 	_, err = tx.Exec(context.Background(), sql, m.Id, m.Status, m.Lesson)
 
 	if err != nil {
@@ -118,28 +122,34 @@ func (r *Repository) GetMatchById(mid string) (Match, error) {
 	var period pgtype.Tstzrange
 	var m Match
 
-	if err := r.dbPool.QueryRow(context.Background(), sql, mid).Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &m.Lesson); err != nil {
+	// The lesson is NULL until the match is accepted
+	var lesson pgtype.Varchar
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, mid).Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &lesson); err != nil {
 		return m, err
 	}
 
 	period.Upper.AssignTo(&m.EndTime)
 	period.Lower.AssignTo(&m.StartTime)
+	lesson.AssignTo(&m.Lesson)
 
 	return m, nil
 }
 
 // Gets the match struct based on the token, if it is on demand and it is a valid match
 func (r *Repository) CheckForMatch(token string) (Match, error) {
-	sql := `SELECT id, token, status, scheduled, tutor, student, subject, period, lesson FROM matchings WHERE token = $1 AND scheduled = FALSE AND status = "MATCHED"`
+	sql := `SELECT id, token, status, scheduled, tutor, student, subject, period, lesson FROM matchings WHERE token = $1 AND scheduled = FALSE AND status = 'MATCHED'`
 	var period pgtype.Tstzrange
 	var m Match
+	var lesson pgtype.Varchar
 
-	if err := r.dbPool.QueryRow(context.Background(), sql, token).Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &m.Lesson); err != nil {
+	if err := r.dbPool.QueryRow(context.Background(), sql, token).Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &lesson); err != nil {
 		return m, err
 	}
 
 	period.Upper.AssignTo(&m.EndTime)
 	period.Lower.AssignTo(&m.StartTime)
+	lesson.AssignTo(&m.Lesson)
 
 	return m, nil
 }
@@ -159,8 +169,9 @@ func (r *Repository) GetTutorPendingMatches(tid string) ([]Match, error) {
 	for rows.Next() {
 		var m Match
 		var period pgtype.Tstzrange
+		var lesson pgtype.Varchar
 
-		err := rows.Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &m.Lesson)
+		err := rows.Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &lesson)
 
 		if err != nil {
 			return nil, err
@@ -168,6 +179,7 @@ func (r *Repository) GetTutorPendingMatches(tid string) ([]Match, error) {
 
 		period.Upper.AssignTo(&m.EndTime)
 		period.Lower.AssignTo(&m.StartTime)
+		lesson.AssignTo(&m.Lesson)
 
 		matches = append(matches, m)
 	}
@@ -195,8 +207,9 @@ func (r *Repository) GetStudentPendingMatches(sid string) ([]Match, error) {
 	for rows.Next() {
 		var m Match
 		var period pgtype.Tstzrange
+		var lesson pgtype.Varchar
 
-		err := rows.Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &m.Lesson)
+		err := rows.Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &lesson)
 
 		if err != nil {
 			return nil, err
@@ -204,6 +217,7 @@ func (r *Repository) GetStudentPendingMatches(sid string) ([]Match, error) {
 
 		period.Upper.AssignTo(&m.EndTime)
 		period.Lower.AssignTo(&m.StartTime)
+		lesson.AssignTo(&m.Lesson)
 
 		matches = append(matches, m)
 	}
@@ -215,3 +229,48 @@ func (r *Repository) GetStudentPendingMatches(sid string) ([]Match, error) {
 
 	return matches, nil
 }
+
+// Gets all matches still MATCHING although their period started before the given time, oldest first
+// These should have been accepted or expired long ago, and need to be resolved by hand
+func (r *Repository) GetStuckMatches(startedBefore time.Time) ([]Match, error) {
+	sql := `SELECT id, token, status, scheduled, tutor, student, subject, period, lesson FROM matchings WHERE status = 'MATCHING' AND lower(period) < $1 ORDER BY lower(period)`
+
+	var matches []Match
+
+	rows, err := r.dbPool.Query(context.Background(), sql, startedBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var m Match
+		var period pgtype.Tstzrange
+		var lesson pgtype.Varchar
+
+		err := rows.Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &lesson)
+
+		if err != nil {
+			return nil, err
+		}
+
+		period.Upper.AssignTo(&m.EndTime)
+		period.Lower.AssignTo(&m.StartTime)
+		lesson.AssignTo(&m.Lesson)
+
+		matches = append(matches, m)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// Marks a match as FAILED, but only if it is still MATCHING. Its tutor is counted as having ignored it
+// Returns whether the match was actually expired, so callers can tell if it was accepted in the meantime
+func (r *Repository) ExpireMatch(mid string, audit *Audit) (bool, error) {
+	return r.respondToMatch(mid, "FAILED", ResponseIgnored, audit)
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// Type mirror for what matching knows about a tutor when ranking them for a student in a subject
+// Lessons are those the tutor had since loadSince, offers are the matches they answered or let expire since responseSince, both up to the time of the match
+// ConsecutiveIgnored and LastIgnored come from the response stats of the tutor, see TutorResponseStats
+type MatchCandidate struct {
+	Tutor              string
+	Affinity           int
+	Rating             float64
+	HourlyRate         int
+	Lessons            int
+	Offered            int
+	Accepted           int
+	ConsecutiveIgnored int
+	LastIgnored        *time.Time
+}
+
+// Candidates among the tutors $3 at the time $4, with load counted since $5 and responses since $6
+// Affinity and rating are filled in as %[1]s and %[2]s, from the joins added as %[3]s
+const matchCandidatesSQL = `
+	SELECT tutors.id, %[1]s, %[2]s, tutors.hourly_rate, load.lessons, responses.offered, responses.accepted,
+		COALESCE(tutor_response_stats.consecutive_ignored, 0), tutor_response_stats.last_ignored
+	FROM tutors
+	%[3]s
+	LEFT JOIN tutor_response_stats ON tutor_response_stats.tutor = tutors.id
+	CROSS JOIN LATERAL (
+		SELECT COUNT(*) AS lessons FROM lessons
+		WHERE lessons.tutor = tutors.id AND lessons.status <> 'CANCELLED' AND lower(lessons.period) >= $5 AND lower(lessons.period) < $4
+	) AS load
+	CROSS JOIN LATERAL (
+		SELECT COUNT(*) FILTER (WHERE matchings.status <> 'MATCHING' AND matchings.response IS DISTINCT FROM 'WITHDRAWN') AS offered, COUNT(*) FILTER (WHERE matchings.status = 'MATCHED') AS accepted FROM matchings
+		WHERE matchings.tutor = tutors.id AND lower(matchings.period) >= $6 AND lower(matchings.period) < $4
+	) AS responses
+	WHERE tutors.id = ANY($3)`
+
+// Gets what matching knows about each of the given tutors, as of the time at
+// Affinity, rating and response stats are as they are now, so use GetPastMatchCandidates to replay old matches
+func (r *Repository) GetMatchCandidates(sid string, subid string, tids []string, at time.Time, loadSince time.Time, responseSince time.Time) ([]MatchCandidate, error) {
+	sql := fmt.Sprintf(matchCandidatesSQL, "COALESCE(affinity.score, 0)", "tutors.rating_score",
+		"LEFT JOIN affinity ON affinity.tutor = tutors.id AND affinity.student = $1 AND affinity.subject = $2")
+
+	return r.queryMatchCandidates(sql, sid, subid, tids, at, loadSince, responseSince)
+}
+
+// Gets what matching knew about each of the given tutors at the time at, for replaying old matches
+// Ratings only count the reviews left before then. Affinity is left at 0, the affinity service computes it from the lesson outcomes known then
+// Response stats are only known as they are now
+func (r *Repository) GetPastMatchCandidates(tids []string, at time.Time, loadSince time.Time, responseSince time.Time) ([]MatchCandidate, error) {
+	sql := fmt.Sprintf(matchCandidatesSQL, "0", "ratings.score", `
+	CROSS JOIN LATERAL (
+		SELECT ($1::FLOAT8 * $2::INT + COALESCE(SUM(reviews.rating), 0)) / ($2::INT + COUNT(*)) AS score FROM reviews
+		WHERE reviews.tutor = tutors.id AND reviews.hidden = FALSE AND reviews.created < $4
+	) AS ratings`)
+
+	return r.queryMatchCandidates(sql, ratingPrior, ratingWeight, tids, at, loadSince, responseSince)
+}
+
+func (r *Repository) queryMatchCandidates(sql string, args ...interface{}) ([]MatchCandidate, error) {
+	var candidates []MatchCandidate
+
+	rows, err := r.dbPool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var c MatchCandidate
+
+		if err := rows.Scan(&c.Tutor, &c.Affinity, &c.Rating, &c.HourlyRate, &c.Lessons, &c.Offered, &c.Accepted, &c.ConsecutiveIgnored, &c.LastIgnored); err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+// Gets the average hourly rate a student paid for their lessons before the time at, 0 if they have not paid for any
+func (r *Repository) GetStudentAverageRate(sid string, at time.Time) (int, error) {
+	sql := `SELECT COALESCE(ROUND(AVG(hourly_rate)), 0)::INT FROM lesson_charges WHERE student = $1 AND created < $2`
+
+	var rate int
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, sid, at).Scan(&rate); err != nil {
+		return rate, err
+	}
+
+	return rate, nil
+}
+
+// Gets the matches which were accepted or failed since a time, grouped by token, student, subject and period
+// Matches offered together, whether to several tutors at once on demand or for the same scheduled slot, are next to each other
+func (r *Repository) GetDecidedMatches(since time.Time) ([]Match, error) {
+	sql := `
+	SELECT id, token, status, scheduled, tutor, student, subject, period, lesson
+	FROM matchings
+	WHERE status IN ('MATCHED', 'FAILED') AND lower(period) >= $1
+	ORDER BY token, student, subject, lower(period), id`
+
+	var matches []Match
+
+	rows, err := r.dbPool.Query(context.Background(), sql, since)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var m Match
+		var period pgtype.Tstzrange
+		var lesson pgtype.Varchar
+
+		if err := rows.Scan(&m.Id, &m.Token, &m.Status, &m.Scheduled, &m.Tutor, &m.Student, &m.Subject, &period, &lesson); err != nil {
+			return nil, err
+		}
+
+		period.Upper.AssignTo(&m.EndTime)
+		period.Lower.AssignTo(&m.StartTime)
+		lesson.AssignTo(&m.Lesson)
+
+		matches = append(matches, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/pborman/uuid"
+)
+
+// Type mirror for an on-demand match session. Each tutor offer within the session is a row in matchings sharing the token
+// Status is one of SEARCHING, OFFERED, ACCEPTED, EXHAUSTED or CANCELLED
+type MatchSession struct {
+	Token      string
+	Student    string
+	Subject    string
+	Status     string
+	Candidates []string
+	Offered    int
+	Parallel   int
+	Round      int
+	Lesson     string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// Creates a new on-demand match session in the SEARCHING state
+// Takes the student UUID, subject UUID, the ordered list of candidate tutor UUIDs and how many tutors to offer to at once
+func (r *Repository) CreateMatchSession(sid string, subid string, candidates []string, parallel int) (MatchSession, error) {
+	var ms MatchSession
+
+	ms.Token = uuid.New()
+	ms.Student = sid
+	ms.Subject = subid
+	ms.Status = "SEARCHING"
+	ms.Candidates = candidates
+	ms.Offered = 0
+	ms.Parallel = parallel
+	ms.Round = 0
+	ms.Created = time.Now()
+	ms.Updated = ms.Created
+
+	if ms.Candidates == nil {
+		ms.Candidates = []string{}
+	}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return ms, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO match_sessions (token, student, subject, status, candidates, offered, parallel, round, created, updated) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err = tx.Exec(context.Background(), sql, ms.Token, ms.Student, ms.Subject, ms.Status, ms.Candidates, ms.Offered, ms.Parallel, ms.Round, ms.Created, ms.Updated)
+
+	if err != nil {
+		return ms, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return ms, err
+	}
+
+	return ms, nil
+}
+
+// Gets the match session by its token
+func (r *Repository) GetMatchSession(token string) (MatchSession, error) {
+	sql := `SELECT token, student, subject, status, candidates, offered, parallel, round, lesson, created, updated FROM match_sessions WHERE token = $1`
+
+	var ms MatchSession
+
+	// The lesson is NULL until the session is accepted
+	var lesson pgtype.Varchar
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, token).Scan(&ms.Token, &ms.Student, &ms.Subject, &ms.Status, &ms.Candidates, &ms.Offered, &ms.Parallel, &ms.Round, &lesson, &ms.Created, &ms.Updated); err != nil {
+		return ms, err
+	}
+
+	lesson.AssignTo(&ms.Lesson)
+	return ms, nil
+}
+
+// Moves the session into the next round of offers, recording how many candidates have been offered so far
+// Only succeeds if the session is still at the expected round, so a duplicate timer cannot advance it twice
+func (r *Repository) AdvanceMatchSession(token string, round int, offered int) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE match_sessions SET status = 'OFFERED', round = $2 + 1, offered = $3, updated = NOW() WHERE token = $1 AND round = $2 AND status IN ('SEARCHING', 'OFFERED')`
+	tag, err := tx.Exec(context.Background(), sql, token, round, offered)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Transitions the session to a new status, but only if it is currently in one of the from statuses
+// Returns whether the transition happened
+func (r *Repository) TransitionMatchSession(token string, from []string, to string) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE match_sessions SET status = $2, updated = NOW() WHERE token = $1 AND status = ANY($3)`
+	tag, err := tx.Exec(context.Background(), sql, token, to, from)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Atomically accepts a single on-demand offer on behalf of its tutor and books its lesson, first accept wins
+// The offer must still be MATCHING and its session still OFFERED, otherwise nothing changes and false is returned
+// If the lesson cannot be booked, ErrSlotTaken included, the offer and its session are left as they were
+func (r *Repository) AcceptMatchSession(m Match, subject Subject, startTime time.Time, endTime time.Time, audit *Audit) (Lesson, bool, error) {
+	l := newLesson(subject, m.Tutor, m.Student, false, startTime, endTime)
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return l, false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	// Lock the session row first so concurrent accepts within the same session serialise here
+	sql := `UPDATE match_sessions SET status = 'ACCEPTED', updated = NOW() WHERE token = $1 AND status = 'OFFERED'`
+	tag, err := tx.Exec(context.Background(), sql, m.Token)
+	if err != nil {
+		return l, false, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return l, false, nil
+	}
+
+	sql = `UPDATE matchings SET status = 'MATCHED', response = 'ACCEPTED', responded = NOW() WHERE id = $1 AND token = $2 AND status = 'MATCHING'`
+	tag, err = tx.Exec(context.Background(), sql, m.Id, m.Token)
+	if err != nil {
+		return l, false, err
+	}
+
+	// The offer itself already expired, so the session stays as it was
+	if tag.RowsAffected() != 1 {
+		return l, false, nil
+	}
+
+	if err = insertLesson(tx, l); err != nil {
+		return l, false, err
+	}
+
+	sql = `UPDATE matchings SET lesson = $2 WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), sql, m.Id, l.Id); err != nil {
+		return l, false, err
+	}
+
+	sql = `UPDATE match_sessions SET lesson = $2 WHERE token = $1`
+	if _, err = tx.Exec(context.Background(), sql, m.Token, l.Id); err != nil {
+		return l, false, err
+	}
+
+	if err = recordResponses(tx, []string{m.Id}); err != nil {
+		return l, false, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return l, false, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return l, false, err
+	}
+
+	return l, true, nil
+}
+
+// Fails all the outstanding offers of a session, recording the response of their tutors, and returns the tutor UUIDs whose offers were failed
+// Offers which timed out were IGNORED, those which lost to another tutor or were cancelled by the student were WITHDRAWN
+func (r *Repository) FailPendingMatches(token string, response string) ([]string, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE matchings SET status = 'FAILED', response = $2, responded = NOW() WHERE token = $1 AND status = 'MATCHING' RETURNING id, tutor`
+
+	var mids []string
+	var tids []string
+
+	rows, err := tx.Query(context.Background(), sql, token, response)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var mid, tid string
+		if err := rows.Scan(&mid, &tid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		mids = append(mids, mid)
+		tids = append(tids, tid)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = recordResponses(tx, mids); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return tids, nil
+}
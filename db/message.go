@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for a chat message sent in a conversation
+// Message is the text of TEXT messages, the LaTeX source of MATH messages, and the optional caption of the others. Lesson is only set on LESSON cards
+// Edited is when the message was last edited, deleted messages are tombstones which keep their kind but lose their content
+type Message struct {
+	Id           string
+	Conversation string
+	From         string
+	To           string
+	Kind         string
+	Message      string
+	Attachment   *MessageAttachment
+	Lesson       string
+	Created      time.Time
+	Edited       *time.Time
+	Deleted      *time.Time
+}
+
+// Type mirror for a file or image sent in a message, its content lives in the blob store under the storage key
+// Images also have a thumbnail and their size in pixels, which are empty for other files
+type MessageAttachment struct {
+	Id           string
+	Message      string
+	Conversation string
+	Name         string
+	ContentType  string
+	Size         int64
+	StorageKey   string
+	ThumbnailKey string
+	Width        *int
+	Height       *int
+	Created      time.Time
+}
+
+// Convert a db.Message to a model.Message, attachments are downloaded from attachmentPath followed by their id
+// The lesson of a card only carries its id, the rest of it is resolved separately
+func (r *Repository) ToMessageModel(m Message, attachmentPath string) model.Message {
+	mm := model.Message{ID: m.Id, Conversation: m.Conversation, To: m.To, From: m.From, Timestamp: m.Created, Kind: model.MessageKind(m.Kind), Message: m.Message, Edited: m.Edited, Deleted: m.Deleted}
+	if m.Attachment != nil {
+		ma := r.ToMessageAttachmentModel(*m.Attachment, attachmentPath+m.Attachment.Id)
+		mm.Attachment = &ma
+	}
+
+	if m.Lesson != "" {
+		mm.Lesson = &model.Lesson{ID: m.Lesson}
+	}
+
+	return mm
+}
+
+// Convert a db.MessageAttachment to a model.MessageAttachment, url is where its content can be downloaded from and its thumbnail is under url/thumbnail
+func (r *Repository) ToMessageAttachmentModel(a MessageAttachment, url string) model.MessageAttachment {
+	ma := model.MessageAttachment{ID: a.Id, Name: a.Name, ContentType: a.ContentType, Size: int(a.Size), URL: url, Width: a.Width, Height: a.Height}
+	if a.ThumbnailKey != "" {
+		thumbnailUrl := url + "/thumbnail"
+		ma.ThumbnailURL = &thumbnailUrl
+	}
+
+	return ma
+}
+
+const messageColumns = `id, conversation, sender, recipient, kind, body, lesson, created, edited, deleted`
+const messageAttachmentColumns = `id, message, conversation, name, content_type, size, storage_key, thumbnail_key, width, height, created`
+
+// Stores a message sent in a conversation
+func (r *Repository) CreateMessage(m Message) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	if err = insertMessage(tx, m); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Stores a message sent in a conversation and records it there in the same transaction, see RecordMessage
+func (r *Repository) CreateRecordedMessage(m Message) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	if err = insertMessage(tx, m); err != nil {
+		return err
+	}
+
+	if err = recordMessage(tx, m); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func insertMessage(tx pgx.Tx, m Message) error {
+	sql := `INSERT INTO messages (id, conversation, sender, recipient, kind, body, lesson, created) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)`
+	if _, err := tx.Exec(context.Background(), sql, m.Id, m.Conversation, m.From, m.To, m.Kind, m.Message, m.Lesson, m.Created); err != nil {
+		return err
+	}
+
+	if a := m.Attachment; a != nil {
+		sql = `INSERT INTO message_attachments (` + messageAttachmentColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11)`
+		if _, err := tx.Exec(context.Background(), sql, a.Id, m.Id, m.Conversation, a.Name, a.ContentType, a.Size, a.StorageKey, a.ThumbnailKey, a.Width, a.Height, m.Created); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Gets the messages of a conversation newest first, continuing after the message with the given time and id unless the id is empty
+func (r *Repository) GetConversationMessages(cid string, afterCreated time.Time, afterId string, limit int) ([]Message, error) {
+	sql := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE conversation = $1 AND ($2 = '' OR created < $3 OR (created = $3 AND id > $2))
+	ORDER BY created DESC, id
+	LIMIT $4`
+
+	messages := []Message{}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, cid, afterId, afterCreated, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return r.withAttachments(messages)
+}
+
+// Get a message of a conversation based on its UUID
+func (r *Repository) GetMessage(cid string, mid string) (Message, error) {
+	sql := `SELECT ` + messageColumns + ` FROM messages WHERE conversation = $1 AND id = $2`
+
+	m, err := scanMessage(r.dbPool.QueryRow(context.Background(), sql, cid, mid))
+	if err != nil {
+		return m, err
+	}
+
+	messages, err := r.withAttachments([]Message{m})
+	if err != nil {
+		return m, err
+	}
+
+	return messages[0], nil
+}
+
+func scanMessage(row pgx.Row) (Message, error) {
+	var m Message
+
+	// To handle possible null values
+	var lesson pgtype.Varchar
+
+	if err := row.Scan(&m.Id, &m.Conversation, &m.From, &m.To, &m.Kind, &m.Message, &lesson, &m.Created, &m.Edited, &m.Deleted); err != nil {
+		return m, err
+	}
+
+	lesson.AssignTo(&m.Lesson)
+	return m, nil
+}
+
+// Fills in the attachments of file and image messages
+func (r *Repository) withAttachments(messages []Message) ([]Message, error) {
+	mids := []string{}
+	for _, m := range messages {
+		if m.Kind == string(model.MessageKindImage) || m.Kind == string(model.MessageKindFile) {
+			mids = append(mids, m.Id)
+		}
+	}
+
+	if len(mids) == 0 {
+		return messages, nil
+	}
+
+	attachments, err := r.getMessageAttachments(mids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range messages {
+		if a, ok := attachments[messages[i].Id]; ok {
+			messages[i].Attachment = &a
+		}
+	}
+
+	return messages, nil
+}
+
+// Get a message attachment based on its UUID
+func (r *Repository) GetMessageAttachmentById(aid string) (MessageAttachment, error) {
+	sql := `SELECT ` + messageAttachmentColumns + ` FROM message_attachments WHERE id = $1`
+
+	return scanMessageAttachment(r.dbPool.QueryRow(context.Background(), sql, aid))
+}
+
+// Gets the attachments of several messages at once, by message
+func (r *Repository) getMessageAttachments(mids []string) (map[string]MessageAttachment, error) {
+	sql := `SELECT ` + messageAttachmentColumns + ` FROM message_attachments WHERE message = ANY($1)`
+
+	attachments := map[string]MessageAttachment{}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, mids)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanMessageAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments[a.Message] = a
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+func scanMessageAttachment(row pgx.Row) (MessageAttachment, error) {
+	var a MessageAttachment
+
+	// To handle possible null values
+	var thumbnailKey pgtype.Text
+
+	if err := row.Scan(&a.Id, &a.Message, &a.Conversation, &a.Name, &a.ContentType, &a.Size, &a.StorageKey, &thumbnailKey, &a.Width, &a.Height, &a.Created); err != nil {
+		return a, err
+	}
+
+	thumbnailKey.AssignTo(&a.ThumbnailKey)
+	return a, nil
+}
+
+// Stores text messages copied from another store, skipping those which were already copied
+// The conversations they belong to are then brought up to date with their last message, and their participants are considered to have read the copied messages
+// Returns how many messages were new
+func (r *Repository) ImportMessages(messages []Message) (int, error) {
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	ids, cids, senders, recipients, bodies, created := []string{}, []string{}, []string{}, []string{}, []string{}, []time.Time{}
+	for _, m := range messages {
+		ids = append(ids, m.Id)
+		cids = append(cids, m.Conversation)
+		senders = append(senders, m.From)
+		recipients = append(recipients, m.To)
+		bodies = append(bodies, m.Message)
+		created = append(created, m.Created)
+	}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `
+	INSERT INTO messages (id, conversation, sender, recipient, body, created)
+	SELECT * FROM UNNEST($1::VARCHAR[], $2::VARCHAR[], $3::VARCHAR[], $4::VARCHAR[], $5::TEXT[], $6::TIMESTAMPTZ[])
+	ON CONFLICT (id) DO NOTHING`
+	tag, err := tx.Exec(context.Background(), sql, ids, cids, senders, recipients, bodies, created)
+	if err != nil {
+		return 0, err
+	}
+
+	sql = `
+	UPDATE conversations SET messages = s.messages, last_message_id = s.id, last_message_kind = s.kind, last_message = s.body, last_sender = s.sender, last_message_at = s.created, last_message_deleted = s.deleted
+	FROM (
+		SELECT DISTINCT ON (conversation) conversation, COUNT(*) OVER (PARTITION BY conversation) AS messages, id, kind, body, sender, created, deleted
+		FROM messages WHERE conversation = ANY($1)
+		ORDER BY conversation, created DESC, id
+	) AS s
+	WHERE conversations.id = s.conversation`
+	if _, err = tx.Exec(context.Background(), sql, cids); err != nil {
+		return 0, err
+	}
+
+	sql = `
+	UPDATE conversation_participants SET last_read = GREATEST(conversation_participants.last_read, s.created)
+	FROM (SELECT conversation, MAX(created) AS created FROM UNNEST($1::VARCHAR[], $2::TIMESTAMPTZ[]) AS imported (conversation, created) GROUP BY conversation) AS s
+	WHERE conversation_participants.conversation = s.conversation`
+	if _, err = tx.Exec(context.Background(), sql, cids, created); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for a previous version of an edited message, Edited is when it was replaced
+type MessageEdit struct {
+	Message string
+	Body    string
+	Edited  time.Time
+}
+
+// Convert a db.MessageEdit to a model.MessageEdit
+func (r *Repository) ToMessageEditModel(e MessageEdit) model.MessageEdit {
+	return model.MessageEdit{Message: e.Body, Edited: e.Edited}
+}
+
+// Replaces the text of a message, keeping the text it replaces in its edit history
+// Returns false if the message was deleted, in which case nothing changes
+func (r *Repository) EditMessage(mid string, body string, at time.Time) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	// Lock the message, so a delete either went first and is seen here or waits until the edit is done
+	var previous string
+
+	sql := `SELECT body FROM messages WHERE id = $1 AND deleted IS NULL FOR UPDATE`
+	err = tx.QueryRow(context.Background(), sql, mid).Scan(&previous)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	sql = `INSERT INTO message_edits (message, body, edited) VALUES ($1, $2, $3)`
+	if _, err = tx.Exec(context.Background(), sql, mid, previous, at); err != nil {
+		return false, err
+	}
+
+	sql = `UPDATE messages SET body = $2, edited = $3 WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), sql, mid, body, at); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Deletes the content of a message along with its edit history, leaving a tombstone in its place
+// Returns the attachment the message had, whose content has to be removed from the blob store separately, and false if it was already deleted
+func (r *Repository) DeleteMessage(mid string, at time.Time) (*MessageAttachment, bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	// Tombstone the message first, which waits for any edit in progress so its history is removed below
+	sql := `UPDATE messages SET body = '', lesson = NULL, deleted = $2 WHERE id = $1 AND deleted IS NULL`
+	tag, err := tx.Exec(context.Background(), sql, mid, at)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return nil, false, nil
+	}
+
+	var attachment *MessageAttachment
+
+	sql = `DELETE FROM message_attachments WHERE message = $1 RETURNING ` + messageAttachmentColumns
+	a, err := scanMessageAttachment(tx.QueryRow(context.Background(), sql, mid))
+	if err == nil {
+		attachment = &a
+	} else if err != pgx.ErrNoRows {
+		return nil, false, err
+	}
+
+	sql = `DELETE FROM message_edits WHERE message = $1`
+	if _, err = tx.Exec(context.Background(), sql, mid); err != nil {
+		return nil, false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return nil, false, err
+	}
+
+	return attachment, true, nil
+}
+
+// Gets the previous versions of a message, oldest first
+func (r *Repository) GetMessageEdits(mid string) ([]MessageEdit, error) {
+	sql := `SELECT message, body, edited FROM message_edits WHERE message = $1 ORDER BY edited`
+
+	edits := []MessageEdit{}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var e MessageEdit
+
+		if err := rows.Scan(&e.Message, &e.Body, &e.Edited); err != nil {
+			return nil, err
+		}
+
+		edits = append(edits, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return edits, nil
+}
+
+// Removes up to limit of the messages sent before a time, oldest first, along with their edit history and attachments
+// Archived messages are copied to archived_messages first and keep the content of their attachments, the attachments of purged messages are returned so their content can be removed from the blob store
+// Returns how many messages were removed
+func (r *Repository) ExpireMessages(before time.Time, archive bool, limit int) (int, []MessageAttachment, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `SELECT id FROM messages WHERE created < $1 ORDER BY created LIMIT $2 FOR UPDATE`
+
+	var mids []string
+
+	rows, err := tx.Query(context.Background(), sql, before, limit)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for rows.Next() {
+		var mid string
+		if err := rows.Scan(&mid); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+
+		mids = append(mids, mid)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if len(mids) == 0 {
+		return 0, nil, nil
+	}
+
+	attachments := []MessageAttachment{}
+
+	if archive {
+		sql = `
+		INSERT INTO archived_messages (id, conversation, sender, recipient, kind, body, lesson, attachment_name, attachment_content_type, attachment_key, thumbnail_key, created, edited, deleted)
+		SELECT messages.id, messages.conversation, sender, recipient, kind, body, lesson, name, content_type, storage_key, thumbnail_key, messages.created, edited, deleted
+		FROM messages LEFT JOIN message_attachments ON message_attachments.message = messages.id
+		WHERE messages.id = ANY($1)
+		ON CONFLICT (id) DO NOTHING`
+		if _, err = tx.Exec(context.Background(), sql, mids); err != nil {
+			return 0, nil, err
+		}
+	} else {
+		sql = `SELECT ` + messageAttachmentColumns + ` FROM message_attachments WHERE message = ANY($1)`
+
+		rows, err := tx.Query(context.Background(), sql, mids)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		for rows.Next() {
+			a, err := scanMessageAttachment(rows)
+			if err != nil {
+				rows.Close()
+				return 0, nil, err
+			}
+
+			attachments = append(attachments, a)
+		}
+
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// Edit history and attachments go along with their messages
+	sql = `DELETE FROM messages WHERE id = ANY($1)`
+	tag, err := tx.Exec(context.Background(), sql, mids)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return 0, nil, err
+	}
+
+	return int(tag.RowsAffected()), attachments, nil
+}
+
+// Forgets the last message of conversations which were quiet since a time, once their messages have expired, along with which expired messages were recorded
+func (r *Repository) ExpireConversationSummaries(before time.Time) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `
+	UPDATE conversations SET last_message_id = NULL, last_message_kind = NULL, last_message = NULL, last_sender = NULL, last_message_at = NULL, last_message_deleted = NULL
+	WHERE last_message_at < $1`
+	if _, err = tx.Exec(context.Background(), sql, before); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM recorded_messages WHERE created < $1`
+	if _, err = tx.Exec(context.Background(), sql, before); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Brings the last message of a conversation up to date after it was edited or deleted, other messages leave the conversation untouched
+func (r *Repository) RecordMessageChange(m Message) error {
+	sql := `UPDATE conversations SET last_message = $3, last_message_deleted = $4 WHERE id = $1 AND last_message_id = $2`
+
+	_, err := r.dbPool.Exec(context.Background(), sql, m.Conversation, m.Id, m.Message, m.Deleted)
+	return err
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS jobs (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  kind TEXT NOT NULL,
+  payload JSONB NOT NULL DEFAULT '{}',
+  status TEXT NOT NULL DEFAULT 'PENDING',
+  due TIMESTAMPTZ NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  lease_owner TEXT,
+  lease_expires TIMESTAMPTZ,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (due) WHERE status = 'PENDING';
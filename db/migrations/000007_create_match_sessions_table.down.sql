@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS matchings_token_idx;
+DROP TABLE IF EXISTS match_sessions;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS match_sessions (
+  token VARCHAR(38) NOT NULL UNIQUE,
+  student VARCHAR(38) NOT NULL,
+  subject VARCHAR(38) NOT NULL,
+  status TEXT NOT NULL,
+  candidates VARCHAR(38) [] NOT NULL DEFAULT '{}',
+  offered INT NOT NULL DEFAULT 0,
+  parallel INT NOT NULL DEFAULT 1,
+  round INT NOT NULL DEFAULT 0,
+  lesson VARCHAR(38),
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(token),
+  CONSTRAINT fk_student
+    FOREIGN KEY(student)
+      REFERENCES students(id),
+  CONSTRAINT fk_subject
+    FOREIGN KEY(subject)
+      REFERENCES subjects(id),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+);
+
+CREATE INDEX IF NOT EXISTS matchings_token_idx ON matchings (token);
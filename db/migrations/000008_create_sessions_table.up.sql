@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  user_id VARCHAR(38) NOT NULL,
+  device_name TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires TIMESTAMPTZ NOT NULL,
+  revoked BOOL NOT NULL DEFAULT FALSE,
+  PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_idx ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  hash VARCHAR(64) NOT NULL UNIQUE,
+  session VARCHAR(38) NOT NULL,
+  used BOOL NOT NULL DEFAULT FALSE,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(hash),
+  CONSTRAINT fk_session
+    FOREIGN KEY(session)
+      REFERENCES sessions(id)
+      ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS auth_tokens;
+ALTER TABLE tutors DROP COLUMN IF EXISTS email_verified;
+ALTER TABLE students DROP COLUMN IF EXISTS email_verified;
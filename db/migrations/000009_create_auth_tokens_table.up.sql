@@ -0,0 +1,17 @@
+-- Accounts which predate email verification are grandfathered in as verified
+ALTER TABLE students ADD COLUMN IF NOT EXISTS email_verified BOOL NOT NULL DEFAULT TRUE;
+ALTER TABLE students ALTER COLUMN email_verified SET DEFAULT FALSE;
+ALTER TABLE tutors ADD COLUMN IF NOT EXISTS email_verified BOOL NOT NULL DEFAULT TRUE;
+ALTER TABLE tutors ALTER COLUMN email_verified SET DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS auth_tokens (
+  hash VARCHAR(64) NOT NULL UNIQUE,
+  user_id VARCHAR(38) NOT NULL,
+  purpose TEXT NOT NULL,
+  used BOOL NOT NULL DEFAULT FALSE,
+  expires TIMESTAMPTZ NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(hash)
+);
+
+CREATE INDEX IF NOT EXISTS auth_tokens_user_idx ON auth_tokens (user_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS admins (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  username TEXT NOT NULL UNIQUE,
+  email VARCHAR(127) NOT NULL UNIQUE,
+  hashed_password TEXT NOT NULL,
+  scopes TEXT [] NOT NULL DEFAULT '{}',
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE tutors DROP COLUMN IF EXISTS suspended;
+ALTER TABLE students DROP COLUMN IF EXISTS suspended;
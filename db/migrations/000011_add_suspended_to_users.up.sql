@@ -0,0 +1,2 @@
+ALTER TABLE students ADD COLUMN IF NOT EXISTS suspended BOOL NOT NULL DEFAULT FALSE;
+ALTER TABLE tutors ADD COLUMN IF NOT EXISTS suspended BOOL NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE lessons ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'SCHEDULED';
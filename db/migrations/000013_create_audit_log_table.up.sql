@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  actor VARCHAR(38) NOT NULL,
+  action TEXT NOT NULL,
+  target VARCHAR(38) NOT NULL,
+  before JSONB,
+  after JSONB,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_actor
+    FOREIGN KEY(actor)
+      REFERENCES admins(id)
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log (target, created);
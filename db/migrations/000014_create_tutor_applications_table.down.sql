@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS application_reviews;
+DROP TABLE IF EXISTS tutor_documents;
+ALTER TABLE tutors DROP COLUMN IF EXISTS application_status;
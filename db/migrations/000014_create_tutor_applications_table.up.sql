@@ -0,0 +1,41 @@
+-- Tutors who signed up before onboarding existed were already being matched, so they start out approved
+ALTER TABLE tutors ADD COLUMN IF NOT EXISTS application_status TEXT NOT NULL DEFAULT 'APPROVED';
+ALTER TABLE tutors ALTER COLUMN application_status SET DEFAULT 'APPLIED';
+
+CREATE TABLE IF NOT EXISTS tutor_documents (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  tutor VARCHAR(38) NOT NULL,
+  kind TEXT NOT NULL,
+  name TEXT NOT NULL,
+  url TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size INT NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tutor_documents_tutor_idx ON tutor_documents (tutor);
+
+CREATE TABLE IF NOT EXISTS application_reviews (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  tutor VARCHAR(38) NOT NULL,
+  reviewer VARCHAR(38),
+  from_status TEXT NOT NULL,
+  to_status TEXT NOT NULL,
+  notes TEXT,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id)
+      ON DELETE CASCADE,
+  CONSTRAINT fk_reviewer
+    FOREIGN KEY(reviewer)
+      REFERENCES admins(id)
+);
+
+CREATE INDEX IF NOT EXISTS application_reviews_tutor_idx ON application_reviews (tutor, created);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS lessons_period_idx;
+DROP INDEX IF EXISTS lessons_tutor_idx;
+DROP INDEX IF EXISTS availabilities_period_idx;
+DROP INDEX IF EXISTS availabilities_tutor_idx;
+DROP INDEX IF EXISTS affinity_student_idx;
+DROP INDEX IF EXISTS teaching_subject_idx;
+DROP INDEX IF EXISTS tutors_hourly_rate_idx;
+DROP INDEX IF EXISTS tutors_rating_idx;
+DROP INDEX IF EXISTS tutors_search_idx;
+DROP FUNCTION IF EXISTS tutor_search_document;
@@ -0,0 +1,14 @@
+-- The document searched by the free text filter of searchTutors, wrapped in a function so that it can be indexed
+CREATE OR REPLACE FUNCTION tutor_search_document(bio TEXT, education TEXT[]) RETURNS TSVECTOR AS $$
+  SELECT to_tsvector('english', bio || ' ' || array_to_string(education, ' '))
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS tutors_search_idx ON tutors USING GIN (tutor_search_document(bio, education));
+CREATE INDEX IF NOT EXISTS tutors_rating_idx ON tutors (rating DESC, id);
+CREATE INDEX IF NOT EXISTS tutors_hourly_rate_idx ON tutors (hourly_rate, id);
+CREATE INDEX IF NOT EXISTS teaching_subject_idx ON teaching (subject, tutor);
+CREATE INDEX IF NOT EXISTS affinity_student_idx ON affinity (student, subject, tutor);
+CREATE INDEX IF NOT EXISTS availabilities_tutor_idx ON availabilities (tutor);
+CREATE INDEX IF NOT EXISTS availabilities_period_idx ON availabilities USING GIST (period);
+CREATE INDEX IF NOT EXISTS lessons_tutor_idx ON lessons (tutor);
+CREATE INDEX IF NOT EXISTS lessons_period_idx ON lessons USING GIST (period);
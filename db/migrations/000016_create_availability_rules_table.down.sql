@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS tutor_available;
+DROP FUNCTION IF EXISTS tutor_windows;
+DROP TABLE IF EXISTS availability_exceptions;
+DROP TABLE IF EXISTS availability_rules;
+ALTER TABLE tutors DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,60 @@
+ALTER TABLE tutors ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- Weekly recurring availability, in minutes since midnight of the weekday (0 is Sunday) in the tutor's timezone
+CREATE TABLE IF NOT EXISTS availability_rules (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  tutor VARCHAR(38) NOT NULL,
+  weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+  start_minute INT NOT NULL CHECK (start_minute >= 0),
+  end_minute INT NOT NULL CHECK (end_minute <= 1440 AND end_minute > start_minute),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS availability_rules_tutor_idx ON availability_rules (tutor);
+
+-- One-off periods, such as holidays, in which a tutor is unavailable regardless of their rules and windows
+CREATE TABLE IF NOT EXISTS availability_exceptions (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  tutor VARCHAR(38) NOT NULL,
+  period TSTZRANGE NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY(id),
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS availability_exceptions_tutor_idx ON availability_exceptions (tutor);
+
+-- Expands the weekly rules of a tutor into concrete windows overlapping a range, along with their one-off windows
+-- Rules are expanded in the tutor's timezone, so windows keep their local time across daylight saving changes
+CREATE OR REPLACE FUNCTION tutor_windows(tid VARCHAR, range_start TIMESTAMPTZ, range_end TIMESTAMPTZ) RETURNS TABLE (period TSTZRANGE) AS $$
+  SELECT windows.period FROM (
+    SELECT tstzrange(
+      (day::DATE + availability_rules.start_minute * INTERVAL '1 minute') AT TIME ZONE tutors.timezone,
+      (day::DATE + availability_rules.end_minute * INTERVAL '1 minute') AT TIME ZONE tutors.timezone,
+      '(]') AS period
+    FROM tutors
+    INNER JOIN availability_rules ON availability_rules.tutor = tutors.id
+    CROSS JOIN LATERAL generate_series(
+      ((range_start AT TIME ZONE tutors.timezone)::DATE - 1)::TIMESTAMP,
+      ((range_end AT TIME ZONE tutors.timezone)::DATE)::TIMESTAMP,
+      INTERVAL '1 day') AS day
+    WHERE tutors.id = tid AND EXTRACT(DOW FROM day) = availability_rules.weekday
+    UNION ALL
+    SELECT availabilities.period FROM availabilities WHERE availabilities.tutor = tid
+  ) AS windows
+  WHERE windows.period && tstzrange(range_start, range_end, '[]')
+$$ LANGUAGE SQL STABLE;
+
+-- Whether a tutor is available for the whole of a period, that is one of their windows covers it and no exception overlaps it
+CREATE OR REPLACE FUNCTION tutor_available(tid VARCHAR, requested TSTZRANGE) RETURNS BOOLEAN AS $$
+  SELECT
+    EXISTS (SELECT 1 FROM tutor_windows(tid, lower(requested), upper(requested)) AS windows WHERE windows.period @> requested) AND
+    NOT EXISTS (SELECT 1 FROM availability_exceptions WHERE availability_exceptions.tutor = tid AND availability_exceptions.period && requested)
+$$ LANGUAGE SQL STABLE;
@@ -0,0 +1,2 @@
+ALTER TABLE lessons DROP CONSTRAINT IF EXISTS lessons_student_no_overlap;
+ALTER TABLE lessons DROP CONSTRAINT IF EXISTS lessons_tutor_no_overlap;
@@ -0,0 +1,7 @@
+-- Needed to combine equality on the tutor and student ids with range overlap in a single GiST index
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- Tutors and students can only be in one lesson at a time, cancelled lessons free the slot up again
+-- Adding the constraints fails if overlapping lessons were already booked, those have to be cancelled by hand first
+ALTER TABLE lessons ADD CONSTRAINT lessons_tutor_no_overlap EXCLUDE USING GIST (tutor WITH =, period WITH &&) WHERE (status <> 'CANCELLED');
+ALTER TABLE lessons ADD CONSTRAINT lessons_student_no_overlap EXCLUDE USING GIST (student WITH =, period WITH &&) WHERE (status <> 'CANCELLED');
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS lesson_cancellations;
+DROP TABLE IF EXISTS lesson_reschedules;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS lesson_reschedules (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  lesson VARCHAR(38) NOT NULL,
+  requested_by VARCHAR(38) NOT NULL,
+  period TSTZRANGE NOT NULL,
+  status TEXT NOT NULL DEFAULT 'PENDING',
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  responded TIMESTAMPTZ,
+  PRIMARY KEY(id),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS lesson_reschedules_lesson_idx ON lesson_reschedules (lesson, created);
+
+-- Only one reschedule of a lesson can be waiting for an answer at a time
+CREATE UNIQUE INDEX IF NOT EXISTS lesson_reschedules_pending_idx ON lesson_reschedules (lesson) WHERE status = 'PENDING';
+
+CREATE TABLE IF NOT EXISTS lesson_cancellations (
+  lesson VARCHAR(38) NOT NULL UNIQUE,
+  cancelled_by VARCHAR(38) NOT NULL,
+  reason TEXT NOT NULL,
+  late BOOLEAN NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(lesson),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS lesson_charges;
+DROP TABLE IF EXISTS lesson_attendance;
+DROP TABLE IF EXISTS lesson_participants;
+DROP TABLE IF EXISTS lesson_rooms;
@@ -0,0 +1,62 @@
+-- The video room of a lesson, started is when both the student and tutor had joined and ended is when the room was closed
+CREATE TABLE IF NOT EXISTS lesson_rooms (
+  lesson VARCHAR(38) NOT NULL UNIQUE,
+  room_sid TEXT,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  started TIMESTAMPTZ,
+  ended TIMESTAMPTZ,
+  PRIMARY KEY(lesson),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE
+);
+
+-- When each participant was last issued an access token for the room of a lesson
+CREATE TABLE IF NOT EXISTS lesson_participants (
+  lesson VARCHAR(38) NOT NULL,
+  participant VARCHAR(38) NOT NULL,
+  token_issued TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(lesson, participant),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE
+);
+
+-- Every connection of a participant to the room of a lesson, as reported by the Twilio status callbacks
+CREATE TABLE IF NOT EXISTS lesson_attendance (
+  participant_sid TEXT NOT NULL UNIQUE,
+  lesson VARCHAR(38) NOT NULL,
+  participant VARCHAR(38) NOT NULL,
+  joined TIMESTAMPTZ NOT NULL,
+  left_at TIMESTAMPTZ,
+  PRIMARY KEY(participant_sid),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS lesson_attendance_lesson_idx ON lesson_attendance (lesson, joined);
+
+-- What completed lessons are billed, the amount is in the same unit as the hourly rate of the tutor
+CREATE TABLE IF NOT EXISTS lesson_charges (
+  lesson VARCHAR(38) NOT NULL UNIQUE,
+  student VARCHAR(38) NOT NULL,
+  tutor VARCHAR(38) NOT NULL,
+  minutes INT NOT NULL,
+  hourly_rate INT NOT NULL,
+  amount INT NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(lesson),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id),
+  CONSTRAINT fk_student
+    FOREIGN KEY(student)
+      REFERENCES students(id),
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id)
+);
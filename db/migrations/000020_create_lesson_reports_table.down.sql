@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS lesson_attachments;
+DROP TABLE IF EXISTS lesson_notes;
+DROP TABLE IF EXISTS lesson_reports;
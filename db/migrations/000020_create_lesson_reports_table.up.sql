@@ -0,0 +1,54 @@
+-- The report a tutor writes after a lesson, students only see it once it is published
+CREATE TABLE IF NOT EXISTS lesson_reports (
+  lesson VARCHAR(38) NOT NULL UNIQUE,
+  tutor VARCHAR(38) NOT NULL,
+  topics TEXT[] NOT NULL DEFAULT '{}',
+  summary TEXT NOT NULL DEFAULT '',
+  homework TEXT NOT NULL DEFAULT '',
+  follow_up TEXT NOT NULL DEFAULT '',
+  published TIMESTAMPTZ,
+  updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(lesson),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE,
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id)
+);
+
+-- Notes the student or tutor of a lesson keep for themselves, only their author can see them
+CREATE TABLE IF NOT EXISTS lesson_notes (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  lesson VARCHAR(38) NOT NULL,
+  author VARCHAR(38) NOT NULL,
+  body TEXT NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS lesson_notes_lesson_idx ON lesson_notes (lesson, author, created);
+
+-- Files shared on a lesson such as homework, the content lives in the blob store under storage_key
+CREATE TABLE IF NOT EXISTS lesson_attachments (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  lesson VARCHAR(38) NOT NULL,
+  uploaded_by VARCHAR(38) NOT NULL,
+  name TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  storage_key TEXT NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS lesson_attachments_lesson_idx ON lesson_attachments (lesson, created);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS review_flags;
+DROP TABLE IF EXISTS reviews;
+
+ALTER TABLE tutors DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE tutors DROP COLUMN IF EXISTS rating_score;
@@ -0,0 +1,52 @@
+-- The Bayesian average of the visible reviews of each tutor, rating keeps it rounded to whole stars for filtering and sorting
+ALTER TABLE tutors ADD COLUMN IF NOT EXISTS rating_score DOUBLE PRECISION NOT NULL DEFAULT 3;
+ALTER TABLE tutors ADD COLUMN IF NOT EXISTS rating_count INT NOT NULL DEFAULT 0;
+
+UPDATE tutors SET rating_score = rating;
+
+-- A review a student left on a completed lesson, one per lesson. Hidden reviews were taken down by moderation and do not count towards the rating of the tutor
+CREATE TABLE IF NOT EXISTS reviews (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  lesson VARCHAR(38) NOT NULL UNIQUE,
+  student VARCHAR(38) NOT NULL,
+  tutor VARCHAR(38) NOT NULL,
+  subject VARCHAR(38) NOT NULL,
+  rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+  body TEXT NOT NULL,
+  reply TEXT,
+  replied TIMESTAMPTZ,
+  hidden BOOLEAN NOT NULL DEFAULT FALSE,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_lesson
+    FOREIGN KEY(lesson)
+      REFERENCES lessons(id)
+      ON DELETE CASCADE,
+  CONSTRAINT fk_student
+    FOREIGN KEY(student)
+      REFERENCES students(id),
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id),
+  CONSTRAINT fk_subject
+    FOREIGN KEY(subject)
+      REFERENCES subjects(id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_tutor_idx ON reviews (tutor, created DESC, id);
+
+-- Reports of inappropriate reviews, resolved once an admin has moderated the review
+CREATE TABLE IF NOT EXISTS review_flags (
+  review VARCHAR(38) NOT NULL,
+  flagged_by VARCHAR(38) NOT NULL,
+  reason TEXT NOT NULL,
+  resolved BOOLEAN NOT NULL DEFAULT FALSE,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(review, flagged_by),
+  CONSTRAINT fk_review
+    FOREIGN KEY(review)
+      REFERENCES reviews(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS review_flags_open_idx ON review_flags (review) WHERE resolved = FALSE;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS matchings_tutor_idx;
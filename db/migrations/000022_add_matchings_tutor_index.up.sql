@@ -0,0 +1,2 @@
+-- Ranking looks up the recent offers of every candidate tutor
+CREATE INDEX IF NOT EXISTS matchings_tutor_idx ON matchings (tutor, lower(period));
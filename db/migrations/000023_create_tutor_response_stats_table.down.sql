@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS tutor_response_stats;
+
+ALTER TABLE matchings DROP COLUMN IF EXISTS responded;
+ALTER TABLE matchings DROP COLUMN IF EXISTS response;
+ALTER TABLE matchings DROP COLUMN IF EXISTS offered;
@@ -0,0 +1,31 @@
+-- When each match was offered to its tutor, and how they responded: ACCEPTED, DECLINED, IGNORED or WITHDRAWN when another tutor accepted first
+ALTER TABLE matchings ADD COLUMN IF NOT EXISTS offered TIMESTAMPTZ;
+UPDATE matchings SET offered = LEAST(lower(period), NOW()) WHERE offered IS NULL;
+ALTER TABLE matchings ALTER COLUMN offered SET DEFAULT NOW(), ALTER COLUMN offered SET NOT NULL;
+
+ALTER TABLE matchings ADD COLUMN IF NOT EXISTS response TEXT;
+ALTER TABLE matchings ADD COLUMN IF NOT EXISTS responded TIMESTAMPTZ;
+UPDATE matchings SET response = 'ACCEPTED' WHERE status = 'MATCHED' AND response IS NULL;
+
+-- How tutors respond to the matches offered to them, maintained as matches are offered and answered
+-- Only the most recent accept latencies, in seconds, are kept for the median
+CREATE TABLE IF NOT EXISTS tutor_response_stats (
+  tutor VARCHAR(38) NOT NULL UNIQUE,
+  offers INT NOT NULL DEFAULT 0,
+  accepted INT NOT NULL DEFAULT 0,
+  declined INT NOT NULL DEFAULT 0,
+  ignored INT NOT NULL DEFAULT 0,
+  consecutive_ignored INT NOT NULL DEFAULT 0,
+  last_ignored TIMESTAMPTZ,
+  accept_latencies INT[] NOT NULL DEFAULT '{}',
+  updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(tutor),
+  CONSTRAINT fk_tutor
+    FOREIGN KEY(tutor)
+      REFERENCES tutors(id)
+      ON DELETE CASCADE
+);
+
+INSERT INTO tutor_response_stats (tutor, offers, accepted)
+SELECT tutor, COUNT(*), COUNT(*) FILTER (WHERE status = 'MATCHED') FROM matchings WHERE tutor IS NOT NULL GROUP BY tutor
+ON CONFLICT (tutor) DO NOTHING;
@@ -0,0 +1,30 @@
+-- A conversation between two users, who are stored in order so that each pair has a single conversation
+-- The last message is kept alongside for listing conversations without going through the chat history
+CREATE TABLE IF NOT EXISTS conversations (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  user_a VARCHAR(38) NOT NULL,
+  user_b VARCHAR(38) NOT NULL,
+  messages INT NOT NULL DEFAULT 0,
+  last_message TEXT,
+  last_sender VARCHAR(38),
+  last_message_at TIMESTAMPTZ,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  UNIQUE(user_a, user_b),
+  CHECK (user_a < user_b)
+);
+
+-- How far each participant has read a conversation, and how many messages arrived since
+CREATE TABLE IF NOT EXISTS conversation_participants (
+  conversation VARCHAR(38) NOT NULL,
+  participant VARCHAR(38) NOT NULL,
+  last_read TIMESTAMPTZ,
+  unread INT NOT NULL DEFAULT 0,
+  PRIMARY KEY(conversation, participant),
+  CONSTRAINT fk_conversation
+    FOREIGN KEY(conversation)
+      REFERENCES conversations(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS conversation_participants_participant_idx ON conversation_participants (participant);
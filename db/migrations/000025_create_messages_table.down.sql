@@ -0,0 +1,3 @@
+ALTER TABLE conversations DROP COLUMN IF EXISTS last_message_id;
+
+DROP TABLE IF EXISTS messages;
@@ -0,0 +1,19 @@
+-- Chat messages, previously kept in InfluxDB. Messages imported from there have ids derived from their sender, recipient and time
+CREATE TABLE IF NOT EXISTS messages (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  conversation VARCHAR(38) NOT NULL,
+  sender VARCHAR(38) NOT NULL,
+  recipient VARCHAR(38) NOT NULL,
+  body TEXT NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_conversation
+    FOREIGN KEY(conversation)
+      REFERENCES conversations(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS messages_conversation_idx ON messages (conversation, created DESC, id);
+CREATE INDEX IF NOT EXISTS messages_created_idx ON messages (created);
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_message_id VARCHAR(38);
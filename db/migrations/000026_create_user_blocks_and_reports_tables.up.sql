@@ -0,0 +1,31 @@
+-- Users who blocked each other cannot exchange messages, in either direction
+CREATE TABLE IF NOT EXISTS user_blocks (
+  blocker VARCHAR(38) NOT NULL,
+  blocked VARCHAR(38) NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(blocker, blocked)
+);
+
+CREATE INDEX IF NOT EXISTS user_blocks_blocked_idx ON user_blocks (blocked);
+
+-- Reports of users misbehaving in chat, along with the conversation they happened in. Resolved once an admin has looked into them
+CREATE TABLE IF NOT EXISTS user_reports (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  reporter VARCHAR(38) NOT NULL,
+  reported VARCHAR(38) NOT NULL,
+  conversation VARCHAR(38),
+  reason TEXT NOT NULL,
+  resolved BOOLEAN NOT NULL DEFAULT FALSE,
+  resolved_by VARCHAR(38),
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_conversation
+    FOREIGN KEY(conversation)
+      REFERENCES conversations(id)
+      ON DELETE SET NULL,
+  CONSTRAINT fk_resolved_by
+    FOREIGN KEY(resolved_by)
+      REFERENCES admins(id)
+);
+
+CREATE INDEX IF NOT EXISTS user_reports_resolved_idx ON user_reports (resolved, created);
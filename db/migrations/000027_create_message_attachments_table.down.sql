@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS message_attachments;
+
+ALTER TABLE conversations DROP COLUMN IF EXISTS last_message_kind;
+
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_lesson;
+ALTER TABLE messages DROP COLUMN IF EXISTS lesson;
+ALTER TABLE messages DROP COLUMN IF EXISTS kind;
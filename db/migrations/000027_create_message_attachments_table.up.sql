@@ -0,0 +1,33 @@
+-- Messages carry typed content, TEXT and MATH keep their content in body, which is the caption of IMAGE and FILE messages and the comment of LESSON cards
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS kind VARCHAR(8) NOT NULL DEFAULT 'TEXT';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS lesson VARCHAR(38);
+ALTER TABLE messages ADD CONSTRAINT fk_lesson FOREIGN KEY(lesson) REFERENCES lessons(id) ON DELETE SET NULL;
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_message_kind VARCHAR(8);
+UPDATE conversations SET last_message_kind = 'TEXT' WHERE last_message_id IS NOT NULL;
+
+-- Files and images sent in chat, the content lives in the blob store under storage_key and the thumbnail of images under thumbnail_key
+CREATE TABLE IF NOT EXISTS message_attachments (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  message VARCHAR(38) NOT NULL UNIQUE,
+  conversation VARCHAR(38) NOT NULL,
+  name TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  storage_key TEXT NOT NULL,
+  thumbnail_key TEXT,
+  width INTEGER,
+  height INTEGER,
+  created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id),
+  CONSTRAINT fk_message
+    FOREIGN KEY(message)
+      REFERENCES messages(id)
+      ON DELETE CASCADE,
+  CONSTRAINT fk_conversation
+    FOREIGN KEY(conversation)
+      REFERENCES conversations(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS message_attachments_conversation_idx ON message_attachments (conversation, created);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS archived_messages;
+
+DROP TABLE IF EXISTS message_edits;
+
+ALTER TABLE conversations DROP COLUMN IF EXISTS last_message_deleted;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted;
+ALTER TABLE messages DROP COLUMN IF EXISTS edited;
@@ -0,0 +1,40 @@
+-- Messages can be edited, keeping what they said before, and deleted for everyone, leaving a tombstone without content
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted TIMESTAMPTZ;
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_message_deleted TIMESTAMPTZ;
+
+-- Previous versions of edited messages, edited is when the version was replaced
+CREATE TABLE IF NOT EXISTS message_edits (
+  message VARCHAR(38) NOT NULL,
+  body TEXT NOT NULL,
+  edited TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT fk_message
+    FOREIGN KEY(message)
+      REFERENCES messages(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS message_edits_message_idx ON message_edits (message, edited);
+
+-- Messages moved out of chat by the retention job when it archives rather than purges, along with where the content of their attachment is kept
+CREATE TABLE IF NOT EXISTS archived_messages (
+  id VARCHAR(38) NOT NULL UNIQUE,
+  conversation VARCHAR(38) NOT NULL,
+  sender VARCHAR(38) NOT NULL,
+  recipient VARCHAR(38) NOT NULL,
+  kind VARCHAR(8) NOT NULL,
+  body TEXT NOT NULL,
+  lesson VARCHAR(38),
+  attachment_name TEXT,
+  attachment_content_type TEXT,
+  attachment_key TEXT,
+  thumbnail_key TEXT,
+  created TIMESTAMPTZ NOT NULL,
+  edited TIMESTAMPTZ,
+  deleted TIMESTAMPTZ,
+  archived TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS archived_messages_conversation_idx ON archived_messages (conversation, created);
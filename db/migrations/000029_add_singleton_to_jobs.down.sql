@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS jobs_singleton_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS singleton;
@@ -0,0 +1,4 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS singleton BOOL NOT NULL DEFAULT FALSE;
+
+-- Jobs being run stay PENDING under a lease, so this allows at most one live job of each singleton kind
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_singleton_idx ON jobs (kind) WHERE singleton AND status = 'PENDING';
@@ -0,0 +1,13 @@
+-- Messages counted in their conversation, so recording a message kept outside Postgres again does not count it twice
+CREATE TABLE IF NOT EXISTS recorded_messages (
+  message VARCHAR(38) NOT NULL,
+  conversation VARCHAR(38) NOT NULL,
+  created TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY(message),
+  CONSTRAINT fk_conversation
+    FOREIGN KEY(conversation)
+      REFERENCES conversations(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recorded_messages_created_idx ON recorded_messages (created);
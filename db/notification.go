@@ -53,7 +53,7 @@ func (r *Repository) CreateNotification(uid string, title string, subtitle strin
 
 	defer tx.Rollback(context.Background())
 
-	sql := `INSERT INTO notifications (id, tutor, student, title, subtitle, image, read, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	sql := `INSERT INTO notifications (id, tutor, student, title, subtitle, image, read, created) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, $8)`
 	_, err = tx.Exec(context.Background(), sql, n.Id, n.Tutor, n.Student, n.Title, n.Subtitle, n.Image, n.Read, n.Created)
 
 	if err != nil {
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Returned when the lesson being reviewed already has a review
+var ErrAlreadyReviewed = errors.New("This lesson has already been reviewed")
+
+// The unique constraint allowing only one review per lesson
+const reviewsLessonKey = "reviews_lesson_key"
+
+// Ratings are averaged as if every tutor started with ratingWeight reviews of ratingPrior stars, so a handful of reviews cannot swing a rating to either extreme
+const (
+	ratingPrior  = 3
+	ratingWeight = 5
+)
+
+// Recomputes the rating of the tutor given as the first parameter from their visible reviews, see refreshTutorRating
+const refreshTutorRatingSQL = `
+	UPDATE tutors SET
+		rating_count = s.n,
+		rating_score = ($2::FLOAT8 * $3::INT + s.total) / ($3::INT + s.n),
+		rating = ROUND(($2::FLOAT8 * $3::INT + s.total) / ($3::INT + s.n))
+	FROM (SELECT COUNT(*) AS n, COALESCE(SUM(rating), 0) AS total FROM reviews WHERE tutor = $1 AND hidden = FALSE) AS s
+	WHERE tutors.id = $1`
+
+// Type mirror for the review a student left on a completed lesson, reply is empty until the tutor answers it
+type Review struct {
+	Id      string
+	Lesson  string
+	Student string
+	Tutor   string
+	Subject string
+	Rating  int
+	Body    string
+	Reply   string
+	Replied *time.Time
+	Hidden  bool
+	Flags   int
+	Created time.Time
+}
+
+// Convert a db.Review to a model.Review
+func (r *Repository) ToReviewModel(rv Review) model.Review {
+	mrv := model.Review{ID: rv.Id, Lesson: rv.Lesson, Student: rv.Student, Tutor: rv.Tutor, Rating: rv.Rating, Body: rv.Body, Replied: rv.Replied, Hidden: rv.Hidden, Flags: rv.Flags, Created: rv.Created}
+	if rv.Replied != nil {
+		mrv.Reply = &rv.Reply
+	}
+
+	return mrv
+}
+
+// The columns scanned by scanReview, open flags are only counted while they are unresolved
+const reviewColumns = `
+	reviews.id, reviews.lesson, reviews.student, reviews.tutor, reviews.subject, reviews.rating, reviews.body, COALESCE(reviews.reply, ''), reviews.replied, reviews.hidden,
+	(SELECT COUNT(*) FROM review_flags WHERE review_flags.review = reviews.id AND review_flags.resolved = FALSE) AS flags, reviews.created`
+
+func scanReview(row pgx.Row) (Review, error) {
+	var rv Review
+
+	err := row.Scan(&rv.Id, &rv.Lesson, &rv.Student, &rv.Tutor, &rv.Subject, &rv.Rating, &rv.Body, &rv.Reply, &rv.Replied, &rv.Hidden, &rv.Flags, &rv.Created)
+	return rv, err
+}
+
+// Reviews a lesson on behalf of its student, returning ErrAlreadyReviewed if it was reviewed before
+// The rating of the tutor is recomputed in the same transaction
+func (r *Repository) CreateReview(l Lesson, rating int, body string) (Review, error) {
+	rv := Review{Id: uuid.New(), Lesson: l.Id, Student: l.Student, Tutor: l.Tutor, Subject: l.Subject.Id, Rating: rating, Body: body, Created: time.Now()}
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return rv, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO reviews (id, lesson, student, tutor, subject, rating, body, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	if _, err = tx.Exec(context.Background(), sql, rv.Id, rv.Lesson, rv.Student, rv.Tutor, rv.Subject, rv.Rating, rv.Body, rv.Created); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == reviewsLessonKey {
+			return rv, ErrAlreadyReviewed
+		}
+		return rv, err
+	}
+
+	if err = refreshTutorRating(tx, rv.Tutor); err != nil {
+		return rv, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return rv, err
+	}
+
+	return rv, nil
+}
+
+// Sets the reply of the tutor to a review, replacing any previous reply
+func (r *Repository) ReplyToReview(rid string, reply string) (Review, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return Review{}, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE reviews SET reply = $2, replied = NOW() WHERE id = $1 RETURNING ` + reviewColumns
+	rv, err := scanReview(tx.QueryRow(context.Background(), sql, rid, reply))
+	if err != nil {
+		return rv, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return rv, err
+	}
+
+	return rv, nil
+}
+
+// Get a review based on its UUID
+func (r *Repository) GetReviewById(rid string) (Review, error) {
+	sql := `SELECT ` + reviewColumns + ` FROM reviews WHERE id = $1`
+	return scanReview(r.dbPool.QueryRow(context.Background(), sql, rid))
+}
+
+// Gets the review of a lesson, pgx.ErrNoRows if it was not reviewed
+func (r *Repository) GetLessonReview(lid string) (Review, error) {
+	sql := `SELECT ` + reviewColumns + ` FROM reviews WHERE lesson = $1`
+	return scanReview(r.dbPool.QueryRow(context.Background(), sql, lid))
+}
+
+// Gets the visible reviews of a tutor, most recent first
+// Pages are continued with keyset pagination, after the creation time and id of the last review of the previous page. An empty afterId starts from the beginning
+func (r *Repository) GetTutorReviews(tid string, afterCreated time.Time, afterId string, limit int) ([]Review, error) {
+	sql := `
+	SELECT ` + reviewColumns + `
+	FROM reviews
+	WHERE reviews.tutor = $1 AND reviews.hidden = FALSE AND ($2 = '' OR reviews.created < $3 OR (reviews.created = $3 AND reviews.id > $2))
+	ORDER BY reviews.created DESC, reviews.id
+	LIMIT $4`
+
+	return r.queryReviews(sql, tid, afterId, afterCreated, limit)
+}
+
+// Counts the visible reviews of a tutor, see GetTutorReviews
+func (r *Repository) CountTutorReviews(tid string) (int, error) {
+	sql := `SELECT COUNT(*) FROM reviews WHERE tutor = $1 AND hidden = FALSE`
+
+	var count int
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, tid).Scan(&count); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// Flags a review as inappropriate, flagging the same review twice only keeps the first reason
+func (r *Repository) FlagReview(rid string, uid string, reason string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO review_flags (review, flagged_by, reason) VALUES ($1, $2, $3) ON CONFLICT (review, flagged_by) DO NOTHING`
+	if _, err = tx.Exec(context.Background(), sql, rid, uid, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Gets the reviews with unresolved flags, most flagged first
+func (r *Repository) GetFlaggedReviews(limit int, offset int) ([]Review, error) {
+	sql := `
+	SELECT * FROM (SELECT ` + reviewColumns + ` FROM reviews) AS flagged
+	WHERE flagged.flags > 0
+	ORDER BY flagged.flags DESC, flagged.created
+	LIMIT $1 OFFSET $2`
+
+	return r.queryReviews(sql, limit, offset)
+}
+
+// Hides or shows a review, resolving its flags and recomputing the rating of its tutor
+func (r *Repository) SetReviewHidden(rid string, hidden bool, audit *Audit) (Review, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return Review{}, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE review_flags SET resolved = TRUE WHERE review = $1 AND resolved = FALSE`
+	if _, err = tx.Exec(context.Background(), sql, rid); err != nil {
+		return Review{}, err
+	}
+
+	sql = `UPDATE reviews SET hidden = $2 WHERE id = $1 RETURNING ` + reviewColumns
+	rv, err := scanReview(tx.QueryRow(context.Background(), sql, rid, hidden))
+	if err != nil {
+		return rv, err
+	}
+
+	if err = refreshTutorRating(tx, rv.Tutor); err != nil {
+		return rv, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return rv, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return rv, err
+	}
+
+	return rv, nil
+}
+
+// Recomputes the rating of a tutor within the transaction changing their reviews
+// The tutor is locked first, so concurrent changes recompute one after the other, each counting the reviews committed before it
+func refreshTutorRating(tx pgx.Tx, tid string) error {
+	sql := `SELECT 1 FROM tutors WHERE id = $1 FOR UPDATE`
+	if _, err := tx.Exec(context.Background(), sql, tid); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(context.Background(), refreshTutorRatingSQL, tid, ratingPrior, ratingWeight)
+	return err
+}
+
+func (r *Repository) queryReviews(sql string, args ...interface{}) ([]Review, error) {
+	var reviews []Review
+
+	rows, err := r.dbPool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, rv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
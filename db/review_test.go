@@ -0,0 +1,119 @@
+package db_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// Reviews of the same tutor committed at the same time must all be counted in their rating
+func TestConcurrentReviewsAreAllCounted(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	const n = 8
+
+	tutor := dbtest.Tutor(t, repo)
+	sub := dbtest.Subject(t, repo)
+
+	var lessons []db.Lesson
+	for i := 0; i < n; i++ {
+		start := time.Now().Add(-time.Duration(i+2) * time.Hour)
+
+		l, err := repo.CreateLesson(sub, tutor.Id, dbtest.Student(t, repo).Id, true, start, start.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Cannot create lesson: %v", err)
+		}
+		lessons = append(lessons, l)
+	}
+
+	errs := make(chan error, n)
+	ready := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, l := range lessons {
+		wg.Add(1)
+
+		go func(l db.Lesson) {
+			defer wg.Done()
+			<-ready
+			_, err := repo.CreateReview(l, 5, "Great lesson")
+			errs <- err
+		}(l)
+	}
+
+	close(ready)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Cannot create review: %v", err)
+		}
+	}
+
+	got, err := repo.GetTutorById(tutor.Id)
+	if err != nil {
+		t.Fatalf("Cannot get tutor: %v", err)
+	}
+
+	if got.RatingCount != n {
+		t.Errorf("Tutor has %d ratings, want %d", got.RatingCount, n)
+	}
+}
+
+// Hidden reviews stop counting towards the rating of their tutor, and count again once shown
+func TestHiddenReviewsLeaveRating(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	tutor := dbtest.Tutor(t, repo)
+	sub := dbtest.Subject(t, repo)
+
+	var reviews []db.Review
+	for _, rating := range []int{5, 1} {
+		start := time.Now().Add(-2 * time.Hour)
+
+		l, err := repo.CreateLesson(sub, tutor.Id, dbtest.Student(t, repo).Id, true, start, start.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Cannot create lesson: %v", err)
+		}
+
+		rv, err := repo.CreateReview(l, rating, "Review")
+		if err != nil {
+			t.Fatalf("Cannot create review: %v", err)
+		}
+		reviews = append(reviews, rv)
+	}
+
+	rating := func() (int, float64) {
+		got, err := repo.GetTutorById(tutor.Id)
+		if err != nil {
+			t.Fatalf("Cannot get tutor: %v", err)
+		}
+		return got.RatingCount, got.RatingScore
+	}
+
+	count, both := rating()
+	if count != 2 {
+		t.Fatalf("Tutor has %d ratings, want 2", count)
+	}
+
+	if _, err := repo.SetReviewHidden(reviews[1].Id, true, nil); err != nil {
+		t.Fatalf("Cannot hide review: %v", err)
+	}
+
+	count, hidden := rating()
+	if count != 1 || hidden <= both {
+		t.Errorf("With the 1 star review hidden got %d ratings scoring %f, want 1 scoring more than %f", count, hidden, both)
+	}
+
+	if _, err := repo.SetReviewHidden(reviews[1].Id, false, nil); err != nil {
+		t.Fatalf("Cannot show review: %v", err)
+	}
+
+	if count, shown := rating(); count != 2 || shown != both {
+		t.Errorf("With the review shown again got %d ratings scoring %f, want 2 scoring %f", count, shown, both)
+	}
+}
@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for a login session of a student or tutor. A session is a family of rotating refresh tokens
+type Session struct {
+	Id         string
+	User       string
+	DeviceName string
+	IP         string
+	Created    time.Time
+	LastUsed   time.Time
+	Expires    time.Time
+	Revoked    bool
+}
+
+// Type mirror for a single refresh token of a session, only the hash of the token is ever stored
+type RefreshToken struct {
+	Hash    string
+	Session string
+	Used    bool
+	Created time.Time
+}
+
+// Convert a db.Session to model.Session, current marks the session of the requesting client
+func (r *Repository) ToSessionModel(s Session, current bool) model.Session {
+	return model.Session{ID: s.Id, DeviceName: s.DeviceName, IP: s.IP, Created: s.Created, LastUsed: s.LastUsed, Current: current}
+}
+
+// Creates a new session for a user (student or tutor) UUID, expiring at the given time unless refreshed
+func (r *Repository) CreateSession(uid string, deviceName string, ip string, expires time.Time) (Session, error) {
+	var s Session
+
+	s.Id = uuid.New()
+	s.User = uid
+	s.DeviceName = deviceName
+	s.IP = ip
+	s.Created = time.Now()
+	s.LastUsed = s.Created
+	s.Expires = expires
+	s.Revoked = false
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return s, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO sessions (id, user_id, device_name, ip, created, last_used, expires, revoked) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.Exec(context.Background(), sql, s.Id, s.User, s.DeviceName, s.IP, s.Created, s.LastUsed, s.Expires, s.Revoked)
+
+	if err != nil {
+		return s, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// Gets the session by session UUID
+func (r *Repository) GetSessionById(id string) (Session, error) {
+	sql := `SELECT id, user_id, device_name, ip, created, last_used, expires, revoked FROM sessions WHERE id = $1`
+
+	var s Session
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, id).Scan(&s.Id, &s.User, &s.DeviceName, &s.IP, &s.Created, &s.LastUsed, &s.Expires, &s.Revoked); err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// Gets all the active sessions of a user, most recently used first
+func (r *Repository) GetUserSessions(uid string) ([]Session, error) {
+	sql := `SELECT id, user_id, device_name, ip, created, last_used, expires, revoked FROM sessions WHERE user_id = $1 AND revoked = FALSE AND expires > NOW() ORDER BY last_used DESC`
+
+	var sessions []Session
+
+	rows, err := r.dbPool.Query(context.Background(), sql, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var s Session
+
+		if err := rows.Scan(&s.Id, &s.User, &s.DeviceName, &s.IP, &s.Created, &s.LastUsed, &s.Expires, &s.Revoked); err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Records a session being used to refresh, updating the last used time, client IP and sliding the expiry forward
+func (r *Repository) TouchSession(id string, ip string, expires time.Time) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE sessions SET last_used = NOW(), ip = $2, expires = $3 WHERE id = $1`
+	_, err = tx.Exec(context.Background(), sql, id, ip, expires)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Revokes a single session belonging to the user, returns whether such a session existed
+func (r *Repository) RevokeSession(id string, uid string) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE sessions SET revoked = TRUE WHERE id = $1 AND user_id = $2`
+	tag, err := tx.Exec(context.Background(), sql, id, uid)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Revokes every session of the user
+func (r *Repository) RevokeUserSessions(uid string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE sessions SET revoked = TRUE WHERE user_id = $1`
+	_, err = tx.Exec(context.Background(), sql, uid)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Stores the hash of a newly issued refresh token for a session
+func (r *Repository) CreateRefreshToken(sid string, hash string) (RefreshToken, error) {
+	var rt RefreshToken
+
+	rt.Hash = hash
+	rt.Session = sid
+	rt.Used = false
+	rt.Created = time.Now()
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return rt, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO refresh_tokens (hash, session, used, created) VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(context.Background(), sql, rt.Hash, rt.Session, rt.Used, rt.Created)
+
+	if err != nil {
+		return rt, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return rt, err
+	}
+
+	return rt, nil
+}
+
+// Gets a refresh token by its hash
+func (r *Repository) GetRefreshToken(hash string) (RefreshToken, error) {
+	sql := `SELECT hash, session, used, created FROM refresh_tokens WHERE hash = $1`
+
+	var rt RefreshToken
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, hash).Scan(&rt.Hash, &rt.Session, &rt.Used, &rt.Created); err != nil {
+		return rt, err
+	}
+
+	return rt, nil
+}
+
+// Marks a refresh token as used, but only if it has not been used before
+// Returns false if the token was already used, which means it is being replayed
+func (r *Repository) UseRefreshToken(hash string) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE refresh_tokens SET used = TRUE WHERE hash = $1 AND used = FALSE`
+	tag, err := tx.Exec(context.Background(), sql, hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
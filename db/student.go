@@ -18,11 +18,13 @@ type Student struct {
 	HashedPassword string
 	ProfilePic     string
 	PushToken      string
+	EmailVerified  bool
+	Suspended      bool
 }
 
 // Convert from db.Student to model.Student
 func (r *Repository) ToStudentModel(s Student) model.Student {
-	return model.Student{ID: s.Id, Username: s.Username, FirstName: s.FirstName, LastName: s.LastName, Email: s.Email, ProfilePic: s.ProfilePic}
+	return model.Student{ID: s.Id, Username: s.Username, FirstName: s.FirstName, LastName: s.LastName, Email: s.Email, EmailVerified: s.EmailVerified, ProfilePic: s.ProfilePic, Suspended: s.Suspended}
 }
 
 // Creates a new student, returns a db.Student
@@ -62,6 +64,7 @@ func (r *Repository) CreateStudent(username string, firstName string, lastName s
 }
 
 // Update student, takes an existing student. Only can update firstname, lastname, email, profile picture and APN push token
+// Changing the email clears its verification
 func (r *Repository) UpdateStudent(s Student) error {
 	tx, err := r.dbPool.Begin(context.Background())
 	if err != nil {
@@ -70,7 +73,7 @@ func (r *Repository) UpdateStudent(s Student) error {
 
 	defer tx.Rollback(context.Background())
 
-	sql := `UPDATE students SET first_name = $2, last_name = $3, email = $4, profile_pic = $5, push_token = $6 WHERE id = $1`
+	sql := `UPDATE students SET first_name = $2, last_name = $3, email = $4, email_verified = (email_verified AND email = $4), profile_pic = $5, push_token = $6 WHERE id = $1`
 	_, err = tx.Exec(context.Background(), sql, s.Id, s.FirstName, s.LastName, s.Email, s.ProfilePic, s.PushToken)
 
 	if err != nil {
@@ -90,9 +93,9 @@ func (r *Repository) GetStudentById(id string) (Student, error) {
 
 	var s Student
 
-	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, push_token FROM students WHERE id = $1`
+	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, push_token, email_verified, suspended FROM students WHERE id = $1`
 
-	if err := r.dbPool.QueryRow(context.Background(), sql, id).Scan(&s.Id, &s.Username, &s.FirstName, &s.LastName, &s.Email, &s.HashedPassword, &s.ProfilePic, &s.PushToken); err != nil {
+	if err := r.dbPool.QueryRow(context.Background(), sql, id).Scan(&s.Id, &s.Username, &s.FirstName, &s.LastName, &s.Email, &s.HashedPassword, &s.ProfilePic, &s.PushToken, &s.EmailVerified, &s.Suspended); err != nil {
 		return s, err
 	}
 
@@ -104,18 +107,90 @@ func (r *Repository) GetStudentByUsername(username string) (Student, error) {
 
 	var s Student
 
-	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, push_token FROM students WHERE username = $1`
+	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, push_token, email_verified, suspended FROM students WHERE username = $1`
 
-	if err := r.dbPool.QueryRow(context.Background(), sql, username).Scan(&s.Id, &s.Username, &s.FirstName, &s.LastName, &s.Email, &s.HashedPassword, &s.ProfilePic, &s.PushToken); err != nil {
+	if err := r.dbPool.QueryRow(context.Background(), sql, username).Scan(&s.Id, &s.Username, &s.FirstName, &s.LastName, &s.Email, &s.HashedPassword, &s.ProfilePic, &s.PushToken, &s.EmailVerified, &s.Suspended); err != nil {
 		return s, err
 	}
 
 	return s, nil
 }
 
+// Gets student by email address, emails are matched case insensitively
+func (r *Repository) GetStudentByEmail(email string) (Student, error) {
+
+	var s Student
+
+	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, push_token, email_verified, suspended FROM students WHERE LOWER(email) = LOWER($1)`
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, email).Scan(&s.Id, &s.Username, &s.FirstName, &s.LastName, &s.Email, &s.HashedPassword, &s.ProfilePic, &s.PushToken, &s.EmailVerified, &s.Suspended); err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// Searches students by username, name or email, ordered by username. An empty query matches every student
+func (r *Repository) SearchStudents(query string, limit int, offset int) ([]Student, error) {
+	sql := `
+	SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, push_token, email_verified, suspended
+	FROM students
+	WHERE
+		$1 = '' OR
+		username ILIKE '%' || $1 || '%' OR
+		email ILIKE '%' || $1 || '%' OR
+		first_name || ' ' || last_name ILIKE '%' || $1 || '%'
+	ORDER BY username
+	LIMIT $2 OFFSET $3`
+
+	var students []Student
+
+	rows, err := r.dbPool.Query(context.Background(), sql, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var s Student
+
+		if err := rows.Scan(&s.Id, &s.Username, &s.FirstName, &s.LastName, &s.Email, &s.HashedPassword, &s.ProfilePic, &s.PushToken, &s.EmailVerified, &s.Suspended); err != nil {
+			return nil, err
+		}
+
+		students = append(students, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return students, nil
+}
+
+// Counts the students matching a search query, see SearchStudents
+func (r *Repository) CountStudents(query string) (int, error) {
+	sql := `
+	SELECT COUNT(*)
+	FROM students
+	WHERE
+		$1 = '' OR
+		username ILIKE '%' || $1 || '%' OR
+		email ILIKE '%' || $1 || '%' OR
+		first_name || ' ' || last_name ILIKE '%' || $1 || '%'`
+
+	var count int
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, query).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
 // Gets all student lessons, paginated by startTime and endTime
 func (r *Repository) GetStudentLessons(sid string, startTime time.Time, endTime time.Time) ([]Lesson, error) {
-	sql := `SELECT id, subject, summary, tutor, student, scheduled, period FROM lessons WHERE student = $1 and $2 @> period`
+	sql := `SELECT id, subject, summary, tutor, student, scheduled, status, period FROM lessons WHERE student = $1 and $2 @> period`
 
 	var lessons []Lesson
 
@@ -132,7 +207,7 @@ func (r *Repository) GetStudentLessons(sid string, startTime time.Time, endTime
 		var period pgtype.Tstzrange
 		var sid string
 
-		err := rows.Scan(&lesson.Id, &sid, &lesson.Summary, &lesson.Tutor, &lesson.Student, &lesson.Scheduled, &period)
+		err := rows.Scan(&lesson.Id, &sid, &lesson.Summary, &lesson.Tutor, &lesson.Student, &lesson.Scheduled, &lesson.Status, &period)
 
 		if err != nil {
 			return nil, err
@@ -164,5 +239,6 @@ func (r *Repository) IsStudentInLesson(sid string, lid string) (bool, error) {
 		return false, err
 	}
 
+	defer rows.Close()
 	return rows.Next(), nil
 }
@@ -10,21 +10,26 @@ import (
 )
 
 type Tutor struct {
-	Id             string
-	Username       string
-	FirstName      string
-	LastName       string
-	Email          string
-	HashedPassword string
-	ProfilePic     string
-	HourlyRate     int
-	Bio            string
-	Rating         int
-	Education      []string
-	Subjects       []string
-	Status         string
-	LastSeen       time.Time
-	PushToken      string
+	Id                string
+	Username          string
+	FirstName         string
+	LastName          string
+	Email             string
+	HashedPassword    string
+	ProfilePic        string
+	HourlyRate        int
+	Bio               string
+	Rating            int
+	RatingScore       float64
+	RatingCount       int
+	Education         []string
+	Subjects          []string
+	Status            string
+	LastSeen          time.Time
+	PushToken         string
+	EmailVerified     bool
+	Suspended         bool
+	ApplicationStatus string
 }
 
 // Convert db.Tutor to model.Tutor
@@ -41,7 +46,7 @@ func (r *Repository) ToTutorModel(t Tutor) (model.Tutor, error) {
 		subjects = append(subjects, &subject)
 	}
 
-	return model.Tutor{ID: t.Id, Username: t.Username, FirstName: t.FirstName, LastName: t.LastName, Email: t.Email, ProfilePic: t.ProfilePic, HourlyRate: t.HourlyRate, Bio: t.Bio, Rating: t.Rating, Education: t.Education, Subjects: subjects}, nil
+	return model.Tutor{ID: t.Id, Username: t.Username, FirstName: t.FirstName, LastName: t.LastName, Email: t.Email, EmailVerified: t.EmailVerified, ProfilePic: t.ProfilePic, HourlyRate: t.HourlyRate, Bio: t.Bio, Rating: t.Rating, RatingScore: t.RatingScore, RatingCount: t.RatingCount, Education: t.Education, Subjects: subjects, ApplicationStatus: model.ApplicationStatus(t.ApplicationStatus), Suspended: t.Suspended}, nil
 }
 
 // Creates a new tutor, takes subject IDs
@@ -64,6 +69,7 @@ func (r *Repository) CreateTutor(username string, firstName string, lastName str
 	t.Subjects = subjects
 	t.Status = "UNAVAILABLE"
 	t.LastSeen = time.Now()
+	t.ApplicationStatus = "APPLIED"
 
 	tx, err := r.dbPool.Begin(context.Background())
 	if err != nil {
@@ -72,8 +78,8 @@ func (r *Repository) CreateTutor(username string, firstName string, lastName str
 
 	defer tx.Rollback(context.Background())
 
-	sql := `INSERT INTO tutors (id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, rating, bio, education, status, last_seen) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
-	_, err = tx.Exec(context.Background(), sql, t.Id, t.Username, t.FirstName, t.LastName, t.Email, t.HashedPassword, t.ProfilePic, t.HourlyRate, t.Rating, t.Bio, t.Education, t.Status, t.LastSeen)
+	sql := `INSERT INTO tutors (id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, rating, bio, education, status, last_seen, application_status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	_, err = tx.Exec(context.Background(), sql, t.Id, t.Username, t.FirstName, t.LastName, t.Email, t.HashedPassword, t.ProfilePic, t.HourlyRate, t.Rating, t.Bio, t.Education, t.Status, t.LastSeen, t.ApplicationStatus)
 	if err != nil {
 		return t, err
 	}
@@ -90,7 +96,8 @@ func (r *Repository) CreateTutor(username string, firstName string, lastName str
 	return t, nil
 }
 
-// Update tutor to the passed in tutor struct
+// Update tutor to the passed in tutor struct, changing the email clears its verification
+// The rating is left alone, it is maintained from the reviews of the tutor
 func (r *Repository) UpdateTutor(t Tutor) error {
 	tx, err := r.dbPool.Begin(context.Background())
 	if err != nil {
@@ -99,8 +106,8 @@ func (r *Repository) UpdateTutor(t Tutor) error {
 
 	defer tx.Rollback(context.Background())
 
-	sql := `UPDATE tutors SET first_name = $2, last_name = $3, email = $4, profile_pic = $5, hourly_rate = $6, bio = $7, rating = $8, education = $9, status = $10, last_seen = $11, push_token = $12 WHERE id = $1`
-	_, err = tx.Exec(context.Background(), sql, t.Id, t.FirstName, t.LastName, t.Email, t.ProfilePic, t.HourlyRate, t.Bio, t.Rating, t.Education, t.Status, t.LastSeen, t.PushToken)
+	sql := `UPDATE tutors SET first_name = $2, last_name = $3, email = $4, email_verified = (email_verified AND email = $4), profile_pic = $5, hourly_rate = $6, bio = $7, education = $8, status = $9, last_seen = $10, push_token = $11 WHERE id = $1`
+	_, err = tx.Exec(context.Background(), sql, t.Id, t.FirstName, t.LastName, t.Email, t.ProfilePic, t.HourlyRate, t.Bio, t.Education, t.Status, t.LastSeen, t.PushToken)
 
 	if err != nil {
 		return err
@@ -123,7 +130,7 @@ func (r *Repository) UpdateTutor(t Tutor) error {
 
 // Get the tutor based on the Tutor UUID
 func (r *Repository) GetTutorById(id string) (Tutor, error) {
-	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, education, status, last_seen, push_token FROM tutors WHERE id = $1`
+	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, rating_score, rating_count, education, status, last_seen, push_token, email_verified, suspended, application_status FROM tutors WHERE id = $1`
 
 	var t Tutor
 
@@ -138,10 +145,15 @@ func (r *Repository) GetTutorById(id string) (Tutor, error) {
 		&t.HourlyRate,
 		&t.Bio,
 		&t.Rating,
+		&t.RatingScore,
+		&t.RatingCount,
 		&t.Education,
 		&t.Status,
 		&t.LastSeen,
-		&t.PushToken); err != nil {
+		&t.PushToken,
+		&t.EmailVerified,
+		&t.Suspended,
+		&t.ApplicationStatus); err != nil {
 		return t, err
 	}
 
@@ -163,7 +175,7 @@ func (r *Repository) GetTutorById(id string) (Tutor, error) {
 }
 
 func (r *Repository) GetTutorByUsername(username string) (Tutor, error) {
-	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, education, status, last_seen, push_token FROM tutors WHERE username = $1`
+	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, rating_score, rating_count, education, status, last_seen, push_token, email_verified, suspended, application_status FROM tutors WHERE username = $1`
 
 	var t Tutor
 
@@ -178,10 +190,15 @@ func (r *Repository) GetTutorByUsername(username string) (Tutor, error) {
 		&t.HourlyRate,
 		&t.Bio,
 		&t.Rating,
+		&t.RatingScore,
+		&t.RatingCount,
 		&t.Education,
 		&t.Status,
 		&t.LastSeen,
-		&t.PushToken); err != nil {
+		&t.PushToken,
+		&t.EmailVerified,
+		&t.Suspended,
+		&t.ApplicationStatus); err != nil {
 		return t, err
 	}
 
@@ -202,9 +219,161 @@ func (r *Repository) GetTutorByUsername(username string) (Tutor, error) {
 	return t, nil
 }
 
+// Get the tutor by email address, emails are matched case insensitively
+func (r *Repository) GetTutorByEmail(email string) (Tutor, error) {
+	sql := `SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, rating_score, rating_count, education, status, last_seen, push_token, email_verified, suspended, application_status FROM tutors WHERE LOWER(email) = LOWER($1)`
+
+	var t Tutor
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, email).Scan(
+		&t.Id,
+		&t.Username,
+		&t.FirstName,
+		&t.LastName,
+		&t.Email,
+		&t.HashedPassword,
+		&t.ProfilePic,
+		&t.HourlyRate,
+		&t.Bio,
+		&t.Rating,
+		&t.RatingScore,
+		&t.RatingCount,
+		&t.Education,
+		&t.Status,
+		&t.LastSeen,
+		&t.PushToken,
+		&t.EmailVerified,
+		&t.Suspended,
+		&t.ApplicationStatus); err != nil {
+		return t, err
+	}
+
+	// Populating subjects separately because it is an enum array
+	subjects, err := r.getTutorSubjects(t.Id)
+	if err != nil {
+		return t, err
+	}
+
+	var subids []string
+
+	for _, subject := range subjects {
+		subids = append(subids, subject.Id)
+	}
+
+	t.Subjects = subids
+
+	return t, nil
+}
+
+// Searches tutors by username, name or email, ordered by username. An empty query matches every tutor
+// Subjects are not populated, use GetTutorById for the full tutor
+func (r *Repository) SearchTutors(query string, limit int, offset int) ([]Tutor, error) {
+	sql := `
+	SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, rating_score, rating_count, education, status, last_seen, push_token, email_verified, suspended, application_status
+	FROM tutors
+	WHERE
+		$1 = '' OR
+		username ILIKE '%' || $1 || '%' OR
+		email ILIKE '%' || $1 || '%' OR
+		first_name || ' ' || last_name ILIKE '%' || $1 || '%'
+	ORDER BY username
+	LIMIT $2 OFFSET $3`
+
+	var tutors []Tutor
+
+	rows, err := r.dbPool.Query(context.Background(), sql, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var t Tutor
+
+		if err := rows.Scan(
+			&t.Id,
+			&t.Username,
+			&t.FirstName,
+			&t.LastName,
+			&t.Email,
+			&t.HashedPassword,
+			&t.ProfilePic,
+			&t.HourlyRate,
+			&t.Bio,
+			&t.Rating,
+			&t.RatingScore,
+			&t.RatingCount,
+			&t.Education,
+			&t.Status,
+			&t.LastSeen,
+			&t.PushToken,
+			&t.EmailVerified,
+			&t.Suspended,
+			&t.ApplicationStatus); err != nil {
+			return nil, err
+		}
+
+		tutors = append(tutors, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tutors, nil
+}
+
+// Counts the tutors matching a search query, see SearchTutors
+func (r *Repository) CountTutors(query string) (int, error) {
+	sql := `
+	SELECT COUNT(*)
+	FROM tutors
+	WHERE
+		$1 = '' OR
+		username ILIKE '%' || $1 || '%' OR
+		email ILIKE '%' || $1 || '%' OR
+		first_name || ' ' || last_name ILIKE '%' || $1 || '%'`
+
+	var count int
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, query).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Replaces the subjects a tutor teaches, all at once
+func (r *Repository) SetTutorSubjects(tid string, subids []string, audit *Audit) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM teaching WHERE tutor = $1`
+	if _, err = tx.Exec(context.Background(), sql, tid); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO teaching (tutor, subject) VALUES ($1, $2)`
+	for _, s := range subids {
+		if _, err = tx.Exec(context.Background(), sql, tid, s); err != nil {
+			return err
+		}
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
 // Get lessons that the tutor teaches, bounded by a time period
 func (r *Repository) GetTutorLessons(tid string, startTime time.Time, endTime time.Time) ([]Lesson, error) {
-	sql := `SELECT id, subject, summary, tutor, student, scheduled, period FROM lessons WHERE tutor = $1 and $2 @> period`
+	sql := `SELECT id, subject, summary, tutor, student, scheduled, status, period FROM lessons WHERE tutor = $1 and $2 @> period`
 
 	var lessons []Lesson
 
@@ -221,7 +390,7 @@ func (r *Repository) GetTutorLessons(tid string, startTime time.Time, endTime ti
 		var period pgtype.Tstzrange
 		var sid string
 
-		err := rows.Scan(&lesson.Id, &sid, &lesson.Tutor, &lesson.Student, &lesson.Scheduled, &period)
+		err := rows.Scan(&lesson.Id, &sid, &lesson.Summary, &lesson.Tutor, &lesson.Student, &lesson.Scheduled, &lesson.Status, &period)
 
 		if err != nil {
 			return nil, err
@@ -253,6 +422,7 @@ func (r *Repository) IsTutorInLesson(tid string, lid string) (bool, error) {
 		return false, err
 	}
 
+	defer rows.Close()
 	return rows.Next(), nil
 }
 
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Type mirror for the metadata of a qualification document a tutor uploaded with their application, the file itself lives in blob storage
+type TutorDocument struct {
+	Id          string
+	Tutor       string
+	Kind        string
+	Name        string
+	Url         string
+	ContentType string
+	Size        int
+	Created     time.Time
+}
+
+// Type mirror for a change of a tutor's application status, along with who made it and why
+type ApplicationReview struct {
+	Id       string
+	Tutor    string
+	Reviewer string
+	From     string
+	To       string
+	Notes    string
+	Created  time.Time
+}
+
+// Convert a db.TutorDocument to a model.TutorDocument
+func (r *Repository) ToTutorDocumentModel(d TutorDocument) model.TutorDocument {
+	return model.TutorDocument{ID: d.Id, Kind: model.DocumentKind(d.Kind), Name: d.Name, URL: d.Url, ContentType: d.ContentType, Size: d.Size, Created: d.Created}
+}
+
+// Convert a db.ApplicationReview to a model.ApplicationReview
+func (r *Repository) ToApplicationReviewModel(a ApplicationReview) model.ApplicationReview {
+	review := model.ApplicationReview{ID: a.Id, From: model.ApplicationStatus(a.From), To: model.ApplicationStatus(a.To), Created: a.Created}
+
+	if a.Reviewer != "" {
+		review.Reviewer = &a.Reviewer
+	}
+
+	if a.Notes != "" {
+		review.Notes = &a.Notes
+	}
+
+	return review
+}
+
+// Moves a tutor's application from one status to another, recording the change in its history
+// An empty reviewer is stored as NULL, for changes made by the tutor themselves
+// Returns false if the application was not in the expected status, in which case nothing is recorded
+func (r *Repository) TransitionApplication(tid string, reviewer string, from string, to string, notes string, audit *Audit) (ApplicationReview, bool, error) {
+	var a ApplicationReview
+
+	a.Id = uuid.New()
+	a.Tutor = tid
+	a.Reviewer = reviewer
+	a.From = from
+	a.To = to
+	a.Notes = notes
+	a.Created = time.Now()
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return a, false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE tutors SET application_status = $3 WHERE id = $1 AND application_status = $2`
+	tag, err := tx.Exec(context.Background(), sql, tid, from, to)
+	if err != nil {
+		return a, false, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return a, false, nil
+	}
+
+	sql = `INSERT INTO application_reviews (id, tutor, reviewer, from_status, to_status, notes, created) VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7)`
+	_, err = tx.Exec(context.Background(), sql, a.Id, a.Tutor, a.Reviewer, a.From, a.To, a.Notes, a.Created)
+	if err != nil {
+		return a, false, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return a, false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return a, false, err
+	}
+
+	return a, true, nil
+}
+
+// Gets the tutors whose applications are in a status, those who have been waiting the longest first
+// Subjects are not populated, use GetTutorById for the full tutor
+func (r *Repository) GetTutorsByApplicationStatus(status string, limit int, offset int) ([]Tutor, error) {
+	sql := `
+	SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, rating_score, rating_count, education, status, last_seen, push_token, email_verified, suspended, application_status
+	FROM tutors
+	WHERE application_status = $1
+	ORDER BY (SELECT MAX(created) FROM application_reviews WHERE application_reviews.tutor = tutors.id) NULLS FIRST, username
+	LIMIT $2 OFFSET $3`
+
+	var tutors []Tutor
+
+	rows, err := r.dbPool.Query(context.Background(), sql, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var t Tutor
+
+		if err := rows.Scan(
+			&t.Id,
+			&t.Username,
+			&t.FirstName,
+			&t.LastName,
+			&t.Email,
+			&t.HashedPassword,
+			&t.ProfilePic,
+			&t.HourlyRate,
+			&t.Bio,
+			&t.Rating,
+			&t.RatingScore,
+			&t.RatingCount,
+			&t.Education,
+			&t.Status,
+			&t.LastSeen,
+			&t.PushToken,
+			&t.EmailVerified,
+			&t.Suspended,
+			&t.ApplicationStatus); err != nil {
+			return nil, err
+		}
+
+		tutors = append(tutors, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tutors, nil
+}
+
+// Records the metadata of an uploaded qualification document
+func (r *Repository) CreateTutorDocument(tid string, kind string, name string, url string, contentType string, size int) (TutorDocument, error) {
+	var d TutorDocument
+
+	d.Id = uuid.New()
+	d.Tutor = tid
+	d.Kind = kind
+	d.Name = name
+	d.Url = url
+	d.ContentType = contentType
+	d.Size = size
+	d.Created = time.Now()
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return d, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `INSERT INTO tutor_documents (id, tutor, kind, name, url, content_type, size, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.Exec(context.Background(), sql, d.Id, d.Tutor, d.Kind, d.Name, d.Url, d.ContentType, d.Size, d.Created)
+	if err != nil {
+		return d, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
+
+// Get a qualification document based on its UUID
+func (r *Repository) GetTutorDocumentById(did string) (TutorDocument, error) {
+	sql := `SELECT id, tutor, kind, name, url, content_type, size, created FROM tutor_documents WHERE id = $1`
+
+	var d TutorDocument
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, did).Scan(&d.Id, &d.Tutor, &d.Kind, &d.Name, &d.Url, &d.ContentType, &d.Size, &d.Created); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
+
+// Gets all qualification documents of a tutor, oldest first
+func (r *Repository) GetTutorDocuments(tid string) ([]TutorDocument, error) {
+	sql := `SELECT id, tutor, kind, name, url, content_type, size, created FROM tutor_documents WHERE tutor = $1 ORDER BY created`
+
+	var documents []TutorDocument
+
+	rows, err := r.dbPool.Query(context.Background(), sql, tid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var d TutorDocument
+
+		if err := rows.Scan(&d.Id, &d.Tutor, &d.Kind, &d.Name, &d.Url, &d.ContentType, &d.Size, &d.Created); err != nil {
+			return nil, err
+		}
+
+		documents = append(documents, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// Deletes the metadata of a qualification document
+func (r *Repository) DeleteTutorDocument(did string) error {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `DELETE FROM tutor_documents WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), sql, did); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Gets the history of a tutor's application, oldest first
+func (r *Repository) GetApplicationReviews(tid string) ([]ApplicationReview, error) {
+	sql := `SELECT id, tutor, reviewer, from_status, to_status, notes, created FROM application_reviews WHERE tutor = $1 ORDER BY created`
+
+	var reviews []ApplicationReview
+
+	rows, err := r.dbPool.Query(context.Background(), sql, tid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var a ApplicationReview
+
+		// To handle possible null values
+		var reviewer pgtype.Varchar
+		var notes pgtype.Text
+
+		if err := rows.Scan(&a.Id, &a.Tutor, &reviewer, &a.From, &a.To, &notes, &a.Created); err != nil {
+			return nil, err
+		}
+
+		// Handling possible null values
+		reviewer.AssignTo(&a.Reviewer)
+		notes.AssignTo(&a.Notes)
+
+		reviews = append(reviews, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
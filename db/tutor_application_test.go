@@ -0,0 +1,58 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// A transition from a status the application is no longer in changes nothing, and writes neither history nor audit
+func TestTransitionApplicationFromStaleStatus(t *testing.T) {
+	repo := dbtest.Repository(t)
+	tutor := dbtest.Tutor(t, repo)
+	admin := dbtest.Admin(t, repo)
+
+	audit := func() *db.Audit {
+		return &db.Audit{Actor: admin.Id, Action: "TRANSITION_APPLICATION", Target: tutor.Id}
+	}
+
+	if _, moved, err := repo.TransitionApplication(tutor.Id, admin.Id, "UNDER_REVIEW", "APPROVED", "", audit()); err != nil || moved {
+		t.Fatalf("Stale transition moved %v with error %v", moved, err)
+	}
+
+	if _, moved, err := repo.TransitionApplication(tutor.Id, "", "APPLIED", "DOCUMENTS_SUBMITTED", "", nil); err != nil || !moved {
+		t.Fatalf("Submitting moved %v with error %v", moved, err)
+	}
+
+	if _, moved, err := repo.TransitionApplication(tutor.Id, admin.Id, "DOCUMENTS_SUBMITTED", "UNDER_REVIEW", "", audit()); err != nil || !moved {
+		t.Fatalf("Reviewing moved %v with error %v", moved, err)
+	}
+
+	reviews, err := repo.GetApplicationReviews(tutor.Id)
+	if err != nil {
+		t.Fatalf("Cannot get application reviews: %v", err)
+	}
+
+	if len(reviews) != 2 {
+		t.Errorf("Got %d application reviews, want 2", len(reviews))
+	}
+
+	entries, err := repo.GetAuditLog(tutor.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("Cannot get audit log: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("Got %d audit entries, want 1", len(entries))
+	}
+
+	got, err := repo.GetTutorById(tutor.Id)
+	if err != nil {
+		t.Fatalf("Cannot get tutor: %v", err)
+	}
+
+	if got.ApplicationStatus != "UNDER_REVIEW" {
+		t.Errorf("Application is %s, want UNDER_REVIEW", got.ApplicationStatus)
+	}
+}
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// How a tutor responded to a match offered to them. Withdrawn offers were answered by another tutor first, or cancelled by the student
+const (
+	ResponseAccepted  = "ACCEPTED"
+	ResponseDeclined  = "DECLINED"
+	ResponseIgnored   = "IGNORED"
+	ResponseWithdrawn = "WITHDRAWN"
+)
+
+// How many of the most recent accept latencies are kept for the median
+const acceptLatencyWindow = 50
+
+// Type mirror for how a tutor responds to the matches offered to them
+// MedianAccept is nil until they accepted a match, ConsecutiveIgnored counts the offers they ignored since they last answered one
+type TutorResponseStats struct {
+	Tutor              string
+	Offers             int
+	Accepted           int
+	Declined           int
+	Ignored            int
+	MedianAccept       *time.Duration
+	ConsecutiveIgnored int
+	LastIgnored        *time.Time
+}
+
+// Convert a db.TutorResponseStats to a model.TutorResponseStats, tutors stay deprioritised in matching until the given time
+func (r *Repository) ToTutorResponseStatsModel(s TutorResponseStats, deprioritisedUntil *time.Time) model.TutorResponseStats {
+	ms := model.TutorResponseStats{Tutor: s.Tutor, Offers: s.Offers, Accepted: s.Accepted, Declined: s.Declined, Ignored: s.Ignored, ConsecutiveIgnored: s.ConsecutiveIgnored, DeprioritisedUntil: deprioritisedUntil}
+	if s.MedianAccept != nil {
+		seconds := s.MedianAccept.Seconds()
+		ms.MedianAcceptSeconds = &seconds
+	}
+
+	return ms
+}
+
+// Gets how a tutor responds to the matches offered to them, tutors who were never offered one have empty stats
+func (r *Repository) GetTutorResponseStats(tid string) (TutorResponseStats, error) {
+	sql := `
+	SELECT offers, accepted, declined, ignored, consecutive_ignored, last_ignored,
+		(SELECT PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY latency) FROM UNNEST(accept_latencies) AS latency)
+	FROM tutor_response_stats WHERE tutor = $1`
+
+	s := TutorResponseStats{Tutor: tid}
+	var median *float64
+
+	err := r.dbPool.QueryRow(context.Background(), sql, tid).Scan(&s.Offers, &s.Accepted, &s.Declined, &s.Ignored, &s.ConsecutiveIgnored, &s.LastIgnored, &median)
+	if err == pgx.ErrNoRows {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+
+	if median != nil {
+		d := time.Duration(*median * float64(time.Second))
+		s.MedianAccept = &d
+	}
+
+	return s, nil
+}
+
+// Counts a match offered to a tutor in their stats, within the transaction creating it
+func recordOffer(tx pgx.Tx, tid string) error {
+	sql := `
+	INSERT INTO tutor_response_stats (tutor, offers) VALUES ($1, 1)
+	ON CONFLICT (tutor) DO UPDATE SET offers = tutor_response_stats.offers + 1, updated = NOW()`
+
+	_, err := tx.Exec(context.Background(), sql, tid)
+	return err
+}
+
+// Counts the responses just recorded on matches in the stats of their tutors, within the transaction recording them
+// Answering an offer resets the run of ignored offers, withdrawn offers say nothing about the tutor and are left out
+func recordResponses(tx pgx.Tx, mids []string) error {
+	if len(mids) == 0 {
+		return nil
+	}
+
+	sql := `
+	INSERT INTO tutor_response_stats AS stats (tutor, accepted, declined, ignored, consecutive_ignored, last_ignored, accept_latencies)
+	SELECT
+		tutor,
+		COUNT(*) FILTER (WHERE response = 'ACCEPTED'),
+		COUNT(*) FILTER (WHERE response = 'DECLINED'),
+		COUNT(*) FILTER (WHERE response = 'IGNORED'),
+		COUNT(*) FILTER (WHERE response = 'IGNORED'),
+		MAX(responded) FILTER (WHERE response = 'IGNORED'),
+		COALESCE(ARRAY_AGG(GREATEST(EXTRACT(EPOCH FROM responded - offered), 0)::INT ORDER BY responded) FILTER (WHERE response = 'ACCEPTED'), '{}')
+	FROM matchings
+	WHERE id = ANY($1) AND response IN ('ACCEPTED', 'DECLINED', 'IGNORED')
+	GROUP BY tutor
+	ON CONFLICT (tutor) DO UPDATE SET
+		accepted = stats.accepted + EXCLUDED.accepted,
+		declined = stats.declined + EXCLUDED.declined,
+		ignored = stats.ignored + EXCLUDED.ignored,
+		consecutive_ignored = CASE WHEN EXCLUDED.accepted + EXCLUDED.declined > 0 THEN 0 ELSE stats.consecutive_ignored + EXCLUDED.ignored END,
+		last_ignored = COALESCE(EXCLUDED.last_ignored, stats.last_ignored),
+		accept_latencies = (stats.accept_latencies || EXCLUDED.accept_latencies)[GREATEST(CARDINALITY(stats.accept_latencies) + CARDINALITY(EXCLUDED.accept_latencies) - $2 + 1, 1):],
+		updated = NOW()`
+
+	_, err := tx.Exec(context.Background(), sql, mids, acceptLatencyWindow)
+	return err
+}
+
+// Records the response of a tutor to a single match still MATCHING, moving it to the given status
+// Returns false if the match was no longer MATCHING
+func (r *Repository) respondToMatch(mid string, status string, response string, audit *Audit) (bool, error) {
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	sql := `UPDATE matchings SET status = $2, response = $3, responded = NOW() WHERE id = $1 AND status = 'MATCHING'`
+	tag, err := tx.Exec(context.Background(), sql, mid, status, response)
+	if err != nil {
+		return false, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return false, nil
+	}
+
+	if err = recordResponses(tx, []string{mid}); err != nil {
+		return false, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Accepts a scheduled match on behalf of its tutor and books its lesson in the same transaction
+// Returns false if the match was no longer MATCHING. If the lesson cannot be booked, ErrSlotTaken included, the match is left as it was
+func (r *Repository) AcceptMatch(m Match, subject Subject, audit *Audit) (Lesson, bool, error) {
+	l := newLesson(subject, m.Tutor, m.Student, true, m.StartTime, m.EndTime)
+
+	tx, err := r.dbPool.Begin(context.Background())
+	if err != nil {
+		return l, false, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	// Claim the match first, so a match which expired in the meantime never gets a lesson
+	sql := `UPDATE matchings SET status = 'MATCHED', response = $2, responded = NOW(), lesson = $3 WHERE id = $1 AND status = 'MATCHING'`
+	tag, err := tx.Exec(context.Background(), sql, m.Id, ResponseAccepted, l.Id)
+	if err != nil {
+		return l, false, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return l, false, nil
+	}
+
+	if err = insertLesson(tx, l); err != nil {
+		return l, false, err
+	}
+
+	if err = recordResponses(tx, []string{m.Id}); err != nil {
+		return l, false, err
+	}
+
+	if err = writeAudit(tx, audit); err != nil {
+		return l, false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return l, false, err
+	}
+
+	return l, true, nil
+}
+
+// Declines a match on behalf of its tutor, failing it straight away
+// Returns false if the match was no longer MATCHING
+func (r *Repository) DeclineMatch(mid string) (bool, error) {
+	return r.respondToMatch(mid, "FAILED", ResponseDeclined, nil)
+}
+
+// Withdraws a match its tutor can no longer take, failing it without counting against the tutor
+// Returns false if the match was no longer MATCHING
+func (r *Repository) WithdrawMatch(mid string) (bool, error) {
+	return r.respondToMatch(mid, "FAILED", ResponseWithdrawn, nil)
+}
+
+// Counts the offers of a session still waiting for an answer
+func (r *Repository) CountPendingMatches(token string) (int, error) {
+	sql := `SELECT COUNT(*) FROM matchings WHERE token = $1 AND status = 'MATCHING'`
+
+	var count int
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, token).Scan(&count); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
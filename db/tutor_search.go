@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// Orders tutor search results can be sorted in, mirrors the TutorSort enum of the GraphQL schema
+const (
+	SortByRating    = "RATING"
+	SortByPriceAsc  = "PRICE_ASC"
+	SortByPriceDesc = "PRICE_DESC"
+	SortByAffinity  = "AFFINITY"
+)
+
+// Filters of a tutor search, zero values leave a filter out. Only tutors who can be matched are ever found
+type TutorFilter struct {
+	SubjectName     string
+	SubjectStandard string
+	MinRate         int
+	MaxRate         int
+	MinRating       int
+	StartTime       time.Time
+	EndTime         time.Time
+	Text            string
+	Student         string
+}
+
+// A tutor found by a search, along with the value it was sorted by
+type TutorResult struct {
+	Tutor   Tutor
+	SortKey int
+}
+
+// The filters shared by FilterTutors and CountFilteredTutors, taking the seven parameters of TutorFilter.args
+const tutorFilterSQL = `
+	tutors.email_verified = TRUE AND
+	tutors.suspended = FALSE AND
+	tutors.application_status = 'APPROVED' AND
+	(($1 = '' AND $2 = '') OR EXISTS (
+		SELECT 1 FROM teaching
+		INNER JOIN subjects ON subjects.id = teaching.subject
+		WHERE teaching.tutor = tutors.id AND ($1 = '' OR subjects.name = $1) AND ($2 = '' OR subjects.standard = $2))) AND
+	($3 = 0 OR tutors.hourly_rate >= $3) AND
+	($4 = 0 OR tutors.hourly_rate <= $4) AND
+	tutors.rating >= $5 AND
+	($6::TSTZRANGE IS NULL OR (
+		tutor_available(tutors.id, $6) AND
+		NOT EXISTS (SELECT 1 FROM lessons WHERE lessons.tutor = tutors.id AND lessons.scheduled = TRUE AND lessons.status <> 'CANCELLED' AND lessons.period && $6))) AND
+	($7 = '' OR tutor_search_document(tutors.bio, tutors.education) @@ websearch_to_tsquery('english', $7))`
+
+// The value each sort orders by, whether larger values come first, and so which comparison continues after a cursor
+// Affinity is the best score the student of the filter has with the tutor in any of the searched subjects, passed as the last parameter
+var tutorSortSQL = map[string]struct {
+	key  string
+	desc bool
+}{
+	SortByRating:    {key: `tutors.rating`, desc: true},
+	SortByPriceAsc:  {key: `tutors.hourly_rate`, desc: false},
+	SortByPriceDesc: {key: `tutors.hourly_rate`, desc: true},
+	SortByAffinity: {key: `COALESCE((
+		SELECT MAX(affinity.score) FROM affinity
+		INNER JOIN subjects ON subjects.id = affinity.subject
+		WHERE affinity.tutor = tutors.id AND affinity.student = $11 AND ($1 = '' OR subjects.name = $1) AND ($2 = '' OR subjects.standard = $2)), 0)`, desc: true},
+}
+
+func (f TutorFilter) args() []interface{} {
+	period := pgtype.Tstzrange{Status: pgtype.Null}
+	if !f.StartTime.IsZero() && !f.EndTime.IsZero() {
+		period = getTstzrange(f.StartTime, f.EndTime)
+	}
+
+	return []interface{}{f.SubjectName, f.SubjectStandard, f.MinRate, f.MaxRate, f.MinRating, period, f.Text}
+}
+
+// Finds the tutors matching a filter, sorted by rating, price or affinity with the student of the filter, ties broken by id
+// Pages are continued with keyset pagination, after the sort key and id of the last result of the previous page. An empty afterId starts from the beginning
+// Subjects are not populated, use GetTutorById for the full tutor
+func (r *Repository) FilterTutors(f TutorFilter, sort string, afterKey int, afterId string, limit int) ([]TutorResult, error) {
+	order, ok := tutorSortSQL[sort]
+	if !ok {
+		order = tutorSortSQL[SortByRating]
+	}
+
+	direction, cmp := "ASC", ">"
+	if order.desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	sql := `
+	SELECT id, username, first_name, last_name, email, hashed_password, profile_pic, hourly_rate, bio, rating, rating_score, rating_count, education, status, last_seen, push_token, email_verified, suspended, application_status, sort_key
+	FROM (
+		SELECT tutors.*, ` + order.key + ` AS sort_key
+		FROM tutors
+		WHERE ` + tutorFilterSQL + `
+	) AS results
+	WHERE $8 = '' OR sort_key ` + cmp + ` $9 OR (sort_key = $9 AND id > $8)
+	ORDER BY sort_key ` + direction + `, id
+	LIMIT $10`
+
+	var results []TutorResult
+
+	args := append(f.args(), afterId, afterKey, limit)
+	if sort == SortByAffinity {
+		args = append(args, f.Student)
+	}
+
+	rows, err := r.dbPool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var res TutorResult
+		t := &res.Tutor
+
+		if err := rows.Scan(
+			&t.Id,
+			&t.Username,
+			&t.FirstName,
+			&t.LastName,
+			&t.Email,
+			&t.HashedPassword,
+			&t.ProfilePic,
+			&t.HourlyRate,
+			&t.Bio,
+			&t.Rating,
+			&t.RatingScore,
+			&t.RatingCount,
+			&t.Education,
+			&t.Status,
+			&t.LastSeen,
+			&t.PushToken,
+			&t.EmailVerified,
+			&t.Suspended,
+			&t.ApplicationStatus,
+			&res.SortKey); err != nil {
+			return nil, err
+		}
+
+		results = append(results, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Counts the tutors matching a filter, see FilterTutors
+func (r *Repository) CountFilteredTutors(f TutorFilter) (int, error) {
+	sql := `SELECT COUNT(*) FROM tutors WHERE ` + tutorFilterSQL
+
+	var count int
+
+	if err := r.dbPool.QueryRow(context.Background(), sql, f.args()...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,89 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/pborman/uuid"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// Creates a tutor who can be found by searches, teaching the subject
+func searchableTutor(t *testing.T, repo *db.Repository, sub db.Subject) db.Tutor {
+	tutor := dbtest.Tutor(t, repo)
+
+	if err := repo.SetTutorSubjects(tutor.Id, []string{sub.Id}, nil); err != nil {
+		t.Fatalf("Cannot set tutor subjects: %v", err)
+	}
+
+	if err := repo.SetEmailVerified(tutor.Id); err != nil {
+		t.Fatalf("Cannot verify tutor email: %v", err)
+	}
+
+	steps := [][2]string{{"APPLIED", "DOCUMENTS_SUBMITTED"}, {"DOCUMENTS_SUBMITTED", "UNDER_REVIEW"}, {"UNDER_REVIEW", "APPROVED"}}
+	for _, step := range steps {
+		if _, moved, err := repo.TransitionApplication(tutor.Id, "", step[0], step[1], "", nil); err != nil || !moved {
+			t.Fatalf("Cannot approve tutor, moved %v with error %v", moved, err)
+		}
+	}
+
+	return tutor
+}
+
+// Pages continue after the cursor of the last result, tutors with the same sort key are told apart by id
+func TestFilterTutorsPagesThroughTies(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	// A subject of its own keeps tutors created by other tests out of the results
+	sub, err := repo.GetSubject(uuid.New(), "Test")
+	if err != nil {
+		t.Fatalf("Cannot create subject: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		searchableTutor(t, repo, sub)
+	}
+	unapproved := dbtest.Tutor(t, repo)
+	if err = repo.SetTutorSubjects(unapproved.Id, []string{sub.Id}, nil); err != nil {
+		t.Fatalf("Cannot set tutor subjects: %v", err)
+	}
+
+	f := db.TutorFilter{SubjectName: sub.Name}
+
+	count, err := repo.CountFilteredTutors(f)
+	if err != nil {
+		t.Fatalf("Cannot count tutors: %v", err)
+	}
+
+	if count != 3 {
+		t.Errorf("Counted %d tutors, want 3", count)
+	}
+
+	seen := map[string]bool{}
+	afterKey, afterId := 0, ""
+	for page := 0; page < 3; page++ {
+		results, err := repo.FilterTutors(f, db.SortByPriceAsc, afterKey, afterId, 2)
+		if err != nil {
+			t.Fatalf("Cannot filter tutors: %v", err)
+		}
+
+		if len(results) == 0 {
+			break
+		}
+
+		for _, r := range results {
+			if seen[r.Tutor.Id] {
+				t.Errorf("Tutor %s was found twice", r.Tutor.Id)
+			}
+			seen[r.Tutor.Id] = true
+		}
+
+		last := results[len(results)-1]
+		afterKey, afterId = last.SortKey, last.Tutor.Id
+	}
+
+	if len(seen) != 3 || seen[unapproved.Id] {
+		t.Errorf("Found %d tutors, want the 3 approved ones", len(seen))
+	}
+}
@@ -1,8 +1,11 @@
 package db
 
 import (
-	"github.com/jackc/pgtype"
+	"errors"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgtype"
 )
 
 // Utility function to take two time.Time(s) and construct a tstzrange type in pgtype
@@ -22,3 +25,15 @@ func getTstzrange(startTime time.Time, endTime time.Time) pgtype.Tstzrange {
 		Status:    pgtype.Present,
 	}
 }
+
+// Picks the table a user UUID belongs to from its "s:" or "t:" prefix
+func userTable(uid string) (string, error) {
+	switch {
+	case strings.HasPrefix(uid, "s:"):
+		return "students", nil
+	case strings.HasPrefix(uid, "t:"):
+		return "tutors", nil
+	}
+
+	return "", errors.New("Invalid user id")
+}
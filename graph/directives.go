@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/solderneer/axiom-backend/graph/generated"
+	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/policy"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+// Wires the authorisation directives declared on the schema to the policy service
+func NewDirectiveRoot(ps *policy.PolicyService) generated.DirectiveRoot {
+	return generated.DirectiveRoot{
+		HasRole: func(ctx context.Context, obj interface{}, next graphql.Resolver, roles []model.Role) (interface{}, error) {
+			p, err := auth.PrincipalFromContext(ctx)
+			if err != nil {
+				return nil, Unauthorised
+			}
+
+			allowed := make([]auth.Role, len(roles))
+			for i, role := range roles {
+				allowed[i] = auth.Role(role)
+			}
+
+			if !ps.HasRole(p, allowed) {
+				return nil, Unauthorised
+			}
+
+			return next(ctx)
+		},
+		HasScope: func(ctx context.Context, obj interface{}, next graphql.Resolver, scope string) (interface{}, error) {
+			p, err := auth.PrincipalFromContext(ctx)
+			if err != nil {
+				return nil, Unauthorised
+			}
+
+			if !ps.HasScope(p, scope) {
+				return nil, Unauthorised
+			}
+
+			return next(ctx)
+		},
+		Owner: func(ctx context.Context, obj interface{}, next graphql.Resolver, resource model.Resource) (interface{}, error) {
+			p, err := auth.PrincipalFromContext(ctx)
+			if err != nil {
+				return nil, Unauthorised
+			}
+
+			id, ok := inputId(graphql.GetFieldContext(ctx).Args["input"])
+			if !ok {
+				return nil, Unauthorised
+			}
+
+			owns, err := ps.Owns(p, policy.Resource(resource), id)
+			if err != nil {
+				return nil, InternalServerError
+			}
+
+			if !owns {
+				return nil, Unauthorised
+			}
+
+			return next(ctx)
+		},
+	}
+}
+
+// Reads the id of the resource a field acts on, the input argument is either the id itself or an input object with an ID field
+func inputId(input interface{}) (string, bool) {
+	if id, ok := input.(string); ok {
+		return id, true
+	}
+
+	v := reflect.ValueOf(input)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return "", false
+	}
+
+	f := v.FieldByName("ID")
+	if !f.IsValid() || f.Kind() != reflect.String {
+		return "", false
+	}
+
+	return f.String(), true
+}
@@ -0,0 +1,111 @@
+package graph
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/policy"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+func TestInputId(t *testing.T) {
+	type withId struct{ ID string }
+	type withoutId struct{ Name string }
+	type numericId struct{ ID int }
+
+	tests := []struct {
+		name  string
+		input interface{}
+		id    string
+		ok    bool
+	}{
+		{"plain id", "lesson", "lesson", true},
+		{"input object", withId{ID: "lesson"}, "lesson", true},
+		{"input object pointer", &withId{ID: "lesson"}, "lesson", true},
+		{"no id field", withoutId{Name: "lesson"}, "", false},
+		{"id of another type", numericId{ID: 1}, "", false},
+		{"missing input", nil, "", false},
+		{"number", 1, "", false},
+	}
+
+	for _, tt := range tests {
+		if id, ok := inputId(tt.input); id != tt.id || ok != tt.ok {
+			t.Errorf("%s: got %q %v, want %q %v", tt.name, id, ok, tt.id, tt.ok)
+		}
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	var ps policy.PolicyService
+	ps.Init(logger, nil)
+	d := NewDirectiveRoot(&ps)
+
+	next := func(ctx context.Context) (interface{}, error) {
+		return "resolved", nil
+	}
+
+	as := func(p *auth.Principal, input interface{}) context.Context {
+		ctx := graphql.WithFieldContext(context.Background(), &graphql.FieldContext{Args: map[string]interface{}{"input": input}})
+		if p != nil {
+			ctx = auth.WithPrincipal(ctx, *p)
+		}
+		return ctx
+	}
+
+	tutor := &auth.Principal{Id: "t:1", Role: auth.RoleTutor, Scopes: []string{auth.ScopeEmailVerified}}
+	admin := &auth.Principal{Id: "a:1", Role: auth.RoleAdmin}
+
+	tests := []struct {
+		name    string
+		resolve func() (interface{}, error)
+		err     error
+	}{
+		{"role without login", func() (interface{}, error) {
+			return d.HasRole(as(nil, nil), nil, next, []model.Role{model.RoleTutor})
+		}, Unauthorised},
+		{"matching role", func() (interface{}, error) {
+			return d.HasRole(as(tutor, nil), nil, next, []model.Role{model.RoleStudent, model.RoleTutor})
+		}, nil},
+		{"other role", func() (interface{}, error) {
+			return d.HasRole(as(tutor, nil), nil, next, []model.Role{model.RoleAdmin})
+		}, Unauthorised},
+		{"granted scope", func() (interface{}, error) {
+			return d.HasScope(as(tutor, nil), nil, next, auth.ScopeEmailVerified)
+		}, nil},
+		{"missing scope", func() (interface{}, error) {
+			return d.HasScope(as(admin, nil), nil, next, auth.ScopeEmailVerified)
+		}, Unauthorised},
+		{"owner of themselves", func() (interface{}, error) {
+			return d.Owner(as(tutor, "t:1"), nil, next, model.ResourceTutor)
+		}, nil},
+		{"owner of another tutor", func() (interface{}, error) {
+			return d.Owner(as(tutor, "t:2"), nil, next, model.ResourceTutor)
+		}, Unauthorised},
+		{"owner without an input id", func() (interface{}, error) {
+			return d.Owner(as(tutor, nil), nil, next, model.ResourceTutor)
+		}, Unauthorised},
+		{"admin owns everything", func() (interface{}, error) {
+			return d.Owner(as(admin, "lesson"), nil, next, model.ResourceLesson)
+		}, nil},
+		{"owner without login", func() (interface{}, error) {
+			return d.Owner(as(nil, "t:1"), nil, next, model.ResourceTutor)
+		}, Unauthorised},
+	}
+
+	for _, tt := range tests {
+		res, err := tt.resolve()
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		} else if err == nil && res != "resolved" {
+			t.Errorf("%s: next was not called", tt.name)
+		}
+	}
+}
@@ -7,31 +7,269 @@ import (
 	"io"
 	"strconv"
 	"time"
+
+	"github.com/99designs/gqlgen/graphql"
 )
 
 type User interface {
 	IsUser()
 }
 
+type AdminAffinityKey struct {
+	Tutor   string `json:"tutor"`
+	Student string `json:"student"`
+	Subject string `json:"subject"`
+}
+
+type AdminApplicationQueue struct {
+	Status ApplicationStatus `json:"status"`
+	Limit  *int              `json:"limit"`
+	Offset *int              `json:"offset"`
+}
+
+type AdminApplicationReview struct {
+	Tutor    string              `json:"tutor"`
+	Decision ApplicationDecision `json:"decision"`
+	Notes    *string             `json:"notes"`
+}
+
+type AdminAuditRange struct {
+	Target *string `json:"target"`
+	Limit  *int    `json:"limit"`
+	Offset *int    `json:"offset"`
+}
+
+type AdminLessonReassign struct {
+	Lesson string `json:"lesson"`
+	Tutor  string `json:"tutor"`
+}
+
+type AdminMatchResolve struct {
+	Match      string          `json:"match"`
+	Resolution MatchResolution `json:"resolution"`
+}
+
+type AdminReportQueue struct {
+	Resolved *bool `json:"resolved"`
+	Limit    *int  `json:"limit"`
+	Offset   *int  `json:"offset"`
+}
+
+type AdminReviewModeration struct {
+	Review string `json:"review"`
+	Hidden bool   `json:"hidden"`
+}
+
+type AdminReviewQueue struct {
+	Limit  *int `json:"limit"`
+	Offset *int `json:"offset"`
+}
+
+type AdminSearch struct {
+	Query  *string `json:"query"`
+	Limit  *int    `json:"limit"`
+	Offset *int    `json:"offset"`
+}
+
+type AdminTutorSubjects struct {
+	Tutor    string        `json:"tutor"`
+	Subjects []*NewSubject `json:"subjects"`
+}
+
+type AffinityContribution struct {
+	Signal AffinitySignal `json:"signal"`
+	Lesson string         `json:"lesson"`
+	Time   time.Time      `json:"time"`
+	Points float64        `json:"points"`
+	Weight float64        `json:"weight"`
+	Score  float64        `json:"score"`
+}
+
+type AffinityExplanation struct {
+	Tutor         string                  `json:"tutor"`
+	Student       string                  `json:"student"`
+	Subject       string                  `json:"subject"`
+	Score         int                     `json:"score"`
+	Stored        int                     `json:"stored"`
+	Contributions []*AffinityContribution `json:"contributions"`
+}
+
+type ApplicationReview struct {
+	ID       string            `json:"id"`
+	From     ApplicationStatus `json:"from"`
+	To       ApplicationStatus `json:"to"`
+	Reviewer *string           `json:"reviewer"`
+	Notes    *string           `json:"notes"`
+	Created  time.Time         `json:"created"`
+}
+
+type AuditEntry struct {
+	ID      string    `json:"id"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target"`
+	Before  *string   `json:"before"`
+	After   *string   `json:"after"`
+	Created time.Time `json:"created"`
+}
+
+type AuthPayload struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type Availability struct {
+	Timezone   string                   `json:"timezone"`
+	Rules      []*AvailabilityRule      `json:"rules"`
+	Periods    []*AvailabilityPeriod    `json:"periods"`
+	Exceptions []*AvailabilityException `json:"exceptions"`
+	Windows    []*AvailabilityWindow    `json:"windows"`
+}
+
+type AvailabilityException struct {
+	ID        string    `json:"id"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Reason    string    `json:"reason"`
+}
+
+type AvailabilityPeriod struct {
+	ID        string    `json:"id"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+}
+
+type AvailabilityRule struct {
+	ID        string  `json:"id"`
+	Weekday   Weekday `json:"weekday"`
+	StartTime string  `json:"startTime"`
+	EndTime   string  `json:"endTime"`
+}
+
+type AvailabilityWindow struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+}
+
+type CancelLesson struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type Conversation struct {
+	ID           string                     `json:"id"`
+	Participants []*ConversationParticipant `json:"participants"`
+	LastMessage  *Message                   `json:"lastMessage"`
+	Unread       int                        `json:"unread"`
+	Created      time.Time                  `json:"created"`
+}
+
+type ConversationActivity struct {
+	Conversation string                   `json:"conversation"`
+	Kind         ConversationActivityKind `json:"kind"`
+	From         string                   `json:"from"`
+	Timestamp    time.Time                `json:"timestamp"`
+}
+
+type ConversationParticipant struct {
+	ID       string     `json:"id"`
+	LastRead *time.Time `json:"lastRead"`
+}
+
+type EditMessage struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Text    string `json:"text"`
+}
+
 type Heartbeat struct {
 	Status   HeartbeatStatus `json:"status"`
 	LastSeen int             `json:"lastSeen"`
 }
 
 type Lesson struct {
-	ID        string    `json:"id"`
-	Subject   *Subject  `json:"subject"`
-	Summary   string    `json:"summary"`
-	Tutor     *Tutor    `json:"tutor"`
-	Student   *Student  `json:"student"`
-	Scheduled bool      `json:"scheduled"`
-	StartTime time.Time `json:"startTime"`
-	EndTime   time.Time `json:"endTime"`
+	ID           string              `json:"id"`
+	Subject      *Subject            `json:"subject"`
+	Summary      string              `json:"summary"`
+	Tutor        *Tutor              `json:"tutor"`
+	Student      *Student            `json:"student"`
+	Scheduled    bool                `json:"scheduled"`
+	Status       LessonStatus        `json:"status"`
+	StartTime    time.Time           `json:"startTime"`
+	EndTime      time.Time           `json:"endTime"`
+	Cancellation *LessonCancellation `json:"cancellation"`
+	Reschedules  []*LessonReschedule `json:"reschedules"`
+	Attendance   *LessonAttendance   `json:"attendance"`
+	Report       *LessonReport       `json:"report"`
+	Notes        []*LessonNote       `json:"notes"`
+	Attachments  []*LessonAttachment `json:"attachments"`
+	Review       *Review             `json:"review"`
+}
+
+type LessonAttachment struct {
+	ID          string    `json:"id"`
+	Lesson      string    `json:"lesson"`
+	UploadedBy  string    `json:"uploadedBy"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	URL         string    `json:"url"`
+	Created     time.Time `json:"created"`
+}
+
+type LessonAttendance struct {
+	Started  *time.Time            `json:"started"`
+	Ended    *time.Time            `json:"ended"`
+	Sessions []*ParticipantSession `json:"sessions"`
+}
+
+type LessonCancellation struct {
+	CancelledBy string    `json:"cancelledBy"`
+	Reason      string    `json:"reason"`
+	Late        bool      `json:"late"`
+	Created     time.Time `json:"created"`
+}
+
+type LessonHistory struct {
+	Limit  *int `json:"limit"`
+	Offset *int `json:"offset"`
+}
+
+type LessonNote struct {
+	ID      string    `json:"id"`
+	Lesson  string    `json:"lesson"`
+	Body    string    `json:"body"`
+	Created time.Time `json:"created"`
+}
+
+type LessonPage struct {
+	Total   int       `json:"total"`
+	Lessons []*Lesson `json:"lessons"`
+}
+
+type LessonReport struct {
+	Topics    []string   `json:"topics"`
+	Summary   string     `json:"summary"`
+	Homework  string     `json:"homework"`
+	FollowUp  string     `json:"followUp"`
+	Published *time.Time `json:"published"`
+	Updated   time.Time  `json:"updated"`
+}
+
+type LessonReschedule struct {
+	ID          string           `json:"id"`
+	Lesson      string           `json:"lesson"`
+	RequestedBy string           `json:"requestedBy"`
+	StartTime   time.Time        `json:"startTime"`
+	EndTime     time.Time        `json:"endTime"`
+	Status      RescheduleStatus `json:"status"`
+	Created     time.Time        `json:"created"`
 }
 
 type LoginInfo struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string  `json:"username"`
+	Password   string  `json:"password"`
+	DeviceName *string `json:"deviceName"`
 }
 
 type Match struct {
@@ -51,17 +289,78 @@ type MatchNotification struct {
 	Token   string   `json:"token"`
 }
 
+type MatchStatusUpdate struct {
+	Token     string             `json:"token"`
+	Status    MatchSessionStatus `json:"status"`
+	OfferedTo int                `json:"offeredTo"`
+	Lesson    *Lesson            `json:"lesson"`
+}
+
 type Message struct {
-	To        string    `json:"to"`
-	From      string    `json:"from"`
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
+	ID           string             `json:"id"`
+	Conversation string             `json:"conversation"`
+	To           string             `json:"to"`
+	From         string             `json:"from"`
+	Timestamp    time.Time          `json:"timestamp"`
+	Kind         MessageKind        `json:"kind"`
+	Message      string             `json:"message"`
+	Attachment   *MessageAttachment `json:"attachment"`
+	Lesson       *Lesson            `json:"lesson"`
+	Edited       *time.Time         `json:"edited"`
+	Deleted      *time.Time         `json:"deleted"`
+}
+
+type MessageAttachment struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	ContentType  string  `json:"contentType"`
+	Size         int     `json:"size"`
+	URL          string  `json:"url"`
+	ThumbnailURL *string `json:"thumbnailUrl"`
+	Width        *int    `json:"width"`
+	Height       *int    `json:"height"`
+}
+
+type MessageConnection struct {
+	Edges    []*MessageEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type MessageEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Message `json:"node"`
+}
+
+type MessageEdit struct {
+	Message string    `json:"message"`
+	Edited  time.Time `json:"edited"`
+}
+
+type MessageKey struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+type NewAvailabilityException struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Reason    *string   `json:"reason"`
+}
+
+type NewLessonAttachment struct {
+	ID   string         `json:"id"`
+	File graphql.Upload `json:"file"`
 }
 
-type MessageRange struct {
-	To    string     `json:"to"`
-	Start *time.Time `json:"start"`
-	End   *time.Time `json:"end"`
+type NewLessonNote struct {
+	ID   string `json:"id"`
+	Body string `json:"body"`
+}
+
+type NewReview struct {
+	ID     string `json:"id"`
+	Rating int    `json:"rating"`
+	Body   string `json:"body"`
 }
 
 type NewStudent struct {
@@ -91,6 +390,14 @@ type NewTutor struct {
 	Subjects   []*NewSubject `json:"subjects"`
 }
 
+type NewTutorDocument struct {
+	Kind        DocumentKind `json:"kind"`
+	Name        string       `json:"name"`
+	URL         string       `json:"url"`
+	ContentType string       `json:"contentType"`
+	Size        int          `json:"size"`
+}
+
 type Notification struct {
 	ID       string    `json:"id"`
 	Title    string    `json:"title"`
@@ -103,6 +410,75 @@ type OnDemandMatchRequest struct {
 	Subject *NewSubject `json:"subject"`
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type ParticipantSession struct {
+	Participant string     `json:"participant"`
+	Joined      time.Time  `json:"joined"`
+	Left        *time.Time `json:"left"`
+}
+
+type PasswordReset struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+type ReportUser struct {
+	User   string `json:"user"`
+	Reason string `json:"reason"`
+}
+
+type RequestReschedule struct {
+	ID        string    `json:"id"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+}
+
+type RespondToReschedule struct {
+	ID     string `json:"id"`
+	Accept bool   `json:"accept"`
+}
+
+type Review struct {
+	ID      string     `json:"id"`
+	Lesson  string     `json:"lesson"`
+	Student string     `json:"student"`
+	Tutor   string     `json:"tutor"`
+	Rating  int        `json:"rating"`
+	Body    string     `json:"body"`
+	Reply   *string    `json:"reply"`
+	Replied *time.Time `json:"replied"`
+	Hidden  bool       `json:"hidden"`
+	Flags   int        `json:"flags"`
+	Created time.Time  `json:"created"`
+}
+
+type ReviewConnection struct {
+	Edges      []*ReviewEdge `json:"edges"`
+	PageInfo   *PageInfo     `json:"pageInfo"`
+	TotalCount int           `json:"totalCount"`
+}
+
+type ReviewEdge struct {
+	Cursor string  `json:"cursor"`
+	Node   *Review `json:"node"`
+}
+
+type ReviewFlag struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type ReviewReply struct {
+	ID   string `json:"id"`
+	Body string `json:"body"`
+}
+
 type ScheduledMatchParameters struct {
 	Subject *NewSubject       `json:"subject"`
 	Time    *TimeRangeRequest `json:"time"`
@@ -115,21 +491,40 @@ type ScheduledMatchRequest struct {
 }
 
 type SendMessage struct {
-	To      string `json:"to"`
-	Message string `json:"message"`
+	To      string          `json:"to"`
+	Kind    *MessageKind    `json:"kind"`
+	Message *string         `json:"message"`
+	File    *graphql.Upload `json:"file"`
+	Lesson  *string         `json:"lesson"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"deviceName"`
+	IP         string    `json:"ip"`
+	Created    time.Time `json:"created"`
+	LastUsed   time.Time `json:"lastUsed"`
+	Current    bool      `json:"current"`
 }
 
 type Student struct {
-	ID         string `json:"id"`
-	Username   string `json:"username"`
-	FirstName  string `json:"firstName"`
-	LastName   string `json:"lastName"`
-	Email      string `json:"email"`
-	ProfilePic string `json:"profilePic"`
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	FirstName     string `json:"firstName"`
+	LastName      string `json:"lastName"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	ProfilePic    string `json:"profilePic"`
+	Suspended     bool   `json:"suspended"`
 }
 
 func (Student) IsUser() {}
 
+type StudentPage struct {
+	Total    int        `json:"total"`
+	Students []*Student `json:"students"`
+}
+
 type Subject struct {
 	Name     SubjectName     `json:"name"`
 	Standard SubjectStandard `json:"standard"`
@@ -141,153 +536,908 @@ type TimeRangeRequest struct {
 }
 
 type Tutor struct {
-	ID         string     `json:"id"`
-	Username   string     `json:"username"`
-	FirstName  string     `json:"firstName"`
-	LastName   string     `json:"lastName"`
-	Email      string     `json:"email"`
-	ProfilePic string     `json:"profilePic"`
-	HourlyRate int        `json:"hourlyRate"`
-	Bio        string     `json:"bio"`
-	Rating     int        `json:"rating"`
-	Education  []string   `json:"education"`
-	Subjects   []*Subject `json:"subjects"`
+	ID                string                `json:"id"`
+	Username          string                `json:"username"`
+	FirstName         string                `json:"firstName"`
+	LastName          string                `json:"lastName"`
+	Email             string                `json:"email"`
+	EmailVerified     bool                  `json:"emailVerified"`
+	ProfilePic        string                `json:"profilePic"`
+	HourlyRate        int                   `json:"hourlyRate"`
+	Bio               string                `json:"bio"`
+	Rating            int                   `json:"rating"`
+	RatingScore       float64               `json:"ratingScore"`
+	RatingCount       int                   `json:"ratingCount"`
+	Reviews           *ReviewConnection     `json:"reviews"`
+	Education         []string              `json:"education"`
+	Subjects          []*Subject            `json:"subjects"`
+	ApplicationStatus ApplicationStatus     `json:"applicationStatus"`
+	Availability      []*AvailabilityWindow `json:"availability"`
+	Suspended         bool                  `json:"suspended"`
 }
 
 func (Tutor) IsUser() {}
 
+type TutorApplication struct {
+	Tutor     *Tutor               `json:"tutor"`
+	Status    ApplicationStatus    `json:"status"`
+	Documents []*TutorDocument     `json:"documents"`
+	Reviews   []*ApplicationReview `json:"reviews"`
+}
+
+type TutorConnection struct {
+	Edges      []*TutorEdge `json:"edges"`
+	PageInfo   *PageInfo    `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type TutorDocument struct {
+	ID          string       `json:"id"`
+	Kind        DocumentKind `json:"kind"`
+	Name        string       `json:"name"`
+	URL         string       `json:"url"`
+	ContentType string       `json:"contentType"`
+	Size        int          `json:"size"`
+	Created     time.Time    `json:"created"`
+}
+
+type TutorEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Tutor `json:"node"`
+}
+
+type TutorPage struct {
+	Total  int      `json:"total"`
+	Tutors []*Tutor `json:"tutors"`
+}
+
+type TutorResponseStats struct {
+	Tutor               string     `json:"tutor"`
+	Offers              int        `json:"offers"`
+	Accepted            int        `json:"accepted"`
+	Declined            int        `json:"declined"`
+	Ignored             int        `json:"ignored"`
+	ConsecutiveIgnored  int        `json:"consecutiveIgnored"`
+	MedianAcceptSeconds *float64   `json:"medianAcceptSeconds"`
+	DeprioritisedUntil  *time.Time `json:"deprioritisedUntil"`
+}
+
+type TutorSearch struct {
+	Subject   *SubjectName      `json:"subject"`
+	Standard  *SubjectStandard  `json:"standard"`
+	MinRate   *int              `json:"minRate"`
+	MaxRate   *int              `json:"maxRate"`
+	MinRating *int              `json:"minRating"`
+	Available *TimeRangeRequest `json:"available"`
+	Text      *string           `json:"text"`
+	Sort      *TutorSort        `json:"sort"`
+}
+
+type UpdateAvailability struct {
+	ID        string    `json:"id"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+}
+
 type UpdateNotification struct {
 	ID   string `json:"id"`
 	Read bool   `json:"read"`
 }
 
-type HeartbeatStatus string
+type UserReport struct {
+	ID           string    `json:"id"`
+	Reporter     string    `json:"reporter"`
+	Reported     string    `json:"reported"`
+	Conversation *string   `json:"conversation"`
+	Reason       string    `json:"reason"`
+	Resolved     bool      `json:"resolved"`
+	Created      time.Time `json:"created"`
+}
+
+type WeeklyAvailability struct {
+	Timezone string                    `json:"timezone"`
+	Rules    []*WeeklyAvailabilityRule `json:"rules"`
+}
+
+type WeeklyAvailabilityRule struct {
+	Weekday   Weekday `json:"weekday"`
+	StartTime string  `json:"startTime"`
+	EndTime   string  `json:"endTime"`
+}
+
+type WriteLessonReport struct {
+	ID       string   `json:"id"`
+	Topics   []string `json:"topics"`
+	Summary  string   `json:"summary"`
+	Homework *string  `json:"homework"`
+	FollowUp *string  `json:"followUp"`
+}
+
+type AffinitySignal string
 
 const (
-	HeartbeatStatusAvailable   HeartbeatStatus = "AVAILABLE"
-	HeartbeatStatusUnavailable HeartbeatStatus = "UNAVAILABLE"
+	AffinitySignalCompleted     AffinitySignal = "COMPLETED"
+	AffinitySignalRebooked      AffinitySignal = "REBOOKED"
+	AffinitySignalReviewed      AffinitySignal = "REVIEWED"
+	AffinitySignalCancelled     AffinitySignal = "CANCELLED"
+	AffinitySignalLateCancelled AffinitySignal = "LATE_CANCELLED"
+	AffinitySignalNoShow        AffinitySignal = "NO_SHOW"
 )
 
-var AllHeartbeatStatus = []HeartbeatStatus{
-	HeartbeatStatusAvailable,
-	HeartbeatStatusUnavailable,
+var AllAffinitySignal = []AffinitySignal{
+	AffinitySignalCompleted,
+	AffinitySignalRebooked,
+	AffinitySignalReviewed,
+	AffinitySignalCancelled,
+	AffinitySignalLateCancelled,
+	AffinitySignalNoShow,
 }
 
-func (e HeartbeatStatus) IsValid() bool {
+func (e AffinitySignal) IsValid() bool {
 	switch e {
-	case HeartbeatStatusAvailable, HeartbeatStatusUnavailable:
+	case AffinitySignalCompleted, AffinitySignalRebooked, AffinitySignalReviewed, AffinitySignalCancelled, AffinitySignalLateCancelled, AffinitySignalNoShow:
 		return true
 	}
 	return false
 }
 
-func (e HeartbeatStatus) String() string {
+func (e AffinitySignal) String() string {
 	return string(e)
 }
 
-func (e *HeartbeatStatus) UnmarshalGQL(v interface{}) error {
+func (e *AffinitySignal) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = HeartbeatStatus(str)
+	*e = AffinitySignal(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid HeartbeatStatus", str)
+		return fmt.Errorf("%s is not a valid AffinitySignal", str)
 	}
 	return nil
 }
 
-func (e HeartbeatStatus) MarshalGQL(w io.Writer) {
+func (e AffinitySignal) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type SubjectName string
+type ApplicationDecision string
 
 const (
-	SubjectNamePhysics     SubjectName = "PHYSICS"
-	SubjectNameEconomics   SubjectName = "ECONOMICS"
-	SubjectNameMathematics SubjectName = "MATHEMATICS"
-	SubjectNameChemistry   SubjectName = "CHEMISTRY"
-	SubjectNameBiology     SubjectName = "BIOLOGY"
+	ApplicationDecisionApprove ApplicationDecision = "APPROVE"
+	ApplicationDecisionReject  ApplicationDecision = "REJECT"
 )
 
-var AllSubjectName = []SubjectName{
-	SubjectNamePhysics,
-	SubjectNameEconomics,
-	SubjectNameMathematics,
-	SubjectNameChemistry,
-	SubjectNameBiology,
+var AllApplicationDecision = []ApplicationDecision{
+	ApplicationDecisionApprove,
+	ApplicationDecisionReject,
 }
 
-func (e SubjectName) IsValid() bool {
+func (e ApplicationDecision) IsValid() bool {
 	switch e {
-	case SubjectNamePhysics, SubjectNameEconomics, SubjectNameMathematics, SubjectNameChemistry, SubjectNameBiology:
+	case ApplicationDecisionApprove, ApplicationDecisionReject:
 		return true
 	}
 	return false
 }
 
-func (e SubjectName) String() string {
+func (e ApplicationDecision) String() string {
 	return string(e)
 }
 
-func (e *SubjectName) UnmarshalGQL(v interface{}) error {
+func (e *ApplicationDecision) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = SubjectName(str)
+	*e = ApplicationDecision(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid SubjectName", str)
+		return fmt.Errorf("%s is not a valid ApplicationDecision", str)
 	}
 	return nil
 }
 
-func (e SubjectName) MarshalGQL(w io.Writer) {
+func (e ApplicationDecision) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type SubjectStandard string
+type ApplicationStatus string
 
 const (
-	SubjectStandardAlevels SubjectStandard = "ALEVELS"
-	SubjectStandardOlevels SubjectStandard = "OLEVELS"
-	SubjectStandardIb      SubjectStandard = "IB"
+	ApplicationStatusApplied            ApplicationStatus = "APPLIED"
+	ApplicationStatusDocumentsSubmitted ApplicationStatus = "DOCUMENTS_SUBMITTED"
+	ApplicationStatusUnderReview        ApplicationStatus = "UNDER_REVIEW"
+	ApplicationStatusApproved           ApplicationStatus = "APPROVED"
+	ApplicationStatusRejected           ApplicationStatus = "REJECTED"
 )
 
-var AllSubjectStandard = []SubjectStandard{
-	SubjectStandardAlevels,
-	SubjectStandardOlevels,
-	SubjectStandardIb,
+var AllApplicationStatus = []ApplicationStatus{
+	ApplicationStatusApplied,
+	ApplicationStatusDocumentsSubmitted,
+	ApplicationStatusUnderReview,
+	ApplicationStatusApproved,
+	ApplicationStatusRejected,
 }
 
-func (e SubjectStandard) IsValid() bool {
+func (e ApplicationStatus) IsValid() bool {
 	switch e {
-	case SubjectStandardAlevels, SubjectStandardOlevels, SubjectStandardIb:
+	case ApplicationStatusApplied, ApplicationStatusDocumentsSubmitted, ApplicationStatusUnderReview, ApplicationStatusApproved, ApplicationStatusRejected:
 		return true
 	}
 	return false
 }
 
-func (e SubjectStandard) String() string {
+func (e ApplicationStatus) String() string {
 	return string(e)
 }
 
-func (e *SubjectStandard) UnmarshalGQL(v interface{}) error {
+func (e *ApplicationStatus) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = SubjectStandard(str)
+	*e = ApplicationStatus(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid SubjectStandard", str)
+		return fmt.Errorf("%s is not a valid ApplicationStatus", str)
 	}
 	return nil
 }
 
-func (e SubjectStandard) MarshalGQL(w io.Writer) {
+func (e ApplicationStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ConversationActivityKind string
+
+const (
+	ConversationActivityKindTyping ConversationActivityKind = "TYPING"
+	ConversationActivityKindRead   ConversationActivityKind = "READ"
+)
+
+var AllConversationActivityKind = []ConversationActivityKind{
+	ConversationActivityKindTyping,
+	ConversationActivityKindRead,
+}
+
+func (e ConversationActivityKind) IsValid() bool {
+	switch e {
+	case ConversationActivityKindTyping, ConversationActivityKindRead:
+		return true
+	}
+	return false
+}
+
+func (e ConversationActivityKind) String() string {
+	return string(e)
+}
+
+func (e *ConversationActivityKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ConversationActivityKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ConversationActivityKind", str)
+	}
+	return nil
+}
+
+func (e ConversationActivityKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type DocumentKind string
+
+const (
+	DocumentKindDegree      DocumentKind = "DEGREE"
+	DocumentKindTranscript  DocumentKind = "TRANSCRIPT"
+	DocumentKindCertificate DocumentKind = "CERTIFICATE"
+	DocumentKindIDEntity    DocumentKind = "IDENTITY"
+	DocumentKindOther       DocumentKind = "OTHER"
+)
+
+var AllDocumentKind = []DocumentKind{
+	DocumentKindDegree,
+	DocumentKindTranscript,
+	DocumentKindCertificate,
+	DocumentKindIDEntity,
+	DocumentKindOther,
+}
+
+func (e DocumentKind) IsValid() bool {
+	switch e {
+	case DocumentKindDegree, DocumentKindTranscript, DocumentKindCertificate, DocumentKindIDEntity, DocumentKindOther:
+		return true
+	}
+	return false
+}
+
+func (e DocumentKind) String() string {
+	return string(e)
+}
+
+func (e *DocumentKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DocumentKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DocumentKind", str)
+	}
+	return nil
+}
+
+func (e DocumentKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type HeartbeatStatus string
+
+const (
+	HeartbeatStatusAvailable   HeartbeatStatus = "AVAILABLE"
+	HeartbeatStatusUnavailable HeartbeatStatus = "UNAVAILABLE"
+)
+
+var AllHeartbeatStatus = []HeartbeatStatus{
+	HeartbeatStatusAvailable,
+	HeartbeatStatusUnavailable,
+}
+
+func (e HeartbeatStatus) IsValid() bool {
+	switch e {
+	case HeartbeatStatusAvailable, HeartbeatStatusUnavailable:
+		return true
+	}
+	return false
+}
+
+func (e HeartbeatStatus) String() string {
+	return string(e)
+}
+
+func (e *HeartbeatStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = HeartbeatStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid HeartbeatStatus", str)
+	}
+	return nil
+}
+
+func (e HeartbeatStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type LessonStatus string
+
+const (
+	LessonStatusScheduled  LessonStatus = "SCHEDULED"
+	LessonStatusInProgress LessonStatus = "IN_PROGRESS"
+	LessonStatusCompleted  LessonStatus = "COMPLETED"
+	LessonStatusCancelled  LessonStatus = "CANCELLED"
+	LessonStatusNoShow     LessonStatus = "NO_SHOW"
+)
+
+var AllLessonStatus = []LessonStatus{
+	LessonStatusScheduled,
+	LessonStatusInProgress,
+	LessonStatusCompleted,
+	LessonStatusCancelled,
+	LessonStatusNoShow,
+}
+
+func (e LessonStatus) IsValid() bool {
+	switch e {
+	case LessonStatusScheduled, LessonStatusInProgress, LessonStatusCompleted, LessonStatusCancelled, LessonStatusNoShow:
+		return true
+	}
+	return false
+}
+
+func (e LessonStatus) String() string {
+	return string(e)
+}
+
+func (e *LessonStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LessonStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LessonStatus", str)
+	}
+	return nil
+}
+
+func (e LessonStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type MatchResolution string
+
+const (
+	MatchResolutionAccept MatchResolution = "ACCEPT"
+	MatchResolutionFail   MatchResolution = "FAIL"
+)
+
+var AllMatchResolution = []MatchResolution{
+	MatchResolutionAccept,
+	MatchResolutionFail,
+}
+
+func (e MatchResolution) IsValid() bool {
+	switch e {
+	case MatchResolutionAccept, MatchResolutionFail:
+		return true
+	}
+	return false
+}
+
+func (e MatchResolution) String() string {
+	return string(e)
+}
+
+func (e *MatchResolution) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MatchResolution(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MatchResolution", str)
+	}
+	return nil
+}
+
+func (e MatchResolution) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type MatchSessionStatus string
+
+const (
+	MatchSessionStatusSearching MatchSessionStatus = "SEARCHING"
+	MatchSessionStatusOffered   MatchSessionStatus = "OFFERED"
+	MatchSessionStatusMatched   MatchSessionStatus = "MATCHED"
+	MatchSessionStatusExhausted MatchSessionStatus = "EXHAUSTED"
+	MatchSessionStatusCancelled MatchSessionStatus = "CANCELLED"
+)
+
+var AllMatchSessionStatus = []MatchSessionStatus{
+	MatchSessionStatusSearching,
+	MatchSessionStatusOffered,
+	MatchSessionStatusMatched,
+	MatchSessionStatusExhausted,
+	MatchSessionStatusCancelled,
+}
+
+func (e MatchSessionStatus) IsValid() bool {
+	switch e {
+	case MatchSessionStatusSearching, MatchSessionStatusOffered, MatchSessionStatusMatched, MatchSessionStatusExhausted, MatchSessionStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (e MatchSessionStatus) String() string {
+	return string(e)
+}
+
+func (e *MatchSessionStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MatchSessionStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MatchSessionStatus", str)
+	}
+	return nil
+}
+
+func (e MatchSessionStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type MessageKind string
+
+const (
+	MessageKindText   MessageKind = "TEXT"
+	MessageKindImage  MessageKind = "IMAGE"
+	MessageKindFile   MessageKind = "FILE"
+	MessageKindMath   MessageKind = "MATH"
+	MessageKindLesson MessageKind = "LESSON"
+)
+
+var AllMessageKind = []MessageKind{
+	MessageKindText,
+	MessageKindImage,
+	MessageKindFile,
+	MessageKindMath,
+	MessageKindLesson,
+}
+
+func (e MessageKind) IsValid() bool {
+	switch e {
+	case MessageKindText, MessageKindImage, MessageKindFile, MessageKindMath, MessageKindLesson:
+		return true
+	}
+	return false
+}
+
+func (e MessageKind) String() string {
+	return string(e)
+}
+
+func (e *MessageKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MessageKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MessageKind", str)
+	}
+	return nil
+}
+
+func (e MessageKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RescheduleStatus string
+
+const (
+	RescheduleStatusPending   RescheduleStatus = "PENDING"
+	RescheduleStatusAccepted  RescheduleStatus = "ACCEPTED"
+	RescheduleStatusDeclined  RescheduleStatus = "DECLINED"
+	RescheduleStatusCancelled RescheduleStatus = "CANCELLED"
+)
+
+var AllRescheduleStatus = []RescheduleStatus{
+	RescheduleStatusPending,
+	RescheduleStatusAccepted,
+	RescheduleStatusDeclined,
+	RescheduleStatusCancelled,
+}
+
+func (e RescheduleStatus) IsValid() bool {
+	switch e {
+	case RescheduleStatusPending, RescheduleStatusAccepted, RescheduleStatusDeclined, RescheduleStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (e RescheduleStatus) String() string {
+	return string(e)
+}
+
+func (e *RescheduleStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RescheduleStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RescheduleStatus", str)
+	}
+	return nil
+}
+
+func (e RescheduleStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Resource string
+
+const (
+	ResourceLesson                Resource = "LESSON"
+	ResourceMatch                 Resource = "MATCH"
+	ResourceMatchSession          Resource = "MATCH_SESSION"
+	ResourceNotification          Resource = "NOTIFICATION"
+	ResourceSession               Resource = "SESSION"
+	ResourceTutorDocument         Resource = "TUTOR_DOCUMENT"
+	ResourceAvailability          Resource = "AVAILABILITY"
+	ResourceAvailabilityException Resource = "AVAILABILITY_EXCEPTION"
+	ResourceLessonReschedule      Resource = "LESSON_RESCHEDULE"
+	ResourceLessonNote            Resource = "LESSON_NOTE"
+	ResourceLessonAttachment      Resource = "LESSON_ATTACHMENT"
+	ResourceReview                Resource = "REVIEW"
+	ResourceTutor                 Resource = "TUTOR"
+	ResourceConversation          Resource = "CONVERSATION"
+	ResourceMessageAttachment     Resource = "MESSAGE_ATTACHMENT"
+)
+
+var AllResource = []Resource{
+	ResourceLesson,
+	ResourceMatch,
+	ResourceMatchSession,
+	ResourceNotification,
+	ResourceSession,
+	ResourceTutorDocument,
+	ResourceAvailability,
+	ResourceAvailabilityException,
+	ResourceLessonReschedule,
+	ResourceLessonNote,
+	ResourceLessonAttachment,
+	ResourceReview,
+	ResourceTutor,
+	ResourceConversation,
+	ResourceMessageAttachment,
+}
+
+func (e Resource) IsValid() bool {
+	switch e {
+	case ResourceLesson, ResourceMatch, ResourceMatchSession, ResourceNotification, ResourceSession, ResourceTutorDocument, ResourceAvailability, ResourceAvailabilityException, ResourceLessonReschedule, ResourceLessonNote, ResourceLessonAttachment, ResourceReview, ResourceTutor, ResourceConversation, ResourceMessageAttachment:
+		return true
+	}
+	return false
+}
+
+func (e Resource) String() string {
+	return string(e)
+}
+
+func (e *Resource) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Resource(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Resource", str)
+	}
+	return nil
+}
+
+func (e Resource) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Role string
+
+const (
+	RoleStudent Role = "STUDENT"
+	RoleTutor   Role = "TUTOR"
+	RoleAdmin   Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleStudent,
+	RoleTutor,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleStudent, RoleTutor, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubjectName string
+
+const (
+	SubjectNamePhysics     SubjectName = "PHYSICS"
+	SubjectNameEconomics   SubjectName = "ECONOMICS"
+	SubjectNameMathematics SubjectName = "MATHEMATICS"
+	SubjectNameChemistry   SubjectName = "CHEMISTRY"
+	SubjectNameBiology     SubjectName = "BIOLOGY"
+)
+
+var AllSubjectName = []SubjectName{
+	SubjectNamePhysics,
+	SubjectNameEconomics,
+	SubjectNameMathematics,
+	SubjectNameChemistry,
+	SubjectNameBiology,
+}
+
+func (e SubjectName) IsValid() bool {
+	switch e {
+	case SubjectNamePhysics, SubjectNameEconomics, SubjectNameMathematics, SubjectNameChemistry, SubjectNameBiology:
+		return true
+	}
+	return false
+}
+
+func (e SubjectName) String() string {
+	return string(e)
+}
+
+func (e *SubjectName) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubjectName(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubjectName", str)
+	}
+	return nil
+}
+
+func (e SubjectName) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubjectStandard string
+
+const (
+	SubjectStandardAlevels SubjectStandard = "ALEVELS"
+	SubjectStandardOlevels SubjectStandard = "OLEVELS"
+	SubjectStandardIb      SubjectStandard = "IB"
+)
+
+var AllSubjectStandard = []SubjectStandard{
+	SubjectStandardAlevels,
+	SubjectStandardOlevels,
+	SubjectStandardIb,
+}
+
+func (e SubjectStandard) IsValid() bool {
+	switch e {
+	case SubjectStandardAlevels, SubjectStandardOlevels, SubjectStandardIb:
+		return true
+	}
+	return false
+}
+
+func (e SubjectStandard) String() string {
+	return string(e)
+}
+
+func (e *SubjectStandard) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubjectStandard(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubjectStandard", str)
+	}
+	return nil
+}
+
+func (e SubjectStandard) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TutorSort string
+
+const (
+	TutorSortRating    TutorSort = "RATING"
+	TutorSortPriceAsc  TutorSort = "PRICE_ASC"
+	TutorSortPriceDesc TutorSort = "PRICE_DESC"
+	TutorSortAffinity  TutorSort = "AFFINITY"
+)
+
+var AllTutorSort = []TutorSort{
+	TutorSortRating,
+	TutorSortPriceAsc,
+	TutorSortPriceDesc,
+	TutorSortAffinity,
+}
+
+func (e TutorSort) IsValid() bool {
+	switch e {
+	case TutorSortRating, TutorSortPriceAsc, TutorSortPriceDesc, TutorSortAffinity:
+		return true
+	}
+	return false
+}
+
+func (e TutorSort) String() string {
+	return string(e)
+}
+
+func (e *TutorSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TutorSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TutorSort", str)
+	}
+	return nil
+}
+
+func (e TutorSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Weekday string
+
+const (
+	WeekdaySunday    Weekday = "SUNDAY"
+	WeekdayMonday    Weekday = "MONDAY"
+	WeekdayTuesday   Weekday = "TUESDAY"
+	WeekdayWednesday Weekday = "WEDNESDAY"
+	WeekdayThursday  Weekday = "THURSDAY"
+	WeekdayFriday    Weekday = "FRIDAY"
+	WeekdaySaturday  Weekday = "SATURDAY"
+)
+
+var AllWeekday = []Weekday{
+	WeekdaySunday,
+	WeekdayMonday,
+	WeekdayTuesday,
+	WeekdayWednesday,
+	WeekdayThursday,
+	WeekdayFriday,
+	WeekdaySaturday,
+}
+
+func (e Weekday) IsValid() bool {
+	switch e {
+	case WeekdaySunday, WeekdayMonday, WeekdayTuesday, WeekdayWednesday, WeekdayThursday, WeekdayFriday, WeekdaySaturday:
+		return true
+	}
+	return false
+}
+
+func (e Weekday) String() string {
+	return string(e)
+}
+
+func (e *Weekday) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Weekday(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Weekday", str)
+	}
+	return nil
+}
+
+func (e Weekday) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
@@ -8,9 +8,16 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/account"
+	"github.com/solderneer/axiom-backend/services/admin"
+	"github.com/solderneer/axiom-backend/services/availability"
 	"github.com/solderneer/axiom-backend/services/chat"
+	"github.com/solderneer/axiom-backend/services/lesson"
 	"github.com/solderneer/axiom-backend/services/match"
 	"github.com/solderneer/axiom-backend/services/notifs"
+	"github.com/solderneer/axiom-backend/services/onboarding"
+	"github.com/solderneer/axiom-backend/services/review"
+	"github.com/solderneer/axiom-backend/services/session"
 	"github.com/solderneer/axiom-backend/services/video"
 )
 
@@ -22,4 +29,11 @@ type Resolver struct {
 	Cs     *chat.Chat
 	Video  *video.VideoClient
 	Ms     *match.MatchService
+	Ss     *session.SessionService
+	As     *account.AccountService
+	Adm    *admin.AdminService
+	Obs    *onboarding.OnboardingService
+	Avs    *availability.AvailabilityService
+	Ls     *lesson.LessonService
+	Rvs    *review.ReviewService
 }
@@ -6,67 +6,213 @@ package graph
 import (
 	"context"
 	"errors"
-	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/solderneer/axiom-backend/db"
 	"github.com/solderneer/axiom-backend/graph/generated"
 	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/account"
+	"github.com/solderneer/axiom-backend/services/availability"
+	"github.com/solderneer/axiom-backend/services/chat"
+	"github.com/solderneer/axiom-backend/services/lesson"
+	"github.com/solderneer/axiom-backend/services/onboarding"
+	"github.com/solderneer/axiom-backend/services/session"
 	"github.com/solderneer/axiom-backend/utilities/auth"
 )
 
-func (r *mutationResolver) CreateStudent(ctx context.Context, input model.NewStudent) (string, error) {
+func (r *lessonResolver) Cancellation(ctx context.Context, obj *model.Lesson) (*model.LessonCancellation, error) {
+	c, err := r.Ls.Cancellation(obj.ID)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	if c == nil {
+		return nil, nil
+	}
+
+	mc := r.Repo.ToLessonCancellationModel(*c)
+	return &mc, nil
+}
+
+func (r *lessonResolver) Reschedules(ctx context.Context, obj *model.Lesson) ([]*model.LessonReschedule, error) {
+	reschedules, err := r.Ls.Reschedules(obj.ID)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	mreschedules := []*model.LessonReschedule{}
+	for _, lr := range reschedules {
+		mlr := r.Repo.ToLessonRescheduleModel(lr)
+		mreschedules = append(mreschedules, &mlr)
+	}
+
+	return mreschedules, nil
+}
+
+func (r *lessonResolver) Attendance(ctx context.Context, obj *model.Lesson) (*model.LessonAttendance, error) {
+	a, err := r.Ls.Attendance(obj.ID)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	ma := &model.LessonAttendance{Started: a.Room.Started, Ended: a.Room.Ended, Sessions: []*model.ParticipantSession{}}
+	for _, session := range a.Sessions {
+		ms := r.Repo.ToParticipantSessionModel(session)
+		ma.Sessions = append(ma.Sessions, &ms)
+	}
+
+	return ma, nil
+}
+
+func (r *lessonResolver) Report(ctx context.Context, obj *model.Lesson) (*model.LessonReport, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rep, err := r.Ls.Report(p.Id, obj.ID)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	if rep == nil {
+		return nil, nil
+	}
+
+	mrep := r.Repo.ToLessonReportModel(*rep)
+	return &mrep, nil
+}
+
+func (r *lessonResolver) Notes(ctx context.Context, obj *model.Lesson) ([]*model.LessonNote, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Notes are private, everyone only ever sees their own
+	notes, err := r.Ls.Notes(p.Id, obj.ID)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	mnotes := []*model.LessonNote{}
+	for _, n := range notes {
+		mn := r.Repo.ToLessonNoteModel(n)
+		mnotes = append(mnotes, &mn)
+	}
+
+	return mnotes, nil
+}
+
+func (r *lessonResolver) Attachments(ctx context.Context, obj *model.Lesson) ([]*model.LessonAttachment, error) {
+	attachments, err := r.Ls.Attachments(obj.ID)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	mattachments := []*model.LessonAttachment{}
+	for _, a := range attachments {
+		ma := r.Repo.ToLessonAttachmentModel(a, lesson.AttachmentPath+a.Id)
+		mattachments = append(mattachments, &ma)
+	}
+
+	return mattachments, nil
+}
+
+func (r *lessonResolver) Review(ctx context.Context, obj *model.Lesson) (*model.Review, error) {
+	rv, err := r.Rvs.LessonReview(obj.ID)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	if rv == nil {
+		return nil, nil
+	}
+
+	mrv := r.Repo.ToReviewModel(*rv)
+	return &mrv, nil
+}
+
+func (r *messageResolver) Lesson(ctx context.Context, obj *model.Message) (*model.Lesson, error) {
+	if obj.Lesson == nil {
+		return nil, nil
+	}
+
+	l, err := r.Cs.SharedLesson(obj.Lesson.ID)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve shared lesson")
+		return nil, InternalServerError
+	}
+
+	if l == nil {
+		return nil, nil
+	}
+
+	ml, err := r.Repo.ToLessonModel(*l)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve shared lesson")
+		return nil, InternalServerError
+	}
+	return &ml, nil
+}
+
+func (r *mutationResolver) CreateStudent(ctx context.Context, input model.NewStudent) (*model.AuthPayload, error) {
 	// Hashing password
 	hashedPassword, err := auth.HashPassword(input.Password)
 	if err != nil {
 		r.sendError(err, "Cannot hash password")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
 	s, err := r.Repo.CreateStudent(input.Username, input.FirstName, input.LastName, input.Email, hashedPassword, input.ProfilePic)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	token, err := auth.GenerateToken(s.Id, r.Secret)
+	// Signing up still succeeds if the email cannot be sent, it can be requested again
+	r.As.SendVerificationEmail(s.Id)
+
+	tokens, err := r.Ss.Start(s.Id, "", auth.IPFromContext(ctx))
 	if err != nil {
-		r.sendError(err, "Cannot generate JWT")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
-	return token, nil
+	return toAuthPayload(tokens), nil
 }
 
-func (r *mutationResolver) LoginStudent(ctx context.Context, input model.LoginInfo) (string, error) {
+func (r *mutationResolver) LoginStudent(ctx context.Context, input model.LoginInfo) (*model.AuthPayload, error) {
 	s, err := r.Repo.GetStudentByUsername(input.Username)
 	if err != nil {
 		r.Logger.WithFields(log.Fields{
 			"err": err.Error(),
 		}).Error("Cannot log in")
-		return "", errors.New("Invalid username")
+		return nil, errors.New("Invalid username")
 	}
 
 	ok := auth.CheckPasswordHash(input.Password, s.HashedPassword)
 	if !ok {
-		return "", errors.New("Invalid password")
+		return nil, errors.New("Invalid password")
+	}
+
+	if s.Suspended {
+		return nil, errors.New("Account suspended")
 	}
 
-	token, err := auth.GenerateToken(s.Id, r.Secret)
+	tokens, err := r.Ss.Start(s.Id, deviceName(input.DeviceName), auth.IPFromContext(ctx))
 	if err != nil {
-		r.sendError(err, "Cannot generate JWT")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
-	return token, nil
+	return toAuthPayload(tokens), nil
 }
 
-func (r *mutationResolver) CreateTutor(ctx context.Context, input model.NewTutor) (string, error) {
+func (r *mutationResolver) CreateTutor(ctx context.Context, input model.NewTutor) (*model.AuthPayload, error) {
 	// Hashing password
 	hashedPassword, err := auth.HashPassword(input.Password)
 	if err != nil {
 		r.sendError(err, "Cannot hash password")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
 	// DEFAULT RATING IS 3
@@ -74,7 +220,7 @@ func (r *mutationResolver) CreateTutor(ctx context.Context, input model.NewTutor
 	subjects, err := r.Repo.GetSubjects(input.Subjects)
 	if err != nil {
 		r.sendError(err, "Cannnot retrieve subjects from database")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
 	var subids []string
@@ -85,730 +231,1758 @@ func (r *mutationResolver) CreateTutor(ctx context.Context, input model.NewTutor
 	t, err := r.Repo.CreateTutor(input.Username, input.FirstName, input.LastName, input.Email, hashedPassword, input.ProfilePic, input.HourlyRate, 3, input.Bio, input.Education, subids)
 	if err != nil {
 		r.sendError(err, "Cannot create tutor in database")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
-	token, err := auth.GenerateToken(t.Id, r.Secret)
+	// Signing up still succeeds if the email cannot be sent, it can be requested again
+	r.As.SendVerificationEmail(t.Id)
+
+	tokens, err := r.Ss.Start(t.Id, "", auth.IPFromContext(ctx))
 	if err != nil {
-		r.sendError(err, "Cannot generate JWT")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
-	return token, nil
+	return toAuthPayload(tokens), nil
 }
 
-func (r *mutationResolver) LoginTutor(ctx context.Context, input model.LoginInfo) (string, error) {
+func (r *mutationResolver) LoginTutor(ctx context.Context, input model.LoginInfo) (*model.AuthPayload, error) {
 	t, err := r.Repo.GetTutorByUsername(input.Username)
 	if err != nil {
-		return "", errors.New("Invalid username")
+		return nil, errors.New("Invalid username")
 	}
 
 	ok := auth.CheckPasswordHash(input.Password, t.HashedPassword)
 	if !ok {
-		return "", errors.New("Invalid password")
+		return nil, errors.New("Invalid password")
 	}
 
-	token, err := auth.GenerateToken(t.Id, r.Secret)
+	if t.Suspended {
+		return nil, errors.New("Account suspended")
+	}
+
+	tokens, err := r.Ss.Start(t.Id, deviceName(input.DeviceName), auth.IPFromContext(ctx))
 	if err != nil {
-		r.sendError(err, "Cannot generate JWT")
-		return "", InternalServerError
+		return nil, InternalServerError
 	}
 
-	return token, nil
+	return toAuthPayload(tokens), nil
 }
 
-func (r *mutationResolver) RefreshToken(ctx context.Context) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *mutationResolver) LoginAdmin(ctx context.Context, input model.LoginInfo) (*model.AuthPayload, error) {
+	a, err := r.Repo.GetAdminByUsername(input.Username)
 	if err != nil {
-		return "", Unauthorised
+		return nil, errors.New("Invalid username")
 	}
 
-	var token string
+	ok := auth.CheckPasswordHash(input.Password, a.HashedPassword)
+	if !ok {
+		return nil, errors.New("Invalid password")
+	}
 
-	switch user := u.(type) {
-	case db.Student:
-		token, err = auth.GenerateToken(user.Id, r.Secret)
-		if err != nil {
-			r.sendError(err, "Cannot generate JWT")
-			return "", InternalServerError
-		}
-	case db.Tutor:
-		token, err = auth.GenerateToken(user.Id, r.Secret)
-		if err != nil {
-			r.sendError(err, "Cannot generate JWT")
-			return "", InternalServerError
-		}
-	default:
-		return "", Unauthorised
+	tokens, err := r.Ss.Start(a.Id, deviceName(input.DeviceName), auth.IPFromContext(ctx))
+	if err != nil {
+		return nil, InternalServerError
 	}
 
-	return token, nil
+	return toAuthPayload(tokens), nil
 }
 
-func (r *mutationResolver) UpdateHeartbeat(ctx context.Context, input model.HeartbeatStatus) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *mutationResolver) RefreshToken(ctx context.Context, input string) (*model.AuthPayload, error) {
+	tokens, err := r.Ss.Refresh(input, auth.IPFromContext(ctx))
+	if err == session.ErrInvalidRefreshToken {
+		return nil, err
+	} else if err != nil {
+		return nil, InternalServerError
+	}
+
+	return toAuthPayload(tokens), nil
+}
+
+func (r *mutationResolver) RevokeSession(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		r.sendError(err, "Only tutors have persission to update heartbeat")
-		return "", Unauthorised
-	case db.Tutor:
-		user.Status = input.String()
-		user.LastSeen = time.Now()
+	if err = r.Ss.Revoke(p.Id, input); err != nil {
+		return "", err
+	}
 
-		err = r.Repo.UpdateTutor(user)
-		if err != nil {
-			return "", err
-		}
+	return input, nil
+}
 
-		token, err := auth.GenerateToken(user.Id, r.Secret)
-		if err != nil {
-			r.sendError(err, "Cannot generate JWT")
-			return "", InternalServerError
-		}
+func (r *mutationResolver) LogoutEverywhere(ctx context.Context) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
 
-		return token, nil
-	default:
-		return "", Unauthorised
+	if err = r.Ss.RevokeAll(p.Id); err != nil {
+		return "", InternalServerError
 	}
+
+	return "SUCCESS", nil
 }
 
-func (r *mutationResolver) SendMessage(ctx context.Context, input model.SendMessage) (string, error) {
-	u, err := auth.UserFromContext(ctx)
-	if err != nil {
-		return "", Unauthorised
+func (r *mutationResolver) RequestPasswordReset(ctx context.Context, input string) (string, error) {
+	if err := r.As.RequestPasswordReset(input); err != nil {
+		return "", InternalServerError
 	}
 
-	var uid string
+	// Same answer whether or not the email has an account
+	return "SUCCESS", nil
+}
 
-	switch user := u.(type) {
-	case db.Student:
-		uid = user.Id
-	case db.Tutor:
-		uid = user.Id
-	default:
-		return "", Unauthorised
+func (r *mutationResolver) ResetPassword(ctx context.Context, input model.PasswordReset) (string, error) {
+	err := r.As.ResetPassword(input.Token, input.NewPassword)
+	if err == account.ErrInvalidToken || err == account.ErrWeakPassword {
+		return "", err
+	} else if err != nil {
+		return "", InternalServerError
 	}
 
-	err = r.Cs.SendMessage(ctx, uid, input)
+	return "SUCCESS", nil
+}
+
+func (r *mutationResolver) SendVerificationEmail(ctx context.Context) (string, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
-		r.sendError(err, "Cannot send message")
+		return "", err
+	}
+
+	err = r.As.SendVerificationEmail(p.Id)
+	if err == account.ErrAlreadyVerified {
+		return "", err
+	} else if err != nil {
 		return "", InternalServerError
 	}
 
-	token, err := auth.GenerateToken(uid, r.Secret)
-	if err != nil {
-		r.sendError(err, "Cannot generate JWT")
+	return "SUCCESS", nil
+}
+
+func (r *mutationResolver) VerifyEmail(ctx context.Context, input string) (string, error) {
+	_, err := r.As.VerifyEmail(input)
+	if err == account.ErrInvalidToken {
+		return "", err
+	} else if err != nil {
 		return "", InternalServerError
 	}
 
-	return token, nil
+	return "SUCCESS", nil
 }
 
-func (r *mutationResolver) CreateLessonRoom(ctx context.Context, input string) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *mutationResolver) UpdateHeartbeat(ctx context.Context, input model.HeartbeatStatus) (string, error) {
+	t, err := tutorFromContext(ctx)
 	if err != nil {
-		return "", Unauthorised
+		return "", err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		return "", Unauthorised
-	case db.Tutor:
-		inLesson, err := r.Repo.IsTutorInLesson(user.Id, input)
-		if err != nil {
-			r.sendError(err, "Unable to check lesson")
-			return "", InternalServerError
-		}
+	t.Status = input.String()
+	t.LastSeen = time.Now()
 
-		if !inLesson {
-			r.sendError(err, fmt.Sprintf("Tutor %s is not in lesson %s", user.Id, input))
-			return "", Unauthorised
-		}
+	err = r.Repo.UpdateTutor(t)
+	if err != nil {
+		return "", err
+	}
 
-		room, err := r.Video.CreateRoom(input)
-		if err != nil {
-			r.sendError(err, "Unable to create room")
-			return "", InternalServerError
-		}
+	return input.String(), nil
+}
 
-		token, err := r.Video.GenerateAccessToken(user.Id, room.SID)
-		if err != nil {
-			r.sendError(err, "Unable to generate access token")
-			return "", InternalServerError
-		}
+func (r *mutationResolver) SendMessage(ctx context.Context, input model.SendMessage) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
 
-		return token, nil
-	default:
-		return "", InternalServerError
+	c, err := r.Cs.SendMessage(ctx, p.Id, input)
+	if err != nil {
+		return "", r.chatError(err, "Cannot send message")
 	}
+
+	return c.Id, nil
 }
 
-func (r *mutationResolver) EndLessonRoom(ctx context.Context, input string) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *mutationResolver) EditMessage(ctx context.Context, input model.EditMessage) (*model.Message, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
-		return "", Unauthorised
+		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		inLesson, err := r.Repo.IsStudentInLesson(user.Id, input)
-		if err != nil {
-			r.sendError(err, "Unable to check lesson")
-			return "", InternalServerError
-		}
+	c, err := r.Cs.Conversation(input.ID)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot retrieve conversation")
+	}
 
-		if !inLesson {
-			r.sendError(err, fmt.Sprintf("Student %s is not in lesson %s", user.Id, input))
-			return "", Unauthorised
-		}
+	m, err := r.Cs.EditMessage(ctx, c, p.Id, input.Message, input.Text)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot edit message")
+	}
 
-		err = r.Video.CompleteRoom(input)
-		if err != nil {
-			r.sendError(err, "Unable to complete room")
-			return "", InternalServerError
-		}
+	mm := r.Repo.ToMessageModel(m, chat.AttachmentPath)
+	return &mm, nil
+}
 
-		return "", nil
-	case db.Tutor:
-		inLesson, err := r.Repo.IsTutorInLesson(user.Id, input)
-		if err != nil {
-			r.sendError(err, "Unable to check lesson")
-			return "", InternalServerError
-		}
+func (r *mutationResolver) DeleteMessage(ctx context.Context, input model.MessageKey) (*model.Message, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		if !inLesson {
-			r.sendError(err, fmt.Sprintf("Tutor %s is not in lesson %s", user.Id, input))
-			return "", Unauthorised
-		}
+	c, err := r.Cs.Conversation(input.ID)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot retrieve conversation")
+	}
 
-		err = r.Video.CompleteRoom(input)
-		if err != nil {
-			r.sendError(err, "Unable to complete room")
-			return "", InternalServerError
-		}
+	m, err := r.Cs.DeleteMessage(ctx, c, p.Id, input.Message)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot delete message")
+	}
 
-		return "", nil
-	default:
-		return "", InternalServerError
+	mm := r.Repo.ToMessageModel(m, chat.AttachmentPath)
+	return &mm, nil
+}
+
+func (r *mutationResolver) MarkConversationRead(ctx context.Context, input string) (*model.Conversation, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.Cs.Conversation(input)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot retrieve conversation")
+	}
+
+	c, err = r.Cs.MarkRead(c, p.Id)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot mark conversation as read")
 	}
+
+	mc := r.Repo.ToConversationModel(c, p.Id)
+	return &mc, nil
 }
 
-func (r *mutationResolver) RequestOnDemandMatch(ctx context.Context, input model.OnDemandMatchRequest) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *mutationResolver) SendTyping(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		subject, err := r.Repo.GetSubject(input.Subject.Name.String(), input.Subject.Standard.String())
-		if err != nil {
-			r.sendError(err, "Cannot get subject from database")
+	c, err := r.Cs.Conversation(input)
+	if err != nil {
+		return "", r.chatError(err, "Cannot retrieve conversation")
+	}
+
+	if err = r.Cs.SendTyping(c, p.Id); err != nil {
+		return "", r.chatError(err, "Cannot send typing indicator")
+	}
+
+	return "SUCCESS", nil
+}
+
+func (r *mutationResolver) BlockUser(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Cs.Block(p.Id, input); err != nil {
+		return "", r.chatError(err, "Cannot block user")
+	}
+
+	return "BLOCKED", nil
+}
+
+func (r *mutationResolver) UnblockUser(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Cs.Unblock(p.Id, input); err != nil {
+		return "", r.chatError(err, "Cannot unblock user")
+	}
+
+	return "UNBLOCKED", nil
+}
+
+func (r *mutationResolver) ReportUser(ctx context.Context, input model.ReportUser) (*model.UserReport, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ur, err := r.Cs.Report(p.Id, input.User, input.Reason)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot report user")
+	}
+
+	mur := r.Repo.ToUserReportModel(ur)
+	return &mur, nil
+}
+
+func (r *mutationResolver) CreateLessonRoom(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Cancelled and finished lessons cannot be joined
+	if err = r.Ls.OpenRoom(input); err != nil {
+		return "", lessonError(err)
+	}
+
+	room, err := r.Video.CreateRoom(input)
+	if err != nil {
+		r.sendError(err, "Unable to create room")
+		return "", InternalServerError
+	}
+
+	if err = r.Ls.RoomCreated(input, room.SID); err != nil {
+		return "", InternalServerError
+	}
+
+	token, err := r.Video.GenerateAccessToken(p.Id, room.SID)
+	if err != nil {
+		r.sendError(err, "Unable to generate access token")
+		return "", InternalServerError
+	}
+
+	if err = r.Ls.TokenIssued(input, p.Id); err != nil {
+		return "", InternalServerError
+	}
+
+	return token, nil
+}
+
+func (r *mutationResolver) EndLessonRoom(ctx context.Context, input string) (string, error) {
+	err := r.Video.CompleteRoom(input)
+	if err != nil {
+		r.sendError(err, "Unable to complete room")
+		return "", InternalServerError
+	}
+
+	if err = r.Ls.End(input); err != nil {
+		return "", InternalServerError
+	}
+
+	return "", nil
+}
+
+func (r *mutationResolver) RequestOnDemandMatch(ctx context.Context, input model.OnDemandMatchRequest) (string, error) {
+	s, err := studentFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	subject, err := r.Repo.GetSubject(input.Subject.Name.String(), input.Subject.Standard.String())
+	if err != nil {
+		r.sendError(err, "Cannot get subject from database")
+		return "", InternalServerError
+	}
+
+	mid, err := r.Ms.MatchOnDemand(s, subject, 20)
+	return mid, err
+}
+
+func (r *mutationResolver) RequestScheduledMatch(ctx context.Context, input model.ScheduledMatchRequest) (string, error) {
+	s, err := studentFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Retrieve the subject
+	sub, err := r.Repo.GetSubject(input.Subject.Name.String(), input.Subject.Standard.String())
+	if err != nil {
+		r.sendError(err, "Cannot retrieve subject from db")
+		return "", InternalServerError
+	}
+	// Retrieve the tutor
+	t, err := r.Repo.GetTutorById(input.Tutor)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve tutor from db")
+		return "", InternalServerError
+	}
+
+	// Only approved tutors in good standing can be requested
+	if t.Suspended || t.ApplicationStatus != onboarding.Approved {
+		return "", errors.New("Tutor is not available")
+	}
+	m, err := r.Ms.RequestScheduledMatch(s, t, sub, input.Time.StartTime, input.Time.EndTime)
+	if err != nil {
+		r.sendError(err, "Cannot request new match")
+		return "", InternalServerError
+	}
+
+	return m.Id, nil
+}
+
+func (r *mutationResolver) AcceptOnDemandMatch(ctx context.Context, input string) (*model.Lesson, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := r.Ms.AcceptOnDemandMatch(input, t)
+	if err != nil {
+		return nil, err
+	}
+
+	ml, err := r.Repo.ToLessonModel(l)
+	if err != nil {
+		r.sendError(err, "Cannot accept match")
+		return nil, InternalServerError
+	}
+	return &ml, nil
+}
+
+func (r *mutationResolver) AcceptScheduledMatch(ctx context.Context, input string) (*model.Lesson, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := r.Ms.AcceptScheduledMatch(input, t)
+	if err != nil {
+		return nil, err
+	}
+
+	ml, err := r.Repo.ToLessonModel(l)
+	if err != nil {
+		r.sendError(err, "Cannot accept match")
+		return nil, InternalServerError
+	}
+	return &ml, nil
+}
+
+func (r *mutationResolver) DeclineMatch(ctx context.Context, input string) (string, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Ms.DeclineMatch(input, t); err != nil {
+		return "", err
+	}
+
+	return "DECLINED", nil
+}
+
+func (r *mutationResolver) CancelOnDemandMatch(ctx context.Context, input string) (string, error) {
+	s, err := studentFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	err = r.Ms.CancelOnDemandMatch(s, input)
+	if err != nil {
+		r.sendError(err, "Cannot cancel match")
+		return "", err
+	}
+
+	return "CANCELLED", nil
+}
+
+func (r *mutationResolver) RequestReschedule(ctx context.Context, input model.RequestReschedule) (*model.LessonReschedule, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lr, err := r.Ls.RequestReschedule(p.Id, input.ID, input.StartTime, input.EndTime)
+	if err != nil {
+		return nil, lessonError(err)
+	}
+
+	mlr := r.Repo.ToLessonRescheduleModel(lr)
+	return &mlr, nil
+}
+
+func (r *mutationResolver) RespondToReschedule(ctx context.Context, input model.RespondToReschedule) (*model.LessonReschedule, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lr, err := r.Ls.RespondToReschedule(p.Id, input.ID, input.Accept)
+	if err != nil {
+		return nil, lessonError(err)
+	}
+
+	mlr := r.Repo.ToLessonRescheduleModel(lr)
+	return &mlr, nil
+}
+
+func (r *mutationResolver) CancelLesson(ctx context.Context, input model.CancelLesson) (*model.Lesson, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := r.Ls.Cancel(p.Id, input.ID, input.Reason)
+	if err != nil {
+		return nil, lessonError(err)
+	}
+
+	ml, err := r.Repo.ToLessonModel(l)
+	if err != nil {
+		r.sendError(err, "Cannot convert lesson")
+		return nil, InternalServerError
+	}
+	return &ml, nil
+}
+
+func (r *mutationResolver) WriteLessonReport(ctx context.Context, input model.WriteLessonReport) (*model.LessonReport, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rep, err := r.Ls.WriteReport(t.Id, input.ID, input.Topics, input.Summary, orEmpty(input.Homework), orEmpty(input.FollowUp))
+	if err != nil {
+		return nil, lessonError(err)
+	}
+
+	mrep := r.Repo.ToLessonReportModel(rep)
+	return &mrep, nil
+}
+
+func (r *mutationResolver) PublishLessonReport(ctx context.Context, input string) (*model.LessonReport, error) {
+	rep, err := r.Ls.PublishReport(input)
+	if err != nil {
+		return nil, lessonError(err)
+	}
+
+	mrep := r.Repo.ToLessonReportModel(rep)
+	return &mrep, nil
+}
+
+func (r *mutationResolver) AddLessonNote(ctx context.Context, input model.NewLessonNote) (*model.LessonNote, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := r.Ls.AddNote(p.Id, input.ID, input.Body)
+	if err != nil {
+		return nil, lessonError(err)
+	}
+
+	mn := r.Repo.ToLessonNoteModel(n)
+	return &mn, nil
+}
+
+func (r *mutationResolver) RemoveLessonNote(ctx context.Context, input string) (string, error) {
+	if err := r.Ls.RemoveNote(input); err != nil {
+		return "", InternalServerError
+	}
+
+	return input, nil
+}
+
+func (r *mutationResolver) AddLessonAttachment(ctx context.Context, input model.NewLessonAttachment) (*model.LessonAttachment, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := r.Ls.AddAttachment(p.Id, input.ID, input.File.Filename, input.File.ContentType, input.File.Size, input.File.File)
+	if err != nil {
+		return nil, lessonError(err)
+	}
+
+	ma := r.Repo.ToLessonAttachmentModel(a, lesson.AttachmentPath+a.Id)
+	return &ma, nil
+}
+
+func (r *mutationResolver) RemoveLessonAttachment(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Ls.RemoveAttachment(p.Id, input); err != nil {
+		return "", lessonError(err)
+	}
+
+	return input, nil
+}
+
+func (r *mutationResolver) ReviewLesson(ctx context.Context, input model.NewReview) (*model.Review, error) {
+	s, err := studentFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := r.Rvs.Review(s.Id, input.ID, input.Rating, input.Body)
+	if err != nil {
+		return nil, reviewError(err)
+	}
+
+	mrv := r.Repo.ToReviewModel(rv)
+	return &mrv, nil
+}
+
+func (r *mutationResolver) ReplyToReview(ctx context.Context, input model.ReviewReply) (*model.Review, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := r.Rvs.Reply(t.Id, input.ID, input.Body)
+	if err != nil {
+		return nil, reviewError(err)
+	}
+
+	mrv := r.Repo.ToReviewModel(rv)
+	return &mrv, nil
+}
+
+func (r *mutationResolver) FlagReview(ctx context.Context, input model.ReviewFlag) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Rvs.Flag(p.Id, input.ID, input.Reason); err != nil {
+		return "", reviewError(err)
+	}
+
+	return input.ID, nil
+}
+
+func (r *mutationResolver) CreateAvailability(ctx context.Context, input model.TimeRangeRequest) (*model.AvailabilityPeriod, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := r.Avs.CreateWindow(t.Id, input.StartTime, input.EndTime)
+	if err != nil {
+		return nil, availabilityError(err)
+	}
+
+	return toAvailabilityPeriod(a), nil
+}
+
+func (r *mutationResolver) UpdateAvailability(ctx context.Context, input model.UpdateAvailability) (*model.AvailabilityPeriod, error) {
+	a, err := r.Avs.UpdateWindow(input.ID, input.StartTime, input.EndTime)
+	if err != nil {
+		return nil, availabilityError(err)
+	}
+
+	return toAvailabilityPeriod(a), nil
+}
+
+func (r *mutationResolver) DeleteAvailability(ctx context.Context, input string) (string, error) {
+	if err := r.Avs.DeleteWindow(input); err != nil {
+		return "", availabilityError(err)
+	}
+
+	return input, nil
+}
+
+func (r *mutationResolver) SetWeeklyAvailability(ctx context.Context, input model.WeeklyAvailability) ([]*model.AvailabilityRule, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []availability.Rule
+	for _, in := range input.Rules {
+		rule, err := fromWeeklyAvailabilityRule(in)
+		if err != nil {
+			return nil, availabilityError(err)
+		}
+		rules = append(rules, rule)
+	}
+
+	dbRules, err := r.Avs.SetWeekly(t.Id, input.Timezone, rules)
+	if err != nil {
+		return nil, availabilityError(err)
+	}
+
+	mrules := []*model.AvailabilityRule{}
+	for _, rule := range dbRules {
+		mrules = append(mrules, toAvailabilityRule(rule))
+	}
+
+	return mrules, nil
+}
+
+func (r *mutationResolver) AddAvailabilityException(ctx context.Context, input model.NewAvailabilityException) (*model.AvailabilityException, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := r.Avs.AddException(t.Id, input.StartTime, input.EndTime, orEmpty(input.Reason))
+	if err != nil {
+		return nil, availabilityError(err)
+	}
+
+	return toAvailabilityException(e), nil
+}
+
+func (r *mutationResolver) RemoveAvailabilityException(ctx context.Context, input string) (string, error) {
+	if err := r.Avs.RemoveException(input); err != nil {
+		return "", availabilityError(err)
+	}
+
+	return input, nil
+}
+
+func (r *mutationResolver) AddTutorDocument(ctx context.Context, input model.NewTutorDocument) (*model.TutorDocument, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := r.Obs.AddDocument(t.Id, input.Kind.String(), input.Name, input.URL, input.ContentType, input.Size)
+	if err != nil {
+		return nil, onboardingError(err)
+	}
+
+	md := r.Repo.ToTutorDocumentModel(d)
+	return &md, nil
+}
+
+func (r *mutationResolver) RemoveTutorDocument(ctx context.Context, input string) (string, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Obs.RemoveDocument(t.Id, input); err != nil {
+		return "", onboardingError(err)
+	}
+
+	return input, nil
+}
+
+func (r *mutationResolver) SubmitTutorApplication(ctx context.Context) (*model.TutorApplication, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := r.Obs.Submit(t.Id)
+	if err != nil {
+		return nil, onboardingError(err)
+	}
+
+	return r.toTutorApplication(a)
+}
+
+func (r *mutationResolver) UpdateNotification(ctx context.Context, input model.UpdateNotification) (*model.Notification, error) {
+	n, err := r.Repo.GetNotificationById(input.ID)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve notification from database")
+		return nil, InternalServerError
+	}
+
+	n.Read = input.Read
+
+	err = r.Repo.UpdateNotification(n)
+	if err != nil {
+		r.sendError(err, "Cannot update notification in database")
+		return nil, InternalServerError
+	}
+
+	mn := r.Repo.ToNotificationModel(n)
+	return &mn, nil
+}
+
+func (r *mutationResolver) RegisterPushNotification(ctx context.Context, input string) (string, error) {
+	u, err := auth.UserFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	switch user := u.(type) {
+	case db.Student:
+		user.PushToken = input
+		err := r.Repo.UpdateStudent(user)
+
+		if err != nil {
+			r.sendError(err, "Cannot update student in db")
 			return "", InternalServerError
 		}
+		return input, nil
+	case db.Tutor:
+		user.PushToken = input
+		err := r.Repo.UpdateTutor(user)
+
+		if err != nil {
+			r.sendError(err, "Cannot update tutor in db")
+			return "", InternalServerError
+		}
+		return input, nil
+	default:
+		return "", Unauthorised
+	}
+}
+
+func (r *mutationResolver) AdminSuspendUser(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Adm.SetSuspended(p.Id, input, true); err != nil {
+		return "", adminError(err)
+	}
+
+	return input, nil
+}
+
+func (r *mutationResolver) AdminUnsuspendUser(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = r.Adm.SetSuspended(p.Id, input, false); err != nil {
+		return "", adminError(err)
+	}
+
+	return input, nil
+}
+
+func (r *mutationResolver) AdminCancelLesson(ctx context.Context, input string) (*model.Lesson, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := r.Adm.CancelLesson(p.Id, input)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	ml, err := r.Repo.ToLessonModel(l)
+	if err != nil {
+		r.sendError(err, "Cannot parse lesson")
+		return nil, InternalServerError
+	}
+
+	return &ml, nil
+}
+
+func (r *mutationResolver) AdminReassignLesson(ctx context.Context, input model.AdminLessonReassign) (*model.Lesson, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := r.Adm.ReassignLesson(p.Id, input.Lesson, input.Tutor)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	ml, err := r.Repo.ToLessonModel(l)
+	if err != nil {
+		r.sendError(err, "Cannot parse lesson")
+		return nil, InternalServerError
+	}
+
+	return &ml, nil
+}
+
+func (r *mutationResolver) AdminResolveMatch(ctx context.Context, input model.AdminMatchResolve) (*model.Match, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := r.Adm.ResolveMatch(p.Id, input.Match, input.Resolution == model.MatchResolutionAccept)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	mm, err := r.Repo.ToMatchModel(m)
+	if err != nil {
+		r.sendError(err, "Cannot cast dbmodel to gql model")
+		return nil, InternalServerError
+	}
+
+	return &mm, nil
+}
+
+func (r *mutationResolver) AdminSetTutorSubjects(ctx context.Context, input model.AdminTutorSubjects) (*model.Tutor, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects, err := r.Repo.GetSubjects(input.Subjects)
+	if err != nil {
+		r.sendError(err, "Cannnot retrieve subjects from database")
+		return nil, InternalServerError
+	}
+
+	var subids []string
+	for _, subject := range subjects {
+		subids = append(subids, subject.Id)
+	}
+
+	t, err := r.Adm.SetTutorSubjects(p.Id, input.Tutor, subids)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	mt, err := r.Repo.ToTutorModel(t)
+	if err != nil {
+		r.sendError(err, "Cannot parse tutor from database")
+		return nil, InternalServerError
+	}
+
+	return &mt, nil
+}
+
+func (r *mutationResolver) AdminResendNotification(ctx context.Context, input string) (*model.Notification, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := r.Adm.ResendNotification(p.Id, input)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	mn := r.Repo.ToNotificationModel(n)
+	return &mn, nil
+}
+
+func (r *mutationResolver) AdminStartApplicationReview(ctx context.Context, input string) (*model.TutorApplication, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := r.Adm.StartApplicationReview(p.Id, input)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return r.toTutorApplication(a)
+}
+
+func (r *mutationResolver) AdminReviewApplication(ctx context.Context, input model.AdminApplicationReview) (*model.TutorApplication, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := r.Adm.ReviewApplication(p.Id, input.Tutor, input.Decision == model.ApplicationDecisionApprove, orEmpty(input.Notes))
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return r.toTutorApplication(a)
+}
+
+func (r *mutationResolver) AdminModerateReview(ctx context.Context, input model.AdminReviewModeration) (*model.Review, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := r.Adm.ModerateReview(p.Id, input.Review, input.Hidden)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	mrv := r.Repo.ToReviewModel(rv)
+	return &mrv, nil
+}
+
+func (r *mutationResolver) AdminResolveUserReport(ctx context.Context, input string) (*model.UserReport, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ur, err := r.Adm.ResolveReport(p.Id, input)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	mur := r.Repo.ToUserReportModel(ur)
+	return &mur, nil
+}
+
+func (r *queryResolver) Self(ctx context.Context) (model.User, error) {
+	u, err := auth.UserFromContext(ctx)
+	if err != nil {
+		return nil, Unauthorised
+	}
+
+	switch user := u.(type) {
+	case db.Student:
+		return r.Repo.ToStudentModel(user), nil
+	case db.Tutor:
+		return r.Repo.ToTutorModel(user)
+	default:
+		return nil, Unauthorised
+	}
+}
+
+func (r *queryResolver) Conversations(ctx context.Context) ([]*model.Conversation, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		mid, err := r.Ms.MatchOnDemand(user, subject, 20)
-		return mid, err
-	case db.Tutor:
-		r.sendError(err, "Only students can request for a match")
-		return "", Unauthorised
-	default:
-		return "", Unauthorised
+	conversations, err := r.Cs.Conversations(p.Id)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve conversations")
+		return nil, InternalServerError
+	}
+
+	mcs := []*model.Conversation{}
+	for _, c := range conversations {
+		mc := r.Repo.ToConversationModel(c, p.Id)
+		mcs = append(mcs, &mc)
 	}
+
+	return mcs, nil
 }
 
-func (r *mutationResolver) RequestScheduledMatch(ctx context.Context, input model.ScheduledMatchRequest) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) Messages(ctx context.Context, input string, first *int, after *string) (*model.MessageConnection, error) {
+	afterCreated, afterId, err := messagePosition(after)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		// Retrieve the subject
-		sub, err := r.Repo.GetSubject(input.Subject.Name.String(), input.Subject.Standard.String())
-		if err != nil {
-			r.sendError(err, "Cannot retrieve subject from db")
-			return "", InternalServerError
-		}
-		// Retrieve the tutor
-		t, err := r.Repo.GetTutorById(input.Tutor)
-		if err != nil {
-			r.sendError(err, "Cannot retrieve tutor from db")
-			return "", InternalServerError
-		}
-		m, err := r.Ms.RequestScheduledMatch(user, t, sub, input.Time.StartTime, input.Time.EndTime)
+	c, err := r.Cs.Conversation(input)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot retrieve conversation")
+	}
+
+	limit, _ := pageBounds(first, nil)
+
+	// Fetch one more message than asked for, to know whether there is a next page
+	messages, err := r.Cs.GetMessages(ctx, c, afterCreated, afterId, limit+1)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve messages")
+		return nil, InternalServerError
+	}
+
+	return r.toMessageConnection(messages, limit, afterId), nil
+}
+
+func (r *queryResolver) MessageEdits(ctx context.Context, input model.MessageKey) ([]*model.MessageEdit, error) {
+	c, err := r.Cs.Conversation(input.ID)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot retrieve conversation")
+	}
+
+	edits, err := r.Cs.MessageEdits(ctx, c, input.Message)
+	if err != nil {
+		return nil, r.chatError(err, "Cannot retrieve message edits")
+	}
+
+	medits := []*model.MessageEdit{}
+	for _, e := range edits {
+		me := r.Repo.ToMessageEditModel(e)
+		medits = append(medits, &me)
+	}
+
+	return medits, nil
+}
+
+func (r *queryResolver) BlockedUsers(ctx context.Context) ([]string, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked, err := r.Cs.Blocked(p.Id)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve blocked users")
+		return nil, InternalServerError
+	}
+
+	return blocked, nil
+}
+
+func (r *queryResolver) Lessons(ctx context.Context, input model.TimeRangeRequest) ([]*model.Lesson, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var dbLessons []db.Lesson
+
+	if p.Role == auth.RoleStudent {
+		dbLessons, err = r.Repo.GetStudentLessons(p.Id, input.StartTime, input.EndTime)
+	} else {
+		dbLessons, err = r.Repo.GetTutorLessons(p.Id, input.StartTime, input.EndTime)
+	}
+
+	if err != nil {
+		r.sendError(err, "Cannot retrieve lessons from db")
+		return nil, InternalServerError
+	}
+
+	// Convert dbLessons to gql Lesson Type
+	var lessons []*model.Lesson
+	for _, l := range dbLessons {
+		rl, err := r.Repo.ToLessonModel(l)
 		if err != nil {
-			r.sendError(err, "Cannot request new match")
-			return "", InternalServerError
+			r.sendError(err, "Cannot parse lesson")
+			return nil, InternalServerError
 		}
-
-		return m.Id, nil
-	case db.Tutor:
-		r.sendError(err, "Only students can request for a match")
-		return "", Unauthorised
-	default:
-		return "", Unauthorised
+		lessons = append(lessons, &rl)
 	}
+
+	return lessons, nil
 }
 
-func (r *mutationResolver) AcceptOnDemandMatch(ctx context.Context, input string) (*model.Lesson, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) LessonHistory(ctx context.Context, input model.LessonHistory) (*model.LessonPage, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		r.sendError(err, "Only tutors can accept a match")
-		return nil, Unauthorised
-	case db.Tutor:
-		l, err := r.Ms.AcceptOnDemandMatch(input, user)
-		ml, err := r.Repo.ToLessonModel(l)
+	limit, offset := pageBounds(input.Limit, input.Offset)
+
+	dbLessons, err := r.Repo.GetLessonHistory(p.Id, limit, offset)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve lesson history from db")
+		return nil, InternalServerError
+	}
+
+	total, err := r.Repo.CountLessonHistory(p.Id)
+	if err != nil {
+		r.sendError(err, "Cannot count lesson history in db")
+		return nil, InternalServerError
+	}
+
+	lessons := []*model.Lesson{}
+	for _, l := range dbLessons {
+		rl, err := r.Repo.ToLessonModel(l)
 		if err != nil {
-			r.sendError(err, "Cannot accept match")
+			r.sendError(err, "Cannot parse lesson")
 			return nil, InternalServerError
 		}
-		return &ml, nil
-	default:
-		return nil, Unauthorised
+		lessons = append(lessons, &rl)
 	}
+
+	return &model.LessonPage{Total: total, Lessons: lessons}, nil
 }
 
-func (r *mutationResolver) AcceptScheduledMatch(ctx context.Context, input string) (*model.Lesson, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) PendingMatches(ctx context.Context) ([]*model.Match, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		r.sendError(err, "Only tutors can accept a match")
-		return nil, Unauthorised
-	case db.Tutor:
-		l, err := r.Ms.AcceptScheduledMatch(input, user)
-		ml, err := r.Repo.ToLessonModel(l)
+	var dbMatches []db.Match
+
+	if p.Role == auth.RoleStudent {
+		dbMatches, err = r.Repo.GetStudentPendingMatches(p.Id)
+	} else {
+		dbMatches, err = r.Repo.GetTutorPendingMatches(p.Id)
+	}
+
+	if err != nil {
+		r.sendError(err, "Cannot retrieve pending matches from database")
+		return nil, InternalServerError
+	}
+
+	var modelMatches []*model.Match
+	for _, match := range dbMatches {
+		model, err := r.Repo.ToMatchModel(match)
 		if err != nil {
-			r.sendError(err, "Cannot accept match")
+			r.sendError(err, "Cannot cast dbmodel to gql model")
 			return nil, InternalServerError
 		}
-		return &ml, nil
-	default:
-		return nil, Unauthorised
+		modelMatches = append(modelMatches, &model)
 	}
+
+	return modelMatches, nil
 }
 
-func (r *mutationResolver) UpdateNotification(ctx context.Context, input model.UpdateNotification) (*model.Notification, error) {
-	n, err := r.Repo.GetNotificationById(input.ID)
+func (r *queryResolver) Notifications(ctx context.Context, input model.TimeRangeRequest) ([]*model.Notification, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
-		r.sendError(err, "Cannot retrieve notification from database")
+		return nil, err
+	}
+
+	dbNotifications, err := r.Repo.GetUserNotifications(p.Id, input.StartTime, input.EndTime)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve notifications from database")
 		return nil, InternalServerError
 	}
 
-	// Check that notification is for the correct user
-	u, err := auth.UserFromContext(ctx)
+	// Convert dbNotifications to gql Notifications Type
+	var notifications []*model.Notification
+	for _, n := range dbNotifications {
+		rn := r.Repo.ToNotificationModel(n)
+		notifications = append(notifications, &rn)
+	}
+
+	return notifications, nil
+}
+
+func (r *queryResolver) ListSessions(ctx context.Context) ([]*model.Session, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		if n.Student != user.Id {
-			return nil, Unauthorised
+	dbSessions, err := r.Ss.List(p.Id)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	sessions := []*model.Session{}
+	for _, s := range dbSessions {
+		ms := r.Repo.ToSessionModel(s, s.Id == p.Session)
+		sessions = append(sessions, &ms)
+	}
+
+	return sessions, nil
+}
+
+func (r *queryResolver) SearchTutors(ctx context.Context, input model.TutorSearch, first *int, after *string) (*model.TutorConnection, error) {
+	s, err := studentFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f := db.TutorFilter{Student: s.Id, Text: orEmpty(input.Text)}
+	if input.Subject != nil {
+		f.SubjectName = input.Subject.String()
+	}
+	if input.Standard != nil {
+		f.SubjectStandard = input.Standard.String()
+	}
+	if input.MinRate != nil {
+		f.MinRate = *input.MinRate
+	}
+	if input.MaxRate != nil {
+		f.MaxRate = *input.MaxRate
+	}
+	if input.MinRating != nil {
+		f.MinRating = *input.MinRating
+	}
+	if input.Available != nil {
+		if !input.Available.EndTime.After(input.Available.StartTime) {
+			return nil, errors.New("Invalid time range")
 		}
-	case db.Tutor:
-		if n.Tutor != user.Id {
-			return nil, Unauthorised
+		f.StartTime, f.EndTime = input.Available.StartTime, input.Available.EndTime
+	}
+
+	sort := model.TutorSortRating
+	if input.Sort != nil {
+		sort = *input.Sort
+	}
+
+	var afterKey int
+	var afterId string
+	if after != nil {
+		if afterKey, afterId, err = decodeCursor(*after, sort.String()); err != nil {
+			return nil, err
 		}
-	default:
-		return nil, Unauthorised
 	}
 
-	n.Read = input.Read
+	limit, _ := pageBounds(first, nil)
 
-	err = r.Repo.UpdateNotification(n)
+	// Fetch one more result than asked for, to know whether there is a next page
+	results, err := r.Repo.FilterTutors(f, sort.String(), afterKey, afterId, limit+1)
 	if err != nil {
-		r.sendError(err, "Cannot update notification in database")
+		r.sendError(err, "Cannot search tutors in database")
 		return nil, InternalServerError
 	}
 
-	mn := r.Repo.ToNotificationModel(n)
-	return &mn, nil
+	total, err := r.Repo.CountFilteredTutors(f)
+	if err != nil {
+		r.sendError(err, "Cannot count tutors in database")
+		return nil, InternalServerError
+	}
+
+	conn := model.TutorConnection{Edges: []*model.TutorEdge{}, PageInfo: &model.PageInfo{HasPreviousPage: afterId != ""}, TotalCount: total}
+	if len(results) > limit {
+		conn.PageInfo.HasNextPage = true
+		results = results[:limit]
+	}
+
+	for _, res := range results {
+		t, err := r.Repo.ToTutorModel(res.Tutor)
+		if err != nil {
+			r.sendError(err, "Cannot parse tutor from database")
+			return nil, InternalServerError
+		}
+
+		cursor := encodeCursor(sort.String(), res.SortKey, res.Tutor.Id)
+		conn.Edges = append(conn.Edges, &model.TutorEdge{Cursor: cursor, Node: &t})
+	}
+
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+
+	return &conn, nil
 }
 
-func (r *mutationResolver) RegisterPushNotification(ctx context.Context, input string) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) GetScheduledMatches(ctx context.Context, input model.ScheduledMatchParameters) ([]*model.Tutor, error) {
+	s, err := studentFromContext(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		user.PushToken = input
-		err := r.Repo.UpdateStudent(user)
+	subject, err := r.Repo.GetSubject(input.Subject.Name.String(), input.Subject.Standard.String())
+	if err != nil {
+		r.sendError(err, "Cannot get subject from database")
+		return nil, InternalServerError
+	}
+
+	tids, err := r.Ms.MatchScheduled(s, subject, input.Time.StartTime, input.Time.EndTime, 20)
+	if err != nil {
+		return nil, InternalServerError
+	}
 
+	var tutors []*model.Tutor
+	for _, tid := range tids {
+		dbTutor, err := r.Repo.GetTutorById(tid)
 		if err != nil {
-			r.sendError(err, "Cannot update student in db")
-			return "", InternalServerError
+			r.sendError(err, "Cannot get tutor from database")
+			return nil, InternalServerError
 		}
-		return input, nil
-	case db.Tutor:
-		user.PushToken = input
-		err := r.Repo.UpdateTutor(user)
 
-		if err != nil {
-			r.sendError(err, "Cannot update tutor in db")
-			return "", InternalServerError
-		}
-		return input, nil
-	default:
-		return "", Unauthorised
+		tutor, err := r.Repo.ToTutorModel(dbTutor)
+		if err != nil {
+			r.sendError(err, "Cannot parse tutor from database")
+			return nil, InternalServerError
+		}
+
+		tutors = append(tutors, &tutor)
+	}
+
+	return tutors, nil
+}
+
+func (r *queryResolver) CheckForMatch(ctx context.Context, input string) (*model.Lesson, error) {
+	s, err := studentFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := r.Ms.CheckForMatch(s, input)
+	if err != nil && err.Error() == "No match found" {
+		return nil, err
+	} else if err != nil {
+		r.sendError(err, "Error retrieving match")
+		return nil, InternalServerError
+	}
+
+	ml, err := r.Repo.ToLessonModel(*l)
+	if err != nil {
+		return &ml, err
+	}
+
+	return &ml, nil
+}
+
+func (r *queryResolver) TutorResponseStats(ctx context.Context, input string) (*model.TutorResponseStats, error) {
+	s, until, err := r.Ms.ResponseStats(input)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	ms := r.Repo.ToTutorResponseStatsModel(s, until)
+	return &ms, nil
+}
+
+func (r *queryResolver) Availability(ctx context.Context, input model.TimeRangeRequest) (*model.Availability, error) {
+	t, err := tutorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := r.Avs.Schedule(t.Id, input.StartTime, input.EndTime)
+	if err != nil {
+		return nil, availabilityError(err)
+	}
+
+	a := model.Availability{
+		Timezone:   schedule.Timezone,
+		Rules:      []*model.AvailabilityRule{},
+		Periods:    []*model.AvailabilityPeriod{},
+		Exceptions: []*model.AvailabilityException{},
+		Windows:    []*model.AvailabilityWindow{},
+	}
+
+	for _, rule := range schedule.Rules {
+		a.Rules = append(a.Rules, toAvailabilityRule(rule))
+	}
+
+	for _, e := range schedule.Exceptions {
+		a.Exceptions = append(a.Exceptions, toAvailabilityException(e))
+	}
+
+	for _, period := range schedule.Periods {
+		a.Periods = append(a.Periods, toAvailabilityPeriod(period))
+	}
+
+	for _, w := range schedule.Windows {
+		a.Windows = append(a.Windows, toAvailabilityWindow(w))
 	}
+
+	return &a, nil
 }
 
-func (r *queryResolver) Self(ctx context.Context) (model.User, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) TutorApplication(ctx context.Context) (*model.TutorApplication, error) {
+	t, err := tutorFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		return r.Repo.ToStudentModel(user), nil
-	case db.Tutor:
-		return r.Repo.ToTutorModel(user)
-	default:
-		return nil, Unauthorised
+	a, err := r.Obs.Application(t.Id)
+	if err != nil {
+		return nil, onboardingError(err)
 	}
+
+	return r.toTutorApplication(a)
 }
 
-func (r *queryResolver) Messages(ctx context.Context, input model.MessageRange) ([]*model.Message, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) GetLessonRoom(ctx context.Context, input string) (string, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	var uid string
-	switch user := u.(type) {
-	case db.Student:
-		uid = user.Id
-	case db.Tutor:
-		uid = user.Id
-	default:
-		return nil, errors.New("Unauthorised, please log in")
+	if err = r.Ls.OpenRoom(input); err != nil {
+		return "", lessonError(err)
 	}
 
-	messages, err := r.Cs.GetMessages(ctx, uid, input)
+	token, err := r.Video.GenerateAccessToken(p.Id, input)
 	if err != nil {
-		return nil, err
+		r.sendError(err, "Unable to generate room access token")
+		return "", InternalServerError
 	}
 
-	switchedUID := input.To
-	switchedMR := model.MessageRange{
-		To:    uid,
-		Start: input.Start,
-		End:   input.End,
+	if err = r.Ls.TokenIssued(input, p.Id); err != nil {
+		return "", InternalServerError
 	}
 
-	otherMessages, err := r.Cs.GetMessages(ctx, switchedUID, switchedMR)
+	return token, nil
+}
+
+func (r *queryResolver) AdminStudents(ctx context.Context, input model.AdminSearch) (*model.StudentPage, error) {
+	limit, offset := pageBounds(input.Limit, input.Offset)
+
+	dbStudents, total, err := r.Adm.SearchStudents(orEmpty(input.Query), limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, InternalServerError
+	}
+
+	students := []*model.Student{}
+	for _, s := range dbStudents {
+		ms := r.Repo.ToStudentModel(s)
+		students = append(students, &ms)
 	}
 
-	return append(messages, otherMessages...), nil
+	return &model.StudentPage{Total: total, Students: students}, nil
 }
 
-func (r *queryResolver) Lessons(ctx context.Context, input model.TimeRangeRequest) ([]*model.Lesson, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) AdminTutors(ctx context.Context, input model.AdminSearch) (*model.TutorPage, error) {
+	limit, offset := pageBounds(input.Limit, input.Offset)
+
+	dbTutors, total, err := r.Adm.SearchTutors(orEmpty(input.Query), limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, InternalServerError
 	}
 
-	var dbLessons []db.Lesson
-
-	switch user := u.(type) {
-	case db.Student:
-		dbLessons, err = r.Repo.GetStudentLessons(user.Id, input.StartTime, input.EndTime)
+	tutors := []*model.Tutor{}
+	for _, t := range dbTutors {
+		mt, err := r.Repo.ToTutorModel(t)
 		if err != nil {
-			r.sendError(err, "Cannot retrieve student lessons from db")
+			r.sendError(err, "Cannot parse tutor from database")
 			return nil, InternalServerError
 		}
-	case db.Tutor:
-		dbLessons, err = r.Repo.GetTutorLessons(user.Id, input.StartTime, input.EndTime)
-		if err != nil {
-			r.sendError(err, "Cannot retrieve tutor lessons from db")
-			return nil, InternalServerError
-		}
-	default:
-		return nil, Unauthorised
+		tutors = append(tutors, &mt)
 	}
 
-	// Convert dbLessons to gql Lesson Type
-	var lessons []*model.Lesson
-	for _, l := range dbLessons {
-		rl, err := r.Repo.ToLessonModel(l)
+	return &model.TutorPage{Total: total, Tutors: tutors}, nil
+}
+
+func (r *queryResolver) AdminStuckMatches(ctx context.Context) ([]*model.Match, error) {
+	dbMatches, err := r.Adm.StuckMatches()
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	matches := []*model.Match{}
+	for _, m := range dbMatches {
+		mm, err := r.Repo.ToMatchModel(m)
 		if err != nil {
-			r.sendError(err, "Cannot parse lesson")
+			r.sendError(err, "Cannot cast dbmodel to gql model")
 			return nil, InternalServerError
 		}
-		lessons = append(lessons, &rl)
+		matches = append(matches, &mm)
 	}
 
-	return lessons, nil
+	return matches, nil
 }
 
-func (r *queryResolver) PendingMatches(ctx context.Context) ([]*model.Match, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) AdminAuditLog(ctx context.Context, input model.AdminAuditRange) ([]*model.AuditEntry, error) {
+	limit, offset := pageBounds(input.Limit, input.Offset)
+
+	dbEntries, err := r.Adm.AuditLog(orEmpty(input.Target), limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, InternalServerError
 	}
 
-	var dbMatches []db.Match
+	entries := []*model.AuditEntry{}
+	for _, e := range dbEntries {
+		me := r.Repo.ToAuditEntryModel(e)
+		entries = append(entries, &me)
+	}
 
-	switch user := u.(type) {
-	case db.Student:
-		dbMatches, err = r.Repo.GetStudentPendingMatches(user.Id)
-		if err != nil {
-			r.sendError(err, "Cannot retrieve student pending matches from database")
-			return nil, InternalServerError
-		}
-	case db.Tutor:
-		dbMatches, err = r.Repo.GetTutorPendingMatches(user.Id)
-		if err != nil {
-			r.sendError(err, "Cannot retrieve tutor pending matches from database")
-			return nil, InternalServerError
-		}
-	default:
-		return nil, Unauthorised
+	return entries, nil
+}
+
+func (r *queryResolver) AdminFlaggedReviews(ctx context.Context, input model.AdminReviewQueue) ([]*model.Review, error) {
+	limit, offset := pageBounds(input.Limit, input.Offset)
+
+	dbReviews, err := r.Adm.FlaggedReviews(limit, offset)
+	if err != nil {
+		return nil, InternalServerError
 	}
 
-	var modelMatches []*model.Match
-	for _, match := range dbMatches {
-		model, err := r.Repo.ToMatchModel(match)
-		if err != nil {
-			r.sendError(err, "Cannot cast dbmodel to gql model")
-			return nil, InternalServerError
-		}
-		modelMatches = append(modelMatches, &model)
+	reviews := []*model.Review{}
+	for _, rv := range dbReviews {
+		mrv := r.Repo.ToReviewModel(rv)
+		reviews = append(reviews, &mrv)
 	}
 
-	return modelMatches, nil
+	return reviews, nil
 }
 
-func (r *queryResolver) Notifications(ctx context.Context, input model.TimeRangeRequest) ([]*model.Notification, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) AdminUserReports(ctx context.Context, input model.AdminReportQueue) ([]*model.UserReport, error) {
+	limit, offset := pageBounds(input.Limit, input.Offset)
+
+	resolved := false
+	if input.Resolved != nil {
+		resolved = *input.Resolved
+	}
+
+	dbReports, err := r.Adm.UserReports(resolved, limit, offset)
+	if err != nil {
+		return nil, InternalServerError
+	}
+
+	reports := []*model.UserReport{}
+	for _, ur := range dbReports {
+		mur := r.Repo.ToUserReportModel(ur)
+		reports = append(reports, &mur)
+	}
+
+	return reports, nil
+}
+
+func (r *queryResolver) AdminReportedMessages(ctx context.Context, input string, first *int, after *string) (*model.MessageConnection, error) {
+	afterCreated, afterId, err := messagePosition(after)
 	if err != nil {
 		return nil, err
 	}
 
-	var dbNotifications []db.Notification
+	limit, _ := pageBounds(first, nil)
 
-	switch user := u.(type) {
-	case db.Student:
-		dbNotifications, err = r.Repo.GetUserNotifications(user.Id, input.StartTime, input.EndTime)
-		if err != nil {
-			r.sendError(err, "Cannot retrieve student notifications from database")
-			return nil, InternalServerError
-		}
-	case db.Tutor:
-		dbNotifications, err = r.Repo.GetUserNotifications(user.Id, input.StartTime, input.EndTime)
-		if err != nil {
-			r.sendError(err, "Cannot retrieve tutor notifications from database")
-			return nil, InternalServerError
-		}
-	default:
-		return nil, Unauthorised
+	messages, err := r.Adm.ReportedMessages(ctx, input, afterCreated, afterId, limit+1)
+	if err != nil {
+		return nil, adminError(err)
 	}
 
-	// Convert dbNotifications to gql Notifications Type
-	var notifications []*model.Notification
-	for _, n := range dbNotifications {
-		rn := r.Repo.ToNotificationModel(n)
-		if err != nil {
-			r.sendError(err, "Cannot parse notification model")
-			return nil, InternalServerError
-		}
-		notifications = append(notifications, &rn)
+	return r.toMessageConnection(messages, limit, afterId), nil
+}
+
+func (r *queryResolver) AdminAffinity(ctx context.Context, input model.AdminAffinityKey) (*model.AffinityExplanation, error) {
+	e, stored, err := r.Adm.ExplainAffinity(input.Tutor, input.Student, input.Subject)
+	if err != nil {
+		return nil, InternalServerError
 	}
 
-	return notifications, nil
+	return toAffinityExplanation(e, stored), nil
 }
 
-func (r *queryResolver) GetScheduledMatches(ctx context.Context, input model.ScheduledMatchParameters) ([]*model.Tutor, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *queryResolver) AdminTutorApplications(ctx context.Context, input model.AdminApplicationQueue) ([]*model.TutorApplication, error) {
+	limit, offset := pageBounds(input.Limit, input.Offset)
+
+	dbApplications, err := r.Adm.TutorApplications(input.Status.String(), limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, InternalServerError
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		subject, err := r.Repo.GetSubject(input.Subject.Name.String(), input.Subject.Standard.String())
+	applications := []*model.TutorApplication{}
+	for _, a := range dbApplications {
+		ma, err := r.toTutorApplication(a)
 		if err != nil {
-			r.sendError(err, "Cannot get subject from database")
-			return nil, InternalServerError
+			return nil, err
 		}
+		applications = append(applications, ma)
+	}
 
-		tids, err := r.Ms.MatchScheduled(user, subject, input.Time.StartTime, input.Time.EndTime, 20)
-		if err != nil {
-			return nil, InternalServerError
-		}
+	return applications, nil
+}
 
-		var tutors []*model.Tutor
-		for _, tid := range tids {
-			dbTutor, err := r.Repo.GetTutorById(tid)
-			if err != nil {
-				r.sendError(err, "Cannot get tutor from database")
-				return nil, InternalServerError
-			}
+func (r *queryResolver) AdminTutorApplication(ctx context.Context, input string) (*model.TutorApplication, error) {
+	a, err := r.Adm.TutorApplication(input)
+	if err != nil {
+		return nil, adminError(err)
+	}
 
-			tutor, err := r.Repo.ToTutorModel(dbTutor)
-			if err != nil {
-				r.sendError(err, "Cannot parse tutor from database")
-				return nil, InternalServerError
-			}
+	return r.toTutorApplication(a)
+}
 
-			tutors = append(tutors, &tutor)
-		}
+func (r *subscriptionResolver) SubscribeMessages(ctx context.Context) (<-chan *model.Message, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		return tutors, err
-	case db.Tutor:
-		r.sendError(err, "Only students can request for a match")
-		return nil, Unauthorised
-	default:
-		return nil, Unauthorised
+	cchan, err := r.Cs.SubscribeMessages(p.Id, ctx.Done())
+	if err != nil {
+		r.sendError(err, "Cannot subscribe to messages")
+		return nil, InternalServerError
 	}
+
+	return cchan, nil
 }
 
-func (r *queryResolver) CheckForMatch(ctx context.Context, input string) (*model.Lesson, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *subscriptionResolver) SubscribeConversationActivity(ctx context.Context) (<-chan *model.ConversationActivity, error) {
+	p, err := principalFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		l, err := r.Ms.CheckForMatch(user, input)
-		if err == errors.New("No match found") {
-			return nil, err
-		} else if err != nil {
-			r.sendError(err, "Error retrieving match")
-			return nil, InternalServerError
-		}
+	achan, err := r.Cs.SubscribeActivity(p.Id, ctx.Done())
+	if err != nil {
+		r.sendError(err, "Cannot subscribe to conversation activity")
+		return nil, InternalServerError
+	}
 
-		ml, err := r.Repo.ToLessonModel(*l)
+	return achan, nil
+}
 
-		if err != nil {
-			return &ml, err
-		}
+func (r *subscriptionResolver) SubscribeMatchNotifications(ctx context.Context) (<-chan *model.MatchNotification, error) {
+	p, err := principalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		return &ml, nil
-	case db.Tutor:
-		r.sendError(err, "Only students can long poll for a match")
-		return nil, Unauthorised
-	default:
-		return nil, Unauthorised
+	nchan, err := r.Ns.SubscribeMatchNotifications(p.Id, ctx.Done())
+	if err != nil {
+		r.sendError(err, "Cannot subscribe to match notifications")
+		return nil, InternalServerError
 	}
+
+	return nchan, nil
 }
 
-func (r *queryResolver) GetLessonRoom(ctx context.Context, input string) (string, error) {
-	u, err := auth.UserFromContext(ctx)
+func (r *subscriptionResolver) SubscribeMatchStatus(ctx context.Context, input string) (<-chan *model.MatchStatusUpdate, error) {
+	s, err := studentFromContext(ctx)
 	if err != nil {
-		return "", Unauthorised
+		return nil, err
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		inLesson, err := r.Repo.IsStudentInLesson(user.Id, input)
-		if err != nil {
-			r.sendError(err, "Unable to check lesson")
-			return "", InternalServerError
-		}
+	// Subscribe before reading the current status, so that no update is missed in between
+	schan, err := r.Ns.SubscribeMatchStatus(input, ctx.Done())
+	if err != nil {
+		r.sendError(err, "Cannot subscribe to match status")
+		return nil, InternalServerError
+	}
 
-		if !inLesson {
-			r.sendError(err, fmt.Sprintf("Student %s is not in lesson %s", user.Id, input))
-			return "", Unauthorised
-		}
+	current, err := r.Ms.MatchStatus(s, input)
+	if err != nil {
+		r.sendError(err, "Cannot retrieve match status")
+		return nil, err
+	}
 
-		token, err := r.Video.GenerateAccessToken(user.Id, input)
-		if err != nil {
-			r.sendError(err, "Unable to generate room access token")
-			return "", InternalServerError
-		}
+	ochan := make(chan *model.MatchStatusUpdate, 1)
+	ochan <- &current
 
-		return token, nil
-	case db.Tutor:
-		inLesson, err := r.Repo.IsTutorInLesson(user.Id, input)
-		if err != nil {
-			r.sendError(err, "Unable to check lesson")
-			return "", InternalServerError
+	go func() {
+		defer close(ochan)
+		for update := range schan {
+			select {
+			case ochan <- update:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
 
-		if !inLesson {
-			r.sendError(err, fmt.Sprintf("Tutor %s is not in lesson %s", user.Id, input))
-			return "", Unauthorised
-		}
+	return ochan, nil
+}
 
-		token, err := r.Video.GenerateAccessToken(user.Id, input)
+func (r *tutorResolver) Reviews(ctx context.Context, obj *model.Tutor, first *int, after *string) (*model.ReviewConnection, error) {
+	var afterCreated time.Time
+	var afterId string
+	if after != nil {
+		key, id, err := decodeCursor(*after, reviewCursor)
 		if err != nil {
-			r.sendError(err, "Unable to generate room access token")
-			return "", InternalServerError
+			return nil, err
 		}
-
-		return token, nil
-	default:
-		return "", InternalServerError
+		afterCreated, afterId = time.Unix(0, int64(key)*int64(time.Microsecond)), id
 	}
-}
 
-func (r *subscriptionResolver) SubscribeMessages(ctx context.Context) (<-chan *model.Message, error) {
-	u, err := auth.UserFromContext(ctx)
+	limit, _ := pageBounds(first, nil)
+
+	// Fetch one more review than asked for, to know whether there is a next page
+	reviews, total, err := r.Rvs.TutorReviews(obj.ID, afterCreated, afterId, limit+1)
 	if err != nil {
-		return nil, Unauthorised
+		return nil, InternalServerError
 	}
 
-	var uid string
-	switch user := u.(type) {
-	case db.Student:
-		uid = user.Id
-	case db.Tutor:
-		uid = user.Id
-	default:
-		return nil, Unauthorised
+	conn := model.ReviewConnection{Edges: []*model.ReviewEdge{}, PageInfo: &model.PageInfo{HasPreviousPage: afterId != ""}, TotalCount: total}
+	if len(reviews) > limit {
+		conn.PageInfo.HasNextPage = true
+		reviews = reviews[:limit]
 	}
 
-	cchan := r.Cs.SubscribeMessages(uid, ctx.Done())
-	return cchan, nil
-}
+	for _, rv := range reviews {
+		mrv := r.Repo.ToReviewModel(rv)
 
-func (r *subscriptionResolver) SubscribeMatchNotifications(ctx context.Context) (<-chan *model.MatchNotification, error) {
-	u, err := auth.UserFromContext(ctx)
-	if err != nil {
-		return nil, err
+		// Postgres keeps timestamps to the microsecond, so they survive the round trip through the cursor exactly
+		cursor := encodeCursor(reviewCursor, int(rv.Created.UnixNano()/int64(time.Microsecond)), rv.Id)
+		conn.Edges = append(conn.Edges, &model.ReviewEdge{Cursor: cursor, Node: &mrv})
 	}
 
-	switch user := u.(type) {
-	case db.Student:
-		r.sendError(err, "Only tutors can subscribe to match notifications")
-		return nil, Unauthorised
-	case db.Tutor:
-		nchan := r.Ns.CreateUserMatchChannel(user.Id)
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
 
-		// Delete channel when done
-		go func() {
-			<-ctx.Done()
-			r.Ns.DeleteUserMatchChannel(user.Id)
-		}()
+	return &conn, nil
+}
 
-		return *nchan, nil
-	default:
-		return nil, Unauthorised
+func (r *tutorResolver) Availability(ctx context.Context, obj *model.Tutor, input model.TimeRangeRequest) ([]*model.AvailabilityWindow, error) {
+	slots, err := r.Avs.FreeSlots(obj.ID, input.StartTime, input.EndTime)
+	if err != nil {
+		return nil, availabilityError(err)
+	}
+
+	windows := []*model.AvailabilityWindow{}
+	for _, w := range slots {
+		windows = append(windows, toAvailabilityWindow(w))
 	}
+
+	return windows, nil
 }
 
+// Lesson returns generated.LessonResolver implementation.
+func (r *Resolver) Lesson() generated.LessonResolver { return &lessonResolver{r} }
+
+// Message returns generated.MessageResolver implementation.
+func (r *Resolver) Message() generated.MessageResolver { return &messageResolver{r} }
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
@@ -818,6 +1992,12 @@ func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 // Subscription returns generated.SubscriptionResolver implementation.
 func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
 
+// Tutor returns generated.TutorResolver implementation.
+func (r *Resolver) Tutor() generated.TutorResolver { return &tutorResolver{r} }
+
+type lessonResolver struct{ *Resolver }
+type messageResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
+type tutorResolver struct{ *Resolver }
@@ -1,14 +1,32 @@
 package graph
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/admin"
+	"github.com/solderneer/axiom-backend/services/affinity"
+	"github.com/solderneer/axiom-backend/services/availability"
+	"github.com/solderneer/axiom-backend/services/chat"
+	"github.com/solderneer/axiom-backend/services/lesson"
+	"github.com/solderneer/axiom-backend/services/onboarding"
+	"github.com/solderneer/axiom-backend/services/review"
+	"github.com/solderneer/axiom-backend/services/session"
+	"github.com/solderneer/axiom-backend/utilities/auth"
 )
 
 var (
 	InternalServerError = errors.New("Internal Server Error")
 	Unauthorised        = errors.New("Unauthorised access. Please log in, or switch users to the correct permissions")
+	InvalidCursor       = errors.New("Invalid cursor")
 )
 
 // Logs an error with the correct format
@@ -18,3 +36,305 @@ func (r *Resolver) sendError(err error, message string) {
 		"err":     err.Error(),
 	}).Error(message)
 }
+
+// Converts issued session tokens to the GraphQL auth payload
+func toAuthPayload(tokens session.Tokens) *model.AuthPayload {
+	return &model.AuthPayload{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken}
+}
+
+// Reads the optional device name supplied when logging in
+func deviceName(name *string) string {
+	if name == nil {
+		return ""
+	}
+	return *name
+}
+
+// Gets the principal behind a request, the id and role are all most resolvers need
+func principalFromContext(ctx context.Context) (auth.Principal, error) {
+	p, err := auth.PrincipalFromContext(ctx)
+	if err != nil {
+		return p, Unauthorised
+	}
+
+	return p, nil
+}
+
+// Gets the full student record behind a request, for fields restricted to students with @hasRole
+func studentFromContext(ctx context.Context) (db.Student, error) {
+	u, err := auth.UserFromContext(ctx)
+	if err != nil {
+		return db.Student{}, Unauthorised
+	}
+
+	s, ok := u.(db.Student)
+	if !ok {
+		return db.Student{}, Unauthorised
+	}
+
+	return s, nil
+}
+
+// Gets the full tutor record behind a request, for fields restricted to tutors with @hasRole
+func tutorFromContext(ctx context.Context) (db.Tutor, error) {
+	u, err := auth.UserFromContext(ctx)
+	if err != nil {
+		return db.Tutor{}, Unauthorised
+	}
+
+	t, ok := u.(db.Tutor)
+	if !ok {
+		return db.Tutor{}, Unauthorised
+	}
+
+	return t, nil
+}
+
+// Page size used when a paginated admin query does not set a limit, and the largest one allowed
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Reads the optional limit and offset of a paginated query, clamping them to sane values
+func pageBounds(limit *int, offset *int) (int, int) {
+	l, o := defaultPageSize, 0
+
+	if limit != nil && *limit > 0 {
+		l = *limit
+	}
+	if l > maxPageSize {
+		l = maxPageSize
+	}
+
+	if offset != nil && *offset > 0 {
+		o = *offset
+	}
+
+	return l, o
+}
+
+// Reads an optional string argument, treating a missing one as empty
+func orEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Passes the errors admins can act on through, hiding everything else behind an internal server error
+func adminError(err error) error {
+	switch err {
+	case admin.ErrNotFound, admin.ErrLessonNotScheduled, admin.ErrTutorUnavailable, admin.ErrMatchResolved, admin.ErrNoConversation:
+		return err
+	}
+
+	return onboardingError(err)
+}
+
+// Passes the errors of the application workflow through, hiding everything else behind an internal server error
+func onboardingError(err error) error {
+	switch err {
+	case onboarding.ErrNotFound, onboarding.ErrInvalidTransition, onboarding.ErrApplicationLocked, onboarding.ErrNoDocuments,
+		onboarding.ErrTooManyDocuments, onboarding.ErrInvalidDocument, onboarding.ErrNotesRequired:
+		return err
+	}
+
+	return InternalServerError
+}
+
+// Converts a tutor application along with its documents and reviews to the GraphQL model
+func (r *Resolver) toTutorApplication(a onboarding.Application) (*model.TutorApplication, error) {
+	t, err := r.Repo.ToTutorModel(a.Tutor)
+	if err != nil {
+		r.sendError(err, "Cannot parse tutor from database")
+		return nil, InternalServerError
+	}
+
+	documents := []*model.TutorDocument{}
+	for _, d := range a.Documents {
+		md := r.Repo.ToTutorDocumentModel(d)
+		documents = append(documents, &md)
+	}
+
+	reviews := []*model.ApplicationReview{}
+	for _, review := range a.Reviews {
+		mr := r.Repo.ToApplicationReviewModel(review)
+		reviews = append(reviews, &mr)
+	}
+
+	return &model.TutorApplication{Tutor: &t, Status: t.ApplicationStatus, Documents: documents, Reviews: reviews}, nil
+}
+
+// The sort encoded in the cursors of Tutor.reviews, which are always ordered newest first
+const reviewCursor = "REVIEWS"
+
+// The sort encoded in the cursors of messages, which are always ordered newest first
+const messageCursor = "MESSAGES"
+
+// Encodes the position of a search result as an opaque Relay cursor, which is only valid for the same sort
+func encodeCursor(sort string, key int, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sort + ":" + strconv.Itoa(key) + ":" + id))
+}
+
+// Decodes a cursor made by encodeCursor, returning the sort key and id of the result to continue after
+func decodeCursor(cursor string, sort string) (int, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", InvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || parts[0] != sort || parts[2] == "" {
+		return 0, "", InvalidCursor
+	}
+
+	key, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, "", InvalidCursor
+	}
+
+	return key, parts[2], nil
+}
+
+// Decodes the optional cursor of a page of messages, returning the time and id of the message to continue after
+func messagePosition(after *string) (time.Time, string, error) {
+	if after == nil {
+		return time.Time{}, "", nil
+	}
+
+	key, id, err := decodeCursor(*after, messageCursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	return time.Unix(0, int64(key)*int64(time.Microsecond)), id, nil
+}
+
+// Builds a page of messages fetched with one more message than the limit, which tells whether there is a next page
+func (r *Resolver) toMessageConnection(messages []db.Message, limit int, afterId string) *model.MessageConnection {
+	conn := model.MessageConnection{Edges: []*model.MessageEdge{}, PageInfo: &model.PageInfo{HasPreviousPage: afterId != ""}}
+	if len(messages) > limit {
+		conn.PageInfo.HasNextPage = true
+		messages = messages[:limit]
+	}
+
+	for _, m := range messages {
+		mm := r.Repo.ToMessageModel(m, chat.AttachmentPath)
+
+		cursor := encodeCursor(messageCursor, int(m.Created.UnixNano()/int64(time.Microsecond)), m.Id)
+		conn.Edges = append(conn.Edges, &model.MessageEdge{Cursor: cursor, Node: &mm})
+	}
+
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+
+	return &conn
+}
+
+// Passes the validation errors of chat through, logging everything else with the given message and hiding it behind an internal server error
+// Chat does not log on its own, unlike other services
+func (r *Resolver) chatError(err error, message string) error {
+	switch err {
+	case chat.ErrNotFound, chat.ErrEmptyMessage, chat.ErrMessageSelf, chat.ErrNotParticipant, chat.ErrUnknownUser, chat.ErrNotRelated,
+		chat.ErrBlocked, chat.ErrRateLimited, chat.ErrReasonRequired, chat.ErrFileRequired, chat.ErrAttachmentTooLarge, chat.ErrUnsupportedType,
+		chat.ErrInvalidImage, chat.ErrInvalidMath, chat.ErrLessonRequired, chat.ErrLessonNotShared, chat.ErrUnexpectedContent, chat.ErrUnsupportedKind,
+		chat.ErrMessageNotFound, chat.ErrNotSender, chat.ErrEditWindowPassed, chat.ErrDeleteWindowPassed, chat.ErrMessageDeleted, chat.ErrReadOnlyHistory:
+		return err
+	}
+
+	r.sendError(err, message)
+	return InternalServerError
+}
+
+// Passes the validation errors of reviews through, hiding everything else behind an internal server error
+func reviewError(err error) error {
+	switch err {
+	case review.ErrNotFound, review.ErrLessonNotFound, review.ErrNotCompleted, review.ErrInvalidRating, review.ErrBodyRequired,
+		review.ErrReasonRequired, review.ErrNotReviewedTutor, db.ErrAlreadyReviewed:
+		return err
+	}
+
+	return InternalServerError
+}
+
+// Passes the validation errors of availability changes through, hiding everything else behind an internal server error
+func availabilityError(err error) error {
+	switch err {
+	case availability.ErrNotFound, availability.ErrInvalidTimezone, availability.ErrInvalidClock, availability.ErrInvalidRule,
+		availability.ErrOverlappingRules, availability.ErrInvalidRange, availability.ErrLessonConflict:
+		return err
+	}
+
+	return InternalServerError
+}
+
+// Passes the errors of rescheduling and cancelling lessons through, hiding everything else behind an internal server error
+func lessonError(err error) error {
+	switch err {
+	case lesson.ErrNotFound, lesson.ErrRescheduleNotFound, lesson.ErrNotScheduled, lesson.ErrLessonStarted, lesson.ErrTooEarly, lesson.ErrTooLate,
+		lesson.ErrInvalidRange, lesson.ErrOwnReschedule, lesson.ErrRescheduleAnswered, lesson.ErrReasonRequired,
+		lesson.ErrNotCompleted, lesson.ErrNoReport, lesson.ErrSummaryRequired, lesson.ErrNoteRequired, lesson.ErrAttachmentNotFound,
+		lesson.ErrAttachmentTooLarge, lesson.ErrTooManyAttachments, lesson.ErrNotUploader, lesson.ErrAttachmentsCancelled,
+		db.ErrReschedulePending, db.ErrSlotTaken:
+		return err
+	}
+
+	return InternalServerError
+}
+
+// Converts a weekly availability rule to the GraphQL model, weekdays are numbered from Sunday like the Weekday enum
+func toAvailabilityRule(rule db.AvailabilityRule) *model.AvailabilityRule {
+	return &model.AvailabilityRule{
+		ID:        rule.Id,
+		Weekday:   model.AllWeekday[rule.Weekday],
+		StartTime: availability.FormatClock(rule.StartMinute),
+		EndTime:   availability.FormatClock(rule.EndMinute),
+	}
+}
+
+func toAvailabilityPeriod(a db.Availability) *model.AvailabilityPeriod {
+	return &model.AvailabilityPeriod{ID: a.Id, StartTime: a.StartTime, EndTime: a.EndTime}
+}
+
+func toAvailabilityWindow(w db.AvailabilityWindow) *model.AvailabilityWindow {
+	return &model.AvailabilityWindow{StartTime: w.StartTime, EndTime: w.EndTime}
+}
+
+func toAvailabilityException(e db.AvailabilityException) *model.AvailabilityException {
+	return &model.AvailabilityException{ID: e.Id, StartTime: e.StartTime, EndTime: e.EndTime, Reason: e.Reason}
+}
+
+// Reads a weekly availability rule from the GraphQL input
+func fromWeeklyAvailabilityRule(input *model.WeeklyAvailabilityRule) (availability.Rule, error) {
+	var rule availability.Rule
+
+	for i, weekday := range model.AllWeekday {
+		if weekday == input.Weekday {
+			rule.Weekday = i
+		}
+	}
+
+	var err error
+	if rule.StartMinute, err = availability.ParseClock(input.StartTime); err != nil {
+		return rule, err
+	}
+
+	if rule.EndMinute, err = availability.ParseClock(input.EndTime); err != nil {
+		return rule, err
+	}
+
+	return rule, nil
+}
+
+// Converts the explanation of an affinity score to the GraphQL model, stored is the score matching currently uses
+func toAffinityExplanation(e affinity.Explanation, stored int) *model.AffinityExplanation {
+	contributions := []*model.AffinityContribution{}
+	for _, c := range e.Contributions {
+		contributions = append(contributions, &model.AffinityContribution{Signal: model.AffinitySignal(c.Signal), Lesson: c.Lesson, Time: c.Time.UTC(), Points: c.Points, Weight: c.Weight, Score: c.Score})
+	}
+
+	return &model.AffinityExplanation{Tutor: e.Tutor, Student: e.Student, Subject: e.Subject, Score: e.Score, Stored: stored, Contributions: contributions}
+}
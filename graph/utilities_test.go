@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		sort string
+		key  int
+		id   string
+	}{
+		{db.SortByRating, 5, "t:1"},
+		{db.SortByPriceAsc, 0, "t:2"},
+		{db.SortByPriceDesc, -40, "t:3"},
+		{messageCursor, 1600000000123456, "message:with:colons"},
+	}
+
+	for _, tt := range tests {
+		key, id, err := decodeCursor(encodeCursor(tt.sort, tt.key, tt.id), tt.sort)
+		if err != nil || key != tt.key || id != tt.id {
+			t.Errorf("%s %d %s: decoded %d %s with error %v", tt.sort, tt.key, tt.id, key, id, err)
+		}
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	raw := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"other sort", encodeCursor(db.SortByPriceAsc, 5, "t:1")},
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(db.SortByRating + ":5:t:1x"))},
+		{"missing id", raw(db.SortByRating + ":5:")},
+		{"missing key", raw(db.SortByRating + "::t:1")},
+		{"key is not a number", raw(db.SortByRating + ":five:t:1")},
+		{"too few parts", raw(db.SortByRating + ":5")},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := decodeCursor(tt.cursor, db.SortByRating); err != InvalidCursor {
+			t.Errorf("%s: got %v, want %v", tt.name, err, InvalidCursor)
+		}
+	}
+}
+
+func TestMessagePosition(t *testing.T) {
+	if at, id, err := messagePosition(nil); !at.IsZero() || id != "" || err != nil {
+		t.Errorf("Missing cursor gave %v %q %v", at, id, err)
+	}
+
+	created := time.Date(2020, 9, 1, 12, 30, 0, 123456000, time.UTC)
+	cursor := encodeCursor(messageCursor, int(created.UnixNano()/int64(time.Microsecond)), "message")
+
+	at, id, err := messagePosition(&cursor)
+	if err != nil || !at.Equal(created) || id != "message" {
+		t.Errorf("Got %v %q %v, want %v message", at, id, err, created)
+	}
+
+	other := encodeCursor(reviewCursor, 1, "review")
+	if _, _, err = messagePosition(&other); err != InvalidCursor {
+		t.Errorf("Review cursor got %v, want %v", err, InvalidCursor)
+	}
+}
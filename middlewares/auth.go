@@ -2,9 +2,10 @@ package middlewares
 
 import (
 	"context"
-	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/solderneer/axiom-backend/db"
 	"github.com/solderneer/axiom-backend/utilities/auth"
@@ -13,11 +14,16 @@ import (
 type AuthMiddleware struct {
 	Secret string
 	Repo   *db.Repository
+	// Reverse proxies whose X-Forwarded-For header is believed, requests from anywhere else use their remote address
+	TrustedProxies []*net.IPNet
 }
 
 // Standard HTTP.Middleware interface compliant authorisation middleware
 func (amw *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Always record the client IP, it is needed when creating sessions
+		r = r.WithContext(context.WithValue(r.Context(), "ip", amw.clientIP(r)))
+
 		c, err := r.Cookie("token")
 
 		// Allow unauthenticated users in
@@ -32,52 +38,132 @@ func (amw *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		id, err := auth.ParseToken(tokenstr, amw.Secret)
-		if err != nil {
+		id, sid, err := auth.ParseToken(tokenstr, amw.Secret)
+		if err == auth.ErrTokenExpired {
+			// Let expired users through unauthenticated, so that they can still refresh
+			next.ServeHTTP(w, r)
+			return
+		} else if err != nil {
 			http.Error(w, "Invalid auth token", http.StatusForbidden)
 			return
 		}
 
-		// Determine user type
-		idSplit := strings.Split(id, ":")
+		// Reject tokens of sessions which have been revoked or have expired
+		session, err := amw.Repo.GetSessionById(sid)
+		if err != nil || session.User != id || session.Revoked || session.Expires.Before(time.Now()) {
+			http.Error(w, "Revoked auth token", http.StatusForbidden)
+			return
+		}
 
-		var ctx context.Context
+		role, err := auth.RoleFromId(id)
+		if err != nil {
+			http.Error(w, "Malformed auth token", http.StatusForbidden)
+			return
+		}
+
+		p := auth.Principal{Id: id, Role: role, Session: sid}
+
+		var user interface{}
 
 		// Retrieve user from database
-		if idSplit[0] == "s" {
+		switch role {
+		case auth.RoleStudent:
 			s, err := amw.Repo.GetStudentById(id)
-
 			if err != nil {
 				http.Error(w, "Malformed auth token", http.StatusForbidden)
 				return
 			}
 
-			ctx = context.WithValue(r.Context(), "user", map[string]interface{}{
-				"user": s,
-				"type": idSplit[0],
-			})
+			if s.Suspended {
+				http.Error(w, "Suspended account", http.StatusForbidden)
+				return
+			}
 
-		} else if idSplit[0] == "t" {
+			if s.EmailVerified {
+				p.Scopes = append(p.Scopes, auth.ScopeEmailVerified)
+			}
+			user = s
+		case auth.RoleTutor:
 			t, err := amw.Repo.GetTutorById(id)
+			if err != nil {
+				http.Error(w, "Malformed auth token", http.StatusForbidden)
+				return
+			}
 
+			if t.Suspended {
+				http.Error(w, "Suspended account", http.StatusForbidden)
+				return
+			}
+
+			if t.EmailVerified {
+				p.Scopes = append(p.Scopes, auth.ScopeEmailVerified)
+			}
+			user = t
+		case auth.RoleAdmin:
+			a, err := amw.Repo.GetAdminById(id)
 			if err != nil {
-				fmt.Println(err)
 				http.Error(w, "Malformed auth token", http.StatusForbidden)
 				return
 			}
 
-			ctx = context.WithValue(r.Context(), "user", map[string]interface{}{
-				"user": t,
-				"type": idSplit[0],
-			})
-		} else {
-			http.Error(w, "Malformed auth token", http.StatusForbidden)
-			return
+			p.Scopes = append(p.Scopes, a.Scopes...)
+			user = a
 		}
 
+		ctx := context.WithValue(r.Context(), "user", map[string]interface{}{
+			"user":    user,
+			"type":    id[:1],
+			"session": sid,
+		})
+		ctx = auth.WithPrincipal(ctx, p)
+
 		// Continue with new context
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 
 	})
 }
+
+// Gets the IP of the client, when the request comes through a trusted proxy this is the last address in X-Forwarded-For not added by a trusted proxy
+func (amw *AuthMiddleware) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !amw.trusted(host) {
+		return host
+	}
+
+	// Clients can put anything at the start of the header, so only the addresses appended by trusted proxies count
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		if !amw.trusted(hop) {
+			return hop
+		}
+		host = hop
+	}
+
+	return host
+}
+
+// Whether an address belongs to one of the trusted proxies
+func (amw *AuthMiddleware) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range amw.TrustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
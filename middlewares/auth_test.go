@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	amw := &AuthMiddleware{TrustedProxies: []*net.IPNet{proxies}}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct", "203.0.113.7:4000", "", "203.0.113.7"},
+		{"untrusted proxy is ignored", "203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"through a trusted proxy", "10.0.0.2:4000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed start of the header", "10.0.0.2:4000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"through a chain of trusted proxies", "10.0.0.2:4000", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"only trusted proxies", "10.0.0.2:4000", "10.0.0.3", "10.0.0.3"},
+		{"trusted proxy without the header", "10.0.0.2:4000", "", "10.0.0.2"},
+		{"remote address without a port", "203.0.113.7", "", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+
+		if got := amw.clientIP(r); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
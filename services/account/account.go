@@ -0,0 +1,235 @@
+// Package account handles account recovery and email ownership, through single-use tokens sent by email
+package account
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/mail"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+// How long emailed tokens stay valid
+const (
+	passwordResetExpiry     = time.Hour
+	emailVerificationExpiry = 48 * time.Hour
+)
+
+// Shortest password accepted when resetting
+const minPasswordLength = 8
+
+var (
+	ErrInvalidToken    = errors.New("Invalid or expired token, please request a new one")
+	ErrWeakPassword    = errors.New("Password must be at least 8 characters long")
+	ErrAlreadyVerified = errors.New("Email is already verified")
+)
+
+// A user (student or tutor) that can receive account emails
+type recipient struct {
+	id       string
+	name     string
+	email    string
+	verified bool
+}
+
+type AccountService struct {
+	logger *log.Logger
+	repo   *db.Repository
+	mailer mail.Mailer
+	appUrl string
+}
+
+// Initialise the account service, appUrl is the base of the links sent in emails
+func (as *AccountService) Init(logger *log.Logger, repo *db.Repository, mailer mail.Mailer, appUrl string) {
+	as.logger = logger
+	as.repo = repo
+	as.mailer = mailer
+	as.appUrl = appUrl
+
+	as.logger.WithField("service", "account").Info("Successfully initialised")
+}
+
+// Emails a password reset link to every account registered with the email
+// Unknown emails are silently ignored so that this cannot be used to find out who has an account
+func (as *AccountService) RequestPasswordReset(email string) error {
+	var recipients []recipient
+
+	s, err := as.repo.GetStudentByEmail(email)
+	if err == nil {
+		recipients = append(recipients, recipient{id: s.Id, name: s.FirstName, email: s.Email, verified: s.EmailVerified})
+	} else if err != pgx.ErrNoRows {
+		as.sendError(err, "Cannot retrieve student from database")
+		return err
+	}
+
+	t, err := as.repo.GetTutorByEmail(email)
+	if err == nil {
+		recipients = append(recipients, recipient{id: t.Id, name: t.FirstName, email: t.Email, verified: t.EmailVerified})
+	} else if err != pgx.ErrNoRows {
+		as.sendError(err, "Cannot retrieve tutor from database")
+		return err
+	}
+
+	for _, rc := range recipients {
+		token, err := as.issue(rc.id, db.PasswordResetPurpose, passwordResetExpiry)
+		if err != nil {
+			return err
+		}
+
+		as.send(mail.Message{
+			To:      rc.email,
+			Subject: "Reset your Axiom password",
+			Body: "Hi " + rc.name + ",\r\n\r\n" +
+				"Somebody asked to reset the password of your Axiom account. Follow the link below within the next hour to choose a new one:\r\n\r\n" +
+				as.appUrl + "/reset-password?token=" + token + "\r\n\r\n" +
+				"If it was not you, you can safely ignore this email.\r\n",
+		})
+	}
+
+	return nil
+}
+
+// Sets a new password using an emailed reset token, then logs the user out on every device
+func (as *AccountService) ResetPassword(token string, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	uid, err := as.repo.UseAuthToken(auth.HashOpaqueToken(token), db.PasswordResetPurpose)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidToken
+	} else if err != nil {
+		as.sendError(err, "Cannot use auth token in database")
+		return err
+	}
+
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		as.sendError(err, "Cannot hash password")
+		return err
+	}
+
+	if err = as.repo.UpdatePassword(uid, hashedPassword); err != nil {
+		as.sendError(err, "Cannot update password in database")
+		return err
+	}
+
+	// Whoever knew the old password should not stay logged in
+	if err = as.repo.RevokeUserSessions(uid); err != nil {
+		as.sendError(err, "Cannot revoke sessions in database")
+		return err
+	}
+
+	// Receiving the reset link also proves ownership of the email
+	if err = as.repo.SetEmailVerified(uid); err != nil {
+		as.sendError(err, "Cannot update email verification in database")
+		return err
+	}
+
+	return nil
+}
+
+// Emails a verification link to the user's current email
+func (as *AccountService) SendVerificationEmail(uid string) error {
+	rc, err := as.recipient(uid)
+	if err != nil {
+		return err
+	}
+
+	if rc.verified {
+		return ErrAlreadyVerified
+	}
+
+	token, err := as.issue(rc.id, db.EmailVerificationPurpose, emailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+
+	as.send(mail.Message{
+		To:      rc.email,
+		Subject: "Verify your Axiom email",
+		Body: "Hi " + rc.name + ",\r\n\r\n" +
+			"Please confirm this is your email by following the link below within the next 48 hours:\r\n\r\n" +
+			as.appUrl + "/verify-email?token=" + token + "\r\n",
+	})
+
+	return nil
+}
+
+// Marks the user's email as verified using an emailed verification token, returns the user UUID
+func (as *AccountService) VerifyEmail(token string) (string, error) {
+	uid, err := as.repo.UseAuthToken(auth.HashOpaqueToken(token), db.EmailVerificationPurpose)
+	if err == pgx.ErrNoRows {
+		return "", ErrInvalidToken
+	} else if err != nil {
+		as.sendError(err, "Cannot use auth token in database")
+		return "", err
+	}
+
+	if err = as.repo.SetEmailVerified(uid); err != nil {
+		as.sendError(err, "Cannot update email verification in database")
+		return "", err
+	}
+
+	return uid, nil
+}
+
+// Issues a new token for the purpose, invalidating the ones emailed earlier
+func (as *AccountService) issue(uid string, purpose string, expiry time.Duration) (string, error) {
+	if err := as.repo.ExpireAuthTokens(uid, purpose); err != nil {
+		as.sendError(err, "Cannot expire auth tokens in database")
+		return "", err
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		as.sendError(err, "Cannot generate auth token")
+		return "", err
+	}
+
+	if _, err = as.repo.CreateAuthToken(uid, purpose, auth.HashOpaqueToken(token), time.Now().Add(expiry)); err != nil {
+		as.sendError(err, "Cannot create auth token in database")
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Looks up a student or tutor by UUID
+func (as *AccountService) recipient(uid string) (recipient, error) {
+	if s, err := as.repo.GetStudentById(uid); err == nil {
+		return recipient{id: s.Id, name: s.FirstName, email: s.Email, verified: s.EmailVerified}, nil
+	} else if err != pgx.ErrNoRows {
+		as.sendError(err, "Cannot retrieve student from database")
+		return recipient{}, err
+	}
+
+	t, err := as.repo.GetTutorById(uid)
+	if err != nil {
+		as.sendError(err, "Cannot retrieve tutor from database")
+		return recipient{}, err
+	}
+
+	return recipient{id: t.Id, name: t.FirstName, email: t.Email, verified: t.EmailVerified}, nil
+}
+
+// Sends in the background, so a slow mail server neither blocks the request nor reveals whether an email exists
+func (as *AccountService) send(m mail.Message) {
+	go func() {
+		if err := as.mailer.Send(m); err != nil {
+			as.sendError(err, "Cannot send email")
+		}
+	}()
+}
+
+// Making sending errors easier
+func (as *AccountService) sendError(err error, message string) {
+	as.logger.WithFields(log.Fields{
+		"service": "account",
+		"err":     err.Error(),
+	}).Error(message)
+}
@@ -0,0 +1,111 @@
+package account
+
+import (
+	"io/ioutil"
+	"regexp"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+	"github.com/solderneer/axiom-backend/services/mail"
+)
+
+var tokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func newTestService(t *testing.T) (*AccountService, *mail.MemoryMailer, *db.Repository) {
+	repo := dbtest.Repository(t)
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	mm := mail.NewMemoryMailer()
+
+	var as AccountService
+	as.Init(logger, repo, mm, "https://axiom.example.com")
+
+	return &as, mm, repo
+}
+
+// Waits for the nth email to be sent in the background and returns the token linked in it
+func emailedToken(t *testing.T, mm *mail.MemoryMailer, n int) string {
+	deadline := time.Now().Add(time.Second)
+	for len(mm.Sent()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d emails, want %d", len(mm.Sent()), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	match := tokenPattern.FindStringSubmatch(mm.Sent()[n-1].Body)
+	if match == nil {
+		t.Fatalf("No token in email %q", mm.Sent()[n-1].Body)
+	}
+
+	return match[1]
+}
+
+func TestPasswordReset(t *testing.T) {
+	as, mm, repo := newTestService(t)
+	s := dbtest.Student(t, repo)
+
+	if err := as.RequestPasswordReset("nobody@example.com"); err != nil {
+		t.Fatalf("Requesting a reset for an unknown email failed: %v", err)
+	}
+
+	if err := as.RequestPasswordReset(s.Email); err != nil {
+		t.Fatalf("Cannot request password reset: %v", err)
+	}
+	old := emailedToken(t, mm, 1)
+
+	// Asking again invalidates the first link
+	if err := as.RequestPasswordReset(s.Email); err != nil {
+		t.Fatalf("Cannot request password reset: %v", err)
+	}
+	token := emailedToken(t, mm, 2)
+
+	if err := as.ResetPassword(token, "short"); err != ErrWeakPassword {
+		t.Errorf("Short password got %v, want %v", err, ErrWeakPassword)
+	}
+
+	if err := as.ResetPassword(old, "a new password"); err != ErrInvalidToken {
+		t.Errorf("Superseded token got %v, want %v", err, ErrInvalidToken)
+	}
+
+	if err := as.ResetPassword(token, "a new password"); err != nil {
+		t.Fatalf("Cannot reset password: %v", err)
+	}
+
+	if err := as.ResetPassword(token, "another password"); err != ErrInvalidToken {
+		t.Errorf("Reused token got %v, want %v", err, ErrInvalidToken)
+	}
+
+	if err := as.SendVerificationEmail(s.Id); err != ErrAlreadyVerified {
+		t.Errorf("Resetting the password did not verify the email, got %v", err)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	as, mm, repo := newTestService(t)
+	tu := dbtest.Tutor(t, repo)
+
+	if err := as.SendVerificationEmail(tu.Id); err != nil {
+		t.Fatalf("Cannot send verification email: %v", err)
+	}
+	token := emailedToken(t, mm, 1)
+
+	if _, err := as.VerifyEmail("not a token"); err != ErrInvalidToken {
+		t.Errorf("Unknown token got %v, want %v", err, ErrInvalidToken)
+	}
+
+	uid, err := as.VerifyEmail(token)
+	if err != nil || uid != tu.Id {
+		t.Fatalf("Verified %q with error %v, want %q", uid, err, tu.Id)
+	}
+
+	if err = as.SendVerificationEmail(tu.Id); err != ErrAlreadyVerified {
+		t.Errorf("Got %v, want %v", err, ErrAlreadyVerified)
+	}
+}
@@ -0,0 +1,564 @@
+// Package admin lets operations staff inspect and fix marketplace data, recording every change in the audit log
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/affinity"
+	"github.com/solderneer/axiom-backend/services/chat"
+	"github.com/solderneer/axiom-backend/services/lesson"
+	"github.com/solderneer/axiom-backend/services/match"
+	"github.com/solderneer/axiom-backend/services/notifs"
+	"github.com/solderneer/axiom-backend/services/onboarding"
+)
+
+// Matches still MATCHING this long after their period started are considered stuck
+const stuckMatchAge = 10 * time.Minute
+
+// Recorded as the reason of lessons cancelled by admins
+const supportCancellationReason = "Cancelled by Axiom support"
+
+// Actions recorded in the audit log
+const (
+	suspendAction            = "SUSPEND_USER"
+	unsuspendAction          = "UNSUSPEND_USER"
+	cancelLessonAction       = "CANCEL_LESSON"
+	reassignLessonAction     = "REASSIGN_LESSON"
+	acceptMatchAction        = "ACCEPT_MATCH"
+	failMatchAction          = "FAIL_MATCH"
+	setTutorSubjectsAction   = "SET_TUTOR_SUBJECTS"
+	resendNotificationAction = "RESEND_NOTIFICATION"
+	startReviewAction        = "START_APPLICATION_REVIEW"
+	approveApplicationAction = "APPROVE_APPLICATION"
+	rejectApplicationAction  = "REJECT_APPLICATION"
+	hideReviewAction         = "HIDE_REVIEW"
+	showReviewAction         = "SHOW_REVIEW"
+	resolveReportAction      = "RESOLVE_USER_REPORT"
+)
+
+var (
+	ErrNotFound           = errors.New("No such record")
+	ErrLessonNotScheduled = errors.New("Only scheduled lessons can be cancelled or reassigned")
+	ErrTutorUnavailable   = errors.New("Tutor is suspended, not approved or already has a lesson at that time")
+	ErrMatchResolved      = errors.New("Match is no longer pending")
+	ErrNoConversation     = errors.New("The reported users never talked")
+)
+
+type AdminService struct {
+	logger *log.Logger
+	repo   *db.Repository
+	ns     *notifs.NotifService
+	ms     *match.MatchService
+	obs    *onboarding.OnboardingService
+	afs    *affinity.AffinityService
+	cs     *chat.Chat
+	ls     *lesson.LessonService
+}
+
+// Initialise the admin service
+func (as *AdminService) Init(logger *log.Logger, repo *db.Repository, ns *notifs.NotifService, ms *match.MatchService, obs *onboarding.OnboardingService, afs *affinity.AffinityService, cs *chat.Chat, ls *lesson.LessonService) {
+	as.logger = logger
+	as.repo = repo
+	as.ns = ns
+	as.ms = ms
+	as.obs = obs
+	as.afs = afs
+	as.cs = cs
+	as.ls = ls
+
+	as.logger.WithField("service", "admin").Info("Successfully initialised")
+}
+
+// Searches students by username, name or email, also returning the total number of matching students
+func (as *AdminService) SearchStudents(query string, limit int, offset int) ([]db.Student, int, error) {
+	students, err := as.repo.SearchStudents(query, limit, offset)
+	if err != nil {
+		as.sendError(err, "Cannot search students in database")
+		return nil, 0, err
+	}
+
+	total, err := as.repo.CountStudents(query)
+	if err != nil {
+		as.sendError(err, "Cannot count students in database")
+		return nil, 0, err
+	}
+
+	return students, total, nil
+}
+
+// Searches tutors by username, name or email, also returning the total number of matching tutors
+func (as *AdminService) SearchTutors(query string, limit int, offset int) ([]db.Tutor, int, error) {
+	tutors, err := as.repo.SearchTutors(query, limit, offset)
+	if err != nil {
+		as.sendError(err, "Cannot search tutors in database")
+		return nil, 0, err
+	}
+
+	total, err := as.repo.CountTutors(query)
+	if err != nil {
+		as.sendError(err, "Cannot count tutors in database")
+		return nil, 0, err
+	}
+
+	return tutors, total, nil
+}
+
+// Lists the matches which were neither accepted nor expired in time
+func (as *AdminService) StuckMatches() ([]db.Match, error) {
+	matches, err := as.repo.GetStuckMatches(time.Now().Add(-stuckMatchAge))
+	if err != nil {
+		as.sendError(err, "Cannot retrieve stuck matches from database")
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// Lists the audit log, optionally only for one target
+func (as *AdminService) AuditLog(target string, limit int, offset int) ([]db.AuditEntry, error) {
+	entries, err := as.repo.GetAuditLog(target, limit, offset)
+	if err != nil {
+		as.sendError(err, "Cannot retrieve audit log from database")
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Suspends or unsuspends a student or tutor. Suspending also logs the user out everywhere
+func (as *AdminService) SetSuspended(actor string, uid string, suspended bool) error {
+	before, err := as.suspended(uid)
+	if err != nil {
+		return err
+	}
+
+	action := unsuspendAction
+	if suspended {
+		action = suspendAction
+	}
+
+	audit := &db.Audit{Actor: actor, Action: action, Target: uid, Before: map[string]interface{}{"suspended": before}, After: map[string]interface{}{"suspended": suspended}}
+
+	if err = as.repo.SetSuspended(uid, suspended, audit); err != nil {
+		as.sendError(err, "Cannot update suspension in database")
+		return err
+	}
+
+	return nil
+}
+
+// Cancels a scheduled lesson regardless of who is in it or how soon it starts, notifying both the student and tutor
+func (as *AdminService) CancelLesson(actor string, lid string) (db.Lesson, error) {
+	l, err := as.lesson(lid)
+	if err != nil {
+		return l, err
+	}
+
+	cancelled := l
+	cancelled.Status = lesson.Cancelled
+	audit := &db.Audit{Actor: actor, Action: cancelLessonAction, Target: l.Id, Before: lessonSnapshot(l), After: lessonSnapshot(cancelled)}
+
+	// The lesson service only cancels lessons which are still scheduled, and withdraws their pending reschedules
+	l, err = as.ls.CancelAsSupport(actor, l.Id, supportCancellationReason, audit)
+	if err == lesson.ErrNotScheduled {
+		return l, ErrLessonNotScheduled
+	} else if err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
+
+// Hands a scheduled lesson over to another tutor, who has to be free at the time of the lesson
+func (as *AdminService) ReassignLesson(actor string, lid string, tid string) (db.Lesson, error) {
+	l, err := as.lesson(lid)
+	if err != nil {
+		return l, err
+	}
+
+	if l.Status != lesson.Scheduled {
+		return l, ErrLessonNotScheduled
+	}
+
+	t, err := as.repo.GetTutorById(tid)
+	if err == pgx.ErrNoRows {
+		return l, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve tutor from database")
+		return l, err
+	}
+
+	free, err := as.repo.CheckTutorAvailability(t.Id, l.StartTime, l.EndTime)
+	if err != nil {
+		as.sendError(err, "Cannot check tutor availability in database")
+		return l, err
+	}
+
+	if t.Suspended || t.ApplicationStatus != onboarding.Approved || !free {
+		return l, ErrTutorUnavailable
+	}
+
+	previous := l.Tutor
+	reassigned := l
+	reassigned.Tutor = t.Id
+	audit := &db.Audit{Actor: actor, Action: reassignLessonAction, Target: l.Id, Before: lessonSnapshot(l), After: lessonSnapshot(reassigned)}
+
+	// Only the tutor changes, so a reschedule accepted in the meantime stands, the new tutor may have been booked since their availability was checked
+	ok, err := as.repo.ReassignLesson(l.Id, previous, t.Id, audit)
+	if err == db.ErrSlotTaken {
+		return l, ErrTutorUnavailable
+	} else if err != nil {
+		as.sendError(err, "Cannot reassign lesson in database")
+		return l, err
+	}
+
+	if !ok {
+		return l, ErrLessonNotScheduled
+	}
+
+	l = reassigned
+
+	// The lesson no longer counts towards the affinity of its previous tutor
+	as.afs.Refresh(previous, l.Student, l.Subject.Id)
+	as.afs.Refresh(l.Tutor, l.Student, l.Subject.Id)
+
+	as.notify(previous, "Lesson reassigned", "Your "+l.Subject.Name+" lesson has been handed over to another tutor by Axiom support")
+	as.notify(t.Id, "New lesson assigned", "Axiom support has assigned you a "+l.Subject.Name+" lesson")
+	as.notify(l.Student, "Lesson updated", "Your "+l.Subject.Name+" lesson will now be taught by "+t.FirstName)
+
+	return l, nil
+}
+
+// Resolves a stuck match, either accepting it on behalf of its tutor or failing it
+func (as *AdminService) ResolveMatch(actor string, mid string, accept bool) (db.Match, error) {
+	m, err := as.repo.GetMatchById(mid)
+	if err == pgx.ErrNoRows {
+		return m, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve match from database")
+		return m, err
+	}
+
+	if m.Status != "MATCHING" {
+		return m, ErrMatchResolved
+	}
+
+	// The lesson an accept books is linked from the match itself
+	audit := &db.Audit{Actor: actor, Target: m.Id, Before: map[string]interface{}{"status": m.Status}}
+
+	if accept {
+		audit.Action = acceptMatchAction
+		audit.After = map[string]interface{}{"status": "MATCHED"}
+
+		t, err := as.repo.GetTutorById(m.Tutor)
+		if err != nil {
+			as.sendError(err, "Cannot retrieve tutor from database")
+			return m, err
+		}
+
+		if _, err = as.ms.AcceptAsSupport(m, t, audit); err != nil {
+			return m, err
+		}
+	} else {
+		audit.Action = failMatchAction
+		audit.After = map[string]interface{}{"status": "FAILED"}
+
+		expired, err := as.repo.ExpireMatch(m.Id, audit)
+		if err != nil {
+			as.sendError(err, "Cannot expire match in database")
+			return m, err
+		}
+
+		if !expired {
+			return m, ErrMatchResolved
+		}
+	}
+
+	if m, err = as.repo.GetMatchById(mid); err != nil {
+		as.sendError(err, "Cannot retrieve match from database")
+		return m, err
+	}
+
+	return m, nil
+}
+
+// Replaces the subjects a tutor teaches
+func (as *AdminService) SetTutorSubjects(actor string, tid string, subids []string) (db.Tutor, error) {
+	t, err := as.repo.GetTutorById(tid)
+	if err == pgx.ErrNoRows {
+		return t, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve tutor from database")
+		return t, err
+	}
+
+	audit := &db.Audit{Actor: actor, Action: setTutorSubjectsAction, Target: t.Id, Before: map[string]interface{}{"subjects": t.Subjects}, After: map[string]interface{}{"subjects": subids}}
+
+	if err = as.repo.SetTutorSubjects(t.Id, subids, audit); err != nil {
+		as.sendError(err, "Cannot update tutor subjects in database")
+		return t, err
+	}
+
+	t.Subjects = subids
+
+	return t, nil
+}
+
+// Pushes an existing notification to its recipient again
+func (as *AdminService) ResendNotification(actor string, nid string) (db.Notification, error) {
+	n, err := as.repo.GetNotificationById(nid)
+	if err == pgx.ErrNoRows {
+		return n, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve notification from database")
+		return n, err
+	}
+
+	uid := n.Student
+	if uid == "" {
+		uid = n.Tutor
+	}
+
+	token, err := as.pushToken(uid)
+	if err != nil {
+		return n, err
+	}
+
+	if err = as.ns.SendPushNotification(n, token); err != nil {
+		return n, err
+	}
+
+	// Nothing changes in the database, so the audit entry is written on its own once the notification went out
+	if _, err = as.repo.CreateAuditEntry(db.Audit{Actor: actor, Action: resendNotificationAction, Target: n.Id, After: map[string]interface{}{"recipient": uid}}); err != nil {
+		as.sendError(err, "Cannot write audit log entry")
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Lists the reviews flagged as inappropriate which have not been moderated yet, the most flagged first
+func (as *AdminService) FlaggedReviews(limit int, offset int) ([]db.Review, error) {
+	reviews, err := as.repo.GetFlaggedReviews(limit, offset)
+	if err != nil {
+		as.sendError(err, "Cannot retrieve flagged reviews from database")
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// Hides a review from everyone but admins, or shows it again, resolving its flags either way
+// Hidden reviews no longer count towards the rating of the tutor
+func (as *AdminService) ModerateReview(actor string, rid string, hidden bool) (db.Review, error) {
+	rv, err := as.repo.GetReviewById(rid)
+	if err == pgx.ErrNoRows {
+		return rv, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve review from database")
+		return rv, err
+	}
+
+	action := showReviewAction
+	if hidden {
+		action = hideReviewAction
+	}
+
+	// Moderating resolves every flag of the review
+	audit := &db.Audit{Actor: actor, Action: action, Target: rv.Id, Before: map[string]interface{}{"hidden": rv.Hidden, "flags": rv.Flags}, After: map[string]interface{}{"hidden": hidden, "flags": 0}}
+
+	if rv, err = as.repo.SetReviewHidden(rv.Id, hidden, audit); err != nil {
+		as.sendError(err, "Cannot moderate review in database")
+		return rv, err
+	}
+
+	// Hidden reviews no longer count towards affinity either
+	as.afs.Refresh(rv.Tutor, rv.Student, rv.Subject)
+
+	return rv, nil
+}
+
+// Explains how the affinity of a tutor and student in a subject is computed, along with the score currently stored
+func (as *AdminService) ExplainAffinity(tid string, sid string, subid string) (affinity.Explanation, int, error) {
+	return as.afs.Explain(tid, sid, subid)
+}
+
+// Lists the user reports which are resolved or not, oldest first
+func (as *AdminService) UserReports(resolved bool, limit int, offset int) ([]db.UserReport, error) {
+	reports, err := as.repo.GetUserReports(resolved, limit, offset)
+	if err != nil {
+		as.sendError(err, "Cannot retrieve user reports from database")
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// Gets the messages of the conversation a report is about, newest first, see chat.GetMessages
+func (as *AdminService) ReportedMessages(ctx context.Context, rid string, afterCreated time.Time, afterId string, limit int) ([]db.Message, error) {
+	ur, err := as.repo.GetUserReportById(rid)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve user report from database")
+		return nil, err
+	}
+
+	if ur.Conversation == "" {
+		return nil, ErrNoConversation
+	}
+
+	conv, err := as.cs.Conversation(ur.Conversation)
+	if err == chat.ErrNotFound {
+		return nil, ErrNoConversation
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve reported conversation")
+		return nil, err
+	}
+
+	messages, err := as.cs.GetMessages(ctx, conv, afterCreated, afterId, limit)
+	if err != nil {
+		as.sendError(err, "Cannot retrieve reported messages")
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Marks a user report as dealt with, any action against the reported user is taken separately, such as suspending them
+func (as *AdminService) ResolveReport(actor string, rid string) (db.UserReport, error) {
+	ur, err := as.repo.GetUserReportById(rid)
+	if err == pgx.ErrNoRows {
+		return ur, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve user report from database")
+		return ur, err
+	}
+
+	audit := &db.Audit{Actor: actor, Action: resolveReportAction, Target: ur.Id, Before: map[string]interface{}{"resolved": ur.Resolved}, After: map[string]interface{}{"resolved": true}}
+
+	if ur, err = as.repo.ResolveUserReport(ur.Id, actor, audit); err != nil {
+		as.sendError(err, "Cannot resolve user report in database")
+		return ur, err
+	}
+
+	return ur, nil
+}
+
+// Lists the tutor applications in a status, those who have been waiting the longest first
+func (as *AdminService) TutorApplications(status string, limit int, offset int) ([]onboarding.Application, error) {
+	return as.obs.Queue(status, limit, offset)
+}
+
+// Gets the application of a tutor
+func (as *AdminService) TutorApplication(tid string) (onboarding.Application, error) {
+	return as.obs.Application(tid)
+}
+
+// Takes a submitted tutor application up for review
+func (as *AdminService) StartApplicationReview(actor string, tid string) (onboarding.Application, error) {
+	return as.transitionApplication(actor, startReviewAction, tid, onboarding.UnderReview, "")
+}
+
+// Approves a tutor application under review, after which the tutor can be matched, or rejects it with notes for the tutor
+func (as *AdminService) ReviewApplication(actor string, tid string, approve bool, notes string) (onboarding.Application, error) {
+	if approve {
+		return as.transitionApplication(actor, approveApplicationAction, tid, onboarding.Approved, notes)
+	}
+
+	return as.transitionApplication(actor, rejectApplicationAction, tid, onboarding.Rejected, notes)
+}
+
+func (as *AdminService) transitionApplication(actor string, action string, tid string, to string, notes string) (onboarding.Application, error) {
+	// The onboarding service fills in the status the application moved from
+	audit := &db.Audit{Actor: actor, Action: action, Target: tid, After: map[string]interface{}{"applicationStatus": to, "notes": notes}}
+
+	if _, err := as.obs.Transition(actor, tid, to, notes, audit); err != nil {
+		return onboarding.Application{}, err
+	}
+
+	return as.obs.Application(tid)
+}
+
+// Creates a notification for a user and pushes it, only logging failures
+func (as *AdminService) notify(uid string, title string, subtitle string) {
+	n, err := as.repo.CreateNotification(uid, title, subtitle, "")
+	if err != nil {
+		as.sendError(err, "Cannot create notification in database")
+		return
+	}
+
+	token, err := as.pushToken(uid)
+	if err != nil {
+		return
+	}
+
+	if err = as.ns.SendPushNotification(n, token); err != nil {
+		as.sendError(err, "Cannot send firebase push notification")
+	}
+}
+
+// Gets the push token of a student or tutor
+func (as *AdminService) pushToken(uid string) (string, error) {
+	if s, err := as.repo.GetStudentById(uid); err == nil {
+		return s.PushToken, nil
+	}
+
+	t, err := as.repo.GetTutorById(uid)
+	if err == pgx.ErrNoRows {
+		return "", ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve tutor from database")
+		return "", err
+	}
+
+	return t.PushToken, nil
+}
+
+// Gets whether a student or tutor is currently suspended
+func (as *AdminService) suspended(uid string) (bool, error) {
+	if s, err := as.repo.GetStudentById(uid); err == nil {
+		return s.Suspended, nil
+	}
+
+	t, err := as.repo.GetTutorById(uid)
+	if err == pgx.ErrNoRows {
+		return false, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve tutor from database")
+		return false, err
+	}
+
+	return t.Suspended, nil
+}
+
+func (as *AdminService) lesson(lid string) (db.Lesson, error) {
+	l, err := as.repo.GetLessonById(lid)
+	if err == pgx.ErrNoRows {
+		return l, ErrNotFound
+	} else if err != nil {
+		as.sendError(err, "Cannot retrieve lesson from database")
+		return l, err
+	}
+
+	return l, nil
+}
+
+// The parts of a lesson admins can change, as recorded in the audit log
+func lessonSnapshot(l db.Lesson) map[string]interface{} {
+	return map[string]interface{}{"status": l.Status, "tutor": l.Tutor}
+}
+
+// Making sending errors easier
+func (as *AdminService) sendError(err error, message string) {
+	as.logger.WithFields(log.Fields{
+		"service": "admin",
+		"err":     err.Error(),
+	}).Error(message)
+}
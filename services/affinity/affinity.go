@@ -0,0 +1,174 @@
+// Package affinity scores how well each student and tutor get along in a subject from the outcomes of their lessons, which matching then ranks tutors by
+package affinity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/scheduler"
+)
+
+// Job kinds handled by the affinity service
+const (
+	refreshAffinityJob   = "affinity.refresh"
+	recomputeAffinityJob = "affinity.recompute"
+)
+
+type refreshPayload struct {
+	Tutor   string `json:"tutor"`
+	Student string `json:"student"`
+	Subject string `json:"subject"`
+}
+
+type AffinityService struct {
+	logger   *log.Logger
+	repo     *db.Repository
+	sched    *scheduler.Scheduler
+	interval time.Duration
+}
+
+// Initialise the affinity service, every affinity is recomputed from scratch once per interval
+func (as *AffinityService) Init(logger *log.Logger, repo *db.Repository, sched *scheduler.Scheduler, interval time.Duration) {
+	as.logger = logger
+	as.repo = repo
+	as.sched = sched
+	as.interval = interval
+
+	as.sched.Register(refreshAffinityJob, as.handleRefresh)
+
+	if err := as.sched.RegisterRecurring(recomputeAffinityJob, as.handleRecompute, as.interval, as.interval); err != nil {
+		as.sendError(err, "Cannot schedule affinity recompute job")
+	}
+
+	as.logger.WithField("service", "affinity").Info("Successfully initialised")
+}
+
+// Queues the affinity of a tutor and student in a subject to be recomputed, should be called after anything happens to one of their lessons
+// Failures are only logged, the periodic recompute catches up on missed refreshes
+func (as *AffinityService) Refresh(tid string, sid string, subid string) {
+	if _, err := as.sched.ScheduleIn(refreshAffinityJob, refreshPayload{Tutor: tid, Student: sid, Subject: subid}, 0); err != nil {
+		as.sendError(err, "Cannot schedule affinity refresh job")
+	}
+}
+
+// Recomputes the affinity of a tutor and student in a subject straight away
+func (as *AffinityService) Update(tid string, sid string, subid string) (Explanation, error) {
+	e, err := as.score(tid, sid, subid)
+	if err != nil {
+		return e, err
+	}
+
+	if err = as.repo.SetAffinityScores([]db.Affinity{{Tutor: tid, Student: sid, Subject: subid, Score: e.Score}}, false); err != nil {
+		as.sendError(err, "Cannot update affinity in database")
+		return e, err
+	}
+
+	return e, nil
+}
+
+// Recomputes every affinity from the outcomes of all lessons, returning how many were scored
+// Affinities without any lessons left, for example after a lesson was reassigned, are reset to zero
+func (as *AffinityService) Recompute() (int, error) {
+	now := time.Now()
+
+	var affinities []db.Affinity
+	var current []db.LessonOutcome
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+
+		o := current[0]
+		e := Score(o.Tutor, o.Student, o.Subject, current, now)
+		affinities = append(affinities, db.Affinity{Tutor: o.Tutor, Student: o.Student, Subject: o.Subject, Score: e.Score})
+		current = current[:0]
+	}
+
+	// Outcomes arrive grouped by tutor, student and subject
+	err := as.repo.WalkLessonOutcomes(func(o db.LessonOutcome) error {
+		if len(current) > 0 && (current[0].Tutor != o.Tutor || current[0].Student != o.Student || current[0].Subject != o.Subject) {
+			flush()
+		}
+
+		current = append(current, o)
+		return nil
+	})
+	if err != nil {
+		as.sendError(err, "Cannot retrieve lesson outcomes from database")
+		return 0, err
+	}
+
+	flush()
+
+	if err = as.repo.SetAffinityScores(affinities, true); err != nil {
+		as.sendError(err, "Cannot update affinities in database")
+		return 0, err
+	}
+
+	return len(affinities), nil
+}
+
+// Explains how the affinity of a tutor and student in a subject is computed, along with the score currently stored
+// The two differ when a refresh is still waiting to run
+func (as *AffinityService) Explain(tid string, sid string, subid string) (Explanation, int, error) {
+	e, err := as.score(tid, sid, subid)
+	if err != nil {
+		return e, 0, err
+	}
+
+	a, err := as.repo.GetAffinity(tid, sid, subid)
+	if err != nil && err != pgx.ErrNoRows {
+		as.sendError(err, "Cannot retrieve affinity from database")
+		return e, 0, err
+	}
+
+	return e, a.Score, nil
+}
+
+func (as *AffinityService) score(tid string, sid string, subid string) (Explanation, error) {
+	outcomes, err := as.repo.GetLessonOutcomes(tid, sid, subid)
+	if err != nil {
+		as.sendError(err, "Cannot retrieve lesson outcomes from database")
+		return Explanation{}, err
+	}
+
+	return Score(tid, sid, subid, outcomes, time.Now()), nil
+}
+
+func (as *AffinityService) handleRefresh(payload []byte) error {
+	var p refreshPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	_, err := as.Update(p.Tutor, p.Student, p.Subject)
+	return err
+}
+
+// Recomputes every affinity, the scheduler schedules the next recompute once this one finished or failed for good
+func (as *AffinityService) handleRecompute(payload []byte) error {
+	n, err := as.Recompute()
+	if err != nil {
+		return err
+	}
+
+	as.logger.WithFields(log.Fields{
+		"service":    "affinity",
+		"affinities": n,
+	}).Info("Recomputed affinities")
+
+	return nil
+}
+
+// Making sending errors easier
+func (as *AffinityService) sendError(err error, message string) {
+	as.logger.WithFields(log.Fields{
+		"service": "affinity",
+		"err":     err.Error(),
+	}).Error(message)
+}
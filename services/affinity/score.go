@@ -0,0 +1,134 @@
+package affinity
+
+import (
+	"math"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+// The signals lesson outcomes contribute to an affinity score, mirrors the AffinitySignal enum of the GraphQL schema
+const (
+	Completed     = "COMPLETED"
+	Rebooked      = "REBOOKED"
+	Reviewed      = "REVIEWED"
+	Cancelled     = "CANCELLED"
+	LateCancelled = "LATE_CANCELLED"
+	NoShow        = "NO_SHOW"
+)
+
+// Points each signal is worth when it just happened, before decay
+const (
+	completedPoints     = 10
+	rebookedPoints      = 5
+	cancelledPoints     = -3
+	lateCancelledPoints = -8
+	noShowPoints        = -12
+)
+
+// Every star a review is above or below neutralRating is worth reviewPoints
+const (
+	neutralRating = 3
+	reviewPoints  = 5
+)
+
+// Signals lose half their weight every halfLife, so recent lessons say more about a student and tutor than old ones
+const halfLife = 90 * 24 * time.Hour
+
+// A single signal and how much it adds to an affinity score
+type Contribution struct {
+	Signal string
+	Lesson string
+	Time   time.Time
+	Points float64
+	Weight float64
+	Score  float64
+}
+
+// How an affinity score was computed, one contribution per signal, earliest first
+type Explanation struct {
+	Tutor         string
+	Student       string
+	Subject       string
+	Score         int
+	Contributions []Contribution
+}
+
+// Computes the affinity of a tutor and student in a subject from the outcomes of their lessons, as seen at the time now
+// Outcomes must be ordered earliest first, lessons booked after one was completed count as rebookings
+func Score(tid string, sid string, subid string, outcomes []db.LessonOutcome, now time.Time) Explanation {
+	e := Explanation{Tutor: tid, Student: sid, Subject: subid, Contributions: []Contribution{}}
+
+	add := func(signal string, o db.LessonOutcome, at time.Time, points float64) {
+		// Lessons booked in the future are as recent as it gets
+		weight := 1.0
+		if age := now.Sub(at); age > 0 {
+			weight = math.Pow(0.5, float64(age)/float64(halfLife))
+		}
+
+		e.Contributions = append(e.Contributions, Contribution{Signal: signal, Lesson: o.Lesson, Time: at, Points: points, Weight: weight, Score: points * weight})
+	}
+
+	var total float64
+	completed := false
+
+	for _, o := range outcomes {
+		if completed && o.Status != "CANCELLED" {
+			add(Rebooked, o, o.StartTime, rebookedPoints)
+		}
+
+		switch o.Status {
+		case "COMPLETED":
+			add(Completed, o, o.EndTime, completedPoints)
+			completed = true
+		case "NO_SHOW":
+			add(NoShow, o, o.EndTime, noShowPoints)
+		case "CANCELLED":
+			// Lessons cancelled by an admin say nothing about the student and tutor
+			if o.Cancelled != nil && o.Late {
+				add(LateCancelled, o, *o.Cancelled, lateCancelledPoints)
+			} else if o.Cancelled != nil {
+				add(Cancelled, o, *o.Cancelled, cancelledPoints)
+			}
+		}
+
+		if o.Rating != nil && o.Reviewed != nil {
+			add(Reviewed, o, *o.Reviewed, float64((*o.Rating-neutralRating)*reviewPoints))
+		}
+	}
+
+	for _, c := range e.Contributions {
+		total += c.Score
+	}
+	e.Score = int(math.Round(total))
+
+	return e
+}
+
+// Rewinds lesson outcomes to what was known at the time at, for scoring affinity as it was then
+// Lessons which had not started by then are left out, as are cancellations and reviews which came later, and lessons still running then were not yet completed or missed
+func AsOf(outcomes []db.LessonOutcome, at time.Time) []db.LessonOutcome {
+	past := []db.LessonOutcome{}
+
+	for _, o := range outcomes {
+		if !o.StartTime.Before(at) {
+			continue
+		}
+
+		if o.Cancelled != nil && !o.Cancelled.Before(at) {
+			o.Status, o.Cancelled, o.Late = "SCHEDULED", nil, false
+		}
+
+		if (o.Status == "COMPLETED" || o.Status == "NO_SHOW") && o.EndTime.After(at) {
+			o.Status = "SCHEDULED"
+		}
+
+		if o.Reviewed != nil && !o.Reviewed.Before(at) {
+			o.Rating, o.Reviewed = nil, nil
+		}
+
+		past = append(past, o)
+	}
+
+	return past
+}
@@ -0,0 +1,211 @@
+package affinity
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+var scoreEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// A lesson starting the given number of days after scoreEpoch and lasting an hour
+func outcome(id string, days int, status string) db.LessonOutcome {
+	start := scoreEpoch.AddDate(0, 0, days)
+	return db.LessonOutcome{Lesson: id, Status: status, StartTime: start, EndTime: start.Add(time.Hour)}
+}
+
+func at(days int, hours time.Duration) *time.Time {
+	t := scoreEpoch.AddDate(0, 0, days).Add(hours)
+	return &t
+}
+
+func TestAsOf(t *testing.T) {
+	rating := 5
+
+	reviewed := outcome("reviewed", 0, "COMPLETED")
+	reviewed.Rating, reviewed.Reviewed = &rating, at(3, 0)
+
+	cancelled := outcome("cancelled", 4, "CANCELLED")
+	cancelled.Cancelled, cancelled.Late = at(2, 0), true
+
+	outcomes := []db.LessonOutcome{
+		reviewed,
+		cancelled,
+		outcome("running", 1, "COMPLETED"),
+		outcome("upcoming", 5, "SCHEDULED"),
+	}
+
+	rewound := func(o db.LessonOutcome, change func(o *db.LessonOutcome)) db.LessonOutcome {
+		change(&o)
+		return o
+	}
+
+	cases := []struct {
+		name string
+		at   *time.Time
+		want []db.LessonOutcome
+	}{
+		{
+			name: "BeforeAnyLesson",
+			at:   at(0, 0),
+			want: []db.LessonOutcome{},
+		},
+		{
+			// The second lesson is still running, and the first was not reviewed yet
+			name: "DuringALesson",
+			at:   at(1, 30*time.Minute),
+			want: []db.LessonOutcome{
+				rewound(reviewed, func(o *db.LessonOutcome) { o.Rating, o.Reviewed = nil, nil }),
+				rewound(outcome("running", 1, "COMPLETED"), func(o *db.LessonOutcome) { o.Status = "SCHEDULED" }),
+			},
+		},
+		{
+			// The cancelled lesson had not started yet, so it is not known at all
+			name: "AfterTheReview",
+			at:   at(3, time.Hour),
+			want: []db.LessonOutcome{reviewed, outcome("running", 1, "COMPLETED")},
+		},
+		{
+			name: "AfterEverything",
+			at:   at(6, 0),
+			want: outcomes,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := AsOf(outcomes, *c.at); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	now := *at(0, time.Hour)
+	rating := func(stars int) *int { return &stars }
+
+	with := func(o db.LessonOutcome, change func(o *db.LessonOutcome)) db.LessonOutcome {
+		change(&o)
+		return o
+	}
+
+	cases := []struct {
+		name     string
+		outcomes []db.LessonOutcome
+		now      time.Time
+		signals  []string
+		score    int
+	}{
+		{
+			name:    "NoLessons",
+			now:     now,
+			signals: []string{},
+			score:   0,
+		},
+		{
+			name:     "Completed",
+			outcomes: []db.LessonOutcome{outcome("a", 0, "COMPLETED")},
+			now:      now,
+			signals:  []string{Completed},
+			score:    completedPoints,
+		},
+		{
+			// Half the weight after a half life
+			name:     "CompletedLongAgo",
+			outcomes: []db.LessonOutcome{outcome("a", 0, "COMPLETED")},
+			now:      now.Add(halfLife),
+			signals:  []string{Completed},
+			score:    completedPoints / 2,
+		},
+		{
+			// Booking again after a completed lesson counts in full even though the lesson is in the future
+			name:     "Rebooked",
+			outcomes: []db.LessonOutcome{outcome("a", 0, "COMPLETED"), outcome("b", 7, "SCHEDULED")},
+			now:      now,
+			signals:  []string{Completed, Rebooked},
+			score:    completedPoints + rebookedPoints,
+		},
+		{
+			name:     "BookedBeforeCompleting",
+			outcomes: []db.LessonOutcome{outcome("a", -7, "SCHEDULED"), outcome("b", 0, "COMPLETED")},
+			now:      now,
+			signals:  []string{Completed},
+			score:    completedPoints,
+		},
+		{
+			name: "CancelledRebookingIsNotARebooking",
+			outcomes: []db.LessonOutcome{
+				outcome("a", 0, "COMPLETED"),
+				with(outcome("b", 7, "CANCELLED"), func(o *db.LessonOutcome) { o.Cancelled = &now }),
+			},
+			now:     now,
+			signals: []string{Completed, Cancelled},
+			score:   completedPoints + cancelledPoints,
+		},
+		{
+			name:     "LateCancelled",
+			outcomes: []db.LessonOutcome{with(outcome("a", 0, "CANCELLED"), func(o *db.LessonOutcome) { o.Cancelled, o.Late = &now, true })},
+			now:      now,
+			signals:  []string{LateCancelled},
+			score:    lateCancelledPoints,
+		},
+		{
+			// Admins cancel without recording a cancellation by either party
+			name:     "CancelledBySupport",
+			outcomes: []db.LessonOutcome{outcome("a", 0, "CANCELLED")},
+			now:      now,
+			signals:  []string{},
+			score:    0,
+		},
+		{
+			name:     "NoShow",
+			outcomes: []db.LessonOutcome{outcome("a", 0, "NO_SHOW")},
+			now:      now,
+			signals:  []string{NoShow},
+			score:    noShowPoints,
+		},
+		{
+			name:     "GoodReview",
+			outcomes: []db.LessonOutcome{with(outcome("a", 0, "COMPLETED"), func(o *db.LessonOutcome) { o.Rating, o.Reviewed = rating(5), &now })},
+			now:      now,
+			signals:  []string{Completed, Reviewed},
+			score:    completedPoints + 2*reviewPoints,
+		},
+		{
+			name:     "BadReview",
+			outcomes: []db.LessonOutcome{with(outcome("a", 0, "COMPLETED"), func(o *db.LessonOutcome) { o.Rating, o.Reviewed = rating(1), &now })},
+			now:      now,
+			signals:  []string{Completed, Reviewed},
+			score:    completedPoints - 2*reviewPoints,
+		},
+		{
+			name:     "NeutralReview",
+			outcomes: []db.LessonOutcome{with(outcome("a", 0, "COMPLETED"), func(o *db.LessonOutcome) { o.Rating, o.Reviewed = rating(3), &now })},
+			now:      now,
+			signals:  []string{Completed, Reviewed},
+			score:    completedPoints,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := Score("t:1", "s:1", "subject", c.outcomes, c.now)
+
+			signals := []string{}
+			for _, contribution := range e.Contributions {
+				signals = append(signals, contribution.Signal)
+			}
+
+			if e.Score != c.score || !reflect.DeepEqual(signals, c.signals) {
+				t.Errorf("Got %d from %v, want %d from %v", e.Score, signals, c.score, c.signals)
+			}
+
+			if e.Tutor != "t:1" || e.Student != "s:1" || e.Subject != "subject" {
+				t.Errorf("Explanation is for %s, %s and %s", e.Tutor, e.Student, e.Subject)
+			}
+		})
+	}
+}
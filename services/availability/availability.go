@@ -0,0 +1,379 @@
+// Package availability manages when tutors can teach, as weekly rules in their own timezone with one-off exceptions such as holidays
+package availability
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+// Minutes in a day, the latest a weekly rule may end at
+const minutesPerDay = 24 * 60
+
+// The longest range availability can be expanded for at once
+const maxRange = 92 * 24 * time.Hour
+
+var (
+	ErrNotFound         = errors.New("No such availability")
+	ErrInvalidTimezone  = errors.New("Unknown timezone, use an IANA name such as Asia/Singapore")
+	ErrInvalidClock     = errors.New("Times of day must be formatted as HH:MM")
+	ErrInvalidRule      = errors.New("Weekly availability must end after it starts, on the same day")
+	ErrOverlappingRules = errors.New("Weekly availability rules overlap")
+	ErrInvalidRange     = errors.New("Time ranges must end after they start, and span at most 92 days")
+	ErrLessonConflict   = errors.New("Availability overlaps a booked lesson")
+)
+
+// A weekly availability rule as set by a tutor, times are minutes since midnight in the tutor's timezone and weekday 0 is Sunday
+type Rule struct {
+	Weekday     int
+	StartMinute int
+	EndMinute   int
+}
+
+// The availability of a tutor within a range, their rules and one-off windows expanded into concrete windows with the exceptions cut out
+type Schedule struct {
+	Timezone   string
+	Rules      []db.AvailabilityRule
+	Periods    []db.Availability
+	Exceptions []db.AvailabilityException
+	Windows    []db.AvailabilityWindow
+}
+
+type AvailabilityService struct {
+	logger *log.Logger
+	repo   *db.Repository
+}
+
+// Initialise the availability service
+func (avs *AvailabilityService) Init(logger *log.Logger, repo *db.Repository) {
+	avs.logger = logger
+	avs.repo = repo
+
+	avs.logger.WithField("service", "availability").Info("Successfully initialised")
+}
+
+// Replaces the weekly availability of a tutor
+func (avs *AvailabilityService) SetWeekly(tid string, timezone string, rules []Rule) ([]db.AvailabilityRule, error) {
+	if timezone == "" || timezone == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return nil, ErrInvalidTimezone
+	}
+
+	if err := validRules(rules); err != nil {
+		return nil, err
+	}
+
+	dbRules := make([]db.AvailabilityRule, len(rules))
+	for i, rule := range rules {
+		dbRules[i] = db.AvailabilityRule{Weekday: rule.Weekday, StartMinute: rule.StartMinute, EndMinute: rule.EndMinute}
+	}
+
+	created, err := avs.repo.SetWeeklyAvailability(tid, timezone, dbRules)
+	if err != nil {
+		avs.sendError(err, "Cannot set weekly availability in database")
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Marks a tutor unavailable for a period, regardless of their weekly rules
+func (avs *AvailabilityService) AddException(tid string, startTime time.Time, endTime time.Time, reason string) (db.AvailabilityException, error) {
+	if !endTime.After(startTime) {
+		return db.AvailabilityException{}, ErrInvalidRange
+	}
+
+	e, err := avs.repo.CreateAvailabilityException(tid, startTime, endTime, reason)
+	if err != nil {
+		avs.sendError(err, "Cannot create availability exception in database")
+		return e, err
+	}
+
+	return e, nil
+}
+
+// Removes an availability exception
+func (avs *AvailabilityService) RemoveException(eid string) error {
+	if _, err := avs.repo.GetAvailabilityExceptionById(eid); err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		avs.sendError(err, "Cannot retrieve availability exception from database")
+		return err
+	}
+
+	if err := avs.repo.DeleteAvailabilityException(eid); err != nil {
+		avs.sendError(err, "Cannot delete availability exception from database")
+		return err
+	}
+
+	return nil
+}
+
+// Adds a one-off availability window, merging it with the windows it overlaps or touches
+func (avs *AvailabilityService) CreateWindow(tid string, startTime time.Time, endTime time.Time) (db.Availability, error) {
+	if err := avs.checkWindow(tid, startTime, endTime); err != nil {
+		return db.Availability{}, err
+	}
+
+	a, err := avs.repo.CreateAvailability(tid, startTime, endTime)
+	if err != nil {
+		avs.sendError(err, "Cannot create availability in database")
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Moves a one-off availability window, merging it with the windows it then overlaps or touches
+func (avs *AvailabilityService) UpdateWindow(aid string, startTime time.Time, endTime time.Time) (db.Availability, error) {
+	a, err := avs.repo.GetAvailabilityById(aid)
+	if err == pgx.ErrNoRows {
+		return a, ErrNotFound
+	} else if err != nil {
+		avs.sendError(err, "Cannot retrieve availability from database")
+		return a, err
+	}
+
+	if err = avs.checkWindow(a.Tutor, startTime, endTime); err != nil {
+		return a, err
+	}
+
+	a.StartTime = startTime
+	a.EndTime = endTime
+
+	if a, err = avs.repo.UpdateAvailability(a); err != nil {
+		avs.sendError(err, "Cannot update availability in database")
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Removes a one-off availability window, lessons already booked in it are kept
+func (avs *AvailabilityService) DeleteWindow(aid string) error {
+	if _, err := avs.repo.GetAvailabilityById(aid); err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		avs.sendError(err, "Cannot retrieve availability from database")
+		return err
+	}
+
+	if err := avs.repo.DeleteAvailability(aid); err != nil {
+		avs.sendError(err, "Cannot delete availability from database")
+		return err
+	}
+
+	return nil
+}
+
+// Gets the availability of a tutor within a range
+func (avs *AvailabilityService) Schedule(tid string, startTime time.Time, endTime time.Time) (Schedule, error) {
+	var s Schedule
+
+	if !endTime.After(startTime) || endTime.Sub(startTime) > maxRange {
+		return s, ErrInvalidRange
+	}
+
+	var err error
+	if s.Timezone, err = avs.repo.GetTutorTimezone(tid); err != nil {
+		avs.sendError(err, "Cannot retrieve tutor timezone from database")
+		return s, err
+	}
+
+	if s.Rules, err = avs.repo.GetAvailabilityRules(tid); err != nil {
+		avs.sendError(err, "Cannot retrieve availability rules from database")
+		return s, err
+	}
+
+	if s.Periods, err = avs.repo.GetAvailabilities(tid, startTime, endTime); err != nil {
+		avs.sendError(err, "Cannot retrieve availabilities from database")
+		return s, err
+	}
+
+	if s.Exceptions, err = avs.repo.GetAvailabilityExceptions(tid, startTime, endTime); err != nil {
+		avs.sendError(err, "Cannot retrieve availability exceptions from database")
+		return s, err
+	}
+
+	windows, err := avs.repo.GetTutorWindows(tid, startTime, endTime)
+	if err != nil {
+		avs.sendError(err, "Cannot expand availability windows in database")
+		return s, err
+	}
+
+	var exceptions []db.AvailabilityWindow
+	for _, e := range s.Exceptions {
+		exceptions = append(exceptions, db.AvailabilityWindow{StartTime: e.StartTime, EndTime: e.EndTime})
+	}
+
+	s.Windows = merge(subtract(clip(windows, startTime, endTime), exceptions))
+
+	return s, nil
+}
+
+// Gets the slots within a range in which a tutor is available and not yet booked, as shown to students
+func (avs *AvailabilityService) FreeSlots(tid string, startTime time.Time, endTime time.Time) ([]db.AvailabilityWindow, error) {
+	s, err := avs.Schedule(tid, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	booked, err := avs.repo.GetTutorBookedPeriods(tid, startTime, endTime)
+	if err != nil {
+		avs.sendError(err, "Cannot retrieve booked lessons from database")
+		return nil, err
+	}
+
+	return subtract(s.Windows, booked), nil
+}
+
+// Parses a time of day formatted as HH:MM into minutes since midnight, 24:00 being the end of the day
+func ParseClock(clock string) (int, error) {
+	if clock == "24:00" {
+		return minutesPerDay, nil
+	}
+
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, ErrInvalidClock
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Formats minutes since midnight as HH:MM
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func validRules(rules []Rule) error {
+	sorted := make([]Rule, len(rules))
+	copy(sorted, rules)
+
+	for _, rule := range sorted {
+		if rule.Weekday < 0 || rule.Weekday > 6 || rule.StartMinute < 0 || rule.EndMinute > minutesPerDay || rule.EndMinute <= rule.StartMinute {
+			return ErrInvalidRule
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Weekday != sorted[j].Weekday {
+			return sorted[i].Weekday < sorted[j].Weekday
+		}
+		return sorted[i].StartMinute < sorted[j].StartMinute
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Weekday == sorted[i-1].Weekday && sorted[i].StartMinute < sorted[i-1].EndMinute {
+			return ErrOverlappingRules
+		}
+	}
+
+	return nil
+}
+
+// Cuts windows down to a range
+func clip(windows []db.AvailabilityWindow, startTime time.Time, endTime time.Time) []db.AvailabilityWindow {
+	var clipped []db.AvailabilityWindow
+
+	for _, w := range windows {
+		if w.StartTime.Before(startTime) {
+			w.StartTime = startTime
+		}
+		if w.EndTime.After(endTime) {
+			w.EndTime = endTime
+		}
+
+		if w.EndTime.After(w.StartTime) {
+			clipped = append(clipped, w)
+		}
+	}
+
+	return clipped
+}
+
+// Windows must end after they start, and may not overlap lessons the tutor already has
+func (avs *AvailabilityService) checkWindow(tid string, startTime time.Time, endTime time.Time) error {
+	if !endTime.After(startTime) || endTime.Sub(startTime) > maxRange {
+		return ErrInvalidRange
+	}
+
+	free, err := avs.repo.CheckTutorAvailability(tid, startTime, endTime)
+	if err != nil {
+		avs.sendError(err, "Cannot check tutor availability in database")
+		return err
+	}
+
+	if !free {
+		return ErrLessonConflict
+	}
+
+	return nil
+}
+
+// Joins windows which overlap or touch, such as a weekly rule running into a one-off window
+func merge(windows []db.AvailabilityWindow) []db.AvailabilityWindow {
+	sorted := make([]db.AvailabilityWindow, len(windows))
+	copy(sorted, windows)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	var merged []db.AvailabilityWindow
+	for _, w := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && !w.StartTime.After(merged[last].EndTime) {
+			if w.EndTime.After(merged[last].EndTime) {
+				merged[last].EndTime = w.EndTime
+			}
+			continue
+		}
+
+		merged = append(merged, w)
+	}
+
+	return merged
+}
+
+// Cuts periods, such as exceptions or booked lessons, out of windows, splitting windows a period falls in the middle of
+func subtract(windows []db.AvailabilityWindow, cuts []db.AvailabilityWindow) []db.AvailabilityWindow {
+	for _, e := range cuts {
+		var remaining []db.AvailabilityWindow
+
+		for _, w := range windows {
+			if !e.StartTime.Before(w.EndTime) || !e.EndTime.After(w.StartTime) {
+				remaining = append(remaining, w)
+				continue
+			}
+
+			if e.StartTime.After(w.StartTime) {
+				remaining = append(remaining, db.AvailabilityWindow{StartTime: w.StartTime, EndTime: e.StartTime})
+			}
+			if e.EndTime.Before(w.EndTime) {
+				remaining = append(remaining, db.AvailabilityWindow{StartTime: e.EndTime, EndTime: w.EndTime})
+			}
+		}
+
+		windows = remaining
+	}
+
+	return windows
+}
+
+// Making sending errors easier
+func (avs *AvailabilityService) sendError(err error, message string) {
+	avs.logger.WithFields(log.Fields{
+		"service": "availability",
+		"err":     err.Error(),
+	}).Error(message)
+}
@@ -0,0 +1,250 @@
+package availability
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+var day = time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC)
+
+// A window between two hours of the test day
+func w(from int, to int) db.AvailabilityWindow {
+	return db.AvailabilityWindow{StartTime: day.Add(time.Duration(from) * time.Hour), EndTime: day.Add(time.Duration(to) * time.Hour)}
+}
+
+func ws(windows ...db.AvailabilityWindow) []db.AvailabilityWindow {
+	return windows
+}
+
+func TestClock(t *testing.T) {
+	tests := []struct {
+		clock   string
+		minutes int
+		err     error
+	}{
+		{"00:00", 0, nil},
+		{"09:30", 570, nil},
+		{"23:59", 1439, nil},
+		{"24:00", minutesPerDay, nil},
+		{"24:01", 0, ErrInvalidClock},
+		{"09:60", 0, ErrInvalidClock},
+		{"noon", 0, ErrInvalidClock},
+	}
+
+	for _, tt := range tests {
+		minutes, err := ParseClock(tt.clock)
+		if minutes != tt.minutes || err != tt.err {
+			t.Errorf("%q: got %d with error %v, want %d with error %v", tt.clock, minutes, err, tt.minutes, tt.err)
+		}
+
+		if err == nil && FormatClock(minutes) != tt.clock {
+			t.Errorf("%q: formatted back as %q", tt.clock, FormatClock(minutes))
+		}
+	}
+}
+
+func TestValidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		err   error
+	}{
+		{"no rules", nil, nil},
+		{"whole day", []Rule{{Weekday: 0, StartMinute: 0, EndMinute: minutesPerDay}}, nil},
+		{"touching", []Rule{{1, 600, 720}, {1, 540, 600}}, nil},
+		{"same time on other days", []Rule{{1, 540, 600}, {2, 540, 600}}, nil},
+		{"overlapping out of order", []Rule{{3, 600, 720}, {1, 0, 60}, {3, 540, 601}}, ErrOverlappingRules},
+		{"contained", []Rule{{3, 540, 720}, {3, 600, 660}}, ErrOverlappingRules},
+		{"ends before it starts", []Rule{{1, 600, 540}}, ErrInvalidRule},
+		{"empty", []Rule{{1, 600, 600}}, ErrInvalidRule},
+		{"past midnight", []Rule{{1, 1380, minutesPerDay + 60}}, ErrInvalidRule},
+		{"negative start", []Rule{{1, -60, 60}}, ErrInvalidRule},
+		{"unknown weekday", []Rule{{7, 540, 600}}, ErrInvalidRule},
+	}
+
+	for _, tt := range tests {
+		if err := validRules(tt.rules); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestClip(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows []db.AvailabilityWindow
+		from    int
+		to      int
+		want    []db.AvailabilityWindow
+	}{
+		{"inside", ws(w(9, 10)), 8, 12, ws(w(9, 10))},
+		{"over both ends", ws(w(6, 14)), 8, 12, ws(w(8, 12))},
+		{"over the start", ws(w(6, 9), w(10, 11)), 8, 12, ws(w(8, 9), w(10, 11))},
+		{"outside", ws(w(5, 8), w(12, 14)), 8, 12, nil},
+	}
+
+	for _, tt := range tests {
+		if got := clip(tt.windows, w(tt.from, tt.to).StartTime, w(tt.from, tt.to).EndTime); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows []db.AvailabilityWindow
+		cuts    []db.AvailabilityWindow
+		want    []db.AvailabilityWindow
+	}{
+		{"no cuts", ws(w(9, 12)), nil, ws(w(9, 12))},
+		{"middle", ws(w(9, 12)), ws(w(10, 11)), ws(w(9, 10), w(11, 12))},
+		{"start", ws(w(9, 12)), ws(w(8, 10)), ws(w(10, 12))},
+		{"end", ws(w(9, 12)), ws(w(11, 13)), ws(w(9, 11))},
+		{"whole", ws(w(9, 12)), ws(w(9, 12)), nil},
+		{"touching", ws(w(9, 12)), ws(w(12, 13), w(8, 9)), ws(w(9, 12))},
+		{"across windows", ws(w(9, 11), w(12, 14)), ws(w(10, 13)), ws(w(9, 10), w(13, 14))},
+		{"several in one window", ws(w(8, 16)), ws(w(9, 10), w(12, 13)), ws(w(8, 9), w(10, 12), w(13, 16))},
+	}
+
+	for _, tt := range tests {
+		if got := subtract(tt.windows, tt.cuts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows []db.AvailabilityWindow
+		want    []db.AvailabilityWindow
+	}{
+		{"none", nil, nil},
+		{"apart", ws(w(12, 13), w(9, 10)), ws(w(9, 10), w(12, 13))},
+		{"touching", ws(w(10, 11), w(9, 10)), ws(w(9, 11))},
+		{"overlapping", ws(w(9, 11), w(10, 12)), ws(w(9, 12))},
+		{"contained", ws(w(9, 14), w(10, 11), w(12, 13)), ws(w(9, 14))},
+		{"chain", ws(w(13, 15), w(9, 11), w(11, 13), w(16, 17)), ws(w(9, 15), w(16, 17))},
+	}
+
+	for _, tt := range tests {
+		if got := merge(tt.windows); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func newTestService(t *testing.T) (*AvailabilityService, *db.Repository) {
+	repo := dbtest.Repository(t)
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	var avs AvailabilityService
+	avs.Init(logger, repo)
+
+	return &avs, repo
+}
+
+// Weekly rules keep to the wall clock of the tutor across daylight saving changes, and exceptions are cut out of them
+func TestScheduleFollowsTimezone(t *testing.T) {
+	avs, repo := newTestService(t)
+	tutor := dbtest.Tutor(t, repo)
+
+	// Mondays from 09:00 to 10:00, New York moves to daylight saving time on 10 March 2030
+	if _, err := avs.SetWeekly(tutor.Id, "America/New_York", []Rule{{Weekday: 1, StartMinute: 540, EndMinute: 600}}); err != nil {
+		t.Fatalf("Cannot set weekly availability: %v", err)
+	}
+
+	holiday := time.Date(2030, 3, 18, 0, 0, 0, 0, time.UTC)
+	if _, err := avs.AddException(tutor.Id, holiday, holiday.Add(24*time.Hour), "Holiday"); err != nil {
+		t.Fatalf("Cannot add exception: %v", err)
+	}
+
+	s, err := avs.Schedule(tutor.Id, time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 3, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Cannot get schedule: %v", err)
+	}
+
+	want := []db.AvailabilityWindow{
+		{StartTime: time.Date(2030, 3, 4, 14, 0, 0, 0, time.UTC), EndTime: time.Date(2030, 3, 4, 15, 0, 0, 0, time.UTC)},
+		{StartTime: time.Date(2030, 3, 11, 13, 0, 0, 0, time.UTC), EndTime: time.Date(2030, 3, 11, 14, 0, 0, 0, time.UTC)},
+	}
+
+	if len(s.Windows) != len(want) {
+		t.Fatalf("Got windows %v, want %v", s.Windows, want)
+	}
+
+	for i := range want {
+		if !s.Windows[i].StartTime.Equal(want[i].StartTime) || !s.Windows[i].EndTime.Equal(want[i].EndTime) {
+			t.Errorf("Window %d is %v, want %v", i, s.Windows[i], want[i])
+		}
+	}
+
+	if _, err = avs.SetWeekly(tutor.Id, "Mars/Olympus_Mons", nil); err != ErrInvalidTimezone {
+		t.Errorf("Unknown timezone got %v, want %v", err, ErrInvalidTimezone)
+	}
+}
+
+// One-off windows join up, may not be put over booked lessons, and booked lessons are cut out of the free slots
+func TestWindowsAndFreeSlots(t *testing.T) {
+	avs, repo := newTestService(t)
+	tutor := dbtest.Tutor(t, repo)
+
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2031, 1, 6, hour, minute, 0, 0, time.UTC)
+	}
+
+	if _, err := avs.CreateWindow(tutor.Id, at(12, 0), at(14, 0)); err != nil {
+		t.Fatalf("Cannot create window: %v", err)
+	}
+
+	if _, err := avs.CreateWindow(tutor.Id, at(13, 0), at(16, 0)); err != nil {
+		t.Fatalf("Cannot create window: %v", err)
+	}
+
+	if _, err := repo.CreateLesson(dbtest.Subject(t, repo), tutor.Id, dbtest.Student(t, repo).Id, true, at(13, 0), at(14, 0)); err != nil {
+		t.Fatalf("Cannot create lesson: %v", err)
+	}
+
+	if _, err := avs.CreateWindow(tutor.Id, at(13, 30), at(17, 0)); err != ErrLessonConflict {
+		t.Errorf("Window over a lesson got %v, want %v", err, ErrLessonConflict)
+	}
+
+	if _, err := avs.CreateWindow(tutor.Id, at(17, 0), at(16, 0)); err != ErrInvalidRange {
+		t.Errorf("Backwards window got %v, want %v", err, ErrInvalidRange)
+	}
+
+	s, err := avs.Schedule(tutor.Id, at(0, 0), at(23, 0))
+	if err != nil {
+		t.Fatalf("Cannot get schedule: %v", err)
+	}
+
+	if len(s.Windows) != 1 || !s.Windows[0].StartTime.Equal(at(12, 0)) || !s.Windows[0].EndTime.Equal(at(16, 0)) {
+		t.Errorf("Got windows %v, want one from 12:00 to 16:00", s.Windows)
+	}
+
+	free, err := avs.FreeSlots(tutor.Id, at(0, 0), at(23, 0))
+	if err != nil {
+		t.Fatalf("Cannot get free slots: %v", err)
+	}
+
+	want := []db.AvailabilityWindow{{StartTime: at(12, 0), EndTime: at(13, 0)}, {StartTime: at(14, 0), EndTime: at(16, 0)}}
+	if len(free) != len(want) {
+		t.Fatalf("Got free slots %v, want %v", free, want)
+	}
+
+	for i := range want {
+		if !free[i].StartTime.Equal(want[i].StartTime) || !free[i].EndTime.Equal(want[i].EndTime) {
+			t.Errorf("Free slot %d is %v, want %v", i, free[i], want[i])
+		}
+	}
+}
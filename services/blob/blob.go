@@ -0,0 +1,154 @@
+// Package blob stores uploaded files through a pluggable Store
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound   = errors.New("No such blob")
+	ErrInvalidKey = errors.New("Invalid blob key")
+)
+
+// Store keeps the content of files under slash separated keys
+type Store interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// FileStore keeps every blob as a file under a directory of the local filesystem
+type FileStore struct {
+	dir string
+}
+
+// Creates a new file store writing to dir, the directory is created if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Writes a blob to a temporary file first, so a failed upload never leaves a partial blob behind
+func (fs *FileStore) Put(key string, r io.Reader) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (fs *FileStore) Open(key string) (io.ReadCloser, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+func (fs *FileStore) Delete(key string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Resolves a key to a path inside the directory of the store, rejecting keys which would escape it
+func (fs *FileStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+
+	return filepath.Join(fs.dir, filepath.FromSlash(key)), nil
+}
+
+// MemoryStore keeps every blob in memory, for tests
+type MemoryStore struct {
+	blobs map[string][]byte
+	mux   sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: map[string][]byte{}}
+}
+
+func (ms *MemoryStore) Put(key string, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	ms.mux.Lock()
+	ms.blobs[key] = b
+	ms.mux.Unlock()
+
+	return nil
+}
+
+func (ms *MemoryStore) Open(key string) (io.ReadCloser, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	b, ok := ms.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (ms *MemoryStore) Delete(key string) error {
+	ms.mux.Lock()
+	delete(ms.blobs, key)
+	ms.mux.Unlock()
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package blob
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileStorePath(t *testing.T) {
+	fs := &FileStore{dir: "/var/blobs"}
+
+	tests := []struct {
+		key  string
+		want string
+		err  error
+	}{
+		{"lessons/1/2", "/var/blobs/lessons/1/2", nil},
+		{"file", "/var/blobs/file", nil},
+		{"", "", ErrInvalidKey},
+		{"/etc/passwd", "", ErrInvalidKey},
+		{"../etc/passwd", "", ErrInvalidKey},
+		{"lessons/../../etc/passwd", "", ErrInvalidKey},
+		{"lessons/./1", "", ErrInvalidKey},
+		{"lessons//1", "", ErrInvalidKey},
+		{"lessons/1/", "", ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		got, err := fs.path(tt.key)
+		if got != tt.want || err != tt.err {
+			t.Errorf("%q: got %q with error %v, want %q with error %v", tt.key, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// Both stores keep, return and forget blobs the same way
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]Store{"file": fs, "memory": NewMemoryStore()}
+
+	for name, store := range stores {
+		if err := store.Put("lessons/1/2", strings.NewReader("first")); err != nil {
+			t.Fatalf("%s: cannot put blob: %v", name, err)
+		}
+
+		// Putting again replaces the blob
+		if err := store.Put("lessons/1/2", strings.NewReader("second")); err != nil {
+			t.Fatalf("%s: cannot put blob: %v", name, err)
+		}
+
+		r, err := store.Open("lessons/1/2")
+		if err != nil {
+			t.Fatalf("%s: cannot open blob: %v", name, err)
+		}
+
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(content) != "second" {
+			t.Errorf("%s: read %q with error %v, want second", name, content, err)
+		}
+
+		if err = store.Delete("lessons/1/2"); err != nil {
+			t.Errorf("%s: cannot delete blob: %v", name, err)
+		}
+
+		if err = store.Delete("lessons/1/2"); err != nil {
+			t.Errorf("%s: deleting a missing blob failed: %v", name, err)
+		}
+
+		if _, err = store.Open("lessons/1/2"); err != ErrNotFound {
+			t.Errorf("%s: opening a deleted blob got %v, want %v", name, err, ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package chat
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	// Decoders for the images thumbnails are made of
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/policy"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+// Where the content of chat attachments is served from, followed by the id of the attachment. Thumbnails of images are served from the same path followed by /thumbnail
+const AttachmentPath = "/chat/attachments/"
+
+// Limits on the content of messages
+// Decoded images take 4 bytes a pixel, so maxImagePixels keeps a single upload under 50MB of memory
+const (
+	maxAttachmentSize = 20 << 20
+	maxImageSize      = 10 << 20
+	maxImagePixels    = 12000000
+	maxMathLength     = 2000
+)
+
+// Thumbnails fit in a thumbnailSize pixels square, each of their pixels averages up to thumbnailSamples by thumbnailSamples pixels of the image
+const (
+	thumbnailSize    = 320
+	thumbnailSamples = 4
+	thumbnailQuality = 80
+)
+
+var (
+	ErrFileRequired       = errors.New("Attach a file to send it")
+	ErrAttachmentTooLarge = errors.New("Files must be smaller than 20MB and images smaller than 10MB")
+	ErrUnsupportedType    = errors.New("Only images, PDFs, text files and office documents can be sent")
+	ErrInvalidImage       = errors.New("Images must be JPEG, PNG or GIF pictures of at most 12 megapixels")
+	ErrInvalidMath        = errors.New("Math must be LaTeX of at most 2000 characters with balanced braces")
+	ErrLessonRequired     = errors.New("Pick a lesson to share")
+	ErrLessonNotShared    = errors.New("Only lessons between the two users can be shared")
+	ErrUnexpectedContent  = errors.New("Only file and image messages carry a file, and only lesson messages a lesson")
+	ErrAttachmentNotFound = errors.New("No such attachment")
+	ErrUnsupportedKind    = errors.New("Only text messages can be sent while chat is kept in InfluxDB")
+	errNotImage           = errors.New("Not an image")
+)
+
+// Content types of the images which can be sent, those the standard library decodes
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Content types of the other files which can be sent
+// Office documents are zip archives once sniffed, they are told apart by the content type declared on upload
+var (
+	fileTypes = map[string]bool{
+		"application/pdf": true,
+		"text/plain":      true,
+	}
+	officeTypes = map[string]bool{
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	}
+)
+
+// An uploaded file checked to be sent in a message, along with the thumbnail of images
+type upload struct {
+	attachment db.MessageAttachment
+	content    []byte
+	thumbnail  []byte
+}
+
+// Checks that a message carries what its kind calls for, returning its text
+func validateContent(kind model.MessageKind, message model.SendMessage) (string, error) {
+	var text string
+	if message.Message != nil {
+		text = *message.Message
+	}
+
+	if message.File != nil && kind != model.MessageKindImage && kind != model.MessageKindFile {
+		return text, ErrUnexpectedContent
+	}
+
+	if message.Lesson != nil && kind != model.MessageKindLesson {
+		return text, ErrUnexpectedContent
+	}
+
+	switch kind {
+	case model.MessageKindImage, model.MessageKindFile:
+		if message.File == nil {
+			return text, ErrFileRequired
+		}
+	case model.MessageKindLesson:
+		if message.Lesson == nil || *message.Lesson == "" {
+			return text, ErrLessonRequired
+		}
+	}
+
+	return validateText(kind, text)
+}
+
+// Checks the text of a kind of message, returning it as it is kept. Captions and comments are optional
+func validateText(kind model.MessageKind, text string) (string, error) {
+	switch kind {
+	case model.MessageKindText:
+		if strings.TrimSpace(text) == "" {
+			return text, ErrEmptyMessage
+		}
+	case model.MessageKindMath:
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return text, ErrEmptyMessage
+		}
+
+		if !validMath(text) {
+			return text, ErrInvalidMath
+		}
+	default:
+		text = strings.TrimSpace(text)
+	}
+
+	return text, nil
+}
+
+// Checks that math is LaTeX clients can render, braces have to balance and escaped braces do not count
+// Rendering is left to clients, which only render math and never run it
+func validMath(source string) bool {
+	if utf8.RuneCountInString(source) > maxMathLength {
+		return false
+	}
+
+	depth, escaped := 0, false
+	for _, r := range source {
+		if escaped {
+			escaped = false
+			continue
+		}
+
+		switch r {
+		case '\\':
+			escaped = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+
+	return depth == 0
+}
+
+// Checks that a lesson can be shared in a conversation, it has to be between the sender and the recipient
+func (c *Chat) validateLesson(lid string, sender string, recipient string) error {
+	l, err := c.repo.GetLessonById(lid)
+	if err == pgx.ErrNoRows {
+		return ErrLessonNotShared
+	} else if err != nil {
+		return err
+	}
+
+	if !(l.Student == sender && l.Tutor == recipient) && !(l.Tutor == sender && l.Student == recipient) {
+		return ErrLessonNotShared
+	}
+
+	return nil
+}
+
+// Gets a lesson shared in a message, or nil if it was deleted since
+func (c *Chat) SharedLesson(lid string) (*db.Lesson, error) {
+	l, err := c.repo.GetLessonById(lid)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// Reads an uploaded file and checks that it can be sent as the given kind of message
+// Content types are sniffed from the content rather than trusted, and images are decoded to make their thumbnail
+func readUpload(kind model.MessageKind, file graphql.Upload) (upload, error) {
+	var u upload
+
+	limit := int64(maxAttachmentSize)
+	if kind == model.MessageKindImage {
+		limit = maxImageSize
+	}
+
+	if file.Size > limit {
+		return u, ErrAttachmentTooLarge
+	}
+
+	// The declared size is not trusted either, reading one more byte than allowed tells whether the file is too large
+	content, err := ioutil.ReadAll(io.LimitReader(file.File, limit+1))
+	if err != nil {
+		return u, err
+	}
+
+	if int64(len(content)) > limit {
+		return u, ErrAttachmentTooLarge
+	}
+
+	if len(content) == 0 {
+		return u, ErrFileRequired
+	}
+
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(content))
+	if err != nil {
+		return u, ErrUnsupportedType
+	}
+
+	declared, _, _ := mime.ParseMediaType(file.ContentType)
+
+	switch {
+	case kind == model.MessageKindImage:
+		if !imageTypes[contentType] {
+			return u, ErrInvalidImage
+		}
+	case imageTypes[contentType], fileTypes[contentType]:
+	case contentType == "application/zip" && officeTypes[declared]:
+		contentType = declared
+	default:
+		return u, ErrUnsupportedType
+	}
+
+	name := path.Base(strings.TrimSpace(file.Filename))
+	if name == "." || name == "/" {
+		name = "attachment"
+	}
+
+	u.content = content
+	u.attachment = db.MessageAttachment{Id: uuid.New(), Name: name, ContentType: contentType, Size: int64(len(content))}
+
+	if imageTypes[contentType] {
+		thumbnail, width, height, err := makeThumbnail(content)
+		switch {
+		case err == nil:
+			u.thumbnail = thumbnail
+			u.attachment.Width, u.attachment.Height = &width, &height
+		case err != errNotImage:
+			return u, err
+		case kind == model.MessageKindImage:
+			return u, ErrInvalidImage
+		}
+	}
+
+	return u, nil
+}
+
+// Scales an image down to fit in the thumbnail square, returning the thumbnail as a JPEG along with the size of the image
+// Images which cannot be decoded, or are too large to be decoded safely, give errNotImage
+func makeThumbnail(content []byte) ([]byte, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, 0, 0, errNotImage
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, 0, 0, errNotImage
+	}
+
+	width, height := config.Width, config.Height
+	tw, th := width, height
+	if tw > thumbnailSize || th > thumbnailSize {
+		if tw >= th {
+			tw, th = thumbnailSize, max(1, height*thumbnailSize/width)
+		} else {
+			tw, th = max(1, width*thumbnailSize/height), thumbnailSize
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, scale(img, tw, th), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return buf.Bytes(), width, height, nil
+}
+
+// Scales an image to the given size by averaging a grid of samples for each pixel, transparent parts are laid over white since JPEG has no transparency
+func scale(img image.Image, width int, height int) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, bl, n uint64
+
+			for sy := 0; sy < thumbnailSamples; sy++ {
+				for sx := 0; sx < thumbnailSamples; sx++ {
+					// Samples are taken at the centre of each cell of the grid
+					px := b.Min.X + (2*(x*thumbnailSamples+sx)+1)*b.Dx()/(2*width*thumbnailSamples)
+					py := b.Min.Y + (2*(y*thumbnailSamples+sy)+1)*b.Dy()/(2*height*thumbnailSamples)
+
+					cr, cg, cb, ca := img.At(px, py).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: 0xff})
+		}
+	}
+
+	return dst
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Writes the content of an upload to the blob store, keeping the attachment record in sync with where it went
+func (c *Chat) storeUpload(cid string, u *upload) error {
+	u.attachment.Conversation = cid
+	u.attachment.StorageKey = "chat/" + cid + "/" + u.attachment.Id
+
+	if err := c.blobs.Put(u.attachment.StorageKey, bytes.NewReader(u.content)); err != nil {
+		return err
+	}
+
+	if u.thumbnail == nil {
+		return nil
+	}
+
+	u.attachment.ThumbnailKey = "chat/" + cid + "/thumbnails/" + u.attachment.Id
+	if err := c.blobs.Put(u.attachment.ThumbnailKey, bytes.NewReader(u.thumbnail)); err != nil {
+		c.deleteBlobs(u.attachment)
+		return err
+	}
+
+	return nil
+}
+
+// Removes the content of an attachment from the blob store, as best it can
+func (c *Chat) deleteBlobs(a db.MessageAttachment) {
+	c.blobs.Delete(a.StorageKey)
+	if a.ThumbnailKey != "" {
+		c.blobs.Delete(a.ThumbnailKey)
+	}
+}
+
+// Serves the content of chat attachments, or the thumbnails of images, to the participants of their conversation
+func (c *Chat) AttachmentHandler(ps *policy.PolicyService, thumbnail bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := auth.PrincipalFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		aid := mux.Vars(r)["id"]
+
+		owns, err := ps.Owns(p, policy.MessageAttachmentResource, aid)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		} else if !owns {
+			http.Error(w, ErrAttachmentNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		a, err := c.repo.GetMessageAttachmentById(aid)
+		if err == pgx.ErrNoRows {
+			http.Error(w, ErrAttachmentNotFound.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		key, contentType := a.StorageKey, a.ContentType
+		if thumbnail {
+			if a.ThumbnailKey == "" {
+				http.Error(w, ErrAttachmentNotFound.Error(), http.StatusNotFound)
+				return
+			}
+			key, contentType = a.ThumbnailKey, "image/jpeg"
+		}
+
+		content, err := c.blobs.Open(key)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		defer content.Close()
+
+		// Images were checked to be pictures and may be displayed, every other file is downloaded so uploaded html cannot run on this origin
+		disposition := "attachment"
+		if imageTypes[contentType] {
+			disposition = "inline"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		io.Copy(w, content)
+	})
+}
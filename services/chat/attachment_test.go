@@ -0,0 +1,267 @@
+package chat
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/pborman/uuid"
+
+	"github.com/solderneer/axiom-backend/db/dbtest"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// Encodes a PNG of the given size, filled with one colour
+func testPNG(t *testing.T, width int, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Cannot encode image: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestValidMath(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		want   bool
+	}{
+		{"Plain", `x^2 + y^2 = z^2`, true},
+		{"Balanced", `\frac{a}{b^{2}}`, true},
+		{"EscapedBraces", `\{ x \}`, true},
+		{"EscapedBackslash", `a \\ {b}`, true},
+		{"Unclosed", `\frac{a}{b`, false},
+		{"ClosedFirst", `}{`, false},
+		{"EscapedClosingBrace", `{a\}`, false},
+		{"AtTheLimit", strings.Repeat("x", maxMathLength), true},
+		{"TooLong", strings.Repeat("x", maxMathLength+1), false},
+		// The limit is on characters rather than bytes
+		{"MultibyteAtTheLimit", strings.Repeat("π", maxMathLength), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := validMath(c.source); got != c.want {
+				t.Errorf("validMath(%q) = %v, want %v", c.source, got, c.want)
+			}
+		})
+	}
+}
+
+func TestReadUpload(t *testing.T) {
+	picture := testPNG(t, 64, 32)
+	pdf := []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\n")
+	zip := []byte("PK\x03\x04" + strings.Repeat("\x00", 26))
+	docx := "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+	cases := []struct {
+		name        string
+		kind        model.MessageKind
+		content     []byte
+		filename    string
+		declared    string
+		size        int64
+		err         error
+		contentType string
+		wantName    string
+		thumbnail   bool
+	}{
+		{name: "Image", kind: model.MessageKindImage, content: picture, filename: "cat.png", contentType: "image/png", wantName: "cat.png", thumbnail: true},
+		{name: "ImageSentAsFile", kind: model.MessageKindFile, content: picture, filename: "cat.png", contentType: "image/png", wantName: "cat.png", thumbnail: true},
+		{name: "PDF", kind: model.MessageKindFile, content: pdf, filename: "notes.pdf", contentType: "application/pdf", wantName: "notes.pdf"},
+		{name: "PDFSentAsImage", kind: model.MessageKindImage, content: pdf, filename: "notes.pdf", err: ErrInvalidImage},
+		// Content types are sniffed, so html declared as a picture is still html
+		{name: "HTML", kind: model.MessageKindFile, content: []byte("<html><script>alert(1)</script></html>"), filename: "page.png", declared: "image/png", err: ErrUnsupportedType},
+		{name: "OfficeDocument", kind: model.MessageKindFile, content: zip, filename: "essay.docx", declared: docx, contentType: docx, wantName: "essay.docx"},
+		{name: "PlainZip", kind: model.MessageKindFile, content: zip, filename: "files.zip", declared: "application/zip", err: ErrUnsupportedType},
+		{name: "Empty", kind: model.MessageKindFile, content: []byte{}, filename: "empty.pdf", err: ErrFileRequired},
+		{name: "DeclaredTooLarge", kind: model.MessageKindFile, content: pdf, filename: "notes.pdf", size: maxAttachmentSize + 1, err: ErrAttachmentTooLarge},
+		// The declared size is not trusted
+		{name: "ActuallyTooLarge", kind: model.MessageKindImage, content: append(append([]byte{}, picture...), make([]byte, maxImageSize)...), filename: "cat.png", size: 1, err: ErrAttachmentTooLarge},
+		{name: "PathInName", kind: model.MessageKindFile, content: pdf, filename: "../../etc/notes.pdf", contentType: "application/pdf", wantName: "notes.pdf"},
+		{name: "NoName", kind: model.MessageKindFile, content: pdf, filename: " ", contentType: "application/pdf", wantName: "attachment"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			size := c.size
+			if size == 0 {
+				size = int64(len(c.content))
+			}
+
+			u, err := readUpload(c.kind, graphql.Upload{File: bytes.NewReader(c.content), Filename: c.filename, Size: size, ContentType: c.declared})
+			if err != c.err {
+				t.Fatalf("Got error %v, want %v", err, c.err)
+			}
+
+			if c.err != nil {
+				return
+			}
+
+			if u.attachment.ContentType != c.contentType {
+				t.Errorf("Got content type %q, want %q", u.attachment.ContentType, c.contentType)
+			}
+
+			if u.attachment.Name != c.wantName {
+				t.Errorf("Got name %q, want %q", u.attachment.Name, c.wantName)
+			}
+
+			if u.attachment.Size != int64(len(c.content)) || !bytes.Equal(u.content, c.content) {
+				t.Errorf("Got %d bytes of content, want %d", len(u.content), len(c.content))
+			}
+
+			if (u.thumbnail != nil) != c.thumbnail {
+				t.Errorf("Got thumbnail %v, want %v", u.thumbnail != nil, c.thumbnail)
+			}
+
+			if c.thumbnail && (u.attachment.Width == nil || *u.attachment.Width != 64 || u.attachment.Height == nil || *u.attachment.Height != 32) {
+				t.Errorf("Got size %v by %v, want 64 by 32", u.attachment.Width, u.attachment.Height)
+			}
+		})
+	}
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	cases := []struct {
+		name          string
+		content       []byte
+		err           error
+		width, height int
+		thumbW        int
+		thumbH        int
+	}{
+		{name: "Wide", content: testPNG(t, 640, 160), width: 640, height: 160, thumbW: 320, thumbH: 80},
+		{name: "Tall", content: testPNG(t, 100, 1000), width: 100, height: 1000, thumbW: 32, thumbH: 320},
+		// Small images are not scaled up
+		{name: "Small", content: testPNG(t, 10, 20), width: 10, height: 20, thumbW: 10, thumbH: 20},
+		{name: "Sliver", content: testPNG(t, 2000, 1), width: 2000, height: 1, thumbW: 320, thumbH: 1},
+		// Too many pixels to decode safely, which is told from the header alone
+		{name: "TooManyPixels", content: testPNG(t, 4000, maxImagePixels/4000+1), err: errNotImage},
+		{name: "NotAnImage", content: []byte("not an image"), err: errNotImage},
+		{name: "Truncated", content: testPNG(t, 64, 64)[:60], err: errNotImage},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			thumbnail, width, height, err := makeThumbnail(c.content)
+			if err != c.err {
+				t.Fatalf("Got error %v, want %v", err, c.err)
+			}
+
+			if c.err != nil {
+				return
+			}
+
+			if width != c.width || height != c.height {
+				t.Errorf("Got size %d by %d, want %d by %d", width, height, c.width, c.height)
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(thumbnail))
+			if err != nil {
+				t.Fatalf("Thumbnail is not a JPEG: %v", err)
+			}
+
+			if b := img.Bounds(); b.Dx() != c.thumbW || b.Dy() != c.thumbH {
+				t.Errorf("Got thumbnail of %d by %d, want %d by %d", b.Dx(), b.Dy(), c.thumbW, c.thumbH)
+			}
+		})
+	}
+}
+
+// Transparent parts of an image turn white, since JPEG has no transparency
+func TestScaleLaysTransparencyOverWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+
+	got := color.RGBAModel.Convert(scale(img, 2, 2).At(1, 1)).(color.RGBA)
+	if want := (color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}); got != want {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	str := func(s string) *string { return &s }
+	file := &graphql.Upload{Filename: "notes.pdf"}
+
+	cases := []struct {
+		name    string
+		kind    model.MessageKind
+		message model.SendMessage
+		text    string
+		err     error
+	}{
+		{"Text", model.MessageKindText, model.SendMessage{Message: str(" hi ")}, " hi ", nil},
+		{"EmptyText", model.MessageKindText, model.SendMessage{Message: str("  ")}, "  ", ErrEmptyMessage},
+		{"MissingText", model.MessageKindText, model.SendMessage{}, "", ErrEmptyMessage},
+		{"TextWithFile", model.MessageKindText, model.SendMessage{Message: str("hi"), File: file}, "hi", ErrUnexpectedContent},
+		{"TextWithLesson", model.MessageKindText, model.SendMessage{Message: str("hi"), Lesson: str("l")}, "hi", ErrUnexpectedContent},
+		{"Math", model.MessageKindMath, model.SendMessage{Message: str(" \\frac{1}{2} ")}, "\\frac{1}{2}", nil},
+		{"EmptyMath", model.MessageKindMath, model.SendMessage{Message: str(" ")}, "", ErrEmptyMessage},
+		{"InvalidMath", model.MessageKindMath, model.SendMessage{Message: str("{")}, "{", ErrInvalidMath},
+		{"FileWithCaption", model.MessageKindFile, model.SendMessage{Message: str(" notes "), File: file}, "notes", nil},
+		{"ImageWithoutCaption", model.MessageKindImage, model.SendMessage{File: file}, "", nil},
+		{"MissingFile", model.MessageKindFile, model.SendMessage{}, "", ErrFileRequired},
+		{"FileWithLesson", model.MessageKindFile, model.SendMessage{File: file, Lesson: str("l")}, "", ErrUnexpectedContent},
+		{"Lesson", model.MessageKindLesson, model.SendMessage{Lesson: str("l")}, "", nil},
+		{"EmptyLesson", model.MessageKindLesson, model.SendMessage{Lesson: str("")}, "", ErrLessonRequired},
+		{"LessonWithFile", model.MessageKindLesson, model.SendMessage{Lesson: str("l"), File: file}, "", ErrUnexpectedContent},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			text, err := validateContent(c.kind, c.message)
+			if err != c.err || text != c.text {
+				t.Errorf("Got %q with error %v, want %q with error %v", text, err, c.text, c.err)
+			}
+		})
+	}
+}
+
+// Only lessons between the sender and the recipient can be shared
+func TestValidateLesson(t *testing.T) {
+	repo := dbtest.Repository(t)
+	c := NewChat(repo, NewMemoryStore(), nil, nil, 0)
+
+	tutor := dbtest.Tutor(t, repo).Id
+	student := dbtest.Student(t, repo).Id
+	stranger := dbtest.Student(t, repo).Id
+
+	start := time.Now().Add(24 * time.Hour)
+	l, err := repo.CreateLesson(dbtest.Subject(t, repo), tutor, student, true, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Cannot create lesson: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		lid       string
+		sender    string
+		recipient string
+		err       error
+	}{
+		{"ByStudent", l.Id, student, tutor, nil},
+		{"ByTutor", l.Id, tutor, student, nil},
+		{"WithStranger", l.Id, tutor, stranger, ErrLessonNotShared},
+		{"ByStranger", l.Id, stranger, tutor, ErrLessonNotShared},
+		{"Missing", uuid.New(), student, tutor, ErrLessonNotShared},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := c.validateLesson(tc.lid, tc.sender, tc.recipient); err != tc.err {
+				t.Errorf("Got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
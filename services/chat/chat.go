@@ -2,138 +2,401 @@ package chat
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"sync"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
-	"github.com/influxdata/influxdb-client-go/v2"
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/db"
 	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/blob"
+	"github.com/solderneer/axiom-backend/services/pubsub"
+	"github.com/solderneer/axiom-backend/utilities/auth"
 )
 
-type MessageRange struct {
-	To    string
-	Start time.Time
-	End   time.Time
-}
+// How often recording a message in its conversation is tried, for stores which save it separately
+const recordAttempts = 3
+
+var (
+	ErrNotFound       = errors.New("Conversation not found")
+	ErrEmptyMessage   = errors.New("Messages cannot be empty")
+	ErrMessageSelf    = errors.New("Cannot send a message to yourself")
+	ErrNotParticipant = errors.New("Not a participant of this conversation")
+	ErrUnknownUser    = errors.New("No such user")
+	ErrNotRelated     = errors.New("Students and tutors can only message each other once they share a lesson or match")
+	ErrBlocked        = errors.New("Messages between these users are blocked")
+	ErrRateLimited    = errors.New("Too many messages, please wait a moment")
+	ErrReasonRequired = errors.New("A reason is required to report a user")
+)
 
 type Chat struct {
-	dbClient influxdb2.Client
-	org      string
-	bucket   string
-	channels map[string]chan *model.Message
-	mux      sync.Mutex
+	repo      *db.Repository
+	store     MessageStore
+	blobs     blob.Store
+	broker    pubsub.Broker
+	limiter   *limiter
+	retention Retention
+}
+
+// Initialise a Chat struct keeping messages in the given store and attachments in the given blob store, users can send up to perMinute messages a minute
+func NewChat(repo *db.Repository, store MessageStore, blobs blob.Store, broker pubsub.Broker, perMinute int) *Chat {
+	return &Chat{
+		repo:    repo,
+		store:   store,
+		blobs:   blobs,
+		broker:  broker,
+		limiter: newLimiter(perMinute),
+	}
 }
 
-const defaultInfluxURL = "http://localhost:8086"
-const defaultAuthToken = "user:pass"
-const defaultOrg = "axiom"
-const defaultBucket = "messages"
+func (c *Chat) Close() error {
+	return c.store.Close()
+}
 
-// Initialise a Chat struct with InfluxDB connection information taken from environment variables.
-func InitChat() *Chat {
-	influxURL := os.Getenv("INFLUX_URL")
-	if influxURL == "" {
-		influxURL = defaultInfluxURL
+// Gets a conversation by id
+func (c *Chat) Conversation(cid string) (db.Conversation, error) {
+	conv, err := c.repo.GetConversationById(cid)
+	if err == pgx.ErrNoRows {
+		return conv, ErrNotFound
 	}
 
-	authToken := os.Getenv("INFLUX_AUTH_TOKEN")
-	if authToken == "" {
-		authToken = defaultAuthToken
+	return conv, err
+}
+
+// Gets the conversations of a user, those with the most recent messages first
+func (c *Chat) Conversations(uid string) ([]db.Conversation, error) {
+	return c.repo.GetUserConversations(uid)
+}
+
+// Retrieve the messages of a conversation in both directions, newest first
+// Continues after the message with the given time and id unless the id is empty, up to the given limit
+func (c *Chat) GetMessages(ctx context.Context, conv db.Conversation, afterCreated time.Time, afterId string, limit int) ([]db.Message, error) {
+	return c.store.List(ctx, conv, afterCreated, afterId, limit)
+}
+
+// Send a message, starting a conversation with the recipient if there is none yet
+// Messages are text unless another kind is given, files are written to the blob store before the message is saved
+// Returns the conversation the message was sent in
+func (c *Chat) SendMessage(ctx context.Context, sender string, message model.SendMessage) (db.Conversation, error) {
+	kind := model.MessageKindText
+	if message.Kind != nil {
+		kind = *message.Kind
 	}
 
-	org := os.Getenv("INFLUX_ORG")
-	if org == "" {
-		org = defaultOrg
+	text, err := validateContent(kind, message)
+	if err != nil {
+		return db.Conversation{}, err
 	}
 
-	bucket := os.Getenv("INFLUX_BUCKET")
-	if bucket == "" {
-		bucket = defaultBucket
+	if message.To == sender {
+		return db.Conversation{}, ErrMessageSelf
 	}
 
-	return NewChat(influxURL, authToken, org, bucket)
-}
+	if !c.limiter.Allow(sender, time.Now()) {
+		return db.Conversation{}, ErrRateLimited
+	}
+
+	if err = c.canMessage(sender, message.To); err != nil {
+		return db.Conversation{}, err
+	}
+
+	var u *upload
+	switch kind {
+	case model.MessageKindLesson:
+		if err = c.validateLesson(*message.Lesson, sender, message.To); err != nil {
+			return db.Conversation{}, err
+		}
+	case model.MessageKindImage, model.MessageKindFile:
+		read, err := readUpload(kind, *message.File)
+		if err != nil {
+			return db.Conversation{}, err
+		}
+		u = &read
+	}
 
-// Initialise a Chat struct with InfluxDB connection information supplied as arguments.
-func NewChat(influxURL string, authToken string, org string, bucket string) *Chat {
-	c := &Chat{
-		dbClient: influxdb2.NewClient(influxURL, authToken),
-		org:      org,
-		bucket:   bucket,
+	conv, err := c.repo.GetOrCreateConversation(sender, message.To)
+	if err != nil {
+		return conv, err
 	}
 
-	return c
+	// Postgres keeps timestamps to the microsecond, so messages keep the same time in every store
+	m := db.Message{Id: uuid.New(), Conversation: conv.Id, From: sender, To: message.To, Kind: string(kind), Message: text, Created: time.Now().Truncate(time.Microsecond)}
+	if message.Lesson != nil {
+		m.Lesson = *message.Lesson
+	}
+
+	if u != nil {
+		if err = c.storeUpload(conv.Id, u); err != nil {
+			return conv, err
+		}
+
+		u.attachment.Message = m.Id
+		u.attachment.Created = m.Created
+		m.Attachment = &u.attachment
+	}
+
+	if err = c.save(ctx, m); err != nil {
+		return conv, err
+	}
+
+	raw, err := json.Marshal(c.repo.ToMessageModel(m, AttachmentPath))
+	if err != nil {
+		return conv, err
+	}
+
+	return conv, c.broker.Publish(messageTopic(message.To), raw)
 }
 
-func (c *Chat) Close() {
-	c.dbClient.Close()
+// Saves a message and records it in its conversation, in one transaction when the store keeps messages in Postgres
+// Other stores cannot share a transaction with the conversation, so recording is retried instead, which counts each message once however often it runs
+// The content of the attachment is removed again unless the message was saved
+func (c *Chat) save(ctx context.Context, m db.Message) error {
+	var err error
+	rs, recording := c.store.(recordingStore)
+	if recording {
+		err = rs.SaveAndRecord(ctx, m)
+	} else {
+		err = c.store.Save(ctx, m)
+	}
+
+	if err != nil {
+		if m.Attachment != nil {
+			c.deleteBlobs(*m.Attachment)
+		}
+		return err
+	}
+
+	if recording {
+		return nil
+	}
+
+	for attempt := 0; attempt < recordAttempts; attempt++ {
+		if err = c.repo.RecordMessage(m); err == nil {
+			return nil
+		}
+	}
+
+	return err
 }
 
-// Retrieve the messages to and from two certain users in a certain time range.
-func (c *Chat) GetMessages(ctx context.Context, from string, r model.MessageRange) ([]*model.Message, error) {
-	api := c.dbClient.QueryAPI(c.org)
-	query := fmt.Sprintf(`from(bucket:"%s")|> range(start: %d, end: %d)|> filter(fn: (r) => r._measurement == "msg" and r.to == "%s" and r.from == "%s")`, c.bucket, r.Start.Unix(), r.End.Unix(), r.To, from)
-	res, err := api.Query(ctx, query)
+// Marks a conversation as read by one of its participants, letting the other participant know
+func (c *Chat) MarkRead(conv db.Conversation, uid string) (db.Conversation, error) {
+	if _, ok := conv.Participant(uid); !ok {
+		return conv, ErrNotParticipant
+	}
+
+	lastRead, err := c.repo.MarkConversationRead(conv.Id, uid, time.Now())
 	if err != nil {
-		return nil, err
+		return conv, err
 	}
 
-	messages := make([]*model.Message, 0)
-	for res.Next() {
-		record := res.Record()
-		vals := record.Values()
-		m := &model.Message{
-			To:        vals["to"].(string),
-			From:      vals["form"].(string),
-			Timestamp: record.Time(),
-			Message:   vals["msg"].(string),
+	for i := range conv.Participants {
+		if conv.Participants[i].Id == uid {
+			conv.Participants[i].LastRead = &lastRead
+			conv.Participants[i].Unread = 0
 		}
+	}
+
+	return conv, c.publishActivity(conv, uid, model.ConversationActivityKindRead, lastRead)
+}
 
-		messages = append(messages, m)
+// Lets the other participant of a conversation know that a user is typing
+// Typing indicators are not stored, clients are expected to send them again every few seconds while the user is typing
+func (c *Chat) SendTyping(conv db.Conversation, uid string) error {
+	if _, ok := conv.Participant(uid); !ok {
+		return ErrNotParticipant
 	}
 
-	return messages, nil
+	blocked, err := c.repo.IsBlocked(uid, conv.Other(uid))
+	if err != nil {
+		return err
+	}
+
+	if blocked {
+		return ErrBlocked
+	}
+
+	return c.publishActivity(conv, uid, model.ConversationActivityKindTyping, time.Now())
 }
 
-// Send a message.
-func (c *Chat) SendMessage(ctx context.Context, sender string, message model.SendMessage) error {
-	timestamp := time.Now()
+// Checks whether a user may message another, only students and tutors who share a lesson or match can message each other, unless either blocked the other
+func (c *Chat) canMessage(sender string, recipient string) error {
+	senderRole, err := auth.RoleFromId(sender)
+	if err != nil {
+		return ErrUnknownUser
+	}
+
+	recipientRole, err := auth.RoleFromId(recipient)
+	if err != nil {
+		return ErrUnknownUser
+	}
 
-	msg := influxdb2.NewPointWithMeasurement("msg").AddTag("to", message.To).AddTag("from", sender).AddField("msg", message.Message).SetTime(timestamp)
+	var shares bool
+	switch {
+	case senderRole == auth.RoleStudent && recipientRole == auth.RoleTutor:
+		shares, err = c.repo.SharesLessonOrMatch(sender, recipient)
+	case senderRole == auth.RoleTutor && recipientRole == auth.RoleStudent:
+		shares, err = c.repo.SharesLessonOrMatch(recipient, sender)
+	}
+	if err != nil {
+		return err
+	}
 
-	api := c.dbClient.WriteAPIBlocking(c.org, c.bucket)
-	err := api.WritePoint(ctx, msg)
+	if !shares {
+		return ErrNotRelated
+	}
 
+	blocked, err := c.repo.IsBlocked(sender, recipient)
 	if err != nil {
 		return err
 	}
 
-	c.mux.Lock()
-	c.channels[message.To] <- &model.Message{
-		To:        message.To,
-		From:      sender,
-		Timestamp: timestamp,
-		Message:   message.Message,
+	if blocked {
+		return ErrBlocked
 	}
-	c.mux.Unlock()
 
 	return nil
 }
 
+// Blocks another user, neither of them can message the other until the block is lifted
+func (c *Chat) Block(uid string, other string) error {
+	if uid == other {
+		return ErrMessageSelf
+	}
+
+	if _, err := auth.RoleFromId(other); err != nil {
+		return ErrUnknownUser
+	}
+
+	return c.repo.BlockUser(uid, other)
+}
+
+// Lifts a block a user placed on another
+func (c *Chat) Unblock(uid string, other string) error {
+	return c.repo.UnblockUser(uid, other)
+}
+
+// Gets the ids of the users a user blocked
+func (c *Chat) Blocked(uid string) ([]string, error) {
+	return c.repo.GetBlockedUsers(uid)
+}
+
+// Reports another user to the admins, who can then read the conversation between the two
+func (c *Chat) Report(uid string, other string, reason string) (db.UserReport, error) {
+	if uid == other {
+		return db.UserReport{}, ErrMessageSelf
+	}
+
+	if _, err := auth.RoleFromId(other); err != nil {
+		return db.UserReport{}, ErrUnknownUser
+	}
+
+	if strings.TrimSpace(reason) == "" {
+		return db.UserReport{}, ErrReasonRequired
+	}
+
+	return c.repo.CreateUserReport(uid, other, reason)
+}
+
+func (c *Chat) publishActivity(conv db.Conversation, uid string, kind model.ConversationActivityKind, at time.Time) error {
+	raw, err := json.Marshal(&model.ConversationActivity{
+		Conversation: conv.Id,
+		Kind:         kind,
+		From:         uid,
+		Timestamp:    at,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.broker.Publish(activityTopic(conv.Other(uid)), raw)
+}
+
 // Returns a channel that messages to a certain user ID are sent to for the purposes of SSEs.
-func (c *Chat) SubscribeMessages(uid string, done <-chan struct{}) <-chan *model.Message {
-	channel := make(chan *model.Message)
-	c.mux.Lock()
-	c.channels[uid] = channel
-	c.mux.Unlock()
+// Every call creates a new subscription, so a user can be subscribed from several devices at once.
+func (c *Chat) SubscribeMessages(uid string, done <-chan struct{}) (<-chan *model.Message, error) {
+	sub, err := c.broker.Subscribe(messageTopic(uid))
+	if err != nil {
+		return nil, err
+	}
+
+	channel := make(chan *model.Message, 1)
 
 	go func() {
-		<-done
-		c.mux.Lock()
-		delete(c.channels, uid)
-		c.mux.Unlock()
+		defer close(channel)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case <-done:
+				return
+			case raw, ok := <-sub.C:
+				if !ok {
+					return
+				}
+
+				var m model.Message
+				if err := json.Unmarshal(raw, &m); err != nil {
+					continue
+				}
+
+				select {
+				case channel <- &m:
+				case <-done:
+					return
+				}
+			}
+		}
 	}()
 
-	return channel
+	return channel, nil
+}
+
+// Returns a channel that typing indicators and read receipts in the conversations of a certain user ID are sent to
+func (c *Chat) SubscribeActivity(uid string, done <-chan struct{}) (<-chan *model.ConversationActivity, error) {
+	sub, err := c.broker.Subscribe(activityTopic(uid))
+	if err != nil {
+		return nil, err
+	}
+
+	channel := make(chan *model.ConversationActivity, 1)
+
+	go func() {
+		defer close(channel)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case <-done:
+				return
+			case raw, ok := <-sub.C:
+				if !ok {
+					return
+				}
+
+				var a model.ConversationActivity
+				if err := json.Unmarshal(raw, &a); err != nil {
+					continue
+				}
+
+				select {
+				case channel <- &a:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return channel, nil
+}
+
+func activityTopic(uid string) string {
+	return "conversations:" + uid
+}
+
+func messageTopic(uid string) string {
+	return "messages:" + uid
 }
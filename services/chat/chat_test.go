@@ -0,0 +1,97 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// Checks which only need the ids of the users, the repository is never reached
+func TestCanMessageRoles(t *testing.T) {
+	c := &Chat{}
+
+	tests := []struct {
+		sender    string
+		recipient string
+		want      error
+	}{
+		{"s:1", "nobody", ErrUnknownUser},
+		{"nobody", "t:1", ErrUnknownUser},
+		{"s:1", "s:2", ErrNotRelated},
+		{"t:1", "t:2", ErrNotRelated},
+	}
+
+	for _, tt := range tests {
+		if got := c.canMessage(tt.sender, tt.recipient); got != tt.want {
+			t.Errorf("%s to %s: got %v, want %v", tt.sender, tt.recipient, got, tt.want)
+		}
+	}
+}
+
+func TestCanMessage(t *testing.T) {
+	repo := dbtest.Repository(t)
+	c := NewChat(repo, NewMemoryStore(), nil, nil, 0)
+
+	subject := dbtest.Subject(t, repo)
+	tutor := dbtest.Tutor(t, repo).Id
+	student := dbtest.Student(t, repo).Id
+	stranger := dbtest.Student(t, repo).Id
+
+	start := time.Now().Add(24 * time.Hour)
+	if _, err := repo.CreateLesson(subject, tutor, student, true, start, start.Add(time.Hour)); err != nil {
+		t.Fatalf("Cannot create lesson: %v", err)
+	}
+
+	tests := []struct {
+		sender    string
+		recipient string
+		want      error
+	}{
+		{student, tutor, nil},
+		{tutor, student, nil},
+		{stranger, tutor, ErrNotRelated},
+		{tutor, stranger, ErrNotRelated},
+	}
+
+	for _, tt := range tests {
+		if got := c.canMessage(tt.sender, tt.recipient); got != tt.want {
+			t.Errorf("%s to %s: got %v, want %v", tt.sender, tt.recipient, got, tt.want)
+		}
+	}
+
+	// A block stops messages both ways until it is lifted
+	if err := c.Block(student, tutor); err != nil {
+		t.Fatalf("Cannot block: %v", err)
+	}
+
+	for _, pair := range [][2]string{{student, tutor}, {tutor, student}} {
+		if got := c.canMessage(pair[0], pair[1]); got != ErrBlocked {
+			t.Errorf("%s to %s after blocking: got %v, want %v", pair[0], pair[1], got, ErrBlocked)
+		}
+	}
+
+	if err := c.Unblock(student, tutor); err != nil {
+		t.Fatalf("Cannot unblock: %v", err)
+	}
+
+	if got := c.canMessage(tutor, student); got != nil {
+		t.Errorf("Got %v after unblocking, want nil", got)
+	}
+}
+
+func TestBlockValidation(t *testing.T) {
+	c := &Chat{}
+
+	if err := c.Block("s:1", "s:1"); err != ErrMessageSelf {
+		t.Errorf("Blocking yourself returned %v, want %v", err, ErrMessageSelf)
+	}
+
+	if err := c.Block("s:1", "nobody"); err != ErrUnknownUser {
+		t.Errorf("Blocking an unknown user returned %v, want %v", err, ErrUnknownUser)
+	}
+
+	if _, err := c.Report("s:1", "t:1", "  "); err != ErrReasonRequired {
+		t.Errorf("Reporting without a reason returned %v, want %v", err, ErrReasonRequired)
+	}
+}
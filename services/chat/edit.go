@@ -0,0 +1,123 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+// How long after sending a message its sender can still edit it, or delete it for everyone
+const (
+	editWindow   = 15 * time.Minute
+	deleteWindow = time.Hour
+)
+
+var (
+	ErrMessageNotFound    = errors.New("Message not found")
+	ErrNotSender          = errors.New("Only the sender of a message can change it")
+	ErrEditWindowPassed   = errors.New("Messages can only be edited within 15 minutes of being sent")
+	ErrDeleteWindowPassed = errors.New("Messages can only be deleted within an hour of being sent")
+	ErrMessageDeleted     = errors.New("This message was deleted")
+	ErrReadOnlyHistory    = errors.New("Messages cannot be changed while chat is kept in InfluxDB")
+)
+
+// Edits the text of a message sent by a user within the edit window, what it said before is kept in its edit history
+// The other participant gets the edited message over subscribeMessages
+func (c *Chat) EditMessage(ctx context.Context, conv db.Conversation, uid string, mid string, text string) (db.Message, error) {
+	m, err := c.changeable(ctx, conv, uid, mid, editWindow, ErrEditWindowPassed)
+	if err != nil {
+		return m, err
+	}
+
+	if text, err = validateText(model.MessageKind(m.Kind), text); err != nil {
+		return m, err
+	}
+
+	if text == m.Message {
+		return m, nil
+	}
+
+	if !c.limiter.Allow(uid, time.Now()) {
+		return m, ErrRateLimited
+	}
+
+	at := time.Now().Truncate(time.Microsecond)
+	if err = c.store.Edit(ctx, m, text, at); err != nil {
+		return m, err
+	}
+
+	m.Message, m.Edited = text, &at
+	return m, c.publishChange(m)
+}
+
+// Deletes a message sent by a user for everyone within the delete window, along with its attachment and edit history
+// A tombstone keeping the kind of the message is left in its place, and sent to the other participant over subscribeMessages
+func (c *Chat) DeleteMessage(ctx context.Context, conv db.Conversation, uid string, mid string) (db.Message, error) {
+	m, err := c.changeable(ctx, conv, uid, mid, deleteWindow, ErrDeleteWindowPassed)
+	if err != nil {
+		return m, err
+	}
+
+	at := time.Now().Truncate(time.Microsecond)
+	a, err := c.store.Delete(ctx, m, at)
+	if err != nil {
+		return m, err
+	}
+
+	if a != nil {
+		c.deleteBlobs(*a)
+	}
+
+	m.Message, m.Attachment, m.Lesson, m.Deleted = "", nil, "", &at
+	return m, c.publishChange(m)
+}
+
+// Gets what a message said before each of its edits, oldest first
+func (c *Chat) MessageEdits(ctx context.Context, conv db.Conversation, mid string) ([]db.MessageEdit, error) {
+	m, err := c.store.Get(ctx, conv, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.store.Edits(ctx, m)
+}
+
+// Gets a message a user wants to change, as long as they sent it less than window ago and it was not deleted
+func (c *Chat) changeable(ctx context.Context, conv db.Conversation, uid string, mid string, window time.Duration, errWindow error) (db.Message, error) {
+	m, err := c.store.Get(ctx, conv, mid)
+	if err != nil {
+		return m, err
+	}
+
+	if m.From != uid {
+		return m, ErrNotSender
+	}
+
+	if m.Deleted != nil {
+		return m, ErrMessageDeleted
+	}
+
+	if time.Since(m.Created) > window {
+		return m, errWindow
+	}
+
+	return m, nil
+}
+
+// Brings the conversation of a changed message up to date and sends the message to its recipient, who replaces their copy by id
+func (c *Chat) publishChange(m db.Message) error {
+	if err := c.repo.RecordMessageChange(m); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(c.repo.ToMessageModel(m, AttachmentPath))
+	if err != nil {
+		return err
+	}
+
+	return c.broker.Publish(messageTopic(m.To), raw)
+}
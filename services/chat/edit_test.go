@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+	"github.com/solderneer/axiom-backend/services/blob"
+	"github.com/solderneer/axiom-backend/services/pubsub"
+)
+
+func TestChangeable(t *testing.T) {
+	store := NewMemoryStore()
+	c := &Chat{store: store}
+	conv := db.Conversation{Id: uuid.New()}
+
+	message := func(age time.Duration, deleted bool) string {
+		m := db.Message{Id: uuid.New(), Conversation: conv.Id, From: "s:1", To: "t:1", Kind: "TEXT", Message: "hi", Created: time.Now().Add(-age)}
+		if err := store.Save(context.Background(), m); err != nil {
+			t.Fatalf("Cannot save message: %v", err)
+		}
+
+		if deleted {
+			if _, err := store.Delete(context.Background(), m, time.Now()); err != nil {
+				t.Fatalf("Cannot delete message: %v", err)
+			}
+		}
+
+		return m.Id
+	}
+
+	recent := message(time.Minute, false)
+	halfHour := message(30*time.Minute, false)
+	old := message(2*time.Hour, false)
+	deleted := message(time.Minute, true)
+
+	tests := []struct {
+		name   string
+		uid    string
+		mid    string
+		window time.Duration
+		want   error
+	}{
+		{"Recent", "s:1", recent, editWindow, nil},
+		{"NotSender", "t:1", recent, editWindow, ErrNotSender},
+		{"Missing", "s:1", uuid.New(), editWindow, ErrMessageNotFound},
+		{"Deleted", "s:1", deleted, deleteWindow, ErrMessageDeleted},
+		{"PastEditWindow", "s:1", halfHour, editWindow, ErrEditWindowPassed},
+		{"WithinDeleteWindow", "s:1", halfHour, deleteWindow, nil},
+		{"PastDeleteWindow", "s:1", old, deleteWindow, ErrDeleteWindowPassed},
+	}
+
+	for _, tt := range tests {
+		errWindow := ErrEditWindowPassed
+		if tt.window == deleteWindow {
+			errWindow = ErrDeleteWindowPassed
+		}
+
+		if _, err := c.changeable(context.Background(), conv, tt.uid, tt.mid, tt.window, errWindow); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// Edits keep what the message said before and reach the recipient, and nothing can change a message once deleted
+func TestEditAndDeleteMessage(t *testing.T) {
+	repo := dbtest.Repository(t)
+	c := NewChat(repo, NewMemoryStore(), blob.NewMemoryStore(), pubsub.NewMemoryBroker(1, pubsub.DropPolicy), 0)
+
+	tutor := dbtest.Tutor(t, repo).Id
+	student := dbtest.Student(t, repo).Id
+
+	conv, err := repo.GetOrCreateConversation(tutor, student)
+	if err != nil {
+		t.Fatalf("Cannot create conversation: %v", err)
+	}
+
+	m := db.Message{Id: uuid.New(), Conversation: conv.Id, From: student, To: tutor, Kind: "TEXT", Message: "helo", Created: time.Now().Truncate(time.Microsecond)}
+	if err = c.save(context.Background(), m); err != nil {
+		t.Fatalf("Cannot save message: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	messages, err := c.SubscribeMessages(tutor, done)
+	if err != nil {
+		t.Fatalf("Cannot subscribe: %v", err)
+	}
+
+	if _, err = c.EditMessage(context.Background(), conv, tutor, m.Id, "hello"); err != ErrNotSender {
+		t.Errorf("Editing as the recipient returned %v, want %v", err, ErrNotSender)
+	}
+
+	if _, err = c.EditMessage(context.Background(), conv, student, m.Id, " "); err != ErrEmptyMessage {
+		t.Errorf("Editing to an empty message returned %v, want %v", err, ErrEmptyMessage)
+	}
+
+	edited, err := c.EditMessage(context.Background(), conv, student, m.Id, "hello")
+	if err != nil || edited.Message != "hello" || edited.Edited == nil {
+		t.Fatalf("Got %q edited at %v with error %v", edited.Message, edited.Edited, err)
+	}
+
+	select {
+	case got := <-messages:
+		if got.ID != m.Id || got.Message != "hello" {
+			t.Errorf("Recipient got message %s %q, want %s hello", got.ID, got.Message, m.Id)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Recipient did not get the edited message")
+	}
+
+	edits, err := c.MessageEdits(context.Background(), conv, m.Id)
+	if err != nil || len(edits) != 1 || edits[0].Body != "helo" {
+		t.Errorf("Got edits %v with error %v, want the original text", edits, err)
+	}
+
+	if _, err = c.DeleteMessage(context.Background(), conv, student, m.Id); err != nil {
+		t.Fatalf("Cannot delete message: %v", err)
+	}
+
+	if _, err = c.EditMessage(context.Background(), conv, student, m.Id, "again"); err != ErrMessageDeleted {
+		t.Errorf("Editing a deleted message returned %v, want %v", err, ErrMessageDeleted)
+	}
+
+	if edits, err = c.MessageEdits(context.Background(), conv, m.Id); err != nil || len(edits) != 0 {
+		t.Errorf("Got edits %v with error %v after deleting, want none", edits, err)
+	}
+}
@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	"github.com/pborman/uuid"
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/graph/model"
+)
+
+const defaultInfluxURL = "http://localhost:8086"
+const defaultAuthToken = "user:pass"
+const defaultOrg = "axiom"
+const defaultBucket = "messages"
+
+// Escapes a value to be quoted in a Flux query, including the interpolation of ${}
+var fluxEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+
+// InfluxStore keeps messages as points of the msg measurement in InfluxDB, tagged with their sender and recipient
+// Points have no id or conversation, ids are derived from the sender, recipient and time of each message instead
+type InfluxStore struct {
+	dbClient influxdb2.Client
+	org      string
+	bucket   string
+}
+
+// Initialise an InfluxStore with InfluxDB connection information taken from environment variables.
+func InitInfluxStore() *InfluxStore {
+	influxURL := os.Getenv("INFLUX_URL")
+	if influxURL == "" {
+		influxURL = defaultInfluxURL
+	}
+
+	authToken := os.Getenv("INFLUX_AUTH_TOKEN")
+	if authToken == "" {
+		authToken = defaultAuthToken
+	}
+
+	org := os.Getenv("INFLUX_ORG")
+	if org == "" {
+		org = defaultOrg
+	}
+
+	bucket := os.Getenv("INFLUX_BUCKET")
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+
+	return NewInfluxStore(influxURL, authToken, org, bucket)
+}
+
+// Initialise an InfluxStore with InfluxDB connection information supplied as arguments.
+func NewInfluxStore(influxURL string, authToken string, org string, bucket string) *InfluxStore {
+	return &InfluxStore{
+		dbClient: influxdb2.NewClient(influxURL, authToken),
+		org:      org,
+		bucket:   bucket,
+	}
+}
+
+// Points only have room for text, other kinds of messages are refused
+func (is *InfluxStore) Save(ctx context.Context, m db.Message) error {
+	if m.Kind != string(model.MessageKindText) {
+		return ErrUnsupportedKind
+	}
+
+	msg := influxdb2.NewPointWithMeasurement("msg").AddTag("to", m.To).AddTag("from", m.From).AddField("msg", m.Message).SetTime(m.Created)
+
+	api := is.dbClient.WriteAPIBlocking(is.org, is.bucket)
+	return api.WritePoint(ctx, msg)
+}
+
+// Messages are only told apart by time, so pages continue from strictly before the time of the last message
+func (is *InfluxStore) List(ctx context.Context, conv db.Conversation, afterCreated time.Time, afterId string, limit int) ([]db.Message, error) {
+	if len(conv.Participants) != 2 {
+		return []db.Message{}, nil
+	}
+	a, b := fluxEscaper.Replace(conv.Participants[0].Id), fluxEscaper.Replace(conv.Participants[1].Id)
+
+	stop := "now()"
+	if afterId != "" {
+		stop = afterCreated.UTC().Format(time.RFC3339Nano)
+	}
+
+	// Messages are split into one table per sender and recipient, which have to be merged before sorting
+	query := fmt.Sprintf(`from(bucket:"%s")
+		|> range(start: 0, stop: %s)
+		|> filter(fn: (r) => r._measurement == "msg" and r._field == "msg" and ((r.to == "%s" and r.from == "%s") or (r.to == "%s" and r.from == "%s")))
+		|> group()
+		|> sort(columns: ["_time"], desc: true)
+		|> limit(n: %d)`, fluxEscaper.Replace(is.bucket), stop, a, b, b, a, limit)
+
+	messages := []db.Message{}
+	err := is.query(ctx, query, func(m db.Message) error {
+		m.Conversation = conv.Id
+		messages = append(messages, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Calls fn with every message ever stored, oldest first, without their conversation
+func (is *InfluxStore) Walk(ctx context.Context, fn func(m db.Message) error) error {
+	query := fmt.Sprintf(`from(bucket:"%s")
+		|> range(start: 0)
+		|> filter(fn: (r) => r._measurement == "msg" and r._field == "msg")
+		|> group()
+		|> sort(columns: ["_time"])`, fluxEscaper.Replace(is.bucket))
+
+	return is.query(ctx, query, fn)
+}
+
+// Points cannot be changed, messages kept in InfluxDB are never edited or deleted
+func (is *InfluxStore) Get(ctx context.Context, conv db.Conversation, mid string) (db.Message, error) {
+	return db.Message{}, ErrReadOnlyHistory
+}
+
+func (is *InfluxStore) Edit(ctx context.Context, m db.Message, text string, at time.Time) error {
+	return ErrReadOnlyHistory
+}
+
+func (is *InfluxStore) Delete(ctx context.Context, m db.Message, at time.Time) (*db.MessageAttachment, error) {
+	return nil, ErrReadOnlyHistory
+}
+
+func (is *InfluxStore) Edits(ctx context.Context, m db.Message) ([]db.MessageEdit, error) {
+	return []db.MessageEdit{}, nil
+}
+
+// Old points can still be purged, all at once since InfluxDB does not tell how many there were, so 0 is always returned
+// InfluxDB has nowhere to archive them
+func (is *InfluxStore) Expire(ctx context.Context, before time.Time, archive bool, limit int) (int, []db.MessageAttachment, error) {
+	if archive {
+		return 0, nil, ErrReadOnlyHistory
+	}
+
+	api := is.dbClient.DeleteAPI()
+	return 0, nil, api.DeleteWithName(ctx, is.org, is.bucket, time.Unix(0, 0), before, `_measurement="msg"`)
+}
+
+func (is *InfluxStore) Close() error {
+	is.dbClient.Close()
+	return nil
+}
+
+func (is *InfluxStore) query(ctx context.Context, query string, fn func(m db.Message) error) error {
+	api := is.dbClient.QueryAPI(is.org)
+	res, err := api.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	defer res.Close()
+	for res.Next() {
+		record := res.Record()
+		vals := record.Values()
+
+		m := db.Message{Kind: string(model.MessageKindText), Created: record.Time()}
+		m.To, _ = vals["to"].(string)
+		m.From, _ = vals["from"].(string)
+		m.Message, _ = record.Value().(string)
+		m.Id = InfluxMessageId(m)
+
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return res.Err()
+}
+
+// Derives the id of a message stored in InfluxDB, the same message always gets the same id so that copying history twice does not duplicate it
+func InfluxMessageId(m db.Message) string {
+	return uuid.NewSHA1(uuid.NameSpace_OID, []byte(m.From+"\x00"+m.To+"\x00"+m.Created.UTC().Format(time.RFC3339Nano))).String()
+}
@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// How often buckets which refilled completely are forgotten
+const limiterSweepInterval = 10 * time.Minute
+
+// Limits how many messages each user can send, as a token bucket holding up to a minute worth of messages
+// Buckets live in memory, so every replica of the backend limits users on its own
+type limiter struct {
+	perMinute int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	mux       sync.Mutex
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Creates a limiter letting users send perMinute messages a minute, nobody is limited if it is 0
+func newLimiter(perMinute int) *limiter {
+	return &limiter{perMinute: perMinute, buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+// Takes a token from the bucket of a user, returning false if it is empty
+func (l *limiter) Allow(uid string, now time.Time) bool {
+	if l.perMinute <= 0 {
+		return true
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if now.Sub(l.lastSweep) > limiterSweepInterval {
+		for id, b := range l.buckets {
+			if l.refill(b, now) >= float64(l.perMinute) {
+				delete(l.buckets, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[uid]
+	if !ok {
+		b = &bucket{tokens: float64(l.perMinute), updated: now}
+		l.buckets[uid] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// How many tokens a bucket holds at the time now
+func (l *limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updated).Minutes()*float64(l.perMinute)
+	if tokens > float64(l.perMinute) {
+		tokens = float64(l.perMinute)
+	}
+
+	return tokens
+}
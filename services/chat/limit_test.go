@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		perMinute int
+		sends     []time.Duration
+		want      []bool
+	}{
+		{"Unlimited", 0, []time.Duration{0, 0, 0}, []bool{true, true, true}},
+		{"BurstUpToLimit", 2, []time.Duration{0, 0, 0}, []bool{true, true, false}},
+		{"RefillsOverTime", 2, []time.Duration{0, 0, 0, 30 * time.Second, 30 * time.Second}, []bool{true, true, false, true, false}},
+		{"RefillsUpToLimit", 2, []time.Duration{0, 0, time.Hour, time.Hour, time.Hour}, []bool{true, true, true, true, false}},
+	}
+
+	for _, tt := range tests {
+		l := newLimiter(tt.perMinute)
+		l.lastSweep = start
+
+		for i, offset := range tt.sends {
+			if got := l.Allow("s:1", start.Add(offset)); got != tt.want[i] {
+				t.Errorf("%s: message %d allowed %t, want %t", tt.name, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestLimiterPerUser(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(1)
+
+	if !l.Allow("s:1", now) || l.Allow("s:1", now) {
+		t.Errorf("First user was not limited after a message")
+	}
+
+	if !l.Allow("t:1", now) {
+		t.Errorf("Second user was limited by the messages of the first")
+	}
+}
+
+// Buckets which refilled completely are forgotten, leaving the users with a full bucket
+func TestLimiterSweep(t *testing.T) {
+	start := time.Now()
+	l := newLimiter(2)
+
+	l.Allow("s:1", start)
+	l.Allow("t:1", start.Add(limiterSweepInterval))
+	l.Allow("t:1", start.Add(limiterSweepInterval))
+
+	l.Allow("t:2", start.Add(limiterSweepInterval+time.Second))
+
+	if _, ok := l.buckets["s:1"]; ok {
+		t.Errorf("Refilled bucket was not swept")
+	}
+
+	if _, ok := l.buckets["t:1"]; !ok {
+		t.Errorf("Emptied bucket was swept")
+	}
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/solderneer/axiom-backend/services/scheduler"
+)
+
+// Job kind of the retention job, which runs once per retentionInterval and expires up to retentionBatch messages at a time
+const (
+	retentionJob      = "chat.retention"
+	retentionInterval = 24 * time.Hour
+	retentionBatch    = 1000
+)
+
+// How many days messages are kept for, forever when Days is 0. Expired messages are purged, unless Archive is set in which case they are moved out of chat
+type Retention struct {
+	Days    int
+	Archive bool
+}
+
+// Registers the retention job with the scheduler, running it straight away and then once per retentionInterval unless messages are kept forever
+func (c *Chat) ScheduleRetention(sched *scheduler.Scheduler, retention Retention) error {
+	c.retention = retention
+
+	// A run scheduled before retention was turned off is still handled, but not repeated
+	if retention.Days == 0 {
+		sched.Register(retentionJob, c.handleRetention)
+		return nil
+	}
+
+	return sched.RegisterRecurring(retentionJob, c.handleRetention, 0, retentionInterval)
+}
+
+// Purges or archives the messages sent before a time, returning how many there were
+// Conversations which were quiet since then forget their last message too
+func (c *Chat) Expire(ctx context.Context, before time.Time, archive bool) (int, error) {
+	total := 0
+	for {
+		n, attachments, err := c.store.Expire(ctx, before, archive, retentionBatch)
+		if err != nil {
+			return total, err
+		}
+
+		for _, a := range attachments {
+			c.deleteBlobs(a)
+		}
+
+		total += n
+		if n < retentionBatch {
+			break
+		}
+	}
+
+	return total, c.repo.ExpireConversationSummaries(before)
+}
+
+// Expires the messages older than the retention period. Failures are retried by the scheduler before moving on to the next run
+func (c *Chat) handleRetention(payload []byte) error {
+	if c.retention.Days == 0 {
+		return nil
+	}
+
+	_, err := c.Expire(context.Background(), time.Now().AddDate(0, 0, -c.retention.Days), c.retention.Archive)
+	return err
+}
@@ -0,0 +1,249 @@
+package chat
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+// MessageStore keeps the history of every conversation
+type MessageStore interface {
+	Save(ctx context.Context, m db.Message) error
+	// Gets the messages of a conversation newest first, continuing after the message with the given time and id unless the id is empty
+	List(ctx context.Context, conv db.Conversation, afterCreated time.Time, afterId string, limit int) ([]db.Message, error)
+	// Gets a message of a conversation, ErrMessageNotFound if there is none
+	Get(ctx context.Context, conv db.Conversation, mid string) (db.Message, error)
+	// Replaces the text of a message, keeping the text it replaces in its edit history. ErrMessageDeleted if it was deleted
+	Edit(ctx context.Context, m db.Message, text string, at time.Time) error
+	// Deletes the content and edit history of a message, leaving a tombstone. Returns the attachment the message had, ErrMessageDeleted if it was already deleted
+	Delete(ctx context.Context, m db.Message, at time.Time) (*db.MessageAttachment, error)
+	// Gets the previous versions of a message, oldest first
+	Edits(ctx context.Context, m db.Message) ([]db.MessageEdit, error)
+	// Purges or archives up to limit of the messages sent before a time, returning how many there were and the attachments of purged messages
+	Expire(ctx context.Context, before time.Time, archive bool, limit int) (int, []db.MessageAttachment, error)
+	Close() error
+}
+
+// Stores keeping messages next to their conversations save a message and record it in its conversation at once, see db.RecordMessage
+type recordingStore interface {
+	SaveAndRecord(ctx context.Context, m db.Message) error
+}
+
+// PostgresStore keeps messages in the messages table, next to their conversations
+type PostgresStore struct {
+	repo *db.Repository
+}
+
+// Creates a message store backed by the main database
+func NewPostgresStore(repo *db.Repository) *PostgresStore {
+	return &PostgresStore{repo: repo}
+}
+
+func (ps *PostgresStore) Save(ctx context.Context, m db.Message) error {
+	return ps.repo.CreateMessage(m)
+}
+
+func (ps *PostgresStore) SaveAndRecord(ctx context.Context, m db.Message) error {
+	return ps.repo.CreateRecordedMessage(m)
+}
+
+func (ps *PostgresStore) List(ctx context.Context, conv db.Conversation, afterCreated time.Time, afterId string, limit int) ([]db.Message, error) {
+	return ps.repo.GetConversationMessages(conv.Id, afterCreated, afterId, limit)
+}
+
+func (ps *PostgresStore) Get(ctx context.Context, conv db.Conversation, mid string) (db.Message, error) {
+	m, err := ps.repo.GetMessage(conv.Id, mid)
+	if err == pgx.ErrNoRows {
+		return m, ErrMessageNotFound
+	}
+
+	return m, err
+}
+
+func (ps *PostgresStore) Edit(ctx context.Context, m db.Message, text string, at time.Time) error {
+	edited, err := ps.repo.EditMessage(m.Id, text, at)
+	if err == nil && !edited {
+		return ErrMessageDeleted
+	}
+
+	return err
+}
+
+func (ps *PostgresStore) Delete(ctx context.Context, m db.Message, at time.Time) (*db.MessageAttachment, error) {
+	a, deleted, err := ps.repo.DeleteMessage(m.Id, at)
+	if err == nil && !deleted {
+		return nil, ErrMessageDeleted
+	}
+
+	return a, err
+}
+
+func (ps *PostgresStore) Edits(ctx context.Context, m db.Message) ([]db.MessageEdit, error) {
+	return ps.repo.GetMessageEdits(m.Id)
+}
+
+// Archived messages are moved to the archived_messages table
+func (ps *PostgresStore) Expire(ctx context.Context, before time.Time, archive bool, limit int) (int, []db.MessageAttachment, error) {
+	return ps.repo.ExpireMessages(before, archive, limit)
+}
+
+// The connection pool belongs to the repository, which closes it
+func (ps *PostgresStore) Close() error {
+	return nil
+}
+
+// MemoryStore keeps messages in memory, for tests and local development
+type MemoryStore struct {
+	messages map[string][]db.Message
+	edits    map[string][]db.MessageEdit
+	archived []db.Message
+	mux      sync.RWMutex
+}
+
+// Creates an empty in-memory message store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: map[string][]db.Message{}, edits: map[string][]db.MessageEdit{}}
+}
+
+func (ms *MemoryStore) Save(ctx context.Context, m db.Message) error {
+	ms.mux.Lock()
+	ms.messages[m.Conversation] = append(ms.messages[m.Conversation], m)
+	ms.mux.Unlock()
+
+	return nil
+}
+
+func (ms *MemoryStore) List(ctx context.Context, conv db.Conversation, afterCreated time.Time, afterId string, limit int) ([]db.Message, error) {
+	ms.mux.RLock()
+	messages := append([]db.Message{}, ms.messages[conv.Id]...)
+	ms.mux.RUnlock()
+
+	// Same order as the messages table, newest first and by id within the same time
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].Created.Equal(messages[j].Created) {
+			return messages[i].Created.After(messages[j].Created)
+		}
+		return messages[i].Id < messages[j].Id
+	})
+
+	page := []db.Message{}
+	for _, m := range messages {
+		if afterId != "" && !(m.Created.Before(afterCreated) || (m.Created.Equal(afterCreated) && m.Id > afterId)) {
+			continue
+		}
+
+		if len(page) == limit {
+			break
+		}
+		page = append(page, m)
+	}
+
+	return page, nil
+}
+
+func (ms *MemoryStore) Get(ctx context.Context, conv db.Conversation, mid string) (db.Message, error) {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+
+	for _, m := range ms.messages[conv.Id] {
+		if m.Id == mid {
+			return m, nil
+		}
+	}
+
+	return db.Message{}, ErrMessageNotFound
+}
+
+func (ms *MemoryStore) Edit(ctx context.Context, m db.Message, text string, at time.Time) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	return ms.update(m, func(stored *db.Message) error {
+		if stored.Deleted != nil {
+			return ErrMessageDeleted
+		}
+
+		ms.edits[m.Id] = append(ms.edits[m.Id], db.MessageEdit{Message: m.Id, Body: stored.Message, Edited: at})
+		stored.Message = text
+		stored.Edited = &at
+		return nil
+	})
+}
+
+func (ms *MemoryStore) Delete(ctx context.Context, m db.Message, at time.Time) (*db.MessageAttachment, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	var attachment *db.MessageAttachment
+	err := ms.update(m, func(stored *db.Message) error {
+		if stored.Deleted != nil {
+			return ErrMessageDeleted
+		}
+
+		attachment = stored.Attachment
+		stored.Message, stored.Attachment, stored.Lesson, stored.Deleted = "", nil, "", &at
+		delete(ms.edits, m.Id)
+		return nil
+	})
+
+	return attachment, err
+}
+
+func (ms *MemoryStore) Edits(ctx context.Context, m db.Message) ([]db.MessageEdit, error) {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+
+	return append([]db.MessageEdit{}, ms.edits[m.Id]...), nil
+}
+
+// Archived messages are kept aside in memory
+func (ms *MemoryStore) Expire(ctx context.Context, before time.Time, archive bool, limit int) (int, []db.MessageAttachment, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	expired := 0
+	attachments := []db.MessageAttachment{}
+
+	for cid, messages := range ms.messages {
+		kept := []db.Message{}
+		for _, m := range messages {
+			if expired == limit || !m.Created.Before(before) {
+				kept = append(kept, m)
+				continue
+			}
+
+			expired++
+			delete(ms.edits, m.Id)
+
+			if archive {
+				ms.archived = append(ms.archived, m)
+			} else if m.Attachment != nil {
+				attachments = append(attachments, *m.Attachment)
+			}
+		}
+		ms.messages[cid] = kept
+	}
+
+	return expired, attachments, nil
+}
+
+// Applies a change to the stored copy of a message, the lock has to be held
+func (ms *MemoryStore) update(m db.Message, change func(stored *db.Message) error) error {
+	messages := ms.messages[m.Conversation]
+	for i := range messages {
+		if messages[i].Id == m.Id {
+			return change(&messages[i])
+		}
+	}
+
+	return ErrMessageNotFound
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
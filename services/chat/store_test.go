@@ -0,0 +1,282 @@
+package chat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// Every case starts from an empty pair of conversations between the same tutor and two students
+type storeFixture func(t *testing.T) (store MessageStore, conv db.Conversation, other db.Conversation)
+
+// Long before any real message, so expiring messages in tests leaves everything else alone
+var storeEpoch = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var storeCases = []struct {
+	name string
+	run  func(t *testing.T, store MessageStore, conv db.Conversation, other db.Conversation)
+}{
+	{"ListPagesNewestFirst", testListPagesNewestFirst},
+	{"GetIsScopedToConversation", testGetIsScopedToConversation},
+	{"ExpireInBatches", testExpireInBatches},
+	{"DeletedMessagesStayDeleted", testDeletedMessagesStayDeleted},
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreCases(t, func(t *testing.T) (MessageStore, db.Conversation, db.Conversation) {
+		return NewMemoryStore(), db.Conversation{Id: uuid.New()}, db.Conversation{Id: uuid.New()}
+	})
+}
+
+func TestPostgresStore(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	runStoreCases(t, func(t *testing.T) (MessageStore, db.Conversation, db.Conversation) {
+		tutor := dbtest.Tutor(t, repo)
+
+		conv, err := repo.GetOrCreateConversation(tutor.Id, dbtest.Student(t, repo).Id)
+		if err != nil {
+			t.Fatalf("Cannot create conversation: %v", err)
+		}
+
+		other, err := repo.GetOrCreateConversation(tutor.Id, dbtest.Student(t, repo).Id)
+		if err != nil {
+			t.Fatalf("Cannot create conversation: %v", err)
+		}
+
+		return NewPostgresStore(repo), conv, other
+	})
+}
+
+func runStoreCases(t *testing.T, fixture storeFixture) {
+	for _, c := range storeCases {
+		t.Run(c.name, func(t *testing.T) {
+			store, conv, other := fixture(t)
+			c.run(t, store, conv, other)
+		})
+	}
+}
+
+// Messages are saved in the conversation at the given offsets from storeEpoch, ids sort in the same order as names
+func saveMessages(t *testing.T, store MessageStore, conv db.Conversation, offsets map[string]time.Duration) map[string]db.Message {
+	prefix := uuid.New()[:8]
+	messages := map[string]db.Message{}
+
+	for name, offset := range offsets {
+		m := db.Message{
+			Id:           prefix + "-" + name,
+			Conversation: conv.Id,
+			From:         "sender",
+			To:           "recipient",
+			Kind:         "TEXT",
+			Message:      name,
+			Created:      storeEpoch.Add(offset),
+		}
+
+		if err := store.Save(context.Background(), m); err != nil {
+			t.Fatalf("Cannot save message %s: %v", name, err)
+		}
+		messages[name] = m
+	}
+
+	return messages
+}
+
+// Lists a page, returning the names of its messages
+func listPage(t *testing.T, store MessageStore, conv db.Conversation, after *db.Message, limit int) []string {
+	var afterCreated time.Time
+	var afterId string
+	if after != nil {
+		afterCreated, afterId = after.Created, after.Id
+	}
+
+	page, err := store.List(context.Background(), conv, afterCreated, afterId, limit)
+	if err != nil {
+		t.Fatalf("Cannot list messages: %v", err)
+	}
+
+	names := []string{}
+	for _, m := range page {
+		names = append(names, m.Message)
+	}
+
+	return names
+}
+
+func testListPagesNewestFirst(t *testing.T, store MessageStore, conv db.Conversation, other db.Conversation) {
+	// b and c were sent at the same time, so they are ordered by id
+	messages := saveMessages(t, store, conv, map[string]time.Duration{
+		"a": time.Minute,
+		"b": 2 * time.Minute,
+		"c": 2 * time.Minute,
+		"d": 3 * time.Minute,
+	})
+	saveMessages(t, store, other, map[string]time.Duration{"e": 2 * time.Minute})
+
+	b, c, a := messages["b"], messages["c"], messages["a"]
+
+	pages := []struct {
+		after *db.Message
+		limit int
+		want  []string
+	}{
+		{nil, 10, []string{"d", "b", "c", "a"}},
+		{nil, 2, []string{"d", "b"}},
+		// Continuing from b has to pick up c, which shares its time
+		{&b, 2, []string{"c", "a"}},
+		{&c, 2, []string{"a"}},
+		{&a, 2, []string{}},
+	}
+
+	for i, p := range pages {
+		if got := listPage(t, store, conv, p.after, p.limit); !reflect.DeepEqual(got, p.want) {
+			t.Errorf("Page %d: got %v, want %v", i, got, p.want)
+		}
+	}
+}
+
+func testGetIsScopedToConversation(t *testing.T, store MessageStore, conv db.Conversation, other db.Conversation) {
+	m := saveMessages(t, store, conv, map[string]time.Duration{"a": time.Minute})["a"]
+
+	got, err := store.Get(context.Background(), conv, m.Id)
+	if err != nil {
+		t.Fatalf("Cannot get message: %v", err)
+	}
+
+	if got.Id != m.Id || got.Message != m.Message {
+		t.Errorf("Got message %s %q, want %s %q", got.Id, got.Message, m.Id, m.Message)
+	}
+
+	if _, err = store.Get(context.Background(), other, m.Id); err != ErrMessageNotFound {
+		t.Errorf("Getting the message from another conversation returned %v, want ErrMessageNotFound", err)
+	}
+
+	if _, err = store.Get(context.Background(), conv, m.Id+"-missing"); err != ErrMessageNotFound {
+		t.Errorf("Getting a missing message returned %v, want ErrMessageNotFound", err)
+	}
+}
+
+func testExpireInBatches(t *testing.T, store MessageStore, conv db.Conversation, other db.Conversation) {
+	before := storeEpoch.Add(time.Hour)
+
+	// Clear out messages left behind by earlier runs against the same database
+	for {
+		expired, _, err := store.Expire(context.Background(), before, false, 1000)
+		if err != nil {
+			t.Fatalf("Cannot expire messages: %v", err)
+		}
+
+		if expired == 0 {
+			break
+		}
+	}
+
+	saveMessages(t, store, conv, map[string]time.Duration{
+		"a": time.Minute,
+		"b": 2 * time.Minute,
+		"c": 3 * time.Minute,
+		"z": 2 * time.Hour,
+	})
+	saveMessages(t, store, other, map[string]time.Duration{"d": 4 * time.Minute})
+
+	// Purged attachments are handed back so their content can be removed
+	attached := db.Message{
+		Id:           uuid.New()[:8] + "-e",
+		Conversation: conv.Id,
+		From:         "sender",
+		To:           "recipient",
+		Kind:         "FILE",
+		Created:      storeEpoch.Add(5 * time.Minute),
+	}
+	attached.Attachment = &db.MessageAttachment{
+		Id:           uuid.New(),
+		Message:      attached.Id,
+		Conversation: conv.Id,
+		Name:         "notes.pdf",
+		ContentType:  "application/pdf",
+		Size:         1,
+		StorageKey:   "chat/" + attached.Id,
+		Created:      attached.Created,
+	}
+	if err := store.Save(context.Background(), attached); err != nil {
+		t.Fatalf("Cannot save message: %v", err)
+	}
+
+	var batches []int
+	var attachments []db.MessageAttachment
+
+	for {
+		expired, purged, err := store.Expire(context.Background(), before, false, 2)
+		if err != nil {
+			t.Fatalf("Cannot expire messages: %v", err)
+		}
+
+		batches = append(batches, expired)
+		attachments = append(attachments, purged...)
+
+		if expired == 0 {
+			break
+		}
+	}
+
+	if want := []int{2, 2, 1, 0}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("Expired batches of %v, want %v", batches, want)
+	}
+
+	if len(attachments) != 1 || attachments[0].StorageKey != attached.Attachment.StorageKey {
+		t.Errorf("Got purged attachments %v, want only %s", attachments, attached.Attachment.StorageKey)
+	}
+
+	if got := listPage(t, store, conv, nil, 10); !reflect.DeepEqual(got, []string{"z"}) {
+		t.Errorf("Got %v left after expiring, want [z]", got)
+	}
+
+	if got := listPage(t, store, other, nil, 10); len(got) != 0 {
+		t.Errorf("Got %v left in the other conversation after expiring, want none", got)
+	}
+}
+
+func testDeletedMessagesStayDeleted(t *testing.T, store MessageStore, conv db.Conversation, other db.Conversation) {
+	m := saveMessages(t, store, conv, map[string]time.Duration{"a": time.Minute})["a"]
+
+	if err := store.Edit(context.Background(), m, "first edit", storeEpoch.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Cannot edit message: %v", err)
+	}
+
+	if _, err := store.Delete(context.Background(), m, storeEpoch.Add(3*time.Minute)); err != nil {
+		t.Fatalf("Cannot delete message: %v", err)
+	}
+
+	// An edit which lost the race with the delete must not bring the text or its history back
+	if err := store.Edit(context.Background(), m, "second edit", storeEpoch.Add(4*time.Minute)); err != ErrMessageDeleted {
+		t.Errorf("Editing a deleted message returned %v, want ErrMessageDeleted", err)
+	}
+
+	if _, err := store.Delete(context.Background(), m, storeEpoch.Add(5*time.Minute)); err != ErrMessageDeleted {
+		t.Errorf("Deleting a deleted message returned %v, want ErrMessageDeleted", err)
+	}
+
+	got, err := store.Get(context.Background(), conv, m.Id)
+	if err != nil {
+		t.Fatalf("Cannot get message: %v", err)
+	}
+
+	if got.Message != "" || got.Deleted == nil || !got.Deleted.Equal(storeEpoch.Add(3*time.Minute)) {
+		t.Errorf("Got message %q deleted at %v, want an empty tombstone deleted at %v", got.Message, got.Deleted, storeEpoch.Add(3*time.Minute))
+	}
+
+	edits, err := store.Edits(context.Background(), m)
+	if err != nil {
+		t.Fatalf("Cannot get edits: %v", err)
+	}
+
+	if len(edits) != 0 {
+		t.Errorf("Got %d edits of a deleted message, want none", len(edits))
+	}
+}
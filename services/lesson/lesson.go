@@ -0,0 +1,329 @@
+// Package lesson manages booked lessons, letting their student and tutor move or cancel them within the cancellation policy and share reports, notes and files afterwards
+package lesson
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/affinity"
+	"github.com/solderneer/axiom-backend/services/blob"
+	"github.com/solderneer/axiom-backend/services/notifs"
+	"github.com/solderneer/axiom-backend/services/scheduler"
+)
+
+// The statuses of a lesson, mirrors the LessonStatus enum of the GraphQL schema
+const (
+	Scheduled  = "SCHEDULED"
+	InProgress = "IN_PROGRESS"
+	Completed  = "COMPLETED"
+	Cancelled  = "CANCELLED"
+	NoShow     = "NO_SHOW"
+)
+
+// The statuses of a reschedule request, mirrors the RescheduleStatus enum of the GraphQL schema
+const (
+	ReschedulePending   = "PENDING"
+	RescheduleAccepted  = "ACCEPTED"
+	RescheduleDeclined  = "DECLINED"
+	RescheduleCancelled = "CANCELLED"
+)
+
+// How close to the start of a lesson it may still be changed
+// Cancelling within the cancellation window is allowed but recorded as late, rescheduling within the reschedule window is not allowed at all
+type Policy struct {
+	CancellationWindow time.Duration
+	RescheduleWindow   time.Duration
+}
+
+var (
+	ErrNotFound           = errors.New("No such lesson")
+	ErrRescheduleNotFound = errors.New("No such reschedule request")
+	ErrNotScheduled       = errors.New("Only scheduled lessons can be changed")
+	ErrLessonStarted      = errors.New("Lesson has already started")
+	ErrTooEarly           = errors.New("Lessons can only be started 15 minutes before they are scheduled")
+	ErrTooLate            = errors.New("Lesson starts too soon to be rescheduled, cancel it instead")
+	ErrInvalidRange       = errors.New("Lessons must end after they start, and start in the future")
+	ErrOwnReschedule      = errors.New("Reschedule requests must be answered by the other party of the lesson")
+	ErrRescheduleAnswered = errors.New("Reschedule request was already answered")
+	ErrReasonRequired     = errors.New("Give a reason for cancelling the lesson")
+)
+
+type LessonService struct {
+	logger *log.Logger
+	repo   *db.Repository
+	ns     *notifs.NotifService
+	sched  *scheduler.Scheduler
+	afs    *affinity.AffinityService
+	store  blob.Store
+	policy Policy
+}
+
+// Initialise the lesson service
+func (ls *LessonService) Init(logger *log.Logger, repo *db.Repository, ns *notifs.NotifService, sched *scheduler.Scheduler, afs *affinity.AffinityService, store blob.Store, policy Policy) {
+	ls.logger = logger
+	ls.repo = repo
+	ls.ns = ns
+	ls.sched = sched
+	ls.afs = afs
+	ls.store = store
+	ls.policy = policy
+
+	ls.sched.Register(closeLessonJob, ls.handleCloseLesson)
+
+	ls.logger.WithField("service", "lesson").Info("Successfully initialised")
+}
+
+// Asks the other party of a lesson to move it to another time
+func (ls *LessonService) RequestReschedule(uid string, lid string, startTime time.Time, endTime time.Time) (db.LessonReschedule, error) {
+	var lr db.LessonReschedule
+
+	if !endTime.After(startTime) || !startTime.After(time.Now()) {
+		return lr, ErrInvalidRange
+	}
+
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return lr, err
+	}
+
+	if l.Status != Scheduled {
+		return lr, ErrNotScheduled
+	}
+
+	if time.Until(l.StartTime) < ls.policy.RescheduleWindow {
+		return lr, ErrTooLate
+	}
+
+	lr, err = ls.repo.CreateLessonReschedule(l.Id, uid, startTime, endTime)
+	if err == db.ErrReschedulePending {
+		return lr, err
+	} else if err != nil {
+		ls.sendError(err, "Cannot create lesson reschedule in database")
+		return lr, err
+	}
+
+	ls.notify(otherParty(l, uid), "Reschedule requested", "A new time was proposed for your "+l.Subject.Name+" lesson: "+formatTime(startTime))
+
+	return lr, nil
+}
+
+// Accepts or declines a reschedule request, only the party who did not request it may answer
+func (ls *LessonService) RespondToReschedule(uid string, rid string, accept bool) (db.LessonReschedule, error) {
+	lr, err := ls.repo.GetLessonRescheduleById(rid)
+	if err == pgx.ErrNoRows {
+		return lr, ErrRescheduleNotFound
+	} else if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson reschedule from database")
+		return lr, err
+	}
+
+	if lr.RequestedBy == uid {
+		return lr, ErrOwnReschedule
+	}
+
+	if lr.Status != ReschedulePending {
+		return lr, ErrRescheduleAnswered
+	}
+
+	l, err := ls.lesson(lr.Lesson)
+	if err != nil {
+		return lr, err
+	}
+
+	// The lesson may have come within the reschedule window, or the requested time may have passed, while the request was waiting
+	if accept {
+		if time.Until(l.StartTime) < ls.policy.RescheduleWindow {
+			return lr, ErrTooLate
+		}
+
+		if !lr.StartTime.After(time.Now()) {
+			return lr, ErrInvalidRange
+		}
+	}
+
+	answered, err := ls.repo.RespondToLessonReschedule(lr.Id, accept)
+	if err == db.ErrSlotTaken {
+		return lr, err
+	} else if err != nil {
+		ls.sendError(err, "Cannot respond to lesson reschedule in database")
+		return lr, err
+	}
+
+	if !answered {
+		return lr, ErrRescheduleAnswered
+	}
+
+	if accept {
+		l.StartTime, l.EndTime = lr.StartTime, lr.EndTime
+		ls.Track(l)
+
+		lr.Status = RescheduleAccepted
+		ls.notify(lr.RequestedBy, "Reschedule accepted", "Your "+l.Subject.Name+" lesson has been moved to "+formatTime(l.StartTime))
+	} else {
+		lr.Status = RescheduleDeclined
+		ls.notify(lr.RequestedBy, "Reschedule declined", "Your "+l.Subject.Name+" lesson stays at "+formatTime(l.StartTime))
+	}
+
+	return lr, nil
+}
+
+// Cancels a lesson before it starts. Cancelling within the cancellation window is recorded as a late cancellation
+func (ls *LessonService) Cancel(uid string, lid string, reason string) (db.Lesson, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return db.Lesson{}, ErrReasonRequired
+	}
+
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return l, err
+	}
+
+	if l.Status != Scheduled {
+		return l, ErrNotScheduled
+	}
+
+	if !l.StartTime.After(time.Now()) {
+		return l, ErrLessonStarted
+	}
+
+	late := time.Until(l.StartTime) < ls.policy.CancellationWindow
+
+	if err = ls.cancel(&l, uid, reason, late, nil); err != nil {
+		return l, err
+	}
+
+	ls.notify(otherParty(l, uid), "Lesson cancelled", "Your "+l.Subject.Name+" lesson on "+formatTime(l.StartTime)+" has been cancelled: "+reason)
+
+	return l, nil
+}
+
+// Cancels a scheduled lesson on behalf of Axiom support, whatever the cancellation window, notifying both its student and tutor
+// The audit entry of the admin is written along with the cancellation
+func (ls *LessonService) CancelAsSupport(actor string, lid string, reason string, audit *db.Audit) (db.Lesson, error) {
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return l, err
+	}
+
+	if l.Status != Scheduled {
+		return l, ErrNotScheduled
+	}
+
+	if err = ls.cancel(&l, actor, reason, false, audit); err != nil {
+		return l, err
+	}
+
+	ls.notify(l.Student, "Lesson cancelled", "Your "+l.Subject.Name+" lesson on "+formatTime(l.StartTime)+" has been cancelled by Axiom support")
+	ls.notify(l.Tutor, "Lesson cancelled", "Your "+l.Subject.Name+" lesson on "+formatTime(l.StartTime)+" has been cancelled by Axiom support")
+
+	return l, nil
+}
+
+// Cancels a lesson which is still scheduled, recording the cancellation and withdrawing its pending reschedule and close job
+func (ls *LessonService) cancel(l *db.Lesson, uid string, reason string, late bool, audit *db.Audit) error {
+	cancelled, err := ls.repo.CancelLesson(l.Id, uid, reason, late, audit)
+	if err != nil {
+		ls.sendError(err, "Cannot cancel lesson in database")
+		return err
+	}
+
+	if !cancelled {
+		return ErrNotScheduled
+	}
+
+	l.Status = Cancelled
+
+	if err = ls.sched.Cancel(closeLessonJob, closeLessonPayload{LessonId: l.Id}); err != nil {
+		ls.sendError(err, "Cannot cancel lesson close job")
+	}
+
+	ls.afs.Refresh(l.Tutor, l.Student, l.Subject.Id)
+
+	return nil
+}
+
+// Gets the reschedules requested for a lesson, oldest first
+func (ls *LessonService) Reschedules(lid string) ([]db.LessonReschedule, error) {
+	reschedules, err := ls.repo.GetLessonReschedules(lid)
+	if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson reschedules from database")
+		return nil, err
+	}
+
+	return reschedules, nil
+}
+
+// Gets the cancellation of a lesson, or nil if it was not cancelled by its student or tutor
+func (ls *LessonService) Cancellation(lid string) (*db.LessonCancellation, error) {
+	c, err := ls.repo.GetLessonCancellation(lid)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson cancellation from database")
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (ls *LessonService) lesson(lid string) (db.Lesson, error) {
+	l, err := ls.repo.GetLessonById(lid)
+	if err == pgx.ErrNoRows {
+		return l, ErrNotFound
+	} else if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson from database")
+		return l, err
+	}
+
+	return l, nil
+}
+
+// Tells a student or tutor about a change to their lesson, only logging failures
+func (ls *LessonService) notify(uid string, title string, subtitle string) {
+	n, err := ls.repo.CreateNotification(uid, title, subtitle, "")
+	if err != nil {
+		ls.sendError(err, "Cannot create notification in database")
+		return
+	}
+
+	var token string
+	if s, err := ls.repo.GetStudentById(uid); err == nil {
+		token = s.PushToken
+	} else if t, err := ls.repo.GetTutorById(uid); err == nil {
+		token = t.PushToken
+	} else {
+		ls.sendError(err, "Cannot retrieve push token from database")
+		return
+	}
+
+	if err = ls.ns.SendPushNotification(n, token); err != nil {
+		ls.sendError(err, "Cannot send firebase push notification")
+	}
+}
+
+// The student of a lesson if the user is its tutor, and the other way round
+func otherParty(l db.Lesson, uid string) string {
+	if uid == l.Student {
+		return l.Tutor
+	}
+
+	return l.Student
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("Mon 2 Jan 15:04 MST")
+}
+
+// Making sending errors easier
+func (ls *LessonService) sendError(err error, message string) {
+	ls.logger.WithFields(log.Fields{
+		"service": "lesson",
+		"err":     err.Error(),
+	}).Error(message)
+}
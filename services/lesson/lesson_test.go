@@ -0,0 +1,199 @@
+package lesson
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+	"github.com/solderneer/axiom-backend/services/affinity"
+	"github.com/solderneer/axiom-backend/services/blob"
+	"github.com/solderneer/axiom-backend/services/notifs"
+	"github.com/solderneer/axiom-backend/services/pubsub"
+	"github.com/solderneer/axiom-backend/services/scheduler"
+)
+
+// Lessons may be moved up to two hours before they start, and cancelled without penalty up to a day before
+var testPolicy = Policy{CancellationWindow: 24 * time.Hour, RescheduleWindow: 2 * time.Hour}
+
+// Wires a lesson service to the test database, with firebase replaced by a server accepting every push notification
+func newTestService(t *testing.T) (*LessonService, *db.Repository) {
+	repo := dbtest.Repository(t)
+
+	fcm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "projects/test/messages/1"}`))
+	}))
+	t.Cleanup(fcm.Close)
+
+	if os.Getenv("GOOGLE_CLOUD_PROJECT") == "" {
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test")
+		t.Cleanup(func() { os.Unsetenv("GOOGLE_CLOUD_PROJECT") })
+	}
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	var sched scheduler.Scheduler
+	var ns notifs.NotifService
+	var afs affinity.AffinityService
+	var ls LessonService
+
+	sched.Init(logger, repo, nil)
+	ns.Init(logger, pubsub.NewMemoryBroker(1, pubsub.DropPolicy), option.WithEndpoint(fcm.URL), option.WithoutAuthentication())
+	afs.Init(logger, repo, &sched, 24*time.Hour)
+	ls.Init(logger, repo, &ns, &sched, &afs, blob.NewMemoryStore(), testPolicy)
+
+	return &ls, repo
+}
+
+// Books a lesson of an hour starting after the given delay
+func lessonIn(t *testing.T, repo *db.Repository, delay time.Duration) db.Lesson {
+	start := time.Now().Add(delay)
+
+	l, err := repo.CreateLesson(dbtest.Subject(t, repo), dbtest.Tutor(t, repo).Id, dbtest.Student(t, repo).Id, true, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Cannot create lesson: %v", err)
+	}
+
+	return l
+}
+
+func TestOtherParty(t *testing.T) {
+	l := db.Lesson{Student: "s:1", Tutor: "t:1"}
+
+	if got := otherParty(l, "s:1"); got != "t:1" {
+		t.Errorf("Other party of the student is %s", got)
+	}
+
+	if got := otherParty(l, "t:1"); got != "s:1" {
+		t.Errorf("Other party of the tutor is %s", got)
+	}
+}
+
+func TestRescheduleWindow(t *testing.T) {
+	ls, repo := newTestService(t)
+
+	later := time.Now().Add(48 * time.Hour)
+
+	soon := lessonIn(t, repo, time.Hour)
+	if _, err := ls.RequestReschedule(soon.Student, soon.Id, later, later.Add(time.Hour)); err != ErrTooLate {
+		t.Errorf("Request within the reschedule window got %v, want %v", err, ErrTooLate)
+	}
+
+	l := lessonIn(t, repo, 3*time.Hour)
+	if _, err := ls.RequestReschedule(l.Student, l.Id, later, later.Add(-time.Hour)); err != ErrInvalidRange {
+		t.Errorf("Backwards request got %v, want %v", err, ErrInvalidRange)
+	}
+
+	lr, err := ls.RequestReschedule(l.Student, l.Id, later, later.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Cannot request reschedule: %v", err)
+	}
+
+	if _, err = ls.RespondToReschedule(l.Student, lr.Id, true); err != ErrOwnReschedule {
+		t.Errorf("Answering own request got %v, want %v", err, ErrOwnReschedule)
+	}
+
+	if lr, err = ls.RespondToReschedule(l.Tutor, lr.Id, true); err != nil {
+		t.Fatalf("Cannot accept reschedule: %v", err)
+	}
+
+	if lr.Status != RescheduleAccepted {
+		t.Errorf("Reschedule is %s, want %s", lr.Status, RescheduleAccepted)
+	}
+
+	moved, err := repo.GetLessonById(l.Id)
+	if err != nil {
+		t.Fatalf("Cannot get lesson: %v", err)
+	}
+
+	if !moved.StartTime.Equal(lr.StartTime) || !moved.EndTime.Equal(lr.EndTime) {
+		t.Errorf("Lesson is at %v, want %v", moved.StartTime, lr.StartTime)
+	}
+
+	if _, err = ls.RespondToReschedule(l.Tutor, lr.Id, false); err != ErrRescheduleAnswered {
+		t.Errorf("Answering again got %v, want %v", err, ErrRescheduleAnswered)
+	}
+}
+
+// A request made in time can no longer be accepted once the lesson comes within the reschedule window, but can still be declined
+func TestRescheduleWindowClosesWhileWaiting(t *testing.T) {
+	ls, repo := newTestService(t)
+
+	later := time.Now().Add(48 * time.Hour)
+	l := lessonIn(t, repo, time.Hour)
+
+	// Made directly, as if the request had been sent before the window closed
+	lr, err := repo.CreateLessonReschedule(l.Id, l.Student, later, later.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Cannot create reschedule: %v", err)
+	}
+
+	if _, err = ls.RespondToReschedule(l.Tutor, lr.Id, true); err != ErrTooLate {
+		t.Errorf("Accepting within the reschedule window got %v, want %v", err, ErrTooLate)
+	}
+
+	unmoved, err := repo.GetLessonById(l.Id)
+	if err != nil {
+		t.Fatalf("Cannot get lesson: %v", err)
+	}
+
+	if !unmoved.StartTime.Equal(l.StartTime) {
+		t.Errorf("Lesson was moved to %v", unmoved.StartTime)
+	}
+
+	if lr, err = ls.RespondToReschedule(l.Tutor, lr.Id, false); err != nil || lr.Status != RescheduleDeclined {
+		t.Errorf("Declining got %s with error %v", lr.Status, err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ls, repo := newTestService(t)
+
+	tests := []struct {
+		name  string
+		delay time.Duration
+		late  bool
+	}{
+		{"within the cancellation window", time.Hour, true},
+		{"before the cancellation window", 48 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		l := lessonIn(t, repo, tt.delay)
+
+		if _, err := ls.Cancel(l.Student, l.Id, "  "); err != ErrReasonRequired {
+			t.Errorf("%s: cancelling without a reason got %v, want %v", tt.name, err, ErrReasonRequired)
+		}
+
+		cancelled, err := ls.Cancel(l.Student, l.Id, "Feeling unwell")
+		if err != nil {
+			t.Fatalf("%s: cannot cancel lesson: %v", tt.name, err)
+		}
+
+		if cancelled.Status != Cancelled {
+			t.Errorf("%s: lesson is %s, want %s", tt.name, cancelled.Status, Cancelled)
+		}
+
+		c, err := ls.Cancellation(l.Id)
+		if err != nil || c == nil {
+			t.Fatalf("%s: got cancellation %v with error %v", tt.name, c, err)
+		}
+
+		if c.Late != tt.late || c.CancelledBy != l.Student {
+			t.Errorf("%s: got late %v by %s, want late %v by %s", tt.name, c.Late, c.CancelledBy, tt.late, l.Student)
+		}
+
+		if _, err = ls.Cancel(l.Tutor, l.Id, "Also unwell"); err != ErrNotScheduled {
+			t.Errorf("%s: cancelling twice got %v, want %v", tt.name, err, ErrNotScheduled)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package lesson
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/video"
+)
+
+// Job kinds handled by the lesson service
+const closeLessonJob = "lesson.close"
+
+// How long before the start of a lesson its video room may be opened
+const roomLead = 15 * time.Minute
+
+// How long after the end of a lesson it is closed, if its room was not closed before then
+const closeGrace = 15 * time.Minute
+
+type closeLessonPayload struct {
+	LessonId string `json:"lessonId"`
+}
+
+// The video room of a lesson along with every connection made to it
+type Attendance struct {
+	Room     db.LessonRoom
+	Sessions []db.LessonAttendance
+}
+
+// Checks that the video room of a lesson may be opened or joined, cancelled and finished lessons cannot be
+func (ls *LessonService) OpenRoom(lid string) error {
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return err
+	}
+
+	if l.Status != Scheduled && l.Status != InProgress {
+		return ErrNotScheduled
+	}
+
+	if time.Until(l.StartTime) > roomLead {
+		return ErrTooEarly
+	}
+
+	return nil
+}
+
+// Records the video room created for a lesson
+func (ls *LessonService) RoomCreated(lid string, roomSid string) error {
+	if err := ls.repo.RecordLessonRoom(lid, roomSid); err != nil {
+		ls.sendError(err, "Cannot record lesson room in database")
+		return err
+	}
+
+	return nil
+}
+
+// Records that a student or tutor was issued an access token for the room of a lesson
+func (ls *LessonService) TokenIssued(lid string, uid string) error {
+	if err := ls.repo.RecordLessonToken(lid, uid); err != nil {
+		ls.sendError(err, "Cannot record lesson token in database")
+		return err
+	}
+
+	return nil
+}
+
+// Closes a lesson once its room was ended by one of its participants. Lessons which never started are left to be closed after they were due to end
+func (ls *LessonService) End(lid string) error {
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return err
+	}
+
+	if l.Status != InProgress {
+		return nil
+	}
+
+	return ls.finish(l, time.Now())
+}
+
+// Updates the lifecycle of a lesson from an event of its video room
+func (ls *LessonService) HandleRoomEvent(e video.RoomEvent) error {
+	// Rooms are named after their lesson, events of rooms which are not, such as those made while testing, are ignored
+	l, err := ls.lesson(e.RoomName)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	switch e.Event {
+	case video.RoomCreated:
+		return ls.RoomCreated(l.Id, e.RoomSID)
+	case video.ParticipantConnected:
+		if _, err := ls.repo.RecordParticipantJoined(l.Id, e.ParticipantIdentity, e.ParticipantSID, e.Timestamp); err != nil {
+			ls.sendError(err, "Cannot record participant joining in database")
+			return err
+		}
+	case video.ParticipantDisconnected:
+		if err := ls.repo.RecordParticipantLeft(e.ParticipantSID, e.Timestamp); err != nil {
+			ls.sendError(err, "Cannot record participant leaving in database")
+			return err
+		}
+	case video.RoomEnded:
+		if l.Status == InProgress {
+			return ls.finish(l, e.Timestamp)
+		}
+	}
+
+	return nil
+}
+
+// Handles the Twilio status callbacks of video rooms
+func (ls *LessonService) RoomEventHandler(vc *video.VideoClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, err := vc.ParseRoomEvent(r)
+		if err == video.ErrInvalidSignature {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(w, "Malformed status callback", http.StatusBadRequest)
+			return
+		}
+
+		if err = ls.HandleRoomEvent(e); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Gets the video room of a lesson along with every connection made to it
+func (ls *LessonService) Attendance(lid string) (Attendance, error) {
+	var a Attendance
+
+	room, err := ls.repo.GetLessonRoom(lid)
+	if err != nil && err != pgx.ErrNoRows {
+		ls.sendError(err, "Cannot retrieve lesson room from database")
+		return a, err
+	}
+	a.Room = room
+
+	if a.Sessions, err = ls.repo.GetLessonAttendance(lid); err != nil {
+		ls.sendError(err, "Cannot retrieve lesson attendance from database")
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Schedules a lesson to be closed shortly after it is due to end, replacing the job of its previous time, only logging failures
+// The affinity of its student and tutor is refreshed too, booking again after a completed lesson counts towards it
+func (ls *LessonService) Track(l db.Lesson) {
+	ls.afs.Refresh(l.Tutor, l.Student, l.Subject.Id)
+
+	p := closeLessonPayload{LessonId: l.Id}
+
+	if err := ls.sched.Cancel(closeLessonJob, p); err != nil {
+		ls.sendError(err, "Cannot cancel lesson close job")
+	}
+
+	if _, err := ls.sched.Schedule(closeLessonJob, p, l.EndTime.Add(closeGrace)); err != nil {
+		ls.sendError(err, "Cannot schedule lesson close job")
+	}
+}
+
+// Closes lessons whose room was never ended, either because nobody joined or because the room-ended callback never arrived
+func (ls *LessonService) handleCloseLesson(payload []byte) error {
+	var p closeLessonPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	l, err := ls.lesson(p.LessonId)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if l.Status != Scheduled && l.Status != InProgress {
+		return nil
+	}
+
+	// The lesson was moved later since this job was scheduled
+	if due := l.EndTime.Add(closeGrace); time.Now().Before(due) {
+		_, err = ls.sched.Schedule(closeLessonJob, p, due)
+		return err
+	}
+
+	return ls.finish(l, time.Now())
+}
+
+// Closes a lesson, it is completed if both its student and tutor joined and a no-show otherwise
+func (ls *LessonService) finish(l db.Lesson, ended time.Time) error {
+	attendance, err := ls.repo.GetLessonAttendance(l.Id)
+	if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson attendance from database")
+		return err
+	}
+
+	// Another callback or the close job may have finished the lesson first, which is fine
+	finished, err := ls.repo.FinishLesson(l.Id, l.Status, finishedStatus(l, attendance), ended)
+	if err != nil {
+		ls.sendError(err, "Cannot finish lesson in database")
+		return err
+	}
+
+	if finished {
+		ls.afs.Refresh(l.Tutor, l.Student, l.Subject.Id)
+	}
+
+	return nil
+}
+
+// A lesson is completed if both its student and tutor joined its room, and a no-show otherwise
+func finishedStatus(l db.Lesson, attendance []db.LessonAttendance) string {
+	joined := map[string]bool{}
+	for _, a := range attendance {
+		joined[a.Participant] = true
+	}
+
+	if joined[l.Student] && joined[l.Tutor] {
+		return Completed
+	}
+
+	return NoShow
+}
@@ -0,0 +1,35 @@
+package lesson
+
+import (
+	"testing"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+func TestFinishedStatus(t *testing.T) {
+	l := db.Lesson{Student: "student", Tutor: "tutor"}
+
+	tests := []struct {
+		name         string
+		participants []string
+		want         string
+	}{
+		{"nobody joined", nil, NoShow},
+		{"only the student joined", []string{"student"}, NoShow},
+		{"only the tutor joined", []string{"tutor", "tutor"}, NoShow},
+		{"both joined", []string{"tutor", "student"}, Completed},
+		{"both joined, one reconnecting", []string{"student", "tutor", "student"}, Completed},
+		{"someone else joined", []string{"student", "stranger"}, NoShow},
+	}
+
+	for _, tt := range tests {
+		var attendance []db.LessonAttendance
+		for _, p := range tt.participants {
+			attendance = append(attendance, db.LessonAttendance{Participant: p})
+		}
+
+		if got := finishedStatus(l, attendance); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package lesson
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4"
+	"github.com/pborman/uuid"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/policy"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+// Where the content of lesson attachments is served from, followed by the id of the attachment
+const AttachmentPath = "/lessons/attachments/"
+
+// Limits on the files shared on a single lesson
+const (
+	maxAttachmentSize = 20 << 20
+	maxAttachments    = 20
+)
+
+var (
+	ErrNotCompleted         = errors.New("Reports can only be written for completed lessons")
+	ErrNoReport             = errors.New("Write a report for this lesson before publishing it")
+	ErrSummaryRequired      = errors.New("Give a summary of the lesson")
+	ErrNoteRequired         = errors.New("Notes cannot be empty")
+	ErrAttachmentNotFound   = errors.New("No such attachment")
+	ErrAttachmentTooLarge   = errors.New("Attachments must be smaller than 20MB")
+	ErrTooManyAttachments   = errors.New("Lessons can have at most 20 attachments")
+	ErrNotUploader          = errors.New("Attachments can only be removed by whoever uploaded them")
+	ErrAttachmentsCancelled = errors.New("Cancelled lessons cannot have attachments")
+)
+
+// Writes or updates the report of a completed lesson. A published report stays published, its student sees the changes straight away
+func (ls *LessonService) WriteReport(tid string, lid string, topics []string, summary string, homework string, followUp string) (db.LessonReport, error) {
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return db.LessonReport{}, ErrSummaryRequired
+	}
+
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return db.LessonReport{}, err
+	}
+
+	if l.Status != Completed {
+		return db.LessonReport{}, ErrNotCompleted
+	}
+
+	trimmed := []string{}
+	for _, topic := range topics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			trimmed = append(trimmed, topic)
+		}
+	}
+
+	rep, err := ls.repo.SaveLessonReport(l.Id, tid, trimmed, summary, strings.TrimSpace(homework), strings.TrimSpace(followUp))
+	if err != nil {
+		ls.sendError(err, "Cannot save lesson report in database")
+		return rep, err
+	}
+
+	return rep, nil
+}
+
+// Publishes the report of a lesson to its student, who is only notified the first time it is published
+func (ls *LessonService) PublishReport(lid string) (db.LessonReport, error) {
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return db.LessonReport{}, err
+	}
+
+	rep, first, err := ls.repo.PublishLessonReport(l.Id)
+	if err == pgx.ErrNoRows {
+		return rep, ErrNoReport
+	} else if err != nil {
+		ls.sendError(err, "Cannot publish lesson report in database")
+		return rep, err
+	}
+
+	if first {
+		ls.notify(l.Student, "Lesson summary published", "Your tutor has written up your "+l.Subject.Name+" lesson on "+formatTime(l.StartTime))
+	}
+
+	return rep, nil
+}
+
+// Gets the report of a lesson as seen by a user, or nil if there is none. Students only see published reports
+func (ls *LessonService) Report(uid string, lid string) (*db.LessonReport, error) {
+	rep, err := ls.repo.GetLessonReport(lid)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson report from database")
+		return nil, err
+	}
+
+	if role, _ := auth.RoleFromId(uid); rep.Published == nil && role == auth.RoleStudent {
+		return nil, nil
+	}
+
+	return &rep, nil
+}
+
+// Adds a private note to a lesson, only its author will see it
+func (ls *LessonService) AddNote(uid string, lid string, body string) (db.LessonNote, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return db.LessonNote{}, ErrNoteRequired
+	}
+
+	n, err := ls.repo.CreateLessonNote(lid, uid, body)
+	if err != nil {
+		ls.sendError(err, "Cannot create lesson note in database")
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Removes a private note from a lesson
+func (ls *LessonService) RemoveNote(nid string) error {
+	if err := ls.repo.DeleteLessonNote(nid); err != nil {
+		ls.sendError(err, "Cannot delete lesson note from database")
+		return err
+	}
+
+	return nil
+}
+
+// Gets the notes a user kept on a lesson, oldest first
+func (ls *LessonService) Notes(uid string, lid string) ([]db.LessonNote, error) {
+	notes, err := ls.repo.GetLessonNotes(lid, uid)
+	if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson notes from database")
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// Shares a file on a lesson, its content is written to the blob store before the attachment is recorded
+func (ls *LessonService) AddAttachment(uid string, lid string, name string, contentType string, size int64, content io.Reader) (db.LessonAttachment, error) {
+	var a db.LessonAttachment
+
+	if size > maxAttachmentSize {
+		return a, ErrAttachmentTooLarge
+	}
+
+	l, err := ls.lesson(lid)
+	if err != nil {
+		return a, err
+	}
+
+	if l.Status == Cancelled {
+		return a, ErrAttachmentsCancelled
+	}
+
+	attachments, err := ls.repo.GetLessonAttachments(l.Id)
+	if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson attachments from database")
+		return a, err
+	}
+
+	if len(attachments) >= maxAttachments {
+		return a, ErrTooManyAttachments
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	name = path.Base(strings.TrimSpace(name))
+	if name == "." || name == "/" {
+		name = "attachment"
+	}
+
+	a = db.LessonAttachment{Id: uuid.New(), Lesson: l.Id, UploadedBy: uid, Name: name, ContentType: contentType, Size: size}
+	a.StorageKey = "lessons/" + a.Lesson + "/" + a.Id
+
+	// Never store more than was declared, the declared size is what was checked against the limit
+	if err = ls.store.Put(a.StorageKey, io.LimitReader(content, size)); err != nil {
+		ls.sendError(err, "Cannot write lesson attachment to blob store")
+		return a, err
+	}
+
+	if a, err = ls.repo.CreateLessonAttachment(a); err != nil {
+		ls.sendError(err, "Cannot create lesson attachment in database")
+		ls.deleteBlob(a.StorageKey)
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Removes a file from a lesson, only whoever uploaded it may do so
+func (ls *LessonService) RemoveAttachment(uid string, aid string) error {
+	a, err := ls.attachment(aid)
+	if err != nil {
+		return err
+	}
+
+	if role, _ := auth.RoleFromId(uid); a.UploadedBy != uid && role != auth.RoleAdmin {
+		return ErrNotUploader
+	}
+
+	if err = ls.repo.DeleteLessonAttachment(a.Id); err != nil {
+		ls.sendError(err, "Cannot delete lesson attachment from database")
+		return err
+	}
+
+	ls.deleteBlob(a.StorageKey)
+
+	return nil
+}
+
+// Gets the files shared on a lesson, oldest first
+func (ls *LessonService) Attachments(lid string) ([]db.LessonAttachment, error) {
+	attachments, err := ls.repo.GetLessonAttachments(lid)
+	if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson attachments from database")
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Serves the content of lesson attachments to the student and tutor of their lesson
+func (ls *LessonService) AttachmentHandler(ps *policy.PolicyService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := auth.PrincipalFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		aid := mux.Vars(r)["id"]
+
+		owns, err := ps.Owns(p, policy.LessonAttachmentResource, aid)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		} else if !owns {
+			http.Error(w, ErrAttachmentNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		a, err := ls.attachment(aid)
+		if err == ErrAttachmentNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		content, err := ls.store.Open(a.StorageKey)
+		if err != nil {
+			ls.sendError(err, "Cannot read lesson attachment from blob store")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		defer content.Close()
+
+		// Always download rather than display attachments, so uploaded html cannot run on this origin
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if _, err = io.Copy(w, content); err != nil {
+			ls.sendError(err, "Cannot send lesson attachment")
+		}
+	})
+}
+
+func (ls *LessonService) attachment(aid string) (db.LessonAttachment, error) {
+	a, err := ls.repo.GetLessonAttachmentById(aid)
+	if err == pgx.ErrNoRows {
+		return a, ErrAttachmentNotFound
+	} else if err != nil {
+		ls.sendError(err, "Cannot retrieve lesson attachment from database")
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Removes the content of an attachment from the blob store, only logging failures
+func (ls *LessonService) deleteBlob(key string) {
+	if err := ls.store.Delete(key); err != nil {
+		ls.sendError(err, "Cannot delete lesson attachment from blob store")
+	}
+}
@@ -0,0 +1,105 @@
+package lesson
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reports can only be written once a lesson is completed, and students only see them once published
+func TestReports(t *testing.T) {
+	ls, repo := newTestService(t)
+	l := lessonIn(t, repo, -2*time.Hour)
+
+	if _, err := ls.WriteReport(l.Tutor, l.Id, nil, "Covered integration", "", ""); err != ErrNotCompleted {
+		t.Errorf("Report of a scheduled lesson got %v, want %v", err, ErrNotCompleted)
+	}
+
+	if _, err := repo.FinishLesson(l.Id, Scheduled, Completed, time.Now()); err != nil {
+		t.Fatalf("Cannot finish lesson: %v", err)
+	}
+
+	if _, err := ls.WriteReport(l.Tutor, l.Id, nil, "   ", "", ""); err != ErrSummaryRequired {
+		t.Errorf("Report without a summary got %v, want %v", err, ErrSummaryRequired)
+	}
+
+	if _, err := ls.PublishReport(l.Id); err != ErrNoReport {
+		t.Errorf("Publishing without a report got %v, want %v", err, ErrNoReport)
+	}
+
+	rep, err := ls.WriteReport(l.Tutor, l.Id, []string{" Integration ", "", "Limits"}, " Covered integration ", " Exercise 3 ", "")
+	if err != nil {
+		t.Fatalf("Cannot write report: %v", err)
+	}
+
+	if len(rep.Topics) != 2 || rep.Topics[0] != "Integration" || rep.Summary != "Covered integration" || rep.Homework != "Exercise 3" {
+		t.Errorf("Report was not trimmed: %+v", rep)
+	}
+
+	if got, err := ls.Report(l.Student, l.Id); err != nil || got != nil {
+		t.Errorf("Student saw unpublished report %v with error %v", got, err)
+	}
+
+	if got, err := ls.Report(l.Tutor, l.Id); err != nil || got == nil {
+		t.Errorf("Tutor got report %v with error %v", got, err)
+	}
+
+	if _, err = ls.PublishReport(l.Id); err != nil {
+		t.Fatalf("Cannot publish report: %v", err)
+	}
+
+	if got, err := ls.Report(l.Student, l.Id); err != nil || got == nil {
+		t.Errorf("Student got published report %v with error %v", got, err)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	ls, repo := newTestService(t)
+	l := lessonIn(t, repo, 24*time.Hour)
+
+	if _, err := ls.AddAttachment(l.Student, l.Id, "big.pdf", "application/pdf", maxAttachmentSize+1, strings.NewReader("")); err != ErrAttachmentTooLarge {
+		t.Errorf("Large attachment got %v, want %v", err, ErrAttachmentTooLarge)
+	}
+
+	// Only the declared size is stored, and the name cannot point anywhere else
+	a, err := ls.AddAttachment(l.Student, l.Id, "../../notes.txt", "", 5, strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatalf("Cannot add attachment: %v", err)
+	}
+
+	if a.Name != "notes.txt" || a.ContentType != "application/octet-stream" {
+		t.Errorf("Got name %q and content type %q", a.Name, a.ContentType)
+	}
+
+	r, err := ls.store.Open(a.StorageKey)
+	if err != nil {
+		t.Fatalf("Cannot open attachment: %v", err)
+	}
+	content, _ := ioutil.ReadAll(r)
+	r.Close()
+
+	if string(content) != "hello" {
+		t.Errorf("Stored %q, want hello", content)
+	}
+
+	if err = ls.RemoveAttachment(l.Tutor, a.Id); err != ErrNotUploader {
+		t.Errorf("Removing someone else's attachment got %v, want %v", err, ErrNotUploader)
+	}
+
+	if err = ls.RemoveAttachment(l.Student, a.Id); err != nil {
+		t.Fatalf("Cannot remove attachment: %v", err)
+	}
+
+	if _, err = ls.store.Open(a.StorageKey); err == nil {
+		t.Error("Content of a removed attachment was kept")
+	}
+
+	if _, err = ls.Cancel(l.Student, l.Id, "Moving house"); err != nil {
+		t.Fatalf("Cannot cancel lesson: %v", err)
+	}
+
+	if _, err = ls.AddAttachment(l.Student, l.Id, "notes.txt", "text/plain", 5, strings.NewReader("hello")); err != ErrAttachmentsCancelled {
+		t.Errorf("Attachment on a cancelled lesson got %v, want %v", err, ErrAttachmentsCancelled)
+	}
+}
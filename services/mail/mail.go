@@ -0,0 +1,119 @@
+// Package mail sends transactional emails through a pluggable Mailer
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// A plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(m Message) error
+}
+
+// SMTPMailer delivers emails through an SMTP server using PLAIN auth
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// Creates a new SMTP mailer, from is the sender address of every email
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	return &SMTPMailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+func (sm *SMTPMailer) Send(m Message) error {
+	var a smtp.Auth
+	if sm.username != "" {
+		a = smtp.PlainAuth("", sm.username, sm.password, sm.host)
+	}
+
+	return smtp.SendMail(sm.host+":"+sm.port, a, sm.from, []string{m.To}, format(sm.from, m))
+}
+
+// FileMailer writes every email as a .eml file into a directory, for local development
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// Creates a new file mailer writing to dir, the directory is created if needed
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (fm *FileMailer) Send(m Message) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), uuid.New())
+	return ioutil.WriteFile(filepath.Join(fm.dir, name), format(fm.from, m), 0644)
+}
+
+// MemoryMailer keeps every email in memory, for tests
+type MemoryMailer struct {
+	sent []Message
+	mux  sync.Mutex
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (mm *MemoryMailer) Send(m Message) error {
+	mm.mux.Lock()
+	mm.sent = append(mm.sent, m)
+	mm.mux.Unlock()
+
+	return nil
+}
+
+// Returns a copy of every email sent so far
+func (mm *MemoryMailer) Sent() []Message {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	sent := make([]Message, len(mm.sent))
+	copy(sent, mm.sent)
+	return sent
+}
+
+// Formats a message as an RFC 822 email
+func format(from string, m Message) []byte {
+	var b strings.Builder
+
+	b.WriteString("From: " + header(from) + "\r\n")
+	b.WriteString("To: " + header(m.To) + "\r\n")
+	b.WriteString("Subject: " + header(m.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(m.Body)
+
+	return []byte(b.String())
+}
+
+// Strips line breaks from header values, so user input cannot inject extra headers
+func header(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
@@ -0,0 +1,80 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatStripsHeaderInjection(t *testing.T) {
+	raw := string(format("axiom@example.com", Message{
+		To:      "student@example.com\r\nBcc: everyone@example.com",
+		Subject: "Hello\nX-Injected: yes",
+		Body:    "Line one\r\nLine two",
+	}))
+
+	headers := strings.SplitN(raw, "\r\n\r\n", 2)
+	if len(headers) != 2 {
+		t.Fatalf("No blank line between headers and body in %q", raw)
+	}
+
+	if strings.Contains(headers[0], "\nBcc:") || strings.Contains(headers[0], "\nX-Injected:") {
+		t.Errorf("Injected a header: %q", headers[0])
+	}
+
+	if !strings.Contains(headers[0], "To: student@example.comBcc: everyone@example.com\r\n") {
+		t.Errorf("Recipient was not kept on one line: %q", headers[0])
+	}
+
+	if headers[1] != "Line one\r\nLine two" {
+		t.Errorf("Body changed to %q", headers[1])
+	}
+}
+
+func TestMemoryMailerReturnsCopies(t *testing.T) {
+	mm := NewMemoryMailer()
+	mm.Send(Message{To: "a@example.com"})
+
+	sent := mm.Sent()
+	sent[0].To = "changed@example.com"
+
+	if got := mm.Sent(); len(got) != 1 || got[0].To != "a@example.com" {
+		t.Errorf("Got %+v", got)
+	}
+}
+
+func TestFileMailerWritesEmails(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// The directory is created by the mailer
+	dir := filepath.Join(tmp, "mail")
+
+	fm, err := NewFileMailer(dir, "axiom@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fm.Send(Message{To: "a@example.com", Subject: "Hi", Body: "Body"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Got %v files with error %v, want 1", files, err)
+	}
+
+	raw, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(raw), "From: axiom@example.com\r\nTo: a@example.com\r\nSubject: Hi\r\n") {
+		t.Errorf("Unexpected email %q", raw)
+	}
+}
@@ -0,0 +1,168 @@
+package match
+
+import (
+	"sort"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/affinity"
+)
+
+// How a ranking fared when replaying past matches
+// TopOne is the share of groups in which the tutor ranked first accepted, TopBatch the share in which a tutor ranked within the first on-demand batch did
+// MRR is the mean reciprocal rank of the first accepting tutor, over the groups in which one accepted
+type Evaluation struct {
+	Name     string
+	Groups   int
+	Accepted int
+	TopOne   float64
+	TopBatch float64
+	MRR      float64
+}
+
+// Tutors offered the same match, either on demand in the same session or for the same scheduled slot
+type offerGroup struct {
+	student  string
+	subject  string
+	at       time.Time
+	tutors   []string
+	accepted map[string]bool
+}
+
+// Replays the matches decided since a time, ranking the tutors offered each time with every ranker, and measures how often the tutors ranked highest accepted
+// Only tutors who were actually offered a match can be ranked, so rankings are compared on who accepted among them rather than on who would have
+// Affinity and ratings are rewound to the time of each match, so rankings are not credited with what was only learnt from it
+func Evaluate(repo *db.Repository, rankers map[string]Ranker, since time.Time) ([]Evaluation, error) {
+	matches, err := repo.GetDecidedMatches(since)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluations := map[string]*Evaluation{}
+	for name := range rankers {
+		evaluations[name] = &Evaluation{Name: name}
+	}
+
+	for _, g := range groupOffers(matches) {
+		candidates, err := pastCandidates(repo, g)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := request(repo, g.student, g.subject, g.at, candidates)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, ranker := range rankers {
+			evaluations[name].add(rank(ranker, req, g.tutors, candidates), g.accepted)
+		}
+	}
+
+	results := []Evaluation{}
+	for _, e := range evaluations {
+		results = append(results, e.finish())
+	}
+
+	// Best first, ties by name so that runs are comparable
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].TopOne != results[j].TopOne {
+			return results[i].TopOne > results[j].TopOne
+		}
+		return results[i].Name < results[j].Name
+	})
+
+	return results, nil
+}
+
+// Gets the candidates offered a group as they were at the time of its match, with the affinity they had then
+func pastCandidates(repo *db.Repository, g offerGroup) ([]db.MatchCandidate, error) {
+	candidates, err := repo.GetPastMatchCandidates(g.tutors, g.at, g.at.Add(-loadWindow), g.at.Add(-responseWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range candidates {
+		outcomes, err := repo.GetLessonOutcomes(c.Tutor, g.student, g.subject)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates[i].Affinity = affinity.Score(c.Tutor, g.student, g.subject, affinity.AsOf(outcomes, g.at), g.at).Score
+	}
+
+	return candidates, nil
+}
+
+// Counts how a ranking of a group fared, given which tutors accepted
+func (e *Evaluation) add(ranked []string, accepted map[string]bool) {
+	e.Groups++
+
+	for i, tid := range ranked {
+		if !accepted[tid] {
+			continue
+		}
+
+		if i == 0 {
+			e.TopOne++
+		}
+		if i < onDemandParallelOffers {
+			e.TopBatch++
+		}
+		e.MRR += 1 / float64(i+1)
+		e.Accepted++
+		break
+	}
+}
+
+// Turns the counts of every group added into shares and means
+func (e Evaluation) finish() Evaluation {
+	if e.Groups > 0 {
+		e.TopOne /= float64(e.Groups)
+		e.TopBatch /= float64(e.Groups)
+	}
+	if e.Accepted > 0 {
+		e.MRR /= float64(e.Accepted)
+	}
+
+	return e
+}
+
+// Groups decided matches by what was offered together, keeping only groups with a choice between several tutors
+// Matches must be ordered by token, student, subject and period, see GetDecidedMatches
+func groupOffers(matches []db.Match) []offerGroup {
+	var groups []offerGroup
+	var current *offerGroup
+	var currentKey string
+
+	for _, m := range matches {
+		// On-demand sessions have their own token, scheduled matches all share one and are told apart by their slot
+		key := m.Token
+		if m.Scheduled {
+			key += "/" + m.Student + "/" + m.Subject + "/" + m.StartTime.String()
+		}
+
+		if current == nil || key != currentKey {
+			groups = append(groups, offerGroup{student: m.Student, subject: m.Subject, at: m.StartTime, accepted: map[string]bool{}})
+			current = &groups[len(groups)-1]
+			currentKey = key
+		}
+
+		if m.Status == "MATCHED" {
+			current.accepted[m.Tutor] = true
+		}
+
+		if len(dedupe(current.tutors, []string{m.Tutor})) > 0 {
+			current.tutors = append(current.tutors, m.Tutor)
+		}
+	}
+
+	choices := []offerGroup{}
+	for _, g := range groups {
+		if len(g.tutors) > 1 {
+			choices = append(choices, g)
+		}
+	}
+
+	return choices
+}
@@ -0,0 +1,100 @@
+package match
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+func TestGroupOffers(t *testing.T) {
+	at := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	match := func(token string, scheduled bool, student string, start time.Time, tutor string, status string) db.Match {
+		return db.Match{Token: token, Scheduled: scheduled, Student: student, Subject: "maths", Tutor: tutor, Status: status, StartTime: start}
+	}
+
+	matches := []db.Match{
+		// An on-demand session offered to three tutors, the second accepted
+		match("a", false, "s1", at, "t1", "FAILED"),
+		match("a", false, "s1", at, "t2", "MATCHED"),
+		match("a", false, "s1", at, "t3", "FAILED"),
+		// A session offered to a single tutor gives no choice to rank
+		match("b", false, "s2", at, "t1", "MATCHED"),
+		// Scheduled matches share a token and are told apart by student and slot
+		match("SCHEDULED", true, "s1", at, "t1", "FAILED"),
+		match("SCHEDULED", true, "s1", at, "t2", "FAILED"),
+		match("SCHEDULED", true, "s1", at.Add(time.Hour), "t3", "MATCHED"),
+		match("SCHEDULED", true, "s2", at.Add(time.Hour), "t1", "FAILED"),
+		match("SCHEDULED", true, "s2", at.Add(time.Hour), "t1", "MATCHED"),
+	}
+
+	want := []offerGroup{
+		{student: "s1", subject: "maths", at: at, tutors: []string{"t1", "t2", "t3"}, accepted: map[string]bool{"t2": true}},
+		{student: "s1", subject: "maths", at: at, tutors: []string{"t1", "t2"}, accepted: map[string]bool{}},
+	}
+
+	if got := groupOffers(matches); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got groups %+v, want %+v", got, want)
+	}
+}
+
+func TestEvaluationMetrics(t *testing.T) {
+	cases := []struct {
+		name     string
+		rankings [][]string
+		accepted []map[string]bool
+		want     Evaluation
+	}{
+		{
+			name:     "NoGroups",
+			rankings: nil,
+			accepted: nil,
+			want:     Evaluation{},
+		},
+		{
+			name:     "FirstAccepted",
+			rankings: [][]string{{"a", "b"}},
+			accepted: []map[string]bool{{"a": true}},
+			want:     Evaluation{Groups: 1, Accepted: 1, TopOne: 1, TopBatch: 1, MRR: 1},
+		},
+		{
+			name:     "OnlyTheFirstAcceptingTutorCounts",
+			rankings: [][]string{{"a", "b", "c"}},
+			accepted: []map[string]bool{{"b": true, "c": true}},
+			want:     Evaluation{Groups: 1, Accepted: 1, TopOne: 0, TopBatch: 1, MRR: 0.5},
+		},
+		{
+			name:     "AcceptedOutsideTheFirstBatch",
+			rankings: [][]string{{"a", "b", "c", "d"}, {"e", "f"}},
+			accepted: []map[string]bool{{"d": true}, {"e": true}},
+			want:     Evaluation{Groups: 2, Accepted: 2, TopOne: 0.5, TopBatch: 0.5, MRR: (0.25 + 1) / 2},
+		},
+		{
+			name:     "NobodyAccepted",
+			rankings: [][]string{{"a", "b"}, {"c", "d"}},
+			accepted: []map[string]bool{{}, {"d": true}},
+			want:     Evaluation{Groups: 2, Accepted: 1, TopOne: 0, TopBatch: 0.5, MRR: 0.5},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var e Evaluation
+			for i, ranked := range c.rankings {
+				e.add(ranked, c.accepted[i])
+			}
+
+			got := e.finish()
+			if got.Groups != c.want.Groups || got.Accepted != c.want.Accepted || !near(got.TopOne, c.want.TopOne) || !near(got.TopBatch, c.want.TopBatch) || !near(got.MRR, c.want.MRR) {
+				t.Errorf("Got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -1,36 +1,72 @@
-// Package match contains all the matching logic, including sorting affinity and fetching random tutors
+// Package match contains all the matching logic, from collecting candidate tutors to ranking them with pluggable strategies
 package match
 
 import (
+	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/jackc/pgx/v4"
-	"github.com/pborman/uuid"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/solderneer/axiom-backend/db"
 	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/lesson"
 	"github.com/solderneer/axiom-backend/services/notifs"
+	"github.com/solderneer/axiom-backend/services/scheduler"
 )
 
+// Job kinds handled by the match service
+const (
+	expireScheduledMatchJob = "match.expire_scheduled"
+	onDemandTimeoutJob      = "match.ondemand_timeout"
+)
+
+// How long a scheduled match request stays open before it expires
+const scheduledMatchExpiry = 24 * time.Hour
+
+// How long tutors get to respond to an on-demand offer, and how many tutors are offered to at once
+const onDemandOfferTimeout = 30 * time.Second
+const onDemandParallelOffers = 3
+
+// How many tutors the student never had a lesson with are sampled as candidates before ranking
+const candidatePool = 100
+
+type matchJobPayload struct {
+	MatchId string `json:"matchId"`
+}
+
+type onDemandJobPayload struct {
+	Token string `json:"token"`
+	Round int    `json:"round"`
+}
+
 type MatchService struct {
 	logger *log.Logger
 
-	ns   *notifs.NotifService
-	repo *db.Repository
+	ns     *notifs.NotifService
+	repo   *db.Repository
+	sched  *scheduler.Scheduler
+	ls     *lesson.LessonService
+	ranker Ranker
 }
 
 // Inititialise the matching service
-func (ms *MatchService) Init(logger *log.Logger, ns *notifs.NotifService, repo *db.Repository) {
+func (ms *MatchService) Init(logger *log.Logger, ns *notifs.NotifService, repo *db.Repository, sched *scheduler.Scheduler, ls *lesson.LessonService, ranker Ranker) {
 	ms.logger = logger
 	ms.ns = ns
 	ms.repo = repo
+	ms.sched = sched
+	ms.ls = ls
+	ms.ranker = ranker
+
+	ms.sched.Register(expireScheduledMatchJob, ms.handleExpireScheduledMatch)
+	ms.sched.Register(onDemandTimeoutJob, ms.handleOnDemandTimeout)
 
 	ms.logger.WithField("service", "match").Info("Successfully initialised")
 }
 
-// Retrieves top scheduled matches based on availability
+// Retrieves top scheduled matches based on availability, best first according to the ranker of the service
 // Takes in a student, subject, start and end times, plus a limit integer of how many matches to return
 func (ms *MatchService) MatchScheduled(s db.Student, subject db.Subject, startTime time.Time, endTime time.Time, limit int) ([]string, error) {
 	affinitytids, err := ms.repo.GetAvailableTutors(s.Id, subject.Id, startTime, endTime)
@@ -39,13 +75,32 @@ func (ms *MatchService) MatchScheduled(s db.Student, subject db.Subject, startTi
 		return nil, err
 	}
 
-	var availabletids []string
-	var count int
+	// Tutors the student never had a lesson with are only sampled, so that ranking stays cheap
+	randomtids, err := ms.repo.GetRandomAvailableTutors(subject.Id, startTime, endTime, candidatePool)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve random available tutors")
+		return nil, err
+	}
+
+	tids := append(affinitytids, dedupe(affinitytids, randomtids)...)
 
-	// Filter affinity Ids
-	for _, tid := range affinitytids {
+	// Check for the edge case where no tutors are available
+	if len(tids) == 0 {
+		ms.logger.Error("Cannot find ANY random available tutors")
+		return nil, errors.New("No tutors available for that timeslot")
+	}
 
-		if count >= limit {
+	ranked, err := Rank(ms.repo, ms.ranker, s.Id, subject.Id, tids, time.Now())
+	if err != nil {
+		ms.sendError(err, "Cannot rank available tutors")
+		return nil, err
+	}
+
+	var availabletids []string
+
+	// Filter out tutors who were booked in the meantime
+	for _, tid := range ranked {
+		if len(availabletids) >= limit {
 			break
 		}
 
@@ -57,40 +112,6 @@ func (ms *MatchService) MatchScheduled(s db.Student, subject db.Subject, startTi
 
 		if available {
 			availabletids = append(availabletids, tid)
-			count++
-		}
-	}
-
-	// Fetch more random tutors if there aren't enough affinity matches. Current BATCH_SIZE = 100
-	for len(availabletids) < limit {
-		randomtids, err := ms.repo.GetRandomAvailableTutors(subject.Id, startTime, endTime, 100)
-		if err != nil {
-			ms.sendError(err, "Cannot retrieve random available tutors")
-			return nil, err
-		}
-
-		// Check for the edge case where no tutors are available
-		if len(randomtids) == 0 {
-			ms.logger.Error("Cannot find ANY random available tutors")
-			return nil, errors.New("No tutors available for that timeslot")
-		}
-
-		for _, tid := range randomtids {
-
-			if count >= limit {
-				break
-			}
-
-			available, err := ms.repo.CheckTutorAvailability(tid, startTime, endTime)
-			if err != nil {
-				ms.sendError(err, "Cannot check tutor availability")
-				continue
-			}
-
-			if available {
-				availabletids = append(availabletids, tid)
-				count++
-			}
 		}
 	}
 
@@ -100,7 +121,7 @@ func (ms *MatchService) MatchScheduled(s db.Student, subject db.Subject, startTi
 // Requests a scheduled match from a specific tutor, typically after a tutor lits is retrieved using MatchScheduled
 func (ms *MatchService) RequestScheduledMatch(s db.Student, t db.Tutor, subject db.Subject, startTime time.Time, endTime time.Time) (db.Match, error) {
 	// Create the match
-	m, err := ms.repo.CreateMatch("SCHEDULED", "MATCHING", false, s.Id, t.Id, subject.Id, startTime, endTime)
+	m, err := ms.repo.CreateMatch("SCHEDULED", "MATCHING", true, s.Id, t.Id, subject.Id, startTime, endTime)
 	if err != nil {
 		ms.sendError(err, "Cannot create match in database")
 		return m, err
@@ -119,37 +140,87 @@ func (ms *MatchService) RequestScheduledMatch(s db.Student, t db.Tutor, subject
 		return m, err
 	}
 
-	// Handles expiring after one day
-	go func() {
-		time.Sleep(time.Hour * 24)
+	// Handles expiring after one day, durably so that it survives restarts
+	_, err = ms.sched.ScheduleIn(expireScheduledMatchJob, matchJobPayload{MatchId: m.Id}, scheduledMatchExpiry)
+	if err != nil {
+		ms.sendError(err, "Cannot schedule match expiry")
+		return m, err
+	}
 
-		// Send failure push nnotification
-		n, err := ms.repo.CreateNotification(s.Id, "Match failed", "Your scheduled match with "+t.FirstName+" has expired", "")
-		if err != nil {
-			ms.sendError(err, "Cannot create notification in database")
-			return
-		}
+	return m, nil
+}
 
-		err = ms.ns.SendPushNotification(n, s.PushToken)
-		if err != nil {
-			ms.sendError(err, "Cannot send firebase push notification")
-			return
-		}
+// Scheduler job handler which fails a scheduled match that was never accepted, and informs the student
+func (ms *MatchService) handleExpireScheduledMatch(payload []byte) error {
+	var p matchJobPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
 
-		// Update match status
-		m.Status = "FAILED"
-		err = ms.repo.UpdateMatch(m)
-		if err != nil {
-			ms.sendError(err, "Cannot update match in database")
-			return
-		}
-	}()
+	// Only expire matches that are still pending, the tutor might have accepted in the meantime
+	expired, err := ms.repo.ExpireMatch(p.MatchId, nil)
+	if err != nil {
+		ms.sendError(err, "Cannot update match in database")
+		return err
+	}
 
-	return m, nil
+	if !expired {
+		return nil
+	}
+
+	m, err := ms.repo.GetMatchById(p.MatchId)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve match from database")
+		return nil
+	}
+
+	s, err := ms.repo.GetStudentById(m.Student)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve student from database")
+		return nil
+	}
+
+	t, err := ms.repo.GetTutorById(m.Tutor)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve tutor from database")
+		return nil
+	}
+
+	// The match has already been failed at this point, so notification errors are logged and not retried
+	n, err := ms.repo.CreateNotification(s.Id, "Match failed", "Your scheduled match with "+t.FirstName+" has expired", "")
+	if err != nil {
+		ms.sendError(err, "Cannot create notification in database")
+		return nil
+	}
+
+	err = ms.ns.SendPushNotification(n, s.PushToken)
+	if err != nil {
+		ms.sendError(err, "Cannot send firebase push notification")
+	}
+
+	return nil
 }
 
 // Lets a tutor accept a scheduled match request
 func (ms *MatchService) AcceptScheduledMatch(mid string, t db.Tutor) (db.Lesson, error) {
+	return ms.acceptScheduledMatch(mid, t, nil)
+}
+
+// Lets a tutor accept an on-demand match. When offered to several tutors at once, the first to accept wins
+func (ms *MatchService) AcceptOnDemandMatch(id string, t db.Tutor) (db.Lesson, error) {
+	return ms.acceptOnDemandMatch(id, t, nil)
+}
+
+// Accepts a match on behalf of its tutor, writing the audit entry of the admin along with the accept
+func (ms *MatchService) AcceptAsSupport(m db.Match, t db.Tutor, audit *db.Audit) (db.Lesson, error) {
+	if m.Scheduled {
+		return ms.acceptScheduledMatch(m.Id, t, audit)
+	}
+
+	return ms.acceptOnDemandMatch(m.Id, t, audit)
+}
+
+func (ms *MatchService) acceptScheduledMatch(mid string, t db.Tutor, audit *db.Audit) (db.Lesson, error) {
 	var l db.Lesson
 
 	m, err := ms.repo.GetMatchById(mid)
@@ -164,6 +235,10 @@ func (ms *MatchService) AcceptScheduledMatch(mid string, t db.Tutor) (db.Lesson,
 		return l, errors.New("Unauthorised to access match")
 	}
 
+	if m.Status != "MATCHING" {
+		return l, errors.New("Expired match")
+	}
+
 	// Fetch the subject
 	sub, err := ms.repo.GetSubjectById(m.Subject)
 	if err != nil {
@@ -171,22 +246,21 @@ func (ms *MatchService) AcceptScheduledMatch(mid string, t db.Tutor) (db.Lesson,
 		return l, err
 	}
 
-	// Create the lesson
-	l, err = ms.repo.CreateLesson(sub, m.Tutor, m.Student, true, m.StartTime, m.EndTime)
-	if err != nil {
-		ms.sendError(err, "Cannot create lesson in database")
+	// Claim the match and book its lesson together, the database rejects the lesson if the tutor or student was booked for the same time in the meantime
+	l, accepted, err := ms.repo.AcceptMatch(m, sub, audit)
+	if err == db.ErrSlotTaken {
+		return l, err
+	} else if err != nil {
+		ms.sendError(err, "Cannot accept match in database")
 		return l, err
 	}
 
-	// Update match status
-	m.Status = "MATCHED"
-	m.Lesson = l.Id
-	err = ms.repo.UpdateMatch(m)
-	if err != nil {
-		ms.sendError(err, "Cannot update match in database")
-		return l, err
+	if !accepted {
+		return l, errors.New("Expired match")
 	}
 
+	ms.ls.Track(l)
+
 	// Send push notification to student
 	s, err := ms.repo.GetStudentById(m.Student)
 	if err != nil {
@@ -209,82 +283,152 @@ func (ms *MatchService) AcceptScheduledMatch(mid string, t db.Tutor) (db.Lesson,
 	return l, err
 }
 
-// Collects top students, ordered by affinity, send match notifications to each of them (timeout 20 seconds), once a match is found set match Id to a created lesson
-// Retrieves all the top  matches for on demand. Limit integer defines how many matches to generate
+// Collects top tutors, best first according to the ranker of the service, into a persisted on-demand match session and offers the first batch
+// Offers to a batch of tutors time out after onDemandOfferTimeout, after which the durable timer moves on to the next batch
+// Returns the session token, limit integer defines how many tutors to consider in total
 func (ms *MatchService) MatchOnDemand(s db.Student, subject db.Subject, limit int) (string, error) {
-	// Generate match token
-	token := uuid.New()
+	tids, err := ms.repo.GetOnlineAffinityMatches(s.Id, subject.Id, candidatePool)
+	if err != nil {
+		ms.sendError(err, "Error retrieving database matches")
+		return "", err
+	}
+
+	rtids, err := ms.repo.GetOnlineRandomMatches(subject.Id, candidatePool)
+	if err != nil {
+		ms.sendError(err, "Error retrieving database matches")
+		return "", err
+	}
+	tids = append(tids, dedupe(tids, rtids)...)
+
+	if tids, err = Rank(ms.repo, ms.ranker, s.Id, subject.Id, tids, time.Now()); err != nil {
+		ms.sendError(err, "Cannot rank online tutors")
+		return "", err
+	}
+
+	if len(tids) > limit {
+		tids = tids[:limit]
+	}
 
-	go func() {
-		tids, err := ms.repo.GetOnlineAffinityMatches(s.Id, subject.Id, limit)
+	session, err := ms.repo.CreateMatchSession(s.Id, subject.Id, tids, onDemandParallelOffers)
+	if err != nil {
+		ms.sendError(err, "Cannot create match session in database")
+		return "", err
+	}
+
+	if err = ms.offerNextBatch(session); err != nil {
+		return "", err
+	}
+
+	return session.Token, nil
+}
+
+// Offers the session to the next batch of candidate tutors and arms the timeout for that round
+// If there are no candidates left, the session is marked EXHAUSTED and the student is informed
+func (ms *MatchService) offerNextBatch(session db.MatchSession) error {
+	if session.Offered >= len(session.Candidates) {
+		exhausted, err := ms.repo.TransitionMatchSession(session.Token, []string{"SEARCHING", "OFFERED"}, "EXHAUSTED")
 		if err != nil {
-			ms.sendError(err, "Error retrieving database matches")
-			return
+			ms.sendError(err, "Cannot update match session in database")
+			return err
 		}
 
-		if len(tids) < limit {
-			rtids, err := ms.repo.GetOnlineRandomMatches(subject.Id, limit-len(tids))
-			if err != nil {
-				ms.sendError(err, "Error retrieving database matches")
-				return
-			}
-			tids = append(tids, rtids...)
+		if exhausted {
+			ms.ns.SendMatchStatus(model.MatchStatusUpdate{Token: session.Token, Status: model.MatchSessionStatusExhausted})
+			ms.notifyStudent(session.Student, "Match failed", "There are no tutors available right now, please try again later")
 		}
 
-		mstudent := ms.repo.ToStudentModel(s)
-		msubject := ms.repo.ToSubjectModel(subject)
+		return nil
+	}
 
-		for _, tid := range tids {
-			// Creating the match
-			m, err := ms.repo.CreateMatch(token, "MATCHING", false, s.Id, tid, subject.Id, time.Now(), time.Now().Add(time.Second*30))
-			if err != nil {
-				m.Status = "FAILED"
-				ms.sendError(err, "Error retrieving database match")
+	end := session.Offered + session.Parallel
+	if end > len(session.Candidates) {
+		end = len(session.Candidates)
+	}
+	batch := session.Candidates[session.Offered:end]
 
-				err := ms.repo.UpdateMatch(m)
-				ms.sendError(err, "Updating match to failed")
-				return
-			}
+	// Claims the round first, so duplicated timers cannot offer the same batch twice
+	advanced, err := ms.repo.AdvanceMatchSession(session.Token, session.Round, end)
+	if err != nil {
+		ms.sendError(err, "Cannot update match session in database")
+		return err
+	}
 
-			n := model.MatchNotification{
-				Student: &mstudent,
-				Subject: &msubject,
-				Token:   m.Id,
-			}
+	if !advanced {
+		return nil
+	}
 
-			ms.ns.SendMatchNotification(n, tid)
-			time.Sleep(time.Duration(30) * time.Second)
+	s, err := ms.repo.GetStudentById(session.Student)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve student from database")
+		return err
+	}
 
-			// Go and check the match queue for a match
-			latestMatch, err := ms.repo.GetMatchById(m.Id)
-			if err != nil {
-				m.Status = "FAILED"
-				ms.sendError(err, "Error retrieving database match")
+	subject, err := ms.repo.GetSubjectById(session.Subject)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve subject from database")
+		return err
+	}
 
-				err := ms.repo.UpdateMatch(m)
-				ms.sendError(err, "Updating match to failed")
-				return
-			}
+	mstudent := ms.repo.ToStudentModel(s)
+	msubject := ms.repo.ToSubjectModel(subject)
 
-			if latestMatch.Status == "MATCHED" {
-				// Stop looping
-				return
-			}
-			// No matches found at the moment
-			m.Status = "FAILED"
-			err = ms.repo.UpdateMatch(m)
-			if err != nil {
-				ms.sendError(err, "Cannot update database match")
-				return
-			}
+	now := time.Now()
+	offered := 0
+	for _, tid := range batch {
+		m, err := ms.repo.CreateMatch(session.Token, "MATCHING", false, s.Id, tid, subject.Id, now, now.Add(onDemandOfferTimeout))
+		if err != nil {
+			ms.sendError(err, "Cannot create match in database")
+			continue
+		}
+		offered++
+
+		n := model.MatchNotification{
+			Student: &mstudent,
+			Subject: &msubject,
+			Token:   m.Id,
 		}
-	}()
 
-	return token, nil
+		ms.ns.SendMatchNotification(n, tid)
+	}
+
+	ms.ns.SendMatchStatus(model.MatchStatusUpdate{Token: session.Token, Status: model.MatchSessionStatusOffered, OfferedTo: offered})
+
+	payload := onDemandJobPayload{Token: session.Token, Round: session.Round + 1}
+	if _, err = ms.sched.ScheduleIn(onDemandTimeoutJob, payload, onDemandOfferTimeout); err != nil {
+		ms.sendError(err, "Cannot schedule on-demand offer timeout")
+		return err
+	}
+
+	return nil
 }
 
-// Lets a tutor accept an on-demand match
-func (ms *MatchService) AcceptOnDemandMatch(id string, t db.Tutor) (db.Lesson, error) {
+// Scheduler job handler which withdraws the unanswered offers of a round and moves the session on to the next batch
+func (ms *MatchService) handleOnDemandTimeout(payload []byte) error {
+	var p onDemandJobPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	session, err := ms.repo.GetMatchSession(p.Token)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve match session from database")
+		return err
+	}
+
+	// The session was accepted, cancelled or already moved on since this timer was armed
+	if session.Status != "OFFERED" || session.Round != p.Round {
+		return nil
+	}
+
+	if _, err = ms.repo.FailPendingMatches(session.Token, db.ResponseIgnored); err != nil {
+		ms.sendError(err, "Cannot update matches in database")
+		return err
+	}
+
+	return ms.offerNextBatch(session)
+}
+
+func (ms *MatchService) acceptOnDemandMatch(id string, t db.Tutor, audit *db.Audit) (db.Lesson, error) {
 	var l db.Lesson
 
 	// Fetching the match
@@ -299,10 +443,6 @@ func (ms *MatchService) AcceptOnDemandMatch(id string, t db.Tutor) (db.Lesson, e
 		return l, errors.New("Unauthorised tutor accessing match")
 	}
 
-	if m.Status != "MATCHING" {
-		return l, errors.New("Expired match")
-	}
-
 	// Fetch the match subject
 	sub, err := ms.repo.GetSubjectById(m.Subject)
 	if err != nil {
@@ -310,24 +450,202 @@ func (ms *MatchService) AcceptOnDemandMatch(id string, t db.Tutor) (db.Lesson, e
 		return l, err
 	}
 
-	l, err = ms.repo.CreateLesson(sub, t.Id, m.Student, false, time.Now(), time.Now().Add(15*time.Minute))
-	if err != nil {
-		ms.sendError(err, "Unable to create lesson in database")
+	// The lesson is booked along with the accept, so a lesson that cannot be booked leaves the session open
+	l, accepted, err := ms.repo.AcceptMatchSession(m, sub, time.Now(), time.Now().Add(15*time.Minute), audit)
+	if err == db.ErrSlotTaken {
+		// The tutor or student was booked in the meantime, so drop this offer and let the session carry on without it
+		// Errors moving the session on are already logged, the tutor still needs to hear the slot was taken
+		if _, werr := ms.repo.WithdrawMatch(m.Id); werr != nil {
+			ms.sendError(werr, "Unable to withdraw match")
+		} else {
+			ms.continueSession(m.Token)
+		}
+
 		return l, err
+	} else if err != nil {
+		ms.sendError(err, "Unable to accept match session")
+		return l, err
+	}
+
+	if !accepted {
+		return l, errors.New("Expired match")
 	}
 
-	// Updating match queue
-	m.Lesson = l.Id
-	m.Status = "MATCHED"
-	err = ms.repo.UpdateMatch(m)
+	ms.ls.Track(l)
+
+	// Withdraw the offers made to the other tutors in the same round
+	if _, err = ms.repo.FailPendingMatches(m.Token, db.ResponseWithdrawn); err != nil {
+		ms.sendError(err, "Unable to update matches")
+	}
+
+	ml, err := ms.repo.ToLessonModel(l)
 	if err != nil {
-		ms.sendError(err, "Unable to update match status")
-		return l, err
+		ms.sendError(err, "Unable to convert lesson")
+		return l, nil
 	}
+	ms.ns.SendMatchStatus(model.MatchStatusUpdate{Token: m.Token, Status: model.MatchSessionStatusMatched, Lesson: &ml})
 
 	return l, nil
 }
 
+// Gets how a tutor responds to the matches offered to them, and until when they are ranked last for ignoring offers
+func (ms *MatchService) ResponseStats(tid string) (db.TutorResponseStats, *time.Time, error) {
+	s, err := ms.repo.GetTutorResponseStats(tid)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve tutor response stats from database")
+		return s, nil, err
+	}
+
+	return s, DeprioritisedUntil(s.ConsecutiveIgnored, s.LastIgnored, time.Now()), nil
+}
+
+// Lets a tutor decline a match offered to them, instead of leaving the student waiting for the offer to time out
+// Scheduled matches fail straight away, on-demand sessions move on to the next batch once every offer of the round was declined
+func (ms *MatchService) DeclineMatch(mid string, t db.Tutor) error {
+	m, err := ms.repo.GetMatchById(mid)
+	if err == pgx.ErrNoRows {
+		return errors.New("No match found")
+	} else if err != nil {
+		ms.sendError(err, "Unable to retrieve match")
+		return err
+	}
+
+	if m.Tutor != t.Id {
+		return errors.New("Unauthorised to access match")
+	}
+
+	declined, err := ms.repo.DeclineMatch(m.Id)
+	if err != nil {
+		ms.sendError(err, "Unable to decline match")
+		return err
+	}
+
+	if !declined {
+		return errors.New("Expired match")
+	}
+
+	if m.Scheduled {
+		if err = ms.sched.Cancel(expireScheduledMatchJob, matchJobPayload{MatchId: m.Id}); err != nil {
+			ms.sendError(err, "Cannot cancel match expiry")
+		}
+
+		ms.notifyStudent(m.Student, "Match declined", t.FirstName+" cannot take your scheduled lesson, please choose another tutor")
+		return nil
+	}
+
+	return ms.continueSession(m.Token)
+}
+
+// Offers an on-demand session to the next batch of tutors once no offer of the current round is left waiting
+func (ms *MatchService) continueSession(token string) error {
+	pending, err := ms.repo.CountPendingMatches(token)
+	if err != nil {
+		ms.sendError(err, "Unable to count pending matches")
+		return err
+	}
+
+	if pending > 0 {
+		return nil
+	}
+
+	session, err := ms.repo.GetMatchSession(token)
+	if err != nil {
+		ms.sendError(err, "Unable to retrieve match session")
+		return err
+	}
+
+	// The round already timed out, or the session was cancelled in the meantime
+	if session.Status != "OFFERED" {
+		return nil
+	}
+
+	return ms.offerNextBatch(session)
+}
+
+// Lets a student cancel an on-demand match session that has not been accepted yet
+func (ms *MatchService) CancelOnDemandMatch(s db.Student, token string) error {
+	session, err := ms.repo.GetMatchSession(token)
+	if err == pgx.ErrNoRows {
+		return errors.New("No match found")
+	} else if err != nil {
+		ms.sendError(err, "Unable to retrieve match session")
+		return err
+	}
+
+	if session.Student != s.Id {
+		return errors.New("Unauthorised to access match")
+	}
+
+	cancelled, err := ms.repo.TransitionMatchSession(token, []string{"SEARCHING", "OFFERED"}, "CANCELLED")
+	if err != nil {
+		ms.sendError(err, "Unable to cancel match session")
+		return err
+	}
+
+	if !cancelled {
+		return errors.New("Match can no longer be cancelled")
+	}
+
+	if _, err = ms.repo.FailPendingMatches(token, db.ResponseWithdrawn); err != nil {
+		ms.sendError(err, "Unable to update matches")
+		return err
+	}
+
+	ms.ns.SendMatchStatus(model.MatchStatusUpdate{Token: token, Status: model.MatchSessionStatusCancelled})
+
+	return nil
+}
+
+// Gets the current status of an on-demand match session, used to seed new status subscriptions
+func (ms *MatchService) MatchStatus(s db.Student, token string) (model.MatchStatusUpdate, error) {
+	u := model.MatchStatusUpdate{Token: token}
+
+	session, err := ms.repo.GetMatchSession(token)
+	if err == pgx.ErrNoRows {
+		return u, errors.New("No match found")
+	} else if err != nil {
+		ms.sendError(err, "Unable to retrieve match session")
+		return u, err
+	}
+
+	if session.Student != s.Id {
+		return u, errors.New("Unauthorised to access match")
+	}
+
+	switch session.Status {
+	case "SEARCHING":
+		u.Status = model.MatchSessionStatusSearching
+	case "OFFERED":
+		// Every round but the last offers to exactly session.Parallel tutors
+		u.Status = model.MatchSessionStatusOffered
+		u.OfferedTo = session.Offered - (session.Round-1)*session.Parallel
+	case "ACCEPTED":
+		u.Status = model.MatchSessionStatusMatched
+
+		// The lesson is attached shortly after the session is accepted, the MATCHED update carries it once it is
+		if session.Lesson != "" {
+			l, err := ms.repo.GetLessonById(session.Lesson)
+			if err != nil {
+				ms.sendError(err, "Unable to retrieve lesson from database")
+				return u, err
+			}
+
+			ml, err := ms.repo.ToLessonModel(l)
+			if err != nil {
+				ms.sendError(err, "Unable to convert lesson")
+				return u, err
+			}
+			u.Lesson = &ml
+		}
+	case "EXHAUSTED":
+		u.Status = model.MatchSessionStatusExhausted
+	case "CANCELLED":
+		u.Status = model.MatchSessionStatusCancelled
+	}
+
+	return u, nil
+}
+
 func (ms *MatchService) CheckForMatch(s db.Student, token string) (*db.Lesson, error) {
 
 	// Fetching the match
@@ -354,6 +672,43 @@ func (ms *MatchService) CheckForMatch(s db.Student, token string) (*db.Lesson, e
 	return &l, nil
 }
 
+// Creates a notification for the student and pushes it, only logging failures
+func (ms *MatchService) notifyStudent(sid string, title string, subtitle string) {
+	s, err := ms.repo.GetStudentById(sid)
+	if err != nil {
+		ms.sendError(err, "Cannot retrieve student from database")
+		return
+	}
+
+	n, err := ms.repo.CreateNotification(s.Id, title, subtitle, "")
+	if err != nil {
+		ms.sendError(err, "Cannot create notification in database")
+		return
+	}
+
+	if err = ms.ns.SendPushNotification(n, s.PushToken); err != nil {
+		ms.sendError(err, "Cannot send firebase push notification")
+	}
+}
+
+// Returns the ids in extra which are not already in ids, preserving order
+func dedupe(ids []string, extra []string) []string {
+	seen := map[string]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+
+	var res []string
+	for _, id := range extra {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+
+	return res
+}
+
 // Making sending errors easier
 func (ms *MatchService) sendError(err error, message string) {
 	ms.logger.WithFields(log.Fields{
@@ -0,0 +1,225 @@
+package match
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+	"github.com/solderneer/axiom-backend/services/affinity"
+	"github.com/solderneer/axiom-backend/services/lesson"
+	"github.com/solderneer/axiom-backend/services/notifs"
+	"github.com/solderneer/axiom-backend/services/pubsub"
+	"github.com/solderneer/axiom-backend/services/scheduler"
+)
+
+// Wires a match service to the test database, with firebase replaced by a server accepting every push notification
+func newTestService(t *testing.T) (*MatchService, *db.Repository) {
+	repo := dbtest.Repository(t)
+
+	fcm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "projects/test/messages/1"}`))
+	}))
+	t.Cleanup(fcm.Close)
+
+	if os.Getenv("GOOGLE_CLOUD_PROJECT") == "" {
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test")
+		t.Cleanup(func() { os.Unsetenv("GOOGLE_CLOUD_PROJECT") })
+	}
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	var sched scheduler.Scheduler
+	var ns notifs.NotifService
+	var afs affinity.AffinityService
+	var ls lesson.LessonService
+	var ms MatchService
+
+	sched.Init(logger, repo, nil)
+	ns.Init(logger, pubsub.NewMemoryBroker(1, pubsub.DropPolicy), option.WithEndpoint(fcm.URL), option.WithoutAuthentication())
+	afs.Init(logger, repo, &sched, 24*time.Hour)
+	ls.Init(logger, repo, &ns, &sched, &afs, nil, lesson.Policy{})
+	ms.Init(logger, &ns, repo, &sched, &ls, nil)
+
+	return &ms, repo
+}
+
+// Scheduled and on-demand accepts racing for the same tutor and time must book exactly one lesson between them
+func TestConcurrentAcceptsBookOneLesson(t *testing.T) {
+	ms, repo := newTestService(t)
+
+	const n = 5
+
+	tutor := dbtest.Tutor(t, repo)
+	sub := dbtest.Subject(t, repo)
+	start := time.Now().Add(5 * time.Minute)
+
+	var scheduled, onDemand []db.Match
+	for i := 0; i < n; i++ {
+		m, err := repo.CreateMatch("SCHEDULED", "MATCHING", true, dbtest.Student(t, repo).Id, tutor.Id, sub.Id, start, start.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Cannot create scheduled match: %v", err)
+		}
+		scheduled = append(scheduled, m)
+
+		s := dbtest.Student(t, repo)
+		session, err := repo.CreateMatchSession(s.Id, sub.Id, []string{tutor.Id}, 1)
+		if err != nil {
+			t.Fatalf("Cannot create match session: %v", err)
+		}
+
+		if _, err = repo.AdvanceMatchSession(session.Token, session.Round, 1); err != nil {
+			t.Fatalf("Cannot offer match session: %v", err)
+		}
+
+		m, err = repo.CreateMatch(session.Token, "MATCHING", false, s.Id, tutor.Id, sub.Id, time.Now(), time.Now().Add(15*time.Minute))
+		if err != nil {
+			t.Fatalf("Cannot create on-demand match: %v", err)
+		}
+		onDemand = append(onDemand, m)
+	}
+
+	errs := make(chan error, 2*n)
+	ready := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+
+		go func(m db.Match) {
+			defer wg.Done()
+			<-ready
+			_, err := ms.AcceptScheduledMatch(m.Id, tutor)
+			errs <- err
+		}(scheduled[i])
+
+		go func(m db.Match) {
+			defer wg.Done()
+			<-ready
+			_, err := ms.AcceptOnDemandMatch(m.Id, tutor)
+			errs <- err
+		}(onDemand[i])
+	}
+
+	close(ready)
+	wg.Wait()
+	close(errs)
+
+	taken := 0
+	for err := range errs {
+		if err == db.ErrSlotTaken {
+			taken++
+		} else if err != nil {
+			t.Errorf("Accept failed with %v, want nil or ErrSlotTaken", err)
+		}
+	}
+
+	if taken != 2*n-1 {
+		t.Errorf("%d accepts got ErrSlotTaken, want %d", taken, 2*n-1)
+	}
+
+	lessons, err := repo.GetTutorLessons(tutor.Id, start.Add(-time.Hour), start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Cannot get tutor lessons: %v", err)
+	}
+
+	if len(lessons) != 1 {
+		t.Fatalf("Got %d lessons, want 1", len(lessons))
+	}
+
+	// The losing sessions must not be left waiting on an offer that can never be accepted
+	for _, m := range onDemand {
+		session, err := repo.GetMatchSession(m.Token)
+		if err != nil {
+			t.Fatalf("Cannot get match session: %v", err)
+		}
+
+		if session.Status == "OFFERED" {
+			t.Errorf("Session %s is still OFFERED after its only offer lost the slot", session.Token)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	tests := []struct {
+		name  string
+		ids   []string
+		extra []string
+		want  []string
+	}{
+		{"nothing extra", []string{"a"}, nil, nil},
+		{"all new", []string{"a"}, []string{"b", "c"}, []string{"b", "c"}},
+		{"already present", []string{"a", "b"}, []string{"b", "c", "a"}, []string{"c"}},
+		{"repeated in extra", nil, []string{"c", "b", "c"}, []string{"c", "b"}},
+	}
+
+	for _, tt := range tests {
+		if got := dedupe(tt.ids, tt.extra); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Each timeout moves the session on to the next batch until the candidates run out, and stale timers change nothing
+func TestOnDemandSessionOffersBatchesUntilExhausted(t *testing.T) {
+	ms, repo := newTestService(t)
+
+	s := dbtest.Student(t, repo)
+	sub := dbtest.Subject(t, repo)
+	tids := []string{dbtest.Tutor(t, repo).Id, dbtest.Tutor(t, repo).Id, dbtest.Tutor(t, repo).Id}
+
+	session, err := repo.CreateMatchSession(s.Id, sub.Id, tids, 2)
+	if err != nil {
+		t.Fatalf("Cannot create match session: %v", err)
+	}
+
+	timeout := func(round int) {
+		payload, _ := json.Marshal(onDemandJobPayload{Token: session.Token, Round: round})
+		if err := ms.handleOnDemandTimeout(payload); err != nil {
+			t.Fatalf("Timeout of round %d failed: %v", round, err)
+		}
+	}
+
+	check := func(step string, status string, round int, offered int) {
+		got, err := repo.GetMatchSession(session.Token)
+		if err != nil {
+			t.Fatalf("Cannot get match session: %v", err)
+		}
+
+		if got.Status != status || got.Round != round || got.Offered != offered {
+			t.Errorf("%s: got %s round %d offered %d, want %s round %d offered %d", step, got.Status, got.Round, got.Offered, status, round, offered)
+		}
+	}
+
+	if err = ms.offerNextBatch(session); err != nil {
+		t.Fatalf("Cannot offer first batch: %v", err)
+	}
+	check("first batch", "OFFERED", 1, 2)
+
+	// A duplicated start offers nothing more
+	if err = ms.offerNextBatch(session); err != nil {
+		t.Fatalf("Cannot offer first batch again: %v", err)
+	}
+	check("first batch again", "OFFERED", 1, 2)
+
+	timeout(1)
+	check("second batch", "OFFERED", 2, 3)
+
+	timeout(1)
+	check("stale timeout", "OFFERED", 2, 3)
+
+	timeout(2)
+	check("exhausted", "EXHAUSTED", 2, 3)
+}
@@ -0,0 +1,254 @@
+package match
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+// How far back the load and response rate of a tutor are measured
+const (
+	loadWindow     = 7 * 24 * time.Hour
+	responseWindow = 30 * 24 * time.Hour
+)
+
+// Response rates are smoothed as if every tutor had answered responsePriorOffers offers at responsePriorRate, so a single missed offer does not sink a new tutor
+const (
+	responsePriorOffers = 5
+	responsePriorRate   = 0.5
+)
+
+// Tutors who ignored ignoredOffersLimit offers in a row are ranked after everyone else, until deprioritiseFor has passed since the last one
+const (
+	ignoredOffersLimit = 3
+	deprioritiseFor    = time.Hour
+)
+
+// The ranking used unless MATCH_RANKING says otherwise
+const DefaultRanking = "affinity:4,rating:2,response:2,fairness:1,price:1"
+
+var ErrInvalidRanking = errors.New("Rankings are comma separated strategy:weight pairs, such as affinity:4,rating:2")
+
+// What a tutor is being ranked for
+// TargetRate is the hourly rate the student is used to paying, price proximity favours tutors close to it
+type Request struct {
+	Student    string
+	Subject    string
+	At         time.Time
+	TargetRate int
+}
+
+// Ranker scores how good a match a candidate tutor is for a request, from 0 for the worst to 1 for the best
+type Ranker interface {
+	Score(req Request, c db.MatchCandidate) float64
+}
+
+// Favours tutors the student got along with before, scores of 0 are neutral
+type AffinityRanker struct{}
+
+func (AffinityRanker) Score(req Request, c db.MatchCandidate) float64 {
+	return 1 / (1 + math.Exp(-float64(c.Affinity)/10))
+}
+
+// Favours tutors with better reviews
+type RatingRanker struct{}
+
+func (RatingRanker) Score(req Request, c db.MatchCandidate) float64 {
+	return math.Max(0, math.Min(1, (c.Rating-1)/4))
+}
+
+// Favours tutors charging close to what the student is used to paying, every tutor is equal when that is unknown
+type PriceRanker struct{}
+
+func (PriceRanker) Score(req Request, c db.MatchCandidate) float64 {
+	if req.TargetRate <= 0 {
+		return 0.5
+	}
+
+	return 1 / (1 + math.Abs(float64(c.HourlyRate-req.TargetRate))/float64(req.TargetRate))
+}
+
+// Spreads lessons across tutors by favouring those who taught the least recently
+type FairnessRanker struct{}
+
+func (FairnessRanker) Score(req Request, c db.MatchCandidate) float64 {
+	return 1 / (1 + float64(c.Lessons)/5)
+}
+
+// Favours tutors who accept the offers they get
+type ResponseRanker struct{}
+
+func (ResponseRanker) Score(req Request, c db.MatchCandidate) float64 {
+	return (float64(c.Accepted) + responsePriorOffers*responsePriorRate) / float64(c.Offered+responsePriorOffers)
+}
+
+// Ranks tutors randomly, the baseline other strategies are compared against
+type RandomRanker struct{}
+
+func (RandomRanker) Score(req Request, c db.MatchCandidate) float64 {
+	return rand.Float64()
+}
+
+// Strategies by the names used in rankings
+var Strategies = map[string]Ranker{
+	"affinity": AffinityRanker{},
+	"rating":   RatingRanker{},
+	"price":    PriceRanker{},
+	"fairness": FairnessRanker{},
+	"response": ResponseRanker{},
+	"random":   RandomRanker{},
+}
+
+type weightedRanker struct {
+	ranker Ranker
+	weight float64
+}
+
+// Combines strategies into a weighted average of their scores
+type WeightedRanker struct {
+	rankers []weightedRanker
+	total   float64
+}
+
+func (wr *WeightedRanker) Add(r Ranker, weight float64) {
+	wr.rankers = append(wr.rankers, weightedRanker{ranker: r, weight: weight})
+	wr.total += weight
+}
+
+func (wr *WeightedRanker) Score(req Request, c db.MatchCandidate) float64 {
+	if wr.total == 0 {
+		return 0
+	}
+
+	var score float64
+	for _, r := range wr.rankers {
+		score += r.weight * r.ranker.Score(req, c)
+	}
+
+	return score / wr.total
+}
+
+// Parses a ranking such as affinity:4,rating:2 into a weighted ranker, strategies without a weight count once
+func ParseRanking(spec string) (*WeightedRanker, error) {
+	wr := &WeightedRanker{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weight := part, 1.0
+		if i := strings.Index(part, ":"); i >= 0 {
+			var err error
+			if weight, err = strconv.ParseFloat(strings.TrimSpace(part[i+1:]), 64); err != nil || weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+				return nil, ErrInvalidRanking
+			}
+			name = strings.TrimSpace(part[:i])
+		}
+
+		r, ok := Strategies[name]
+		if !ok {
+			return nil, errors.New("Unknown ranking strategy " + name)
+		}
+
+		wr.Add(r, weight)
+	}
+
+	if wr.total == 0 {
+		return nil, ErrInvalidRanking
+	}
+
+	return wr, nil
+}
+
+// Orders tutors from the best to the worst match for a student in a subject at the time at
+func Rank(repo *db.Repository, ranker Ranker, sid string, subid string, tids []string, at time.Time) ([]string, error) {
+	if len(tids) == 0 {
+		return tids, nil
+	}
+
+	candidates, err := repo.GetMatchCandidates(sid, subid, tids, at, at.Add(-loadWindow), at.Add(-responseWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := request(repo, sid, subid, at, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	return rank(ranker, req, tids, candidates), nil
+}
+
+// Builds the request the candidates are ranked for
+func request(repo *db.Repository, sid string, subid string, at time.Time, candidates []db.MatchCandidate) (Request, error) {
+	req := Request{Student: sid, Subject: subid, At: at}
+
+	var err error
+	if req.TargetRate, err = repo.GetStudentAverageRate(sid, at); err != nil {
+		return req, err
+	}
+
+	// Students without paid lessons are assumed to be after a typical rate among the candidates
+	if req.TargetRate == 0 {
+		rates := []int{}
+		for _, c := range candidates {
+			rates = append(rates, c.HourlyRate)
+		}
+		sort.Ints(rates)
+
+		if len(rates) > 0 {
+			req.TargetRate = rates[len(rates)/2]
+		}
+	}
+
+	return req, nil
+}
+
+// Orders the tutors with a candidate from the best to the worst match, tutors without one are left out
+func rank(ranker Ranker, req Request, tids []string, candidates []db.MatchCandidate) []string {
+	scores := map[string]float64{}
+	deprioritised := map[string]bool{}
+	for _, c := range candidates {
+		scores[c.Tutor] = ranker.Score(req, c)
+		deprioritised[c.Tutor] = DeprioritisedUntil(c.ConsecutiveIgnored, c.LastIgnored, req.At) != nil
+	}
+
+	// Keeps the order tutors were found in between equal scores
+	ranked := []string{}
+	for _, tid := range tids {
+		if _, ok := scores[tid]; ok {
+			ranked = append(ranked, tid)
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if deprioritised[ranked[i]] != deprioritised[ranked[j]] {
+			return !deprioritised[ranked[i]]
+		}
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+
+	return ranked
+}
+
+// When a tutor who kept ignoring offers stops being ranked last, nil if they are not deprioritised at the time at
+func DeprioritisedUntil(consecutiveIgnored int, lastIgnored *time.Time, at time.Time) *time.Time {
+	if consecutiveIgnored < ignoredOffersLimit || lastIgnored == nil {
+		return nil
+	}
+
+	until := lastIgnored.Add(deprioritiseFor)
+	if !until.After(at) {
+		return nil
+	}
+
+	return &until
+}
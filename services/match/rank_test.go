@@ -0,0 +1,221 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+func TestParseRanking(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    string
+		weights []float64
+		err     bool
+	}{
+		{name: "Default", spec: DefaultRanking, weights: []float64{4, 2, 2, 1, 1}},
+		{name: "WithoutWeights", spec: "affinity,random", weights: []float64{1, 1}},
+		{name: "Spaces", spec: " rating : 2 , , price:0.5 ", weights: []float64{2, 0.5}},
+		{name: "ZeroWeightAmongOthers", spec: "rating:0,price:1", weights: []float64{0, 1}},
+		{name: "Empty", spec: "", err: true},
+		{name: "OnlyZeroWeights", spec: "rating:0", err: true},
+		{name: "NegativeWeight", spec: "rating:-1", err: true},
+		{name: "NotANumber", spec: "rating:lots", err: true},
+		{name: "NaN", spec: "rating:NaN", err: true},
+		{name: "Infinite", spec: "rating:Inf", err: true},
+		{name: "UnknownStrategy", spec: "affinity:1,height:2", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			wr, err := ParseRanking(c.spec)
+			if (err != nil) != c.err {
+				t.Fatalf("Got error %v", err)
+			} else if err != nil {
+				return
+			}
+
+			weights := []float64{}
+			for _, r := range wr.rankers {
+				weights = append(weights, r.weight)
+			}
+
+			if !reflect.DeepEqual(weights, c.weights) {
+				t.Errorf("Got weights %v, want %v", weights, c.weights)
+			}
+		})
+	}
+}
+
+// Every strategy scores between 0 and 1, better candidates scoring higher
+func TestStrategies(t *testing.T) {
+	req := Request{TargetRate: 40}
+
+	cases := []struct {
+		name   string
+		ranker Ranker
+		better db.MatchCandidate
+		worse  db.MatchCandidate
+	}{
+		{"Affinity", AffinityRanker{}, db.MatchCandidate{Affinity: 20}, db.MatchCandidate{Affinity: -20}},
+		{"Rating", RatingRanker{}, db.MatchCandidate{Rating: 5}, db.MatchCandidate{Rating: 2}},
+		{"PriceCloser", PriceRanker{}, db.MatchCandidate{HourlyRate: 45}, db.MatchCandidate{HourlyRate: 20}},
+		{"PriceAbove", PriceRanker{}, db.MatchCandidate{HourlyRate: 40}, db.MatchCandidate{HourlyRate: 80}},
+		{"Fairness", FairnessRanker{}, db.MatchCandidate{Lessons: 1}, db.MatchCandidate{Lessons: 10}},
+		{"Response", ResponseRanker{}, db.MatchCandidate{Offered: 10, Accepted: 9}, db.MatchCandidate{Offered: 10, Accepted: 1}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			better, worse := c.ranker.Score(req, c.better), c.ranker.Score(req, c.worse)
+
+			if better <= worse {
+				t.Errorf("Better candidate scored %f, worse %f", better, worse)
+			}
+
+			for _, score := range []float64{better, worse} {
+				if score < 0 || score > 1 {
+					t.Errorf("Score %f is out of range", score)
+				}
+			}
+		})
+	}
+}
+
+func TestNeutralScores(t *testing.T) {
+	if got := (AffinityRanker{}).Score(Request{}, db.MatchCandidate{}); got != 0.5 {
+		t.Errorf("No affinity scored %f, want 0.5", got)
+	}
+
+	if got := (PriceRanker{}).Score(Request{}, db.MatchCandidate{HourlyRate: 100}); got != 0.5 {
+		t.Errorf("Price without a target rate scored %f, want 0.5", got)
+	}
+
+	if got := (RatingRanker{}).Score(Request{}, db.MatchCandidate{Rating: 0}); got != 0 {
+		t.Errorf("Unrated tutor scored %f, want 0", got)
+	}
+}
+
+// A ranker scoring candidates by their hourly rate, to control the order in tests
+type rateRanker struct{}
+
+func (rateRanker) Score(req Request, c db.MatchCandidate) float64 {
+	return float64(c.HourlyRate)
+}
+
+func TestWeightedRanker(t *testing.T) {
+	var wr WeightedRanker
+	if got := wr.Score(Request{}, db.MatchCandidate{HourlyRate: 1}); got != 0 {
+		t.Errorf("Empty ranker scored %f, want 0", got)
+	}
+
+	wr.Add(rateRanker{}, 3)
+	wr.Add(FairnessRanker{}, 1)
+
+	// A weighted average of 1 and the fairness of a tutor without lessons, which is 1
+	if got := wr.Score(Request{}, db.MatchCandidate{HourlyRate: 1}); got != 1 {
+		t.Errorf("Got %f, want 1", got)
+	}
+
+	if got := wr.Score(Request{}, db.MatchCandidate{HourlyRate: 5}); got != 4 {
+		t.Errorf("Got %f, want 4", got)
+	}
+}
+
+func TestRank(t *testing.T) {
+	candidates := []db.MatchCandidate{
+		{Tutor: "a", HourlyRate: 10},
+		{Tutor: "b", HourlyRate: 30},
+		{Tutor: "c", HourlyRate: 20},
+		{Tutor: "d", HourlyRate: 30},
+	}
+
+	cases := []struct {
+		name string
+		tids []string
+		want []string
+	}{
+		{"BestFirst", []string{"a", "b", "c"}, []string{"b", "c", "a"}},
+		{"TiesKeepTheirOrder", []string{"d", "a", "b"}, []string{"d", "b", "a"}},
+		{"WithoutCandidatesLeftOut", []string{"a", "missing", "c"}, []string{"c", "a"}},
+		{"Nobody", nil, []string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := rank(rateRanker{}, Request{At: time.Now()}, c.tids, candidates); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDeprioritisedUntil(t *testing.T) {
+	at := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	recent := at.Add(-10 * time.Minute)
+	old := at.Add(-deprioritiseFor)
+
+	cases := []struct {
+		name        string
+		ignored     int
+		lastIgnored *time.Time
+		want        *time.Time
+	}{
+		{"BelowLimit", ignoredOffersLimit - 1, &recent, nil},
+		{"NeverIgnored", ignoredOffersLimit, nil, nil},
+		{"AtLimit", ignoredOffersLimit, &recent, timePtr(recent.Add(deprioritiseFor))},
+		{"AboveLimit", ignoredOffersLimit + 5, &recent, timePtr(recent.Add(deprioritiseFor))},
+		{"Expired", ignoredOffersLimit, &old, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := DeprioritisedUntil(c.ignored, c.lastIgnored, at)
+			if (got == nil) != (c.want == nil) || (got != nil && !got.Equal(*c.want)) {
+				t.Errorf("Got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// Tutors with few offers score close to neutral rather than at the extremes
+func TestResponseSmoothing(t *testing.T) {
+	var r ResponseRanker
+
+	if got := r.Score(Request{}, db.MatchCandidate{}); got != 0.5 {
+		t.Errorf("Tutor without offers scored %f, want 0.5", got)
+	}
+
+	once := r.Score(Request{}, db.MatchCandidate{Offered: 1, Accepted: 1})
+	often := r.Score(Request{}, db.MatchCandidate{Offered: 50, Accepted: 50})
+	if once >= often || once <= 0.5 {
+		t.Errorf("One accepted offer scored %f, fifty scored %f", once, often)
+	}
+
+	if got := r.Score(Request{}, db.MatchCandidate{Offered: 1}); got <= 0.3 {
+		t.Errorf("One ignored offer scored %f", got)
+	}
+}
+
+func TestRankDeprioritisedLast(t *testing.T) {
+	at := time.Now()
+	recent := at.Add(-time.Minute)
+	old := at.Add(-2 * deprioritiseFor)
+
+	candidates := []db.MatchCandidate{
+		{Tutor: "ignoring", HourlyRate: 50, ConsecutiveIgnored: ignoredOffersLimit, LastIgnored: &recent},
+		{Tutor: "forgiven", HourlyRate: 40, ConsecutiveIgnored: ignoredOffersLimit, LastIgnored: &old},
+		{Tutor: "worst", HourlyRate: 10},
+	}
+
+	got := rank(rateRanker{}, Request{At: at}, []string{"ignoring", "forgiven", "worst"}, candidates)
+	if want := []string{"forgiven", "worst", "ignoring"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
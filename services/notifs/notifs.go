@@ -3,7 +3,7 @@ package notifs
 
 import (
 	"context"
-	"sync"
+	"encoding/json"
 	// "time"
 
 	log "github.com/sirupsen/logrus"
@@ -12,23 +12,25 @@ import (
 	"firebase.google.com/go/v4/messaging"
 	"github.com/solderneer/axiom-backend/db"
 	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/pubsub"
+	"google.golang.org/api/option"
 )
 
 type NotifService struct {
 	logger *log.Logger
 	fb     *firebase.App
 	fbm    *messaging.Client
-	nchans map[string]chan *model.MatchNotification
-	nmutex sync.Mutex
+	broker pubsub.Broker
 }
 
 // Inititalise the Notification service
 // Remember to set your GOOGLE_APPLICATION_CREDENTIALS="/home/user/Downloads/service-account-file.json" in the env variables
-func (ns *NotifService) Init(logger *log.Logger) {
+// Any options are passed on to firebase, such as an endpoint for tests to stand in for it
+func (ns *NotifService) Init(logger *log.Logger, broker pubsub.Broker, opts ...option.ClientOption) {
 	ns.logger = logger
 
 	// Initialise firebase
-	fb, err := firebase.NewApp(context.Background(), nil)
+	fb, err := firebase.NewApp(context.Background(), nil, opts...)
 	if err != nil {
 		ns.logger.WithFields(log.Fields{
 			"service": "notification",
@@ -47,33 +49,121 @@ func (ns *NotifService) Init(logger *log.Logger) {
 
 	ns.fb = fb
 	ns.fbm = client
-	ns.nchans = map[string]chan *model.MatchNotification{}
-	ns.nmutex = sync.Mutex{}
+	ns.broker = broker
 
 	ns.logger.WithField("service", "notification").Info("Successfully initialised")
 }
 
-// Send a match notification to a specified user
+// Send a match notification to a specified user. Never blocks, notifications for users who are not subscribed are dropped
 func (ns *NotifService) SendMatchNotification(n model.MatchNotification, uid string) {
-	ns.nchans[uid] <- &n
+	ns.publish(matchNotificationTopic(uid), n)
 }
 
-// Create a match subscriptions channel for a specific user
-func (ns *NotifService) CreateUserMatchChannel(user string) *chan *model.MatchNotification {
+// Subscribe to the match notifications of a specific user until done is closed
+func (ns *NotifService) SubscribeMatchNotifications(uid string, done <-chan struct{}) (<-chan *model.MatchNotification, error) {
+	sub, err := ns.broker.Subscribe(matchNotificationTopic(uid))
+	if err != nil {
+		return nil, err
+	}
+
 	nchan := make(chan *model.MatchNotification, 1)
 
-	ns.nmutex.Lock()
-	ns.nchans[user] = nchan
-	ns.nmutex.Unlock()
+	go func() {
+		defer close(nchan)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case <-done:
+				return
+			case raw, ok := <-sub.C:
+				if !ok {
+					return
+				}
+
+				var n model.MatchNotification
+				if err := json.Unmarshal(raw, &n); err != nil {
+					ns.sendError(err, "Cannot decode match notification")
+					continue
+				}
+
+				select {
+				case nchan <- &n:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return nchan, nil
+}
 
-	return &nchan
+// Send a match status update to every subscriber of a match session token, ie. all the student's connected devices
+func (ns *NotifService) SendMatchStatus(u model.MatchStatusUpdate) {
+	ns.publish(matchStatusTopic(u.Token), u)
 }
 
-// Delete a match subscribetion channel
-func (ns *NotifService) DeleteUserMatchChannel(user string) {
-	ns.nmutex.Lock()
-	delete(ns.nchans, user)
-	ns.nmutex.Unlock()
+// Subscribe to the status updates of a match session token until done is closed
+// Every call creates a new subscription, so multiple devices can subscribe to the same session
+func (ns *NotifService) SubscribeMatchStatus(token string, done <-chan struct{}) (<-chan *model.MatchStatusUpdate, error) {
+	sub, err := ns.broker.Subscribe(matchStatusTopic(token))
+	if err != nil {
+		return nil, err
+	}
+
+	schan := make(chan *model.MatchStatusUpdate, 1)
+
+	go func() {
+		defer close(schan)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case <-done:
+				return
+			case raw, ok := <-sub.C:
+				if !ok {
+					return
+				}
+
+				var u model.MatchStatusUpdate
+				if err := json.Unmarshal(raw, &u); err != nil {
+					ns.sendError(err, "Cannot decode match status update")
+					continue
+				}
+
+				select {
+				case schan <- &u:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return schan, nil
+}
+
+// Encodes and publishes a payload to the broker, only logging failures
+func (ns *NotifService) publish(topic string, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		ns.sendError(err, "Cannot encode notification")
+		return
+	}
+
+	if err = ns.broker.Publish(topic, raw); err != nil {
+		ns.sendError(err, "Cannot publish notification")
+	}
+}
+
+func matchNotificationTopic(uid string) string {
+	return "match_notifications:" + uid
+}
+
+func matchStatusTopic(token string) string {
+	return "match_status:" + token
 }
 
 // Send a push notification using firebase
@@ -99,3 +189,11 @@ func (ns *NotifService) SendPushNotification(n db.Notification, token string) er
 
 	return nil
 }
+
+// Making sending errors easier
+func (ns *NotifService) sendError(err error, message string) {
+	ns.logger.WithFields(log.Fields{
+		"service": "notification",
+		"err":     err.Error(),
+	}).Error(message)
+}
@@ -0,0 +1,87 @@
+package notifs
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/graph/model"
+	"github.com/solderneer/axiom-backend/services/pubsub"
+)
+
+func newTestService() *NotifService {
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	return &NotifService{logger: logger, broker: pubsub.NewMemoryBroker(4, pubsub.DropPolicy)}
+}
+
+func receive(t *testing.T, c <-chan *model.MatchStatusUpdate) *model.MatchStatusUpdate {
+	select {
+	case u := <-c:
+		return u
+	case <-time.After(time.Second):
+		t.Fatal("No match status update received")
+		return nil
+	}
+}
+
+// Every device subscribed to a session hears its updates, and nobody else does
+func TestMatchStatusReachesEverySubscriber(t *testing.T) {
+	ns := newTestService()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	first, err := ns.SubscribeMatchStatus("session", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := ns.SubscribeMatchStatus("session", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := ns.SubscribeMatchStatus("other", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ns.SendMatchStatus(model.MatchStatusUpdate{Token: "session", Status: model.MatchSessionStatusOffered, OfferedTo: 3})
+
+	for _, c := range []<-chan *model.MatchStatusUpdate{first, second} {
+		if u := receive(t, c); u.Token != "session" || u.Status != model.MatchSessionStatusOffered || u.OfferedTo != 3 {
+			t.Errorf("Got %+v", *u)
+		}
+	}
+
+	select {
+	case u := <-other:
+		t.Errorf("Subscriber of another session got %+v", *u)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMatchStatusSubscriptionEndsWhenDone(t *testing.T) {
+	ns := newTestService()
+
+	done := make(chan struct{})
+	c, err := ns.SubscribeMatchStatus("session", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(done)
+
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Error("Got an update after done was closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("Channel was not closed after done")
+	}
+}
@@ -0,0 +1,306 @@
+// Package onboarding walks tutors through their application, from signing up with their qualification documents to being approved for matching
+package onboarding
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/notifs"
+)
+
+// The statuses of a tutor application, mirrors the ApplicationStatus enum of the GraphQL schema. Only approved tutors are ever matched
+const (
+	Applied            = "APPLIED"
+	DocumentsSubmitted = "DOCUMENTS_SUBMITTED"
+	UnderReview        = "UNDER_REVIEW"
+	Approved           = "APPROVED"
+	Rejected           = "REJECTED"
+)
+
+// The statuses an application may move to from each status. Rejected tutors may fix their documents and submit again
+var transitions = map[string][]string{
+	Applied:            {DocumentsSubmitted},
+	DocumentsSubmitted: {UnderReview},
+	UnderReview:        {Approved, Rejected},
+	Rejected:           {DocumentsSubmitted},
+}
+
+// Limits on the documents of a single application
+const (
+	maxDocuments    = 10
+	maxDocumentSize = 20 << 20
+)
+
+var (
+	ErrNotFound          = errors.New("No such tutor application")
+	ErrInvalidTransition = errors.New("Application cannot move to that status")
+	ErrApplicationLocked = errors.New("Documents cannot be changed while the application is submitted")
+	ErrNoDocuments       = errors.New("Upload at least one document before submitting")
+	ErrTooManyDocuments  = errors.New("Too many documents")
+	ErrInvalidDocument   = errors.New("Documents need a name, an https url and a size of at most 20MB")
+	ErrNotesRequired     = errors.New("Rejections need notes for the tutor")
+)
+
+// A tutor application, along with its documents and the history of its status
+type Application struct {
+	Tutor     db.Tutor
+	Documents []db.TutorDocument
+	Reviews   []db.ApplicationReview
+}
+
+type OnboardingService struct {
+	logger *log.Logger
+	repo   *db.Repository
+	ns     *notifs.NotifService
+}
+
+// Initialise the onboarding service
+func (obs *OnboardingService) Init(logger *log.Logger, repo *db.Repository, ns *notifs.NotifService) {
+	obs.logger = logger
+	obs.repo = repo
+	obs.ns = ns
+
+	obs.logger.WithField("service", "onboarding").Info("Successfully initialised")
+}
+
+// Gets the application of a tutor
+func (obs *OnboardingService) Application(tid string) (Application, error) {
+	var a Application
+
+	t, err := obs.tutor(tid)
+	if err != nil {
+		return a, err
+	}
+
+	return obs.application(t)
+}
+
+// Lists the applications in a status, those who have been waiting the longest first
+func (obs *OnboardingService) Queue(status string, limit int, offset int) ([]Application, error) {
+	tutors, err := obs.repo.GetTutorsByApplicationStatus(status, limit, offset)
+	if err != nil {
+		obs.sendError(err, "Cannot retrieve tutor applications from database")
+		return nil, err
+	}
+
+	var applications []Application
+	for _, t := range tutors {
+		a, err := obs.application(t)
+		if err != nil {
+			return nil, err
+		}
+
+		applications = append(applications, a)
+	}
+
+	return applications, nil
+}
+
+// Records a qualification document the tutor uploaded to blob storage. Documents can only be changed before the application is submitted
+func (obs *OnboardingService) AddDocument(tid string, kind string, name string, link string, contentType string, size int) (db.TutorDocument, error) {
+	var d db.TutorDocument
+
+	if !validDocument(name, link, size) {
+		return d, ErrInvalidDocument
+	}
+
+	t, err := obs.tutor(tid)
+	if err != nil {
+		return d, err
+	}
+
+	if t.ApplicationStatus != Applied && t.ApplicationStatus != Rejected {
+		return d, ErrApplicationLocked
+	}
+
+	documents, err := obs.repo.GetTutorDocuments(t.Id)
+	if err != nil {
+		obs.sendError(err, "Cannot retrieve tutor documents from database")
+		return d, err
+	}
+
+	if len(documents) >= maxDocuments {
+		return d, ErrTooManyDocuments
+	}
+
+	d, err = obs.repo.CreateTutorDocument(t.Id, kind, name, link, contentType, size)
+	if err != nil {
+		obs.sendError(err, "Cannot create tutor document in database")
+		return d, err
+	}
+
+	return d, nil
+}
+
+// Removes a qualification document from the application. Documents can only be changed before the application is submitted
+func (obs *OnboardingService) RemoveDocument(tid string, did string) error {
+	t, err := obs.tutor(tid)
+	if err != nil {
+		return err
+	}
+
+	if t.ApplicationStatus != Applied && t.ApplicationStatus != Rejected {
+		return ErrApplicationLocked
+	}
+
+	if err = obs.repo.DeleteTutorDocument(did); err != nil {
+		obs.sendError(err, "Cannot delete tutor document from database")
+		return err
+	}
+
+	return nil
+}
+
+// Submits the application of a tutor for review
+func (obs *OnboardingService) Submit(tid string) (Application, error) {
+	if _, err := obs.Transition("", tid, DocumentsSubmitted, "", nil); err != nil {
+		return Application{}, err
+	}
+
+	return obs.Application(tid)
+}
+
+// Moves an application to another status, recording who moved it and why, and notifying the tutor
+// The reviewer is the admin making the change, whose audit entry is written along with it, or empty for changes made by the tutor themselves
+func (obs *OnboardingService) Transition(reviewer string, tid string, to string, notes string, audit *db.Audit) (db.ApplicationReview, error) {
+	var r db.ApplicationReview
+
+	t, err := obs.tutor(tid)
+	if err != nil {
+		return r, err
+	}
+
+	if !allowed(t.ApplicationStatus, to) {
+		return r, ErrInvalidTransition
+	}
+
+	if to == Rejected && strings.TrimSpace(notes) == "" {
+		return r, ErrNotesRequired
+	}
+
+	if to == DocumentsSubmitted {
+		documents, err := obs.repo.GetTutorDocuments(t.Id)
+		if err != nil {
+			obs.sendError(err, "Cannot retrieve tutor documents from database")
+			return r, err
+		}
+
+		if len(documents) == 0 {
+			return r, ErrNoDocuments
+		}
+	}
+
+	// An admin's audit entry records the status the application actually moved from
+	if audit != nil {
+		audit.Before = map[string]interface{}{"applicationStatus": t.ApplicationStatus}
+	}
+
+	// The status is only changed if nobody else changed it in the meantime
+	r, moved, err := obs.repo.TransitionApplication(t.Id, reviewer, t.ApplicationStatus, to, notes, audit)
+	if err != nil {
+		obs.sendError(err, "Cannot update application status in database")
+		return r, err
+	}
+
+	if !moved {
+		return r, ErrInvalidTransition
+	}
+
+	obs.notify(t, to, notes)
+
+	return r, nil
+}
+
+func (obs *OnboardingService) application(t db.Tutor) (Application, error) {
+	a := Application{Tutor: t}
+
+	var err error
+	if a.Documents, err = obs.repo.GetTutorDocuments(t.Id); err != nil {
+		obs.sendError(err, "Cannot retrieve tutor documents from database")
+		return a, err
+	}
+
+	if a.Reviews, err = obs.repo.GetApplicationReviews(t.Id); err != nil {
+		obs.sendError(err, "Cannot retrieve application reviews from database")
+		return a, err
+	}
+
+	return a, nil
+}
+
+func (obs *OnboardingService) tutor(tid string) (db.Tutor, error) {
+	t, err := obs.repo.GetTutorById(tid)
+	if err == pgx.ErrNoRows {
+		return t, ErrNotFound
+	} else if err != nil {
+		obs.sendError(err, "Cannot retrieve tutor from database")
+		return t, err
+	}
+
+	return t, nil
+}
+
+// Tells the tutor their application moved, only logging failures
+func (obs *OnboardingService) notify(t db.Tutor, status string, notes string) {
+	var title, subtitle string
+
+	switch status {
+	case DocumentsSubmitted:
+		title, subtitle = "Application submitted", "We have received your documents and will review them shortly"
+	case UnderReview:
+		title, subtitle = "Application under review", "Axiom is now reviewing your application"
+	case Approved:
+		title, subtitle = "Application approved", "Welcome to Axiom! Students can now be matched with you"
+	case Rejected:
+		title, subtitle = "Application not approved", notes
+	default:
+		return
+	}
+
+	n, err := obs.repo.CreateNotification(t.Id, title, subtitle, "")
+	if err != nil {
+		obs.sendError(err, "Cannot create notification in database")
+		return
+	}
+
+	if err = obs.ns.SendPushNotification(n, t.PushToken); err != nil {
+		obs.sendError(err, "Cannot send firebase push notification")
+	}
+}
+
+func allowed(from string, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Documents are uploaded straight to blob storage by the client, so only their metadata can be checked
+func validDocument(name string, link string, size int) bool {
+	if strings.TrimSpace(name) == "" || size <= 0 || size > maxDocumentSize {
+		return false
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "https" && u.Host != ""
+}
+
+// Making sending errors easier
+func (obs *OnboardingService) sendError(err error, message string) {
+	obs.logger.WithFields(log.Fields{
+		"service": "onboarding",
+		"err":     err.Error(),
+	}).Error(message)
+}
@@ -0,0 +1,56 @@
+package onboarding
+
+import "testing"
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{Applied, DocumentsSubmitted, true},
+		{DocumentsSubmitted, UnderReview, true},
+		{UnderReview, Approved, true},
+		{UnderReview, Rejected, true},
+		{Rejected, DocumentsSubmitted, true},
+		{Applied, Approved, false},
+		{DocumentsSubmitted, Approved, false},
+		{Approved, Rejected, false},
+		{Approved, DocumentsSubmitted, false},
+		{Rejected, Approved, false},
+		{UnderReview, UnderReview, false},
+		{"UNKNOWN", Applied, false},
+	}
+
+	for _, tt := range tests {
+		if got := allowed(tt.from, tt.to); got != tt.want {
+			t.Errorf("%s to %s: got %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestValidDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		link     string
+		size     int
+		want     bool
+	}{
+		{"valid", "Degree", "https://files.example.com/degree.pdf", 1024, true},
+		{"largest", "Degree", "https://files.example.com/degree.pdf", maxDocumentSize, true},
+		{"too large", "Degree", "https://files.example.com/degree.pdf", maxDocumentSize + 1, false},
+		{"empty", "Degree", "https://files.example.com/degree.pdf", 0, false},
+		{"blank name", "  ", "https://files.example.com/degree.pdf", 1024, false},
+		{"plain http", "Degree", "http://files.example.com/degree.pdf", 1024, false},
+		{"no host", "Degree", "https:///degree.pdf", 1024, false},
+		{"relative link", "Degree", "degree.pdf", 1024, false},
+		{"other scheme", "Degree", "javascript:alert(1)", 1024, false},
+	}
+
+	for _, tt := range tests {
+		if got := validDocument(tt.document, tt.link, tt.size); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
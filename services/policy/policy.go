@@ -0,0 +1,195 @@
+// Package policy decides who may do what. Rules are declared on the GraphQL schema with the @hasRole and @owner directives and evaluated here
+package policy
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+// The kinds of resources ownership can be checked for, mirrors the Resource enum of the GraphQL schema
+type Resource string
+
+const (
+	LessonResource                Resource = "LESSON"
+	MatchResource                 Resource = "MATCH"
+	MatchSessionResource          Resource = "MATCH_SESSION"
+	NotificationResource          Resource = "NOTIFICATION"
+	SessionResource               Resource = "SESSION"
+	TutorDocumentResource         Resource = "TUTOR_DOCUMENT"
+	AvailabilityResource          Resource = "AVAILABILITY"
+	AvailabilityExceptionResource Resource = "AVAILABILITY_EXCEPTION"
+	LessonRescheduleResource      Resource = "LESSON_RESCHEDULE"
+	LessonNoteResource            Resource = "LESSON_NOTE"
+	LessonAttachmentResource      Resource = "LESSON_ATTACHMENT"
+	ReviewResource                Resource = "REVIEW"
+	TutorResource                 Resource = "TUTOR"
+	ConversationResource          Resource = "CONVERSATION"
+	MessageAttachmentResource     Resource = "MESSAGE_ATTACHMENT"
+)
+
+var ErrUnknownResource = errors.New("Unknown resource")
+
+type PolicyService struct {
+	logger *log.Logger
+	repo   *db.Repository
+}
+
+// Initialise the policy service
+func (ps *PolicyService) Init(logger *log.Logger, repo *db.Repository) {
+	ps.logger = logger
+	ps.repo = repo
+
+	ps.logger.WithField("service", "policy").Info("Successfully initialised")
+}
+
+// Checks whether the principal acts in one of the roles
+func (ps *PolicyService) HasRole(p auth.Principal, roles []auth.Role) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks whether the principal was granted the scope
+func (ps *PolicyService) HasScope(p auth.Principal, scope string) bool {
+	return p.HasScope(scope)
+}
+
+// Checks whether the principal owns the resource with the given id. Admins own everything
+// Resources that do not exist are owned by nobody
+func (ps *PolicyService) Owns(p auth.Principal, resource Resource, id string) (bool, error) {
+	if p.Role == auth.RoleAdmin {
+		return true, nil
+	}
+
+	owns, err := ps.owns(p, resource, id)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		ps.sendError(err, "Cannot check ownership of "+string(resource))
+		return false, err
+	}
+
+	if !owns {
+		ps.logger.WithFields(log.Fields{
+			"service":  "policy",
+			"user":     p.Id,
+			"resource": resource,
+			"id":       id,
+		}).Warn("Denied access to resource not owned by user")
+	}
+
+	return owns, nil
+}
+
+func (ps *PolicyService) owns(p auth.Principal, resource Resource, id string) (bool, error) {
+	switch resource {
+	case LessonResource:
+		switch p.Role {
+		case auth.RoleStudent:
+			return ps.repo.IsStudentInLesson(p.Id, id)
+		case auth.RoleTutor:
+			return ps.repo.IsTutorInLesson(p.Id, id)
+		}
+		return false, nil
+	case MatchResource:
+		m, err := ps.repo.GetMatchById(id)
+		if err != nil {
+			return false, err
+		}
+		return m.Student == p.Id || m.Tutor == p.Id, nil
+	case MatchSessionResource:
+		s, err := ps.repo.GetMatchSession(id)
+		if err != nil {
+			return false, err
+		}
+		return s.Student == p.Id, nil
+	case NotificationResource:
+		n, err := ps.repo.GetNotificationById(id)
+		if err != nil {
+			return false, err
+		}
+		return n.Student == p.Id || n.Tutor == p.Id, nil
+	case SessionResource:
+		s, err := ps.repo.GetSessionById(id)
+		if err != nil {
+			return false, err
+		}
+		return s.User == p.Id, nil
+	case TutorDocumentResource:
+		d, err := ps.repo.GetTutorDocumentById(id)
+		if err != nil {
+			return false, err
+		}
+		return d.Tutor == p.Id, nil
+	case AvailabilityResource:
+		a, err := ps.repo.GetAvailabilityById(id)
+		if err != nil {
+			return false, err
+		}
+		return a.Tutor == p.Id, nil
+	case AvailabilityExceptionResource:
+		e, err := ps.repo.GetAvailabilityExceptionById(id)
+		if err != nil {
+			return false, err
+		}
+		return e.Tutor == p.Id, nil
+	case LessonRescheduleResource:
+		lr, err := ps.repo.GetLessonRescheduleById(id)
+		if err != nil {
+			return false, err
+		}
+		return ps.owns(p, LessonResource, lr.Lesson)
+	case LessonNoteResource:
+		n, err := ps.repo.GetLessonNoteById(id)
+		if err != nil {
+			return false, err
+		}
+		return n.Author == p.Id, nil
+	case LessonAttachmentResource:
+		a, err := ps.repo.GetLessonAttachmentById(id)
+		if err != nil {
+			return false, err
+		}
+		return ps.owns(p, LessonResource, a.Lesson)
+	case ReviewResource:
+		rv, err := ps.repo.GetReviewById(id)
+		if err != nil {
+			return false, err
+		}
+		return rv.Student == p.Id || rv.Tutor == p.Id, nil
+	case TutorResource:
+		return id == p.Id, nil
+	case ConversationResource:
+		c, err := ps.repo.GetConversationById(id)
+		if err != nil {
+			return false, err
+		}
+		_, ok := c.Participant(p.Id)
+		return ok, nil
+	case MessageAttachmentResource:
+		a, err := ps.repo.GetMessageAttachmentById(id)
+		if err != nil {
+			return false, err
+		}
+		return ps.owns(p, ConversationResource, a.Conversation)
+	}
+
+	return false, ErrUnknownResource
+}
+
+// Making sending errors easier
+func (ps *PolicyService) sendError(err error, message string) {
+	ps.logger.WithFields(log.Fields{
+		"service": "policy",
+		"err":     err.Error(),
+	}).Error(message)
+}
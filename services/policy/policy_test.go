@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/db/dbtest"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+func newTestService(repo *db.Repository) *PolicyService {
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	var ps PolicyService
+	ps.Init(logger, repo)
+
+	return &ps
+}
+
+func TestHasRole(t *testing.T) {
+	ps := newTestService(nil)
+
+	tests := []struct {
+		name  string
+		role  auth.Role
+		roles []auth.Role
+		want  bool
+	}{
+		{"only role", auth.RoleStudent, []auth.Role{auth.RoleStudent}, true},
+		{"one of several", auth.RoleTutor, []auth.Role{auth.RoleStudent, auth.RoleTutor}, true},
+		{"other role", auth.RoleTutor, []auth.Role{auth.RoleStudent}, false},
+		{"admins are not implied", auth.RoleAdmin, []auth.Role{auth.RoleStudent, auth.RoleTutor}, false},
+		{"no roles", auth.RoleAdmin, nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := ps.HasRole(auth.Principal{Role: tt.role}, tt.roles); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Checks which need no database: admins own everything and tutors own themselves
+func TestOwnsWithoutLookup(t *testing.T) {
+	ps := newTestService(nil)
+
+	student := auth.Principal{Id: "s:1", Role: auth.RoleStudent}
+	tutor := auth.Principal{Id: "t:1", Role: auth.RoleTutor}
+	admin := auth.Principal{Id: "a:1", Role: auth.RoleAdmin}
+
+	tests := []struct {
+		name     string
+		p        auth.Principal
+		resource Resource
+		id       string
+		want     bool
+		err      error
+	}{
+		{"admin owns any lesson", admin, LessonResource, "lesson", true, nil},
+		{"admin owns unknown resources", admin, Resource("UNKNOWN"), "id", true, nil},
+		{"tutor owns themselves", tutor, TutorResource, "t:1", true, nil},
+		{"tutor does not own another tutor", tutor, TutorResource, "t:2", false, nil},
+		{"student does not own a tutor", student, TutorResource, "t:1", false, nil},
+		{"unknown resource", student, Resource("UNKNOWN"), "id", false, ErrUnknownResource},
+	}
+
+	for _, tt := range tests {
+		got, err := ps.Owns(tt.p, tt.resource, tt.id)
+		if got != tt.want || err != tt.err {
+			t.Errorf("%s: got %v with error %v, want %v with error %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestOwnsLessons(t *testing.T) {
+	repo := dbtest.Repository(t)
+	ps := newTestService(repo)
+
+	s := dbtest.Student(t, repo)
+	tu := dbtest.Tutor(t, repo)
+	other := dbtest.Student(t, repo)
+
+	start := time.Now().Add(24 * time.Hour)
+	l, err := repo.CreateLesson(dbtest.Subject(t, repo), tu.Id, s.Id, true, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Cannot create lesson: %v", err)
+	}
+
+	n, err := repo.CreateLessonNote(l.Id, s.Id, "Bring a calculator")
+	if err != nil {
+		t.Fatalf("Cannot create lesson note: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		p        auth.Principal
+		resource Resource
+		id       string
+		want     bool
+	}{
+		{"student of the lesson", auth.Principal{Id: s.Id, Role: auth.RoleStudent}, LessonResource, l.Id, true},
+		{"tutor of the lesson", auth.Principal{Id: tu.Id, Role: auth.RoleTutor}, LessonResource, l.Id, true},
+		{"another student", auth.Principal{Id: other.Id, Role: auth.RoleStudent}, LessonResource, l.Id, false},
+		{"tutor id claimed as a student", auth.Principal{Id: tu.Id, Role: auth.RoleStudent}, LessonResource, l.Id, false},
+		{"missing lesson", auth.Principal{Id: s.Id, Role: auth.RoleStudent}, LessonResource, "missing", false},
+		{"author of a note", auth.Principal{Id: s.Id, Role: auth.RoleStudent}, LessonNoteResource, n.Id, true},
+		{"other party of a note", auth.Principal{Id: tu.Id, Role: auth.RoleTutor}, LessonNoteResource, n.Id, false},
+		{"missing note", auth.Principal{Id: s.Id, Role: auth.RoleStudent}, LessonNoteResource, "missing", false},
+	}
+
+	for _, tt := range tests {
+		got, err := ps.Owns(tt.p, tt.resource, tt.id)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %v with error %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
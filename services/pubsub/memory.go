@@ -0,0 +1,91 @@
+package pubsub
+
+import (
+	"sync"
+)
+
+// MemoryBroker is an in-process Broker, subscribers only see payloads published within the same process
+type MemoryBroker struct {
+	buffer int
+	policy Policy
+
+	topics map[string]map[*Subscription]struct{}
+	mux    sync.RWMutex
+}
+
+// Creates an in-memory broker, every subscriber gets a channel buffered to the given size
+func NewMemoryBroker(buffer int, policy Policy) *MemoryBroker {
+	return &MemoryBroker{
+		buffer: buffer,
+		policy: policy,
+		topics: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+// Publishes to all subscribers of a topic without ever blocking on a slow subscriber
+func (b *MemoryBroker) Publish(topic string, payload []byte) error {
+	var slow []*Subscription
+
+	b.mux.RLock()
+	for sub := range b.topics[topic] {
+		select {
+		case sub.c <- payload:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	b.mux.RUnlock()
+
+	if b.policy == DisconnectPolicy {
+		for _, sub := range slow {
+			sub.Unsubscribe()
+		}
+	}
+
+	return nil
+}
+
+// Subscribes to a topic, any number of subscribers can listen on the same topic
+func (b *MemoryBroker) Subscribe(topic string) (*Subscription, error) {
+	sub := newSubscription(topic, b.buffer, b.remove)
+
+	b.mux.Lock()
+	if b.topics[topic] == nil {
+		b.topics[topic] = map[*Subscription]struct{}{}
+	}
+	b.topics[topic][sub] = struct{}{}
+	b.mux.Unlock()
+
+	return sub, nil
+}
+
+// Unsubscribes everybody
+func (b *MemoryBroker) Close() error {
+	var subs []*Subscription
+
+	b.mux.RLock()
+	for _, topic := range b.topics {
+		for sub := range topic {
+			subs = append(subs, sub)
+		}
+	}
+	b.mux.RUnlock()
+
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// Removes a subscription and closes its channel, only ever called once per subscription
+func (b *MemoryBroker) remove(sub *Subscription) {
+	b.mux.Lock()
+	delete(b.topics[sub.topic], sub)
+	if len(b.topics[sub.topic]) == 0 {
+		delete(b.topics, sub.topic)
+	}
+	b.mux.Unlock()
+
+	close(sub.c)
+}
@@ -0,0 +1,164 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// The single Postgres channel all topics are multiplexed over, topics are carried inside the payload
+const postgresChannel = "axiom_pubsub"
+
+// Postgres rejects notification payloads of 8000 bytes or more
+const maxNotification = 7999
+
+// Separates the topic from the payload of a notification, topics cannot contain it
+const topicSeparator = "\n"
+
+var (
+	ErrInvalidTopic    = errors.New("Topics cannot contain a newline")
+	ErrPayloadTooLarge = errors.New("Payload is too large for a Postgres notification")
+)
+
+// PostgresBroker is a Broker backed by Postgres LISTEN/NOTIFY, so subscribers on every backend replica receive each publish
+// Payloads are sent as is after their topic and a newline, which together must stay under 8000 bytes
+type PostgresBroker struct {
+	logger *log.Logger
+	pool   *pgxpool.Pool
+	local  *MemoryBroker
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Connects to Postgres and starts listening for notifications in the background
+// Delivery to subscribers within this process follows the given buffer size and slow consumer policy
+func NewPostgresBroker(logger *log.Logger, dbUrl string, buffer int, policy Policy) (*PostgresBroker, error) {
+	pool, err := pgxpool.Connect(context.Background(), dbUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &PostgresBroker{
+		logger: logger,
+		pool:   pool,
+		local:  NewMemoryBroker(buffer, policy),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go b.listen(ctx)
+
+	b.logger.WithField("service", "pubsub").Info("Successfully initialised postgres broker")
+	return b, nil
+}
+
+// Publishes through pg_notify, the payload reaches local subscribers once Postgres echoes it back
+func (b *PostgresBroker) Publish(topic string, payload []byte) error {
+	notification, err := encodeNotification(topic, payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.pool.Exec(context.Background(), `SELECT pg_notify($1, $2)`, postgresChannel, notification)
+	return err
+}
+
+// Subscribes to a topic on this replica
+func (b *PostgresBroker) Subscribe(topic string) (*Subscription, error) {
+	return b.local.Subscribe(topic)
+}
+
+// Stops listening, unsubscribes everybody and closes the connections
+func (b *PostgresBroker) Close() error {
+	b.cancel()
+	<-b.done
+
+	b.local.Close()
+	b.pool.Close()
+	return nil
+}
+
+// Holds a dedicated connection in LISTEN mode, reconnecting with a backoff whenever it drops
+func (b *PostgresBroker) listen(ctx context.Context) {
+	defer close(b.done)
+
+	backoff := time.Second
+	for {
+		err := b.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.logger.WithFields(log.Fields{
+			"service": "pubsub",
+			"err":     err.Error(),
+		}).Error("Lost postgres listen connection, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// Listens until the connection fails or the context is cancelled, forwarding every notification to local subscribers
+func (b *PostgresBroker) listenOnce(ctx context.Context) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+postgresChannel); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		topic, payload, ok := decodeNotification(n.Payload)
+		if !ok {
+			b.logger.WithField("service", "pubsub").Error("Dropping malformed notification")
+			continue
+		}
+
+		b.local.Publish(topic, payload)
+	}
+}
+
+// Prefixes the payload with its topic, checking that the result fits in a notification
+func encodeNotification(topic string, payload []byte) (string, error) {
+	if strings.Contains(topic, topicSeparator) {
+		return "", ErrInvalidTopic
+	}
+
+	if len(topic)+len(topicSeparator)+len(payload) > maxNotification {
+		return "", ErrPayloadTooLarge
+	}
+
+	return topic + topicSeparator + string(payload), nil
+}
+
+// Splits a notification back into its topic and payload
+func decodeNotification(notification string) (string, []byte, bool) {
+	i := strings.Index(notification, topicSeparator)
+	if i < 0 {
+		return "", nil, false
+	}
+
+	return notification[:i], []byte(notification[i+len(topicSeparator):]), true
+}
@@ -0,0 +1,97 @@
+package pubsub
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// A payload which fills a notification on the topic up to the given total size
+func payloadOfSize(topic string, size int) []byte {
+	return bytes.Repeat([]byte("x"), size-len(topic)-len(topicSeparator))
+}
+
+func TestEncodeNotification(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		payload []byte
+		err     error
+	}{
+		{"json payload", "messages:1", []byte(`{"text":"hi\nthere"}`), nil},
+		{"empty payload", "messages:1", nil, nil},
+		{"largest notification", "messages:1", payloadOfSize("messages:1", 7999), nil},
+		{"notification of 8000 bytes", "messages:1", payloadOfSize("messages:1", 8000), ErrPayloadTooLarge},
+		{"topic with a newline", "messages:\n1", []byte(`{}`), ErrInvalidTopic},
+	}
+
+	for _, tt := range tests {
+		notification, err := encodeNotification(tt.topic, tt.payload)
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		topic, payload, ok := decodeNotification(notification)
+		if !ok || topic != tt.topic || !bytes.Equal(payload, tt.payload) {
+			t.Errorf("%s: decoded %q %q %v", tt.name, topic, payload, ok)
+		}
+	}
+}
+
+func TestDecodeMalformedNotification(t *testing.T) {
+	if _, _, ok := decodeNotification("no separator"); ok {
+		t.Error("Decoded a notification without a topic")
+	}
+}
+
+func TestPostgresBrokerAtNotificationLimit(t *testing.T) {
+	url := dbtest.URL(t)
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	b, err := NewPostgresBroker(logger, url, 1, DropPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	topic := "test:limit"
+	sub, err := b.Subscribe(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	// The listener connects in the background, so keep publishing until it is up
+	largest := payloadOfSize(topic, maxNotification)
+	deadline := time.After(10 * time.Second)
+	for received := false; !received; {
+		if err = b.Publish(topic, largest); err != nil {
+			t.Fatalf("Cannot publish the largest notification: %v", err)
+		}
+
+		select {
+		case p := <-sub.C:
+			if !bytes.Equal(p, largest) {
+				t.Fatalf("Received %d bytes, want %d", len(p), len(largest))
+			}
+			received = true
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Notification never arrived")
+		}
+	}
+
+	if err = b.Publish(topic, payloadOfSize(topic, maxNotification+1)); err != ErrPayloadTooLarge {
+		t.Errorf("Got %v publishing 8000 bytes, want %v", err, ErrPayloadTooLarge)
+	}
+}
@@ -0,0 +1,54 @@
+// Package pubsub provides topic based publish/subscribe used to deliver GraphQL subscriptions
+package pubsub
+
+import (
+	"sync"
+)
+
+// Broker fans published payloads out to every subscriber of a topic
+type Broker interface {
+	// Publishes a payload to every current subscriber of the topic
+	Publish(topic string, payload []byte) error
+	// Subscribes to a topic, call Unsubscribe on the subscription once done
+	Subscribe(topic string) (*Subscription, error)
+	// Releases any resources held by the broker
+	Close() error
+}
+
+// Policy decides what happens when a subscriber's buffer is full
+type Policy int
+
+const (
+	// Drop the payload for the slow subscriber only, it stays subscribed
+	DropPolicy Policy = iota
+	// Unsubscribe the slow subscriber and close its channel, so that the client can reconnect and resync
+	DisconnectPolicy
+)
+
+// Subscription is a single subscriber's view of a topic
+type Subscription struct {
+	// Payloads published to the topic, closed once unsubscribed
+	C <-chan []byte
+
+	topic string
+	c     chan []byte
+	once  sync.Once
+	unsub func(*Subscription)
+}
+
+func newSubscription(topic string, buffer int, unsub func(*Subscription)) *Subscription {
+	c := make(chan []byte, buffer)
+	return &Subscription{C: c, topic: topic, c: c, unsub: unsub}
+}
+
+// Topic the subscription is listening on
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// Removes the subscription from its broker and closes the channel. Safe to call more than once
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.unsub(s)
+	})
+}
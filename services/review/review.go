@@ -0,0 +1,227 @@
+// Package review lets students rate and review their completed lessons, and tutors reply to those reviews
+package review
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/services/affinity"
+	"github.com/solderneer/axiom-backend/services/notifs"
+)
+
+// The range of stars a lesson can be rated with
+const (
+	minRating = 1
+	maxRating = 5
+)
+
+var (
+	ErrNotFound         = errors.New("No such review")
+	ErrLessonNotFound   = errors.New("No such lesson")
+	ErrNotCompleted     = errors.New("Only completed lessons can be reviewed")
+	ErrInvalidRating    = errors.New("Ratings must be between 1 and 5 stars")
+	ErrBodyRequired     = errors.New("Reviews and replies cannot be empty")
+	ErrReasonRequired   = errors.New("Give a reason for flagging the review")
+	ErrNotReviewedTutor = errors.New("Only the tutor of a lesson can reply to its review")
+)
+
+type ReviewService struct {
+	logger *log.Logger
+	repo   *db.Repository
+	ns     *notifs.NotifService
+	afs    *affinity.AffinityService
+}
+
+// Initialise the review service
+func (rs *ReviewService) Init(logger *log.Logger, repo *db.Repository, ns *notifs.NotifService, afs *affinity.AffinityService) {
+	rs.logger = logger
+	rs.repo = repo
+	rs.ns = ns
+	rs.afs = afs
+
+	rs.logger.WithField("service", "review").Info("Successfully initialised")
+}
+
+// Reviews a completed lesson on behalf of its student, updating the rating of the tutor and the affinity of both
+func (rs *ReviewService) Review(sid string, lid string, rating int, body string) (db.Review, error) {
+	if rating < minRating || rating > maxRating {
+		return db.Review{}, ErrInvalidRating
+	}
+
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return db.Review{}, ErrBodyRequired
+	}
+
+	l, err := rs.repo.GetLessonById(lid)
+	if err == pgx.ErrNoRows {
+		return db.Review{}, ErrLessonNotFound
+	} else if err != nil {
+		rs.sendError(err, "Cannot retrieve lesson from database")
+		return db.Review{}, err
+	}
+
+	if l.Student != sid {
+		return db.Review{}, ErrLessonNotFound
+	}
+
+	if l.Status != "COMPLETED" {
+		return db.Review{}, ErrNotCompleted
+	}
+
+	rv, err := rs.repo.CreateReview(l, rating, body)
+	if err == db.ErrAlreadyReviewed {
+		return rv, err
+	} else if err != nil {
+		rs.sendError(err, "Cannot create review in database")
+		return rv, err
+	}
+
+	rs.afs.Refresh(l.Tutor, l.Student, l.Subject.Id)
+
+	rs.notify(l.Tutor, "New review", "Your "+l.Subject.Name+" lesson was rated "+stars(rating))
+
+	return rv, nil
+}
+
+// Replies to a review on behalf of the tutor it is about, replacing any previous reply
+func (rs *ReviewService) Reply(tid string, rid string, body string) (db.Review, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return db.Review{}, ErrBodyRequired
+	}
+
+	rv, err := rs.review(rid)
+	if err != nil {
+		return rv, err
+	}
+
+	if rv.Tutor != tid {
+		return rv, ErrNotReviewedTutor
+	}
+
+	first := rv.Replied == nil
+
+	if rv, err = rs.repo.ReplyToReview(rv.Id, body); err != nil {
+		rs.sendError(err, "Cannot reply to review in database")
+		return rv, err
+	}
+
+	if first {
+		rs.notify(rv.Student, "Your tutor replied", "Your tutor replied to your review")
+	}
+
+	return rv, nil
+}
+
+// Flags a visible review as inappropriate, for admins to moderate
+func (rs *ReviewService) Flag(uid string, rid string, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+
+	rv, err := rs.review(rid)
+	if err != nil {
+		return err
+	}
+
+	// Hidden reviews can only be seen by admins, so they cannot be flagged
+	if rv.Hidden {
+		return ErrNotFound
+	}
+
+	if err = rs.repo.FlagReview(rv.Id, uid, reason); err != nil {
+		rs.sendError(err, "Cannot flag review in database")
+		return err
+	}
+
+	return nil
+}
+
+// Gets a page of the visible reviews of a tutor, most recent first, along with how many there are in total
+func (rs *ReviewService) TutorReviews(tid string, afterCreated time.Time, afterId string, limit int) ([]db.Review, int, error) {
+	reviews, err := rs.repo.GetTutorReviews(tid, afterCreated, afterId, limit)
+	if err != nil {
+		rs.sendError(err, "Cannot retrieve tutor reviews from database")
+		return nil, 0, err
+	}
+
+	total, err := rs.repo.CountTutorReviews(tid)
+	if err != nil {
+		rs.sendError(err, "Cannot count tutor reviews in database")
+		return nil, 0, err
+	}
+
+	return reviews, total, nil
+}
+
+// Gets the review of a lesson, or nil if it was not reviewed
+func (rs *ReviewService) LessonReview(lid string) (*db.Review, error) {
+	rv, err := rs.repo.GetLessonReview(lid)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		rs.sendError(err, "Cannot retrieve lesson review from database")
+		return nil, err
+	}
+
+	return &rv, nil
+}
+
+func (rs *ReviewService) review(rid string) (db.Review, error) {
+	rv, err := rs.repo.GetReviewById(rid)
+	if err == pgx.ErrNoRows {
+		return rv, ErrNotFound
+	} else if err != nil {
+		rs.sendError(err, "Cannot retrieve review from database")
+		return rv, err
+	}
+
+	return rv, nil
+}
+
+// Tells a student or tutor about a review, only logging failures
+func (rs *ReviewService) notify(uid string, title string, subtitle string) {
+	n, err := rs.repo.CreateNotification(uid, title, subtitle, "")
+	if err != nil {
+		rs.sendError(err, "Cannot create notification in database")
+		return
+	}
+
+	var token string
+	if s, err := rs.repo.GetStudentById(uid); err == nil {
+		token = s.PushToken
+	} else if t, err := rs.repo.GetTutorById(uid); err == nil {
+		token = t.PushToken
+	} else {
+		rs.sendError(err, "Cannot retrieve push token from database")
+		return
+	}
+
+	if err = rs.ns.SendPushNotification(n, token); err != nil {
+		rs.sendError(err, "Cannot send firebase push notification")
+	}
+}
+
+func stars(rating int) string {
+	if rating == 1 {
+		return "1 star"
+	}
+
+	return strconv.Itoa(rating) + " stars"
+}
+
+// Making sending errors easier
+func (rs *ReviewService) sendError(err error, message string) {
+	rs.logger.WithFields(log.Fields{
+		"service": "review",
+		"err":     err.Error(),
+	}).Error(message)
+}
@@ -0,0 +1,52 @@
+package review
+
+import "testing"
+
+func TestStars(t *testing.T) {
+	tests := []struct {
+		rating int
+		want   string
+	}{
+		{1, "1 star"},
+		{2, "2 stars"},
+		{5, "5 stars"},
+	}
+
+	for _, tt := range tests {
+		if got := stars(tt.rating); got != tt.want {
+			t.Errorf("%d: got %q, want %q", tt.rating, got, tt.want)
+		}
+	}
+}
+
+// Ratings and bodies are checked before anything is looked up
+func TestReviewValidation(t *testing.T) {
+	var rs ReviewService
+
+	tests := []struct {
+		name   string
+		rating int
+		body   string
+		err    error
+	}{
+		{"no stars", 0, "Great", ErrInvalidRating},
+		{"too many stars", 6, "Great", ErrInvalidRating},
+		{"negative", -1, "Great", ErrInvalidRating},
+		{"empty body", 5, "", ErrBodyRequired},
+		{"blank body", 1, " \n\t", ErrBodyRequired},
+	}
+
+	for _, tt := range tests {
+		if _, err := rs.Review("s:1", "lesson", tt.rating, tt.body); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	if _, err := rs.Reply("t:1", "review", "  "); err != ErrBodyRequired {
+		t.Errorf("Blank reply got %v, want %v", err, ErrBodyRequired)
+	}
+
+	if err := rs.Flag("s:1", "review", ""); err != ErrReasonRequired {
+		t.Errorf("Flag without a reason got %v, want %v", err, ErrReasonRequired)
+	}
+}
@@ -0,0 +1,243 @@
+// Package scheduler implements a durable, restart-safe job scheduler backed by the jobs table
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+)
+
+// Clock abstracts away the current time so the scheduler can be driven by a fake clock
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Handler processes the payload of a single claimed job. Returning an error schedules a retry
+type Handler func(payload []byte) error
+
+type Scheduler struct {
+	logger *log.Logger
+	repo   *db.Repository
+	clock  Clock
+
+	owner     string
+	handlers  map[string]Handler
+	intervals map[string]time.Duration
+	hmutex    sync.RWMutex
+	done      chan struct{}
+	wg        sync.WaitGroup
+
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	BatchSize     int
+	MaxAttempts   int
+}
+
+// Initialise the scheduler. A nil clock defaults to the wall clock
+func (s *Scheduler) Init(logger *log.Logger, repo *db.Repository, clock Clock) {
+	s.logger = logger
+	s.repo = repo
+	s.clock = clock
+	if s.clock == nil {
+		s.clock = realClock{}
+	}
+
+	// Identifies this replica as the lease owner of the jobs it claims
+	hostname, _ := os.Hostname()
+	s.owner = hostname + ":" + uuid.New()
+	s.handlers = map[string]Handler{}
+	s.intervals = map[string]time.Duration{}
+	s.done = make(chan struct{})
+
+	s.PollInterval = 5 * time.Second
+	s.LeaseDuration = time.Minute
+	s.BatchSize = 20
+	s.MaxAttempts = 5
+
+	s.logger.WithField("service", "scheduler").Info("Successfully initialised")
+}
+
+// Registers the handler for a job kind, should be called by services during their own initialisation
+func (s *Scheduler) Register(kind string, h Handler) {
+	s.hmutex.Lock()
+	s.handlers[kind] = h
+	s.hmutex.Unlock()
+}
+
+// Registers the handler for a recurring job kind, of which only one job is ever pending across replicas
+// Its first run is scheduled after the delay unless one is pending already, every later run interval after the previous one finished or died
+func (s *Scheduler) RegisterRecurring(kind string, h Handler, delay time.Duration, interval time.Duration) error {
+	s.hmutex.Lock()
+	s.handlers[kind] = h
+	s.intervals[kind] = interval
+	s.hmutex.Unlock()
+
+	_, err := s.ScheduleOnce(kind, struct{}{}, s.clock.Now().Add(delay))
+	return err
+}
+
+// Enqueues a job of the given kind to run at the due time, unless a job of the kind is already pending or being run
+// Returns whether the job was enqueued. The payload is JSON encoded
+func (s *Scheduler) ScheduleOnce(kind string, payload interface{}, due time.Time) (bool, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+
+	_, created, err := s.repo.CreateSingletonJob(kind, raw, due)
+	if err != nil {
+		s.sendError(err, "Cannot create job in database")
+		return false, err
+	}
+
+	return created, nil
+}
+
+// Enqueues a job of the given kind to run at the due time. The payload is JSON encoded
+func (s *Scheduler) Schedule(kind string, payload interface{}, due time.Time) (db.Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return db.Job{}, err
+	}
+
+	j, err := s.repo.CreateJob(kind, raw, due)
+	if err != nil {
+		s.sendError(err, "Cannot create job in database")
+		return j, err
+	}
+
+	return j, nil
+}
+
+// Enqueues a job of the given kind to run after a delay relative to the scheduler clock
+func (s *Scheduler) ScheduleIn(kind string, payload interface{}, delay time.Duration) (db.Job, error) {
+	return s.Schedule(kind, payload, s.clock.Now().Add(delay))
+}
+
+// Cancels any pending jobs of the given kind with an identical payload
+func (s *Scheduler) Cancel(kind string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if err = s.repo.CancelJobs(kind, raw); err != nil {
+		s.sendError(err, "Cannot cancel jobs in database")
+		return err
+	}
+
+	return nil
+}
+
+// Starts the worker loop in the background, polling for due jobs every PollInterval
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.RunDue()
+
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stops the worker loop and waits for the in-flight batch to finish
+func (s *Scheduler) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// Claims and runs a single batch of due jobs, returning how many were processed
+// Exposed so that the scheduler can be stepped manually alongside a fake clock
+func (s *Scheduler) RunDue() int {
+	now := s.clock.Now()
+
+	jobs, err := s.repo.ClaimDueJobs(s.owner, now, now.Add(s.LeaseDuration), s.BatchSize)
+	if err != nil {
+		s.sendError(err, "Cannot claim due jobs from database")
+		return 0
+	}
+
+	for _, j := range jobs {
+		s.run(j)
+	}
+
+	return len(jobs)
+}
+
+// Runs the handler for one job, completing or rescheduling it depending on the result
+func (s *Scheduler) run(j db.Job) {
+	s.hmutex.RLock()
+	h, ok := s.handlers[j.Kind]
+	interval, recurring := s.intervals[j.Kind]
+	s.hmutex.RUnlock()
+
+	// The next run of a recurring job is scheduled as it finishes, whether it succeeded or died
+	var next *time.Time
+	if recurring {
+		due := s.clock.Now().Add(interval)
+		next = &due
+	}
+
+	var err error
+	if !ok {
+		err = errors.New("No handler registered for job kind " + j.Kind)
+	} else {
+		err = h(j.Payload)
+	}
+
+	if err == nil {
+		if err := s.repo.CompleteJob(j.Id, s.owner, next); err != nil {
+			s.sendError(err, "Cannot complete job in database")
+		}
+		return
+	}
+
+	s.logger.WithFields(log.Fields{
+		"service":  "scheduler",
+		"job":      j.Id,
+		"kind":     j.Kind,
+		"attempts": j.Attempts,
+		"err":      err.Error(),
+	}).Warn("Job failed")
+
+	// Exponential backoff between attempts, giving up after MaxAttempts
+	status := "PENDING"
+	if j.Attempts >= s.MaxAttempts {
+		status = "DEAD"
+	}
+	due := s.clock.Now().Add(time.Duration(1<<uint(j.Attempts)) * s.PollInterval)
+
+	if err := s.repo.RetryJob(j.Id, s.owner, status, due, err.Error(), next); err != nil {
+		s.sendError(err, "Cannot reschedule job in database")
+	}
+}
+
+// Making sending errors easier
+func (s *Scheduler) sendError(err error, message string) {
+	s.logger.WithFields(log.Fields{
+		"service": "scheduler",
+		"err":     err.Error(),
+	}).Error(message)
+}
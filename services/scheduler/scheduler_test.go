@@ -0,0 +1,201 @@
+package scheduler
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db/dbtest"
+)
+
+// A clock which only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// Starts a scheduler on the test database with a fake clock set long before any real job is due, so jobs left by other tests are never claimed
+func newTestScheduler(t *testing.T) (*Scheduler, *fakeClock) {
+	repo := dbtest.Repository(t)
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	clock := &fakeClock{now: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var s Scheduler
+	s.Init(logger, repo, clock)
+	s.BatchSize = 1000
+
+	return &s, clock
+}
+
+// Registers a handler under a kind unique to the test, counting how often it runs
+func countingHandler(s *Scheduler, err error) (string, *int) {
+	kind := "test." + uuid.New()
+	calls := 0
+
+	s.Register(kind, func(payload []byte) error {
+		calls++
+		return err
+	})
+
+	return kind, &calls
+}
+
+func TestFailingJobBacksOffUntilDead(t *testing.T) {
+	s, clock := newTestScheduler(t)
+	s.MaxAttempts = 3
+
+	kind, calls := countingHandler(s, errors.New("Failed"))
+	if _, err := s.ScheduleIn(kind, struct{}{}, 0); err != nil {
+		t.Fatalf("Cannot schedule job: %v", err)
+	}
+
+	steps := []struct {
+		advance time.Duration
+		calls   int
+	}{
+		{0, 1},
+		// The first retry is due two poll intervals later
+		{2*s.PollInterval - time.Second, 1},
+		{time.Second, 2},
+		// The second retry waits twice as long
+		{4*s.PollInterval - time.Second, 2},
+		{time.Second, 3},
+		// MaxAttempts was reached, so the job is DEAD and never runs again
+		{time.Hour, 3},
+	}
+
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		s.RunDue()
+
+		if *calls != step.calls {
+			t.Fatalf("Step %d: handler ran %d times, want %d", i, *calls, step.calls)
+		}
+	}
+}
+
+func TestExpiredLeaseIsReclaimed(t *testing.T) {
+	s, clock := newTestScheduler(t)
+
+	kind, calls := countingHandler(s, nil)
+	job, err := s.ScheduleIn(kind, struct{}{}, 0)
+	if err != nil {
+		t.Fatalf("Cannot schedule job: %v", err)
+	}
+
+	// Another worker claims the job and crashes without completing it
+	jobs, err := s.repo.ClaimDueJobs("crashed", clock.Now(), clock.Now().Add(s.LeaseDuration), 1000)
+	if err != nil {
+		t.Fatalf("Cannot claim jobs: %v", err)
+	}
+
+	claimed := false
+	for _, j := range jobs {
+		claimed = claimed || j.Id == job.Id
+	}
+
+	if !claimed {
+		t.Fatalf("Job %s was not claimed by the crashed worker", job.Id)
+	}
+
+	steps := []struct {
+		advance time.Duration
+		calls   int
+	}{
+		{0, 0},
+		{s.LeaseDuration - time.Second, 0},
+		// The lease has expired, so the job is taken over and completed
+		{2 * time.Second, 1},
+		{time.Hour, 1},
+	}
+
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		s.RunDue()
+
+		if *calls != step.calls {
+			t.Fatalf("Step %d: handler ran %d times, want %d", i, *calls, step.calls)
+		}
+	}
+}
+
+func TestScheduleOnceKeepsOneLiveJob(t *testing.T) {
+	s, clock := newTestScheduler(t)
+
+	kind, calls := countingHandler(s, nil)
+
+	for i, want := range []bool{true, false} {
+		created, err := s.ScheduleOnce(kind, struct{}{}, clock.Now())
+		if err != nil {
+			t.Fatalf("Cannot schedule job: %v", err)
+		}
+
+		if created != want {
+			t.Errorf("Attempt %d: scheduled %v, want %v", i, created, want)
+		}
+	}
+
+	s.RunDue()
+
+	if *calls != 1 {
+		t.Errorf("Handler ran %d times, want 1", *calls)
+	}
+
+	// Once the job ran, another one can be scheduled
+	if created, err := s.ScheduleOnce(kind, struct{}{}, clock.Now()); err != nil || !created {
+		t.Errorf("Scheduling after the job ran returned %v, %v, want true, nil", created, err)
+	}
+}
+
+func TestRecurringJobOutlivesDeadRuns(t *testing.T) {
+	s, clock := newTestScheduler(t)
+	s.MaxAttempts = 1
+
+	kind := "test." + uuid.New()
+	calls := 0
+
+	// Every run fails, so each one dies straight away
+	if err := s.RegisterRecurring(kind, func(payload []byte) error {
+		calls++
+		return errors.New("Failed")
+	}, 0, time.Hour); err != nil {
+		t.Fatalf("Cannot register recurring job: %v", err)
+	}
+
+	// Registering again, as another replica would, does not start a second chain
+	if err := s.RegisterRecurring(kind, func(payload []byte) error {
+		calls++
+		return errors.New("Failed")
+	}, 0, time.Hour); err != nil {
+		t.Fatalf("Cannot register recurring job: %v", err)
+	}
+
+	steps := []struct {
+		advance time.Duration
+		calls   int
+	}{
+		{0, 1},
+		{time.Hour - time.Second, 1},
+		{time.Second, 2},
+		{time.Hour, 3},
+	}
+
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		s.RunDue()
+
+		if calls != step.calls {
+			t.Fatalf("Step %d: handler ran %d times, want %d", i, calls, step.calls)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package session handles login sessions, issuing short-lived access tokens and rotating refresh tokens
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+// How long a session survives without being refreshed
+const sessionExpiry = 30 * 24 * time.Hour
+
+var ErrInvalidRefreshToken = errors.New("Invalid refresh token, please log in again")
+
+// Tokens handed to a client after logging in or refreshing
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+type SessionService struct {
+	logger *log.Logger
+	repo   *db.Repository
+	secret string
+}
+
+// Initialise the session service
+func (ss *SessionService) Init(logger *log.Logger, repo *db.Repository, secret string) {
+	ss.logger = logger
+	ss.repo = repo
+	ss.secret = secret
+
+	ss.logger.WithField("service", "session").Info("Successfully initialised")
+}
+
+// Starts a new session for a user that just logged in or signed up
+func (ss *SessionService) Start(uid string, deviceName string, ip string) (Tokens, error) {
+	s, err := ss.repo.CreateSession(uid, deviceName, ip, time.Now().Add(sessionExpiry))
+	if err != nil {
+		ss.sendError(err, "Cannot create session in database")
+		return Tokens{}, err
+	}
+
+	return ss.issue(uid, s.Id)
+}
+
+// Exchanges a refresh token for a new access token and refresh token. Every refresh token can only be used once
+// Presenting an already used refresh token means it was stolen, so the whole session is revoked
+func (ss *SessionService) Refresh(refreshToken string, ip string) (Tokens, error) {
+	hash := auth.HashOpaqueToken(refreshToken)
+
+	rt, err := ss.repo.GetRefreshToken(hash)
+	if err == pgx.ErrNoRows {
+		return Tokens{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		ss.sendError(err, "Cannot retrieve refresh token from database")
+		return Tokens{}, err
+	}
+
+	s, err := ss.repo.GetSessionById(rt.Session)
+	if err != nil {
+		ss.sendError(err, "Cannot retrieve session from database")
+		return Tokens{}, err
+	}
+
+	if s.Revoked || s.Expires.Before(time.Now()) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	fresh, err := ss.repo.UseRefreshToken(hash)
+	if err != nil {
+		ss.sendError(err, "Cannot update refresh token in database")
+		return Tokens{}, err
+	}
+
+	if !fresh {
+		ss.logger.WithFields(log.Fields{
+			"service": "session",
+			"session": s.Id,
+			"user":    s.User,
+			"ip":      ip,
+		}).Warn("Refresh token reuse detected, revoking session")
+
+		if _, err := ss.repo.RevokeSession(s.Id, s.User); err != nil {
+			ss.sendError(err, "Cannot revoke session in database")
+			return Tokens{}, err
+		}
+
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	if err = ss.repo.TouchSession(s.Id, ip, time.Now().Add(sessionExpiry)); err != nil {
+		ss.sendError(err, "Cannot update session in database")
+		return Tokens{}, err
+	}
+
+	return ss.issue(s.User, s.Id)
+}
+
+// Lists the active sessions of a user
+func (ss *SessionService) List(uid string) ([]db.Session, error) {
+	sessions, err := ss.repo.GetUserSessions(uid)
+	if err != nil {
+		ss.sendError(err, "Cannot retrieve sessions from database")
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revokes one of the user's sessions, its access tokens stop working immediately
+func (ss *SessionService) Revoke(uid string, sid string) error {
+	revoked, err := ss.repo.RevokeSession(sid, uid)
+	if err != nil {
+		ss.sendError(err, "Cannot revoke session in database")
+		return err
+	}
+
+	if !revoked {
+		return errors.New("No such session")
+	}
+
+	return nil
+}
+
+// Revokes every session of the user, logging them out on all devices
+func (ss *SessionService) RevokeAll(uid string) error {
+	if err := ss.repo.RevokeUserSessions(uid); err != nil {
+		ss.sendError(err, "Cannot revoke sessions in database")
+		return err
+	}
+
+	return nil
+}
+
+// Issues a fresh access token and refresh token pair for a session
+func (ss *SessionService) issue(uid string, sid string) (Tokens, error) {
+	refreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		ss.sendError(err, "Cannot generate refresh token")
+		return Tokens{}, err
+	}
+
+	if _, err = ss.repo.CreateRefreshToken(sid, auth.HashOpaqueToken(refreshToken)); err != nil {
+		ss.sendError(err, "Cannot create refresh token in database")
+		return Tokens{}, err
+	}
+
+	accessToken, err := auth.GenerateToken(uid, sid, ss.secret)
+	if err != nil {
+		ss.sendError(err, "Cannot generate JWT")
+		return Tokens{}, err
+	}
+
+	return Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// Making sending errors easier
+func (ss *SessionService) sendError(err error, message string) {
+	ss.logger.WithFields(log.Fields{
+		"service": "session",
+		"err":     err.Error(),
+	}).Error(message)
+}
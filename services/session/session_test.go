@@ -0,0 +1,59 @@
+package session
+
+import (
+	"io/ioutil"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/solderneer/axiom-backend/db/dbtest"
+	"github.com/solderneer/axiom-backend/utilities/auth"
+)
+
+// Refresh tokens rotate on every use, and reusing an old one revokes the whole session
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	repo := dbtest.Repository(t)
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+
+	var ss SessionService
+	ss.Init(logger, repo, "secret")
+
+	s := dbtest.Student(t, repo)
+
+	first, err := ss.Start(s.Id, "phone", "203.0.113.7")
+	if err != nil {
+		t.Fatalf("Cannot start session: %v", err)
+	}
+
+	second, err := ss.Refresh(first.RefreshToken, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("Cannot refresh session: %v", err)
+	}
+
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("Refresh token was not rotated")
+	}
+
+	if uid, _, err := auth.ParseToken(second.AccessToken, "secret"); err != nil || uid != s.Id {
+		t.Errorf("Refreshed access token is for %q with error %v", uid, err)
+	}
+
+	if _, err = ss.Refresh(first.RefreshToken, "198.51.100.1"); err != ErrInvalidRefreshToken {
+		t.Errorf("Reusing a refresh token got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	if _, err = ss.Refresh(second.RefreshToken, "203.0.113.7"); err != ErrInvalidRefreshToken {
+		t.Errorf("Refreshing a revoked session got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	sessions, err := ss.List(s.Id)
+	if err != nil {
+		t.Fatalf("Cannot list sessions: %v", err)
+	}
+
+	if len(sessions) != 0 {
+		t.Errorf("Got %d active sessions, want 0", len(sessions))
+	}
+}
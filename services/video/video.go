@@ -58,15 +58,17 @@ type APIKeyResponse struct {
 }
 
 type VideoClient struct {
-	accountSID  string
-	authToken   string
-	client      *http.Client
-	apiKey      *APIKeyResponse
-	tokenExpiry time.Duration
+	accountSID     string
+	authToken      string
+	client         *http.Client
+	apiKey         *APIKeyResponse
+	tokenExpiry    time.Duration
+	statusCallback string
 }
 
 // Initialise the video client. Requests an API key from the API.
-func NewVideoClient(accountSID string, authToken string, tokenExpiry time.Duration) (*VideoClient, error) {
+// Rooms report their events to the status callback, the public url of the webhook, if it is set
+func NewVideoClient(accountSID string, authToken string, tokenExpiry time.Duration, statusCallback string) (*VideoClient, error) {
 	client := &http.Client{}
 	vc := &VideoClient{
 		accountSID,
@@ -74,6 +76,7 @@ func NewVideoClient(accountSID string, authToken string, tokenExpiry time.Durati
 		client,
 		nil,
 		tokenExpiry,
+		statusCallback,
 	}
 
 	key, err := vc.requestAPIKey()
@@ -167,6 +170,10 @@ func (c *VideoClient) CreateRoom(name string) (*TwilioRoomResponse, error) {
 	if name != "" {
 		v.Set("uniqueName", name)
 	}
+	if c.statusCallback != "" {
+		v.Set("StatusCallback", c.statusCallback)
+		v.Set("StatusCallbackMethod", "POST")
+	}
 
 	res, err := c.makeRequest("POST", "/Rooms", v)
 	if err != nil {
@@ -0,0 +1,88 @@
+package video
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Room events reported to the status callback
+const (
+	RoomCreated             = "room-created"
+	RoomEnded               = "room-ended"
+	ParticipantConnected    = "participant-connected"
+	ParticipantDisconnected = "participant-disconnected"
+)
+
+var ErrInvalidSignature = errors.New("Invalid Twilio signature")
+
+// A room event posted by Twilio to the status callback. Rooms are named after their lesson, and participants are identified by their user id
+type RoomEvent struct {
+	Event               string
+	RoomSID             string
+	RoomName            string
+	ParticipantSID      string
+	ParticipantIdentity string
+	Timestamp           time.Time
+}
+
+// Reads a room event posted to the status callback, rejecting requests which were not signed by Twilio with the auth token of this account
+func (c *VideoClient) ParseRoomEvent(r *http.Request) (RoomEvent, error) {
+	var e RoomEvent
+
+	if err := r.ParseForm(); err != nil {
+		return e, err
+	}
+
+	if !c.validSignature(c.statusCallback, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+		return e, ErrInvalidSignature
+	}
+
+	e.Event = r.PostForm.Get("StatusCallbackEvent")
+	e.RoomSID = r.PostForm.Get("RoomSid")
+	e.RoomName = r.PostForm.Get("RoomName")
+	e.ParticipantSID = r.PostForm.Get("ParticipantSid")
+	e.ParticipantIdentity = r.PostForm.Get("ParticipantIdentity")
+
+	// Fall back to the time the callback arrived if Twilio left the timestamp out
+	e.Timestamp = time.Now()
+	if ts, err := time.Parse(time.RFC3339, r.PostForm.Get("Timestamp")); err == nil {
+		e.Timestamp = ts
+	}
+
+	return e, nil
+}
+
+// Twilio signs the full callback url followed by every posted parameter sorted by name, with the name and value concatenated
+func (c *VideoClient) validSignature(callback string, params url.Values, signature string) bool {
+	if signature == "" {
+		return false
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(callback)
+	for _, k := range keys {
+		for _, v := range params[k] {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(c.authToken))
+	mac.Write([]byte(b.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
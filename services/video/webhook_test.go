@@ -0,0 +1,48 @@
+package video
+
+import (
+	"net/url"
+	"testing"
+)
+
+// The example request from Twilio's documentation on validating its signatures
+func TestValidSignature(t *testing.T) {
+	c := &VideoClient{authToken: "12345"}
+	callback := "https://mycompany.com/myapp.php?foo=1&bar=2"
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	signature := "0/KCTR6DLpKmkAf8muzZqo1nDgQ="
+
+	tampered := url.Values{}
+	for k, v := range params {
+		tampered[k] = v
+	}
+	tampered.Set("Digits", "4321")
+
+	tests := []struct {
+		name      string
+		client    *VideoClient
+		callback  string
+		params    url.Values
+		signature string
+		want      bool
+	}{
+		{"documented example", c, callback, params, signature, true},
+		{"missing signature", c, callback, params, "", false},
+		{"wrong auth token", &VideoClient{authToken: "54321"}, callback, params, signature, false},
+		{"different callback", c, "https://mycompany.com/myapp.php?foo=1", params, signature, false},
+		{"tampered parameter", c, callback, tampered, signature, false},
+		{"missing parameters", c, callback, url.Values{}, signature, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.client.validSignature(tt.callback, tt.params, tt.signature); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,10 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -10,14 +14,20 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-//GenerateToken generates a jwt token and assign a username to it's claims and return it
-func GenerateToken(id string, secret string) (string, error) {
+// How long an access token stays valid, clients are expected to use their refresh token after that
+const AccessTokenExpiry = 15 * time.Minute
+
+var ErrTokenExpired = errors.New("Auth token expired")
+
+//GenerateToken generates a short-lived jwt access token bound to a user id and session id and returns it
+func GenerateToken(id string, sid string, secret string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 	/* Create a map to store our claims */
 	claims := token.Claims.(jwt.MapClaims)
 	/* Set token claims */
 	claims["id"] = id
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
+	claims["sid"] = sid
+	claims["exp"] = time.Now().Add(AccessTokenExpiry).Unix()
 	tokenString, err := token.SignedString([]byte(secret))
 	if err != nil {
 		return "", err
@@ -25,17 +35,44 @@ func GenerateToken(id string, secret string) (string, error) {
 	return tokenString, nil
 }
 
-//ParseToken parses a jwt token and returns the username it it's claims
-func ParseToken(tokenStr string, secret string) (string, error) {
+//ParseToken parses a jwt token and returns the user id and session id in it's claims
+func ParseToken(tokenStr string, secret string) (string, string, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("Unexpected signing method")
+		}
 		return []byte(secret), nil
 	})
+
+	if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+		return "", "", ErrTokenExpired
+	}
+
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		id := claims["id"].(string)
-		return id, nil
+		id, _ := claims["id"].(string)
+		sid, _ := claims["sid"].(string)
+		if id == "" || sid == "" {
+			return "", "", errors.New("Missing auth token claims")
+		}
+		return id, sid, nil
 	} else {
+		return "", "", err
+	}
+}
+
+//GenerateOpaqueToken generates an opaque random token for refresh tokens, password resets etc., only its hash should ever be stored
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//HashOpaqueToken hashes an opaque token for storage and lookup
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 //HashPassword hashes given password
@@ -59,3 +96,24 @@ func UserFromContext(ctx context.Context) (interface{}, error) {
 
 	return raw["user"], nil
 }
+
+// Reads a context and returns the session id of the authenticated request
+func SessionFromContext(ctx context.Context) (string, error) {
+	raw, ok := ctx.Value("user").(map[string]interface{})
+	if !ok {
+		return "", errors.New("Unauthorised, please log in")
+	}
+
+	sid, ok := raw["session"].(string)
+	if !ok {
+		return "", errors.New("Unauthorised, please log in")
+	}
+
+	return sid, nil
+}
+
+// Reads a context and returns the IP address of the client making the request
+func IPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value("ip").(string)
+	return ip
+}
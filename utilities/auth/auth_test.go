@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func signed(t *testing.T, claims jwt.MapClaims, secret string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestParseToken(t *testing.T) {
+	valid, err := GenerateToken("user", "session", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Minute).Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  string
+		id      string
+		sid     string
+		wantErr bool
+		err     error
+	}{
+		{"generated token", valid, "secret", "user", "session", false, nil},
+		{"wrong secret", valid, "other", "", "", true, nil},
+		{"expired", signed(t, jwt.MapClaims{"id": "user", "sid": "session", "exp": time.Now().Add(-time.Minute).Unix()}, "secret"), "secret", "", "", true, ErrTokenExpired},
+		{"without a session", signed(t, jwt.MapClaims{"id": "user", "exp": future}, "secret"), "secret", "", "", true, nil},
+		{"garbage", "not.a.token", "secret", "", "", true, nil},
+	}
+
+	for _, tt := range tests {
+		id, sid, err := ParseToken(tt.token, tt.secret)
+		if (err != nil) != tt.wantErr || (tt.err != nil && err != tt.err) {
+			t.Errorf("%s: got error %v", tt.name, err)
+			continue
+		}
+
+		if id != tt.id || sid != tt.sid {
+			t.Errorf("%s: got %q %q, want %q %q", tt.name, id, sid, tt.id, tt.sid)
+		}
+	}
+}
+
+func TestOpaqueTokens(t *testing.T) {
+	a, err := GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Error("Generated the same opaque token twice")
+	}
+
+	if HashOpaqueToken(a) != HashOpaqueToken(a) || HashOpaqueToken(a) == HashOpaqueToken(b) {
+		t.Error("Opaque token hashes are not stable and distinct")
+	}
+
+	if HashOpaqueToken(a) == a {
+		t.Error("Opaque token hash is the token itself")
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// The role a principal acts in, mirrors the Role enum of the GraphQL schema
+type Role string
+
+const (
+	RoleStudent Role = "STUDENT"
+	RoleTutor   Role = "TUTOR"
+	RoleAdmin   Role = "ADMIN"
+)
+
+// Scopes narrow down what a principal may do within its role
+const (
+	ScopeEmailVerified = "email:verified"
+	ScopeAdminRead     = "admin:read"
+	ScopeAdminWrite    = "admin:write"
+)
+
+var ErrNoPrincipal = errors.New("Unauthorised, please log in")
+
+// The authenticated identity behind a request
+type Principal struct {
+	Id      string
+	Role    Role
+	Scopes  []string
+	Session string
+}
+
+// Checks whether the principal was granted a scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Works out the role from the prefix of a user id, "s:" for students, "t:" for tutors and "a:" for admins
+func RoleFromId(id string) (Role, error) {
+	if len(id) > 2 && id[1] == ':' {
+		switch id[0] {
+		case 's':
+			return RoleStudent, nil
+		case 't':
+			return RoleTutor, nil
+		case 'a':
+			return RoleAdmin, nil
+		}
+	}
+
+	return "", errors.New("Malformed user id")
+}
+
+// Returns a copy of the context carrying the principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, "principal", p)
+}
+
+// Reads a context and returns the principal of the authenticated request
+func PrincipalFromContext(ctx context.Context) (Principal, error) {
+	p, ok := ctx.Value("principal").(Principal)
+	if !ok {
+		return Principal{}, ErrNoPrincipal
+	}
+
+	return p, nil
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRoleFromId(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    Role
+		wantErr bool
+	}{
+		{"s:123", RoleStudent, false},
+		{"t:123", RoleTutor, false},
+		{"a:123", RoleAdmin, false},
+		{"x:123", "", true},
+		{"s:", "", true},
+		{"s123", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := RoleFromId(tt.id)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%q: got %q with error %v, want %q", tt.id, got, err, tt.want)
+		}
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	if _, err := PrincipalFromContext(context.Background()); err != ErrNoPrincipal {
+		t.Errorf("Got %v without a principal, want %v", err, ErrNoPrincipal)
+	}
+
+	p := Principal{Id: "t:1", Role: RoleTutor, Scopes: []string{ScopeEmailVerified}, Session: "session"}
+
+	got, err := PrincipalFromContext(WithPrincipal(context.Background(), p))
+	if err != nil || got.Id != p.Id || got.Role != p.Role || got.Session != p.Session {
+		t.Errorf("Got %+v with error %v, want %+v", got, err, p)
+	}
+
+	if !got.HasScope(ScopeEmailVerified) || got.HasScope(ScopeAdminRead) {
+		t.Errorf("Scopes of %+v were not kept", got)
+	}
+}